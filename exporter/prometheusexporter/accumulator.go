@@ -5,10 +5,12 @@ package prometheusexporter // import "github.com/open-telemetry/opentelemetry-co
 
 import (
 	"fmt"
+	"math"
 	"regexp"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/prometheus/common/model"
@@ -33,6 +35,17 @@ type accumulatedValue struct {
 	scopeAttributes pcommon.Map
 }
 
+// labelFilterWildcard is the label filter value matching any value of a present label
+const labelFilterWildcard = "*"
+
+// evictionHeadroomPercent is the share of maxSeries evicted below the cap once it is exceeded, so that during
+// a cardinality spike the series are not scanned and sorted again for every new one
+const evictionHeadroomPercent = 10
+
+// staleNaN is the NaN bit pattern Prometheus uses for stale markers (value.StaleNaN in prometheus/model/value).
+// Other NaN values are regular samples to Prometheus.
+const staleNaN uint64 = 0x7ff0000000000002
+
 // accumulator stores aggregated values of incoming metrics
 type accumulator interface {
 	// Accumulate stores aggregated metric values
@@ -40,6 +53,11 @@ type accumulator interface {
 	// Collect returns a slice with relevant aggregated metrics and their resource attributes.
 	// The number or metrics and attributes returned will be the same.
 	Collect() (metrics []pmetric.Metric, resourceAttrs []pcommon.Map, scopeNames []string, scopeVersions []string, scopeSchemaURLs []string, scopeAttributes []pcommon.Map)
+	// Snapshot returns the same metrics as Collect without deleting the expired ones, for callers that only
+	// inspect the accumulated series
+	Snapshot() (metrics []pmetric.Metric, resourceAttrs []pcommon.Map, scopeNames []string, scopeVersions []string, scopeSchemaURLs []string, scopeAttributes []pcommon.Map)
+	// RangeSeries calls fn for each series Snapshot returns, one at a time, until fn returns false
+	RangeSeries(fn func(v *accumulatedValue) bool)
 
 	// ========== ENHANCEMENT: Metric Cleanup Functionality ==========
 	// CleanByLabels removes metrics based on label filters
@@ -48,6 +66,12 @@ type accumulator interface {
 	CleanByMetricName(namePattern string) int
 	// CleanExpired removes expired metrics
 	CleanExpired() int
+	// CleanAll removes every accumulated metric
+	CleanAll() int
+	// CollectStaleMarkers returns, once, a NaN copy of the series deleted by the cleanup methods up to generation
+	CollectStaleMarkers(generation uint64) (metrics []pmetric.Metric, resourceAttrs []pcommon.Map, scopeNames []string, scopeVersions []string, scopeSchemaURLs []string, scopeAttributes []pcommon.Map)
+	// Generation changes whenever series are stored or deleted
+	Generation() uint64
 	// ================================================================
 }
 
@@ -56,22 +80,82 @@ type lastValueAccumulator struct {
 	logger *zap.Logger
 
 	registeredMetrics sync.Map
+	// cleanMu makes each cleanup atomic with respect to Accumulate. sync.Map only makes single
+	// operations atomic, so without it an Accumulate running between a cleanup's Range and Delete
+	// could store a series the cleanup then misses or counts wrongly. Accumulate calls hold it for
+	// reading and still run concurrently with each other; cleanups hold it for writing.
+	cleanMu sync.RWMutex
 
 	// metricExpiration contains duration for which metric
 	// should be served after it was updated
 	metricExpiration time.Duration
+	// expirationGracePeriod is how long an expired series is kept as stale before it is deleted
+	expirationGracePeriod time.Duration
+
+	// maxSeries caps the number of accumulated series, zero means unlimited
+	maxSeries int
+	// evictMu serializes evictions so concurrent Accumulate calls do not evict twice
+	evictMu sync.Mutex
+	// evictedSeries counts the series evicted because maxSeries was exceeded
+	evictedSeries atomic.Int64
+	// seriesCount is the number of series in registeredMetrics, so evictions only scan them once over maxSeries
+	seriesCount atomic.Int64
+
+	// targetLabels derives the job and instance labels, nil uses the default mapping
+	targetLabels *targetLabels
+
+	// generation is incremented by every change to the accumulated series. Cleanups increment it while
+	// holding cleanMu, so a stale marker is never visible before the change that invalidates cached collections.
+	generation atomic.Uint64
+
+	// emitStaleMarkers keeps a NaN sample of the series deleted by a cleanup for the next scrape
+	emitStaleMarkers bool
+	// staleMarkers holds the staleMarker of the cleaned series until they are collected once, keyed by signature
+	staleMarkers sync.Map
+}
+
+// staleMarker is the NaN sample of a cleaned series, with the generation of the accumulator once it was deleted
+type staleMarker struct {
+	value      *accumulatedValue
+	generation uint64
 }
 
 // NewAccumulator returns LastValueAccumulator
 func newAccumulator(logger *zap.Logger, metricExpiration time.Duration) accumulator {
+	return newBoundedAccumulator(logger, metricExpiration, 0, 0, nil, false)
+}
+
+// newBoundedAccumulator returns a LastValueAccumulator that keeps at most maxSeries series.
+// Expired series are kept as stale for expirationGracePeriod before they are deleted.
+// targetLabels sets how the job and instance labels are derived, nil uses the default mapping.
+// With emitStaleMarkers, the series deleted by a cleanup are returned once by CollectStaleMarkers with a NaN value.
+func newBoundedAccumulator(logger *zap.Logger, metricExpiration time.Duration, expirationGracePeriod time.Duration, maxSeries int, targetLabels *targetLabels, emitStaleMarkers bool) *lastValueAccumulator {
 	return &lastValueAccumulator{
-		logger:           logger,
-		metricExpiration: metricExpiration,
+		logger:                logger,
+		metricExpiration:      metricExpiration,
+		expirationGracePeriod: expirationGracePeriod,
+		maxSeries:             maxSeries,
+		targetLabels:          targetLabels,
+		emitStaleMarkers:      emitStaleMarkers,
+	}
+}
+
+// expirationState reports whether a series last updated at updated is stale (expired, so it is
+// not exported) and whether it is past the grace period and must be deleted.
+// Every update resets both, since it moves updated forward.
+func (a *lastValueAccumulator) expirationState(updated time.Time, now time.Time) (stale bool, deleted bool) {
+	staleTime := now.Add(-a.metricExpiration)
+	if !staleTime.After(updated) {
+		return false, false
 	}
+	return true, staleTime.Add(-a.expirationGracePeriod).After(updated)
 }
 
 // Accumulate stores one datapoint per metric
 func (a *lastValueAccumulator) Accumulate(rm pmetric.ResourceMetrics) (n int) {
+	a.cleanMu.RLock()
+	defer a.cleanMu.RUnlock()
+
 	now := time.Now()
 	ilms := rm.ScopeMetrics()
 	resourceAttrs := rm.Resource().Attributes()
@@ -85,9 +169,89 @@ func (a *lastValueAccumulator) Accumulate(rm pmetric.ResourceMetrics) (n int) {
 		}
 	}
 
+	if n > 0 {
+		a.generation.Add(1)
+		a.evictOverflow()
+	}
+
 	return
 }
 
+// Generation returns the current generation of the accumulated series
+func (a *lastValueAccumulator) Generation() uint64 {
+	return a.generation.Load()
+}
+
+// evictOverflow removes the least recently updated series once there are more than maxSeries, down to
+// evictionHeadroomPercent below maxSeries
+func (a *lastValueAccumulator) evictOverflow() {
+	if a.maxSeries <= 0 || a.seriesCount.Load() <= int64(a.maxSeries) {
+		return
+	}
+
+	a.evictMu.Lock()
+	defer a.evictMu.Unlock()
+
+	// Another Accumulate may have evicted while this one waited for the lock
+	if a.seriesCount.Load() <= int64(a.maxSeries) {
+		return
+	}
+
+	type series struct {
+		signature string
+		updated   time.Time
+	}
+	var all []series
+	a.registeredMetrics.Range(func(key, value any) bool {
+		all = append(all, series{signature: key.(string), updated: value.(*accumulatedValue).updated})
+		return true
+	})
+	if len(all) <= a.maxSeries {
+		return
+	}
+
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].updated.Before(all[j].updated)
+	})
+
+	lowWatermark := a.maxSeries - a.maxSeries*evictionHeadroomPercent/100
+	evicted := 0
+	for _, s := range all[:len(all)-lowWatermark] {
+		if _, deleted := a.deleteSeries(s.signature); deleted {
+			evicted++
+		}
+	}
+	total := a.evictedSeries.Add(int64(evicted))
+
+	a.logger.Warn("Evicted least recently updated series to stay under max_series",
+		zap.Int("max_series", a.maxSeries),
+		zap.Int("low_watermark", lowWatermark),
+		zap.Int("evicted_count", evicted),
+		zap.Int64("evicted_total", total))
+}
+
+// storeSeries stores the accumulated value of a series, counting it if it is new.
+// A series accumulated again is no longer stale, so its pending stale marker is dropped first.
+func (a *lastValueAccumulator) storeSeries(signature string, v *accumulatedValue) {
+	if a.emitStaleMarkers {
+		a.staleMarkers.Delete(signature)
+	}
+	if _, loaded := a.registeredMetrics.Swap(signature, v); !loaded {
+		a.seriesCount.Add(1)
+	}
+}
+
+// deleteSeries deletes a series and returns its accumulated value, if it was still accumulated
+func (a *lastValueAccumulator) deleteSeries(signature string) (*accumulatedValue, bool) {
+	value, loaded := a.registeredMetrics.LoadAndDelete(signature)
+	if !loaded {
+		return nil, false
+	}
+	a.seriesCount.Add(-1)
+	a.generation.Add(1)
+	return value.(*accumulatedValue), true
+}
+
 func (a *lastValueAccumulator) addMetric(metric pmetric.Metric, scopeName string, scopeVersion string, scopeSchemaURL string, scopeAttributes pcommon.Map, resourceAttrs pcommon.Map, now time.Time) int {
 	a.logger.Debug(fmt.Sprintf("accumulating metric: %s", metric.Name()))
 
@@ -115,9 +279,9 @@ func (a *lastValueAccumulator) accumulateSummary(metric pmetric.Metric, scopeNam
 	for i := 0; i < dps.Len(); i++ {
 		ip := dps.At(i)
 
-		signature := timeseriesSignature(scopeName, scopeVersion, scopeSchemaURL, scopeAttributes, metric, ip.Attributes(), resourceAttrs)
+		signature := timeseriesSignature(scopeName, scopeVersion, scopeSchemaURL, scopeAttributes, metric, ip.Attributes(), resourceAttrs) + a.targetLabels.signatureSuffix(resourceAttrs)
 		if ip.Flags().NoRecordedValue() {
-			a.registeredMetrics.Delete(signature)
+			a.deleteSeries(signature)
 			return 0
 		}
 
@@ -132,7 +296,7 @@ func (a *lastValueAccumulator) accumulateSummary(metric pmetric.Metric, scopeNam
 
 		m := copyMetricMetadata(metric)
 		ip.CopyTo(m.SetEmptySummary().DataPoints().AppendEmpty())
-		a.registeredMetrics.Store(signature, &accumulatedValue{value: m, resourceAttrs: resourceAttrs, scopeName: scopeName, scopeVersion: scopeVersion, scopeSchemaURL: scopeSchemaURL, scopeAttributes: scopeAttributes, updated: now})
+		a.storeSeries(signature, &accumulatedValue{value: m, resourceAttrs: resourceAttrs, scopeName: scopeName, scopeVersion: scopeVersion, scopeSchemaURL: scopeSchemaURL, scopeAttributes: scopeAttributes, updated: now})
 		n++
 	}
 
@@ -144,9 +308,9 @@ func (a *lastValueAccumulator) accumulateGauge(metric pmetric.Metric, scopeName
 	for i := 0; i < dps.Len(); i++ {
 		ip := dps.At(i)
 
-		signature := timeseriesSignature(scopeName, scopeVersion, scopeSchemaURL, scopeAttributes, metric, ip.Attributes(), resourceAttrs)
+		signature := timeseriesSignature(scopeName, scopeVersion, scopeSchemaURL, scopeAttributes, metric, ip.Attributes(), resourceAttrs) + a.targetLabels.signatureSuffix(resourceAttrs)
 		if ip.Flags().NoRecordedValue() {
-			a.registeredMetrics.Delete(signature)
+			a.deleteSeries(signature)
 			return 0
 		}
 
@@ -154,7 +318,7 @@ func (a *lastValueAccumulator) accumulateGauge(metric pmetric.Metric, scopeName
 		if !ok {
 			m := copyMetricMetadata(metric)
 			ip.CopyTo(m.SetEmptyGauge().DataPoints().AppendEmpty())
-			a.registeredMetrics.Store(signature, &accumulatedValue{value: m, resourceAttrs: resourceAttrs, scopeName: scopeName, scopeVersion: scopeVersion, scopeSchemaURL: scopeSchemaURL, scopeAttributes: scopeAttributes, updated: now})
+			a.storeSeries(signature, &accumulatedValue{value: m, resourceAttrs: resourceAttrs, scopeName: scopeName, scopeVersion: scopeVersion, scopeSchemaURL: scopeSchemaURL, scopeAttributes: scopeAttributes, updated: now})
 			n++
 			continue
 		}
@@ -167,7 +331,7 @@ func (a *lastValueAccumulator) accumulateGauge(metric pmetric.Metric, scopeName
 
 		m := copyMetricMetadata(metric)
 		ip.CopyTo(m.SetEmptyGauge().DataPoints().AppendEmpty())
-		a.registeredMetrics.Store(signature, &accumulatedValue{value: m, resourceAttrs: resourceAttrs, scopeName: scopeName, scopeVersion: scopeVersion, scopeSchemaURL: scopeSchemaURL, scopeAttributes: scopeAttributes, updated: now})
+		a.storeSeries(signature, &accumulatedValue{value: m, resourceAttrs: resourceAttrs, scopeName: scopeName, scopeVersion: scopeVersion, scopeSchemaURL: scopeSchemaURL, scopeAttributes: scopeAttributes, updated: now})
 		n++
 	}
 	return
@@ -190,9 +354,9 @@ func (a *lastValueAccumulator) accumulateSum(metric pmetric.Metric, scopeName st
 	for i := 0; i < dps.Len(); i++ {
 		ip := dps.At(i)
 
-		signature := timeseriesSignature(scopeName, scopeVersion, scopeSchemaURL, scopeAttributes, metric, ip.Attributes(), resourceAttrs)
+		signature := timeseriesSignature(scopeName, scopeVersion, scopeSchemaURL, scopeAttributes, metric, ip.Attributes(), resourceAttrs) + a.targetLabels.signatureSuffix(resourceAttrs)
 		if ip.Flags().NoRecordedValue() {
-			a.registeredMetrics.Delete(signature)
+			a.deleteSeries(signature)
 			return 0
 		}
 
@@ -202,7 +366,7 @@ func (a *lastValueAccumulator) accumulateSum(metric pmetric.Metric, scopeName st
 			m.SetEmptySum().SetIsMonotonic(metric.Sum().IsMonotonic())
 			m.Sum().SetAggregationTemporality(pmetric.AggregationTemporalityCumulative)
 			ip.CopyTo(m.Sum().DataPoints().AppendEmpty())
-			a.registeredMetrics.Store(signature, &accumulatedValue{value: m, resourceAttrs: resourceAttrs, scopeName: scopeName, scopeVersion: scopeVersion, scopeSchemaURL: scopeSchemaURL, scopeAttributes: scopeAttributes, updated: now})
+			a.storeSeries(signature, &accumulatedValue{value: m, resourceAttrs: resourceAttrs, scopeName: scopeName, scopeVersion: scopeVersion, scopeSchemaURL: scopeSchemaURL, scopeAttributes: scopeAttributes, updated: now})
 			n++
 			continue
 		}
@@ -228,7 +392,7 @@ func (a *lastValueAccumulator) accumulateSum(metric pmetric.Metric, scopeName st
 		m.SetEmptySum().SetIsMonotonic(metric.Sum().IsMonotonic())
 		m.Sum().SetAggregationTemporality(pmetric.AggregationTemporalityCumulative)
 		ip.CopyTo(m.Sum().DataPoints().AppendEmpty())
-		a.registeredMetrics.Store(signature, &accumulatedValue{value: m, resourceAttrs: resourceAttrs, scopeName: scopeName, scopeVersion: scopeVersion, scopeSchemaURL: scopeSchemaURL, scopeAttributes: scopeAttributes, updated: now})
+		a.storeSeries(signature, &accumulatedValue{value: m, resourceAttrs: resourceAttrs, scopeName: scopeName, scopeVersion: scopeVersion, scopeSchemaURL: scopeSchemaURL, scopeAttributes: scopeAttributes, updated: now})
 		n++
 	}
 	return
@@ -242,9 +406,9 @@ func (a *lastValueAccumulator) accumulateHistogram(metric pmetric.Metric, scopeN
 	for i := 0; i < dps.Len(); i++ {
 		ip := dps.At(i)
 
-		signature := timeseriesSignature(scopeName, scopeVersion, scopeSchemaURL, scopeAttributes, metric, ip.Attributes(), resourceAttrs) // uniquely identify this time series you are accumulating for
+		signature := timeseriesSignature(scopeName, scopeVersion, scopeSchemaURL, scopeAttributes, metric, ip.Attributes(), resourceAttrs) + a.targetLabels.signatureSuffix(resourceAttrs) // uniquely identify this time series you are accumulating for
 		if ip.Flags().NoRecordedValue() {
-			a.registeredMetrics.Delete(signature)
+			a.deleteSeries(signature)
 			return 0
 		}
 
@@ -254,7 +418,7 @@ func (a *lastValueAccumulator) accumulateHistogram(metric pmetric.Metric, scopeN
 			m := copyMetricMetadata(metric)
 			ip.CopyTo(m.SetEmptyHistogram().DataPoints().AppendEmpty())
 			m.Histogram().SetAggregationTemporality(pmetric.AggregationTemporalityCumulative)
-			a.registeredMetrics.Store(signature, &accumulatedValue{value: m, resourceAttrs: resourceAttrs, scopeName: scopeName, scopeVersion: scopeVersion, scopeSchemaURL: scopeSchemaURL, scopeAttributes: scopeAttributes, updated: now})
+			a.storeSeries(signature, &accumulatedValue{value: m, resourceAttrs: resourceAttrs, scopeName: scopeName, scopeVersion: scopeVersion, scopeSchemaURL: scopeSchemaURL, scopeAttributes: scopeAttributes, updated: now})
 			n++
 			continue
 		}
@@ -297,29 +461,56 @@ func (a *lastValueAccumulator) accumulateHistogram(metric pmetric.Metric, scopeN
 			// unsupported temporality
 			continue
 		}
-		a.registeredMetrics.Store(signature, &accumulatedValue{value: m, resourceAttrs: resourceAttrs, scopeName: scopeName, scopeVersion: scopeVersion, scopeSchemaURL: scopeSchemaURL, scopeAttributes: scopeAttributes, updated: now})
+		a.storeSeries(signature, &accumulatedValue{value: m, resourceAttrs: resourceAttrs, scopeName: scopeName, scopeVersion: scopeVersion, scopeSchemaURL: scopeSchemaURL, scopeAttributes: scopeAttributes, updated: now})
 		n++
 	}
 	return
 }
 
 // Collect returns a slice with relevant aggregated metrics and their resource attributes.
+// The series past the expiration grace period are deleted.
 func (a *lastValueAccumulator) Collect() ([]pmetric.Metric, []pcommon.Map, []string, []string, []string, []pcommon.Map) {
 	a.logger.Debug("Accumulator collect called")
+	return a.collect(true)
+}
+
+// Snapshot returns the same metrics as Collect, but leaves the series past the grace period for the next
+// Collect to delete, so it never changes what scrapes see
+func (a *lastValueAccumulator) Snapshot() ([]pmetric.Metric, []pcommon.Map, []string, []string, []string, []pcommon.Map) {
+	return a.collect(false)
+}
+
+// RangeSeries calls fn for each series that is not stale, without collecting them into slices first
+func (a *lastValueAccumulator) RangeSeries(fn func(v *accumulatedValue) bool) {
+	now := time.Now()
+	a.registeredMetrics.Range(func(_, value any) bool {
+		v := value.(*accumulatedValue)
+		if stale, _ := a.expirationState(v.updated, now); stale {
+			return true
+		}
+		return fn(v)
+	})
+}
 
+// collect returns the series that are not stale, deleting the ones past the grace period if deleteExpired is set
+func (a *lastValueAccumulator) collect(deleteExpired bool) ([]pmetric.Metric, []pcommon.Map, []string, []string, []string, []pcommon.Map) {
 	var metrics []pmetric.Metric
 	var resourceAttrs []pcommon.Map
 	var scopeNames []string
 	var scopeVersions []string
 	var scopeSchemaURLs []string
 	var scopeAttributes []pcommon.Map
-	expirationTime := time.Now().Add(-a.metricExpiration)
+	now := time.Now()
 
 	a.registeredMetrics.Range(func(key, value any) bool {
 		v := value.(*accumulatedValue)
-		if expirationTime.After(v.updated) {
+		stale, deleted := a.expirationState(v.updated, now)
+		if deleted && deleteExpired {
 			a.logger.Debug(fmt.Sprintf("metric expired: %s", v.value.Name()))
-			a.registeredMetrics.Delete(key)
+			a.deleteSeries(key.(string))
+			return true
+		}
+		if stale {
 			return true
 		}
 
@@ -335,12 +526,97 @@ func (a *lastValueAccumulator) Collect() ([]pmetric.Metric, []pcommon.Map, []str
 	return metrics, resourceAttrs, scopeNames, scopeVersions, scopeSchemaURLs, scopeAttributes
 }
 
+// CollectStaleMarkers returns the stale markers of the series deleted by a cleanup since the previous call,
+// as long as they were deleted by the time the accumulator reached generation. A scrape passes the generation
+// its collection was computed at, so the series a marker stands for is never in that collection too; later
+// markers are left for the next scrape. Only scrapes should call it, since each marker is returned once.
+func (a *lastValueAccumulator) CollectStaleMarkers(generation uint64) ([]pmetric.Metric, []pcommon.Map, []string, []string, []string, []pcommon.Map) {
+	var metrics []pmetric.Metric
+	var resourceAttrs []pcommon.Map
+	var scopeNames []string
+	var scopeVersions []string
+	var scopeSchemaURLs []string
+	var scopeAttributes []pcommon.Map
+
+	a.staleMarkers.Range(func(key, value any) bool {
+		marker := value.(*staleMarker)
+		if marker.generation > generation {
+			return true
+		}
+		if !a.staleMarkers.CompareAndDelete(key, value) {
+			// The series was cleaned again meanwhile, its new marker is left for the scrape that can serve it
+			return true
+		}
+		if _, exists := a.registeredMetrics.Load(key); exists {
+			// The series was accumulated again since it was cleaned
+			return true
+		}
+
+		v := marker.value
+		metrics = append(metrics, v.value)
+		resourceAttrs = append(resourceAttrs, v.resourceAttrs)
+		scopeNames = append(scopeNames, v.scopeName)
+		scopeVersions = append(scopeVersions, v.scopeVersion)
+		scopeSchemaURLs = append(scopeSchemaURLs, v.scopeSchemaURL)
+		scopeAttributes = append(scopeAttributes, v.scopeAttributes)
+		return true
+	})
+
+	return metrics, resourceAttrs, scopeNames, scopeVersions, scopeSchemaURLs, scopeAttributes
+}
+
+// deleteCleanedSeries deletes a series removed by a cleanup and, if enabled, keeps a stale marker for it.
+// It reports whether the series was still accumulated, so concurrent cleanups never count a series twice.
+func (a *lastValueAccumulator) deleteCleanedSeries(signature string) bool {
+	value, loaded := a.deleteSeries(signature)
+	if !loaded {
+		return false
+	}
+	if !a.emitStaleMarkers {
+		return true
+	}
+
+	if marker, ok := newStaleMarker(value); ok {
+		a.staleMarkers.Store(signature, &staleMarker{value: marker, generation: a.generation.Load()})
+	}
+	return true
+}
+
+// newStaleMarker returns a copy of a gauge or sum series whose value is the Prometheus stale marker.
+// Histograms and summaries get no marker, since their counts cannot be NaN.
+func newStaleMarker(v *accumulatedValue) (*accumulatedValue, bool) {
+	marker := *v
+	marker.value = pmetric.NewMetric()
+	v.value.CopyTo(marker.value)
+
+	var dps pmetric.NumberDataPointSlice
+	switch marker.value.Type() {
+	case pmetric.MetricTypeGauge:
+		dps = marker.value.Gauge().DataPoints()
+	case pmetric.MetricTypeSum:
+		dps = marker.value.Sum().DataPoints()
+	default:
+		return nil, false
+	}
+	if dps.Len() == 0 {
+		return nil, false
+	}
+
+	dp := dps.At(0)
+	dp.SetDoubleValue(math.Float64frombits(staleNaN))
+	dp.SetTimestamp(pcommon.NewTimestampFromTime(time.Now()))
+	return &marker, true
+}
+
 // ========== ENHANCEMENT: Metric Cleanup Implementation ==========
 
 // CleanByLabels removes metrics based on label filters
 func (a *lastValueAccumulator) CleanByLabels(filters map[string]string) int {
 	a.logger.Debug("CleanByLabels called", zap.Any("filters", filters))
 
+	a.cleanMu.Lock()
+	defer a.cleanMu.Unlock()
+
 	var deletedCount int
 	var keysToDelete []string
 
@@ -355,7 +631,9 @@ func (a *lastValueAccumulator) CleanByLabels(filters map[string]string) int {
 	})
 
 	for _, key := range keysToDelete {
-		a.registeredMetrics.Delete(key)
+		if !a.deleteCleanedSeries(key) {
+			continue
+		}
 		deletedCount++
 		a.logger.Debug("Deleted metric by label filter", zap.String("signature", key))
 	}
@@ -368,6 +646,9 @@ func (a *lastValueAccumulator) CleanByLabels(filters map[string]string) int {
 func (a *lastValueAccumulator) CleanByMetricName(namePattern string) int {
 	a.logger.Debug("CleanByMetricName called", zap.String("pattern", namePattern))
 
+	a.cleanMu.Lock()
+	defer a.cleanMu.Unlock()
+
 	var deletedCount int
 	var keysToDelete []string
 
@@ -401,7 +682,9 @@ func (a *lastValueAccumulator) CleanByMetricName(namePattern string) int {
 	})
 
 	for _, key := range keysToDelete {
-		a.registeredMetrics.Delete(key)
+		if !a.deleteCleanedSeries(key) {
+			continue
+		}
 		deletedCount++
 		a.logger.Debug("Deleted metric by name pattern", zap.String("signature", key))
 	}
@@ -414,20 +697,25 @@ func (a *lastValueAccumulator) CleanByMetricName(namePattern string) int {
 func (a *lastValueAccumulator) CleanExpired() int {
 	a.logger.Debug("CleanExpired called")
 
+	a.cleanMu.Lock()
+	defer a.cleanMu.Unlock()
+
 	var deletedCount int
 	var keysToDelete []string
-	expirationTime := time.Now().Add(-a.metricExpiration)
+	now := time.Now()
 
 	a.registeredMetrics.Range(func(key, value any) bool {
 		v := value.(*accumulatedValue)
-		if expirationTime.After(v.updated) {
+		if _, deleted := a.expirationState(v.updated, now); deleted {
 			keysToDelete = append(keysToDelete, key.(string))
 		}
 		return true
 	})
 
 	for _, key := range keysToDelete {
-		a.registeredMetrics.Delete(key)
+		if !a.deleteCleanedSeries(key) {
+			continue
+		}
 		deletedCount++
 		a.logger.Debug("Deleted expired metric", zap.String("signature", key))
 	}
@@ -436,15 +724,35 @@ func (a *lastValueAccumulator) CleanExpired() int {
 	return deletedCount
 }
 
+// CleanAll removes every accumulated metric, regardless of labels, name or age
+func (a *lastValueAccumulator) CleanAll() int {
+	a.logger.Debug("CleanAll called")
+
+	a.cleanMu.Lock()
+	defer a.cleanMu.Unlock()
+
+	var deletedCount int
+	a.registeredMetrics.Range(func(key, _ any) bool {
+		if a.deleteCleanedSeries(key.(string)) {
+			deletedCount++
+		}
+		return true
+	})
+
+	a.logger.Info("Cleaned all metrics", zap.Int("deleted_count", deletedCount))
+	return deletedCount
+}
+
 // matchesLabelFilters checks if a metric matches the given label filters
 func (a *lastValueAccumulator) matchesLabelFilters(signature string, accValue *accumulatedValue, filters map[string]string) bool {
 	// Extract labels from signature and accumulated value
 	labels := a.extractLabelsFromMetric(signature, accValue)
 
-	// Check if all filters match
+	// Check if all filters match. A wildcard value only requires the label to be present, and an
+	// empty value requires it to be present and empty: series without the label never match.
 	for filterKey, filterValue := range filters {
 		labelValue, exists := labels[filterKey]
-		if !exists || labelValue != filterValue {
+		if !exists || (filterValue != labelFilterWildcard && labelValue != filterValue) {
 			return false
 		}
 	}
@@ -454,16 +762,33 @@ func (a *lastValueAccumulator) matchesLabelFilters(signature string, accValue *a
 
 // extractLabelsFromMetric extracts all labels from a metric for filtering
 func (a *lastValueAccumulator) extractLabelsFromMetric(signature string, accValue *accumulatedValue) map[string]string {
+	labels := extractMetricLabels(accValue.value, accValue.resourceAttrs)
+
+	// Overridden job and instance labels can be filtered on like on /metrics
+	if a.targetLabels != nil {
+		if job, ok := a.targetLabels.extractJob(accValue.resourceAttrs); ok {
+			labels[model.JobLabel] = job
+		}
+		if instance, ok := a.targetLabels.extractInstance(accValue.resourceAttrs); ok {
+			labels[model.InstanceLabel] = instance
+		}
+	}
+
+	return labels
+}
+
+// extractMetricLabels returns the resource attributes and the attributes of the first data point of
+// an accumulated metric, keyed by their OTLP attribute names
+func extractMetricLabels(metric pmetric.Metric, resourceAttrs pcommon.Map) map[string]string {
 	labels := make(map[string]string)
 
 	// Extract ALL resource attributes
 	// This matches the behavior of resource_to_telemetry_conversion
-	for k, v := range accValue.resourceAttrs.All() {
+	for k, v := range resourceAttrs.All() {
 		labels[k] = v.AsString()
 	}
 
 	// Extract metric attributes (depends on metric type)
-	metric := accValue.value
 	switch metric.Type() {
 	case pmetric.MetricTypeGauge:
 		if metric.Gauge().DataPoints().Len() > 0 {
@@ -4,6 +4,7 @@
 package prometheusexporter
 
 import (
+	"fmt"
 	"log"
 	"strings"
 	"testing"
@@ -650,6 +651,131 @@ func TestTimeseriesSignatureNotMutating(t *testing.T) {
 	require.Equal(t, origAttrs, attrs) // make sure attrs are not mutated
 }
 
+func TestAccumulateMaxSeries(t *testing.T) {
+	gauge := func(name string) pmetric.ResourceMetrics {
+		rm := pmetric.NewResourceMetrics()
+		metric := rm.ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+		metric.SetName(name)
+		dp := metric.SetEmptyGauge().DataPoints().AppendEmpty()
+		dp.SetIntValue(1)
+		dp.SetTimestamp(pcommon.NewTimestampFromTime(time.Now()))
+		return rm
+	}
+	names := func(a *lastValueAccumulator) []string {
+		var result []string
+		a.registeredMetrics.Range(func(_, value any) bool {
+			result = append(result, value.(*accumulatedValue).value.Name())
+			return true
+		})
+		return result
+	}
+
+	a := newBoundedAccumulator(zap.NewNop(), 1*time.Hour, 0, 3, nil, false)
+	for _, name := range []string{"series_a", "series_b", "series_c"} {
+		require.Equal(t, 1, a.Accumulate(gauge(name)))
+	}
+	require.ElementsMatch(t, []string{"series_a", "series_b", "series_c"}, names(a))
+
+	// Age the series so their update order is deterministic: a is the oldest, c the newest
+	a.registeredMetrics.Range(func(_, value any) bool {
+		v := value.(*accumulatedValue)
+		switch v.value.Name() {
+		case "series_a":
+			v.updated = time.Now().Add(-3 * time.Second)
+		case "series_b":
+			v.updated = time.Now().Add(-2 * time.Second)
+		case "series_c":
+			v.updated = time.Now().Add(-1 * time.Second)
+		}
+		return true
+	})
+
+	// Updating series_a makes series_b the least recently updated one
+	require.Equal(t, 1, a.Accumulate(gauge("series_a")))
+	require.Equal(t, 1, a.Accumulate(gauge("series_d")))
+
+	require.ElementsMatch(t, []string{"series_a", "series_c", "series_d"}, names(a))
+	require.Equal(t, int64(1), a.evictedSeries.Load())
+	require.Equal(t, int64(3), a.seriesCount.Load())
+
+	// The series count follows deletions, so the cap is only enforced again once it is exceeded
+	require.Equal(t, 3, a.CleanAll())
+	require.Equal(t, int64(0), a.seriesCount.Load())
+	require.Equal(t, 1, a.Accumulate(gauge("series_e")))
+	require.Equal(t, int64(1), a.seriesCount.Load())
+	require.Equal(t, int64(1), a.evictedSeries.Load())
+
+	// Larger caps are evicted down to 10% below, so the next new series do not evict again right away
+	a = newBoundedAccumulator(zap.NewNop(), 1*time.Hour, 0, 20, nil, false)
+	for i := 0; i < 21; i++ {
+		require.Equal(t, 1, a.Accumulate(gauge(fmt.Sprintf("series_%d", i))))
+	}
+	require.Equal(t, int64(18), a.seriesCount.Load())
+	require.Equal(t, int64(3), a.evictedSeries.Load())
+	for i := 21; i < 23; i++ {
+		require.Equal(t, 1, a.Accumulate(gauge(fmt.Sprintf("series_%d", i))))
+	}
+	require.Equal(t, int64(20), a.seriesCount.Load())
+	require.Equal(t, int64(3), a.evictedSeries.Load())
+}
+
+func TestAccumulateExpirationGracePeriod(t *testing.T) {
+	gauge := func(name string) pmetric.ResourceMetrics {
+		rm := pmetric.NewResourceMetrics()
+		metric := rm.ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+		metric.SetName(name)
+		dp := metric.SetEmptyGauge().DataPoints().AppendEmpty()
+		dp.SetIntValue(1)
+		dp.SetTimestamp(pcommon.NewTimestampFromTime(time.Now()))
+		return rm
+	}
+	age := func(a *lastValueAccumulator, name string, d time.Duration) {
+		a.registeredMetrics.Range(func(_, value any) bool {
+			if v := value.(*accumulatedValue); v.value.Name() == name {
+				v.updated = time.Now().Add(-d)
+			}
+			return true
+		})
+	}
+	collected := func(a *lastValueAccumulator) []string {
+		metrics, _, _, _, _, _ := a.Collect()
+		var result []string
+		for _, m := range metrics {
+			result = append(result, m.Name())
+		}
+		return result
+	}
+	stored := func(a *lastValueAccumulator) int {
+		n := 0
+		a.registeredMetrics.Range(func(_, _ any) bool {
+			n++
+			return true
+		})
+		return n
+	}
+
+	a := newBoundedAccumulator(zap.NewNop(), 1*time.Hour, 1*time.Hour, 0, nil, false)
+	require.Equal(t, 1, a.Accumulate(gauge("rescheduled")))
+	require.Equal(t, 1, a.Accumulate(gauge("gone")))
+
+	// Both series expired, but only "gone" is past the grace period
+	age(a, "rescheduled", 90*time.Minute)
+	age(a, "gone", 3*time.Hour)
+	require.Empty(t, collected(a))
+	require.Equal(t, 1, stored(a))
+
+	// A stale series reappearing within the grace period is exported again
+	require.Equal(t, 1, a.Accumulate(gauge("rescheduled")))
+	require.Equal(t, []string{"rescheduled"}, collected(a))
+
+	// Without a grace period, expired series are deleted right away
+	a = newAccumulator(zap.NewNop(), 1*time.Hour).(*lastValueAccumulator)
+	require.Equal(t, 1, a.Accumulate(gauge("rescheduled")))
+	age(a, "rescheduled", 90*time.Minute)
+	require.Empty(t, collected(a))
+	require.Equal(t, 0, stored(a))
+}
+
 func getMetricProperties(metric pmetric.Metric) (
 	attributes pcommon.Map,
 	ts time.Time,
@@ -4,7 +4,11 @@
 package prometheusexporter // import "github.com/open-telemetry/opentelemetry-collector-contrib/exporter/prometheusexporter"
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
@@ -12,11 +16,25 @@ import (
 	"go.uber.org/zap"
 )
 
+const (
+	// defaultCleanupMaxBodyBytes is the default limit for cleanup request bodies (1 MiB)
+	defaultCleanupMaxBodyBytes int64 = 1 << 20
+	// defaultCleanupRequestTimeout is the default time allowed for a single cleanup request
+	defaultCleanupRequestTimeout = 30 * time.Second
+
+	// requestIDHeader carries the ID used to correlate a cleanup request with its log lines
+	requestIDHeader = "X-Request-ID"
+)
+
 // CleanupRequest represents a cleanup request
 type CleanupRequest struct {
-	Type    string            `json:"type"`    // "labels", "name", "expired"
-	Filters map[string]string `json:"filters"` // label filters for type="labels"
-	Pattern string            `json:"pattern"` // name pattern for type="name"
+	Type    string            `json:"type" mapstructure:"type"`       // "labels", "name", "service", "expired", "all"
+	Filters map[string]string `json:"filters" mapstructure:"filters"` // label filters for type="labels"
+	Pattern string            `json:"pattern" mapstructure:"pattern"` // name pattern for type="name"
+	Service string            `json:"service" mapstructure:"service"` // service.name for type="service"
+	// MatchEmpty allows empty filter values for type="labels". They match series where the label
+	// is present with an empty value, never series without the label.
+	MatchEmpty bool `json:"match_empty" mapstructure:"match_empty"`
 }
 
 // CleanupResponse represents the cleanup response
@@ -29,70 +47,85 @@ type CleanupResponse struct {
 
 // CleanupAPI provides HTTP endpoints for metric cleanup
 type CleanupAPI struct {
-	exporter *prometheusExporter
-	logger   *zap.Logger
+	exporter       *prometheusExporter
+	logger         *zap.Logger
+	maxBodyBytes   int64
+	requestTimeout time.Duration
 }
 
 // NewCleanupAPI creates a new cleanup API instance
 func NewCleanupAPI(exporter *prometheusExporter, logger *zap.Logger) *CleanupAPI {
+	maxBodyBytes := exporter.config.CleanupMaxBodyBytes
+	if maxBodyBytes <= 0 {
+		maxBodyBytes = defaultCleanupMaxBodyBytes
+	}
+
+	requestTimeout := exporter.config.CleanupRequestTimeout
+	if requestTimeout <= 0 {
+		requestTimeout = defaultCleanupRequestTimeout
+	}
+
 	return &CleanupAPI{
-		exporter: exporter,
-		logger:   logger,
+		exporter:       exporter,
+		logger:         logger,
+		maxBodyBytes:   maxBodyBytes,
+		requestTimeout: requestTimeout,
 	}
 }
 
 // CleanupHandler handles HTTP cleanup requests
 func (api *CleanupAPI) CleanupHandler(w http.ResponseWriter, r *http.Request) {
+	requestID := api.setRequestID(w, r)
+
 	if r.Method != http.MethodPost {
-		api.writeErrorResponse(w, http.StatusMethodNotAllowed, "Only POST method is allowed")
+		api.writeErrorResponse(w, requestID, http.StatusMethodNotAllowed, "Only POST method is allowed")
 		return
 	}
 
-	var req CleanupRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		api.writeErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("Invalid JSON: %v", err))
-		return
-	}
+	ctx, cancel := context.WithTimeout(r.Context(), api.requestTimeout)
+	defer cancel()
 
-	var deletedCount int
+	// Bound the size of the body and the time spent reading it. Not every ResponseWriter supports
+	// deadlines, so the body is also closed once the timeout expires, which fails a blocked read.
+	_ = http.NewResponseController(w).SetReadDeadline(time.Now().Add(api.requestTimeout))
+	r.Body = http.MaxBytesReader(w, r.Body, api.maxBodyBytes)
+	stopClosingBody := context.AfterFunc(ctx, func() {
+		_ = r.Body.Close()
+	})
+	defer stopClosingBody()
 
-	switch req.Type {
-	case "labels":
-		if len(req.Filters) == 0 {
-			api.writeErrorResponse(w, http.StatusBadRequest, "Filters are required for label-based cleanup")
+	var req CleanupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if ctx.Err() != nil {
+			api.writeErrorResponse(w, requestID, http.StatusServiceUnavailable, fmt.Sprintf("Cleanup request timed out: %v", ctx.Err()))
 			return
 		}
-		deletedCount = api.exporter.CleanByLabels(req.Filters)
-		api.logger.Info("Cleanup by labels completed",
-			zap.Any("filters", req.Filters),
-			zap.Int("deleted_count", deletedCount))
-
-	case "name":
-		if req.Pattern == "" {
-			api.writeErrorResponse(w, http.StatusBadRequest, "Pattern is required for name-based cleanup")
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			api.writeErrorResponse(w, requestID, http.StatusRequestEntityTooLarge,
+				fmt.Sprintf("Request body exceeds the limit of %d bytes", maxBytesErr.Limit))
 			return
 		}
-		deletedCount = api.exporter.CleanByMetricName(req.Pattern)
-		api.logger.Info("Cleanup by name completed",
-			zap.String("pattern", req.Pattern),
-			zap.Int("deleted_count", deletedCount))
-
-	case "expired":
-		deletedCount = api.exporter.CleanExpired()
-		api.logger.Info("Cleanup expired metrics completed",
-			zap.Int("deleted_count", deletedCount))
-
-	default:
-		api.writeErrorResponse(w, http.StatusBadRequest,
-			"Invalid cleanup type. Supported types: 'labels', 'name', 'expired'")
+		api.writeErrorResponse(w, requestID, http.StatusBadRequest, fmt.Sprintf("Invalid JSON: %v", err))
 		return
 	}
 
+	if err := ctx.Err(); err != nil {
+		api.writeErrorResponse(w, requestID, http.StatusServiceUnavailable, fmt.Sprintf("Cleanup request timed out: %v", err))
+		return
+	}
+
+	if err := validateCleanupRequest(req); err != nil {
+		api.writeErrorResponse(w, requestID, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	entry := api.exporter.runCleanup(req, requestID, r.RemoteAddr)
 	response := CleanupResponse{
 		Success:      true,
-		DeletedCount: deletedCount,
-		Message:      fmt.Sprintf("Successfully deleted %d metrics", deletedCount),
-		Timestamp:    time.Now().UTC().Format(time.RFC3339),
+		DeletedCount: entry.DeletedCount,
+		Message:      fmt.Sprintf("Successfully deleted %d metrics", entry.DeletedCount),
+		Timestamp:    entry.Timestamp,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -102,18 +135,22 @@ func (api *CleanupAPI) CleanupHandler(w http.ResponseWriter, r *http.Request) {
 
 // StatusHandler provides cleanup status and available operations
 func (api *CleanupAPI) StatusHandler(w http.ResponseWriter, r *http.Request) {
+	requestID := api.setRequestID(w, r)
+
 	if r.Method != http.MethodGet {
-		api.writeErrorResponse(w, http.StatusMethodNotAllowed, "Only GET method is allowed")
+		api.writeErrorResponse(w, requestID, http.StatusMethodNotAllowed, "Only GET method is allowed")
 		return
 	}
 
 	status := map[string]interface{}{
 		"cleanup_api_version":  "1.0",
-		"supported_operations": []string{"labels", "name", "expired"},
+		"supported_operations": []string{"labels", "name", "service", "expired", "all"},
 		"timestamp":            time.Now().UTC().Format(time.RFC3339),
 		"endpoints": map[string]string{
 			"cleanup": "/cleanup",
 			"status":  "/cleanup/status",
+			"audit":   "/cleanup/audit",
+			"collect": "/api/collect",
 		},
 		"examples": map[string]interface{}{
 			"cleanup_by_labels": CleanupRequest{
@@ -123,13 +160,25 @@ func (api *CleanupAPI) StatusHandler(w http.ResponseWriter, r *http.Request) {
 					"instance": "test-instance",
 				},
 			},
+			"cleanup_by_empty_label": CleanupRequest{
+				Type:       "labels",
+				Filters:    map[string]string{"instance": ""},
+				MatchEmpty: true,
+			},
 			"cleanup_by_name": CleanupRequest{
 				Type:    "name",
 				Pattern: "test_metric_.*",
 			},
+			"cleanup_by_service": CleanupRequest{
+				Type:    "service",
+				Service: "test-service",
+			},
 			"cleanup_expired": CleanupRequest{
 				Type: "expired",
 			},
+			"cleanup_all": CleanupRequest{
+				Type: "all",
+			},
 		},
 	}
 
@@ -140,13 +189,15 @@ func (api *CleanupAPI) StatusHandler(w http.ResponseWriter, r *http.Request) {
 
 // MetricsHandler provides metrics about cleanup operations
 func (api *CleanupAPI) MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	requestID := api.setRequestID(w, r)
+
 	if r.Method != http.MethodGet {
-		api.writeErrorResponse(w, http.StatusMethodNotAllowed, "Only GET method is allowed")
+		api.writeErrorResponse(w, requestID, http.StatusMethodNotAllowed, "Only GET method is allowed")
 		return
 	}
 
 	// Count current metrics
-	metrics, _, _, _, _, _ := api.exporter.collector.accumulator.Collect()
+	metrics, _, _, _, _, _ := api.exporter.collector.accumulator.Snapshot()
 	currentCount := len(metrics)
 
 	response := map[string]interface{}{
@@ -159,9 +210,81 @@ func (api *CleanupAPI) MetricsHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// CollectHandler forces an immediate collection of the accumulator, which also drops the expired series,
+// and reports the number of series collected and how long the collection took. Dropping series changes the
+// accumulator generation, so a collection cached for min_scrape_interval is recomputed on the next scrape.
+func (api *CleanupAPI) CollectHandler(w http.ResponseWriter, r *http.Request) {
+	requestID := api.setRequestID(w, r)
+
+	if r.Method != http.MethodPost {
+		api.writeErrorResponse(w, requestID, http.StatusMethodNotAllowed, "Only POST method is allowed")
+		return
+	}
+
+	start := time.Now()
+	metrics, _, _, _, _, _ := api.exporter.collector.accumulator.Collect()
+	duration := time.Since(start)
+
+	api.logger.Info("Forced accumulator collection",
+		zap.String("request_id", requestID),
+		zap.Int("series_count", len(metrics)),
+		zap.Duration("duration", duration))
+
+	response := map[string]interface{}{
+		"series_count":        len(metrics),
+		"collect_duration_ms": float64(duration.Microseconds()) / 1000,
+		"timestamp":           time.Now().UTC().Format(time.RFC3339),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// AuditHandler returns the most recent cleanup operations, oldest first
+func (api *CleanupAPI) AuditHandler(w http.ResponseWriter, r *http.Request) {
+	requestID := api.setRequestID(w, r)
+
+	if r.Method != http.MethodGet {
+		api.writeErrorResponse(w, requestID, http.StatusMethodNotAllowed, "Only GET method is allowed")
+		return
+	}
+
+	response := map[string]interface{}{
+		"entries":   api.exporter.cleanupAuditLog.list(),
+		"timestamp": time.Now().UTC().Format(time.RFC3339),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// setRequestID reads the request ID of an incoming request, generating one if the client did not send it,
+// and echoes it back on the response
+func (api *CleanupAPI) setRequestID(w http.ResponseWriter, r *http.Request) string {
+	requestID := r.Header.Get(requestIDHeader)
+	if requestID == "" {
+		requestID = generateRequestID()
+	}
+
+	w.Header().Set(requestIDHeader, requestID)
+	return requestID
+}
+
+// generateRequestID returns a random 128-bit hex encoded request ID
+func generateRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
 // writeErrorResponse writes an error response
-func (api *CleanupAPI) writeErrorResponse(w http.ResponseWriter, statusCode int, message string) {
-	api.logger.Error("Cleanup API error", zap.String("message", message), zap.Int("status_code", statusCode))
+func (api *CleanupAPI) writeErrorResponse(w http.ResponseWriter, requestID string, statusCode int, message string) {
+	api.logger.Error("Cleanup API error",
+		zap.String("request_id", requestID),
+		zap.String("message", message),
+		zap.Int("status_code", statusCode))
 
 	response := CleanupResponse{
 		Success:   false,
@@ -0,0 +1,65 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package prometheusexporter // import "github.com/open-telemetry/opentelemetry-collector-contrib/exporter/prometheusexporter"
+
+import (
+	"sync"
+)
+
+// defaultCleanupAuditLogSize is the number of cleanup operations kept in the audit log
+const defaultCleanupAuditLogSize = 100
+
+// CleanupAuditEntry records a single cleanup operation
+type CleanupAuditEntry struct {
+	Type         string            `json:"type"`
+	Filters      map[string]string `json:"filters,omitempty"`
+	MatchEmpty   bool              `json:"match_empty,omitempty"`
+	Pattern      string            `json:"pattern,omitempty"`
+	Service      string            `json:"service,omitempty"`
+	DeletedCount int               `json:"deleted_count"`
+	Timestamp    string            `json:"timestamp"`
+	RequestID    string            `json:"request_id"`
+	RemoteAddr   string            `json:"remote_addr"`
+}
+
+// cleanupAuditLog is an append-only ring buffer of the most recent cleanup operations
+type cleanupAuditLog struct {
+	mu      sync.Mutex
+	entries []CleanupAuditEntry
+	next    int
+	full    bool
+}
+
+// newCleanupAuditLog creates an audit log keeping the last size entries
+func newCleanupAuditLog(size int) *cleanupAuditLog {
+	return &cleanupAuditLog{
+		entries: make([]CleanupAuditEntry, size),
+	}
+}
+
+// add records an entry, overwriting the oldest one when the log is full
+func (l *cleanupAuditLog) add(entry CleanupAuditEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.entries[l.next] = entry
+	l.next = (l.next + 1) % len(l.entries)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// list returns the recorded entries, oldest first
+func (l *cleanupAuditLog) list() []CleanupAuditEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.full {
+		return append([]CleanupAuditEntry(nil), l.entries[:l.next]...)
+	}
+
+	result := make([]CleanupAuditEntry, 0, len(l.entries))
+	result = append(result, l.entries[l.next:]...)
+	return append(result, l.entries[:l.next]...)
+}
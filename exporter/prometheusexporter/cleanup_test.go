@@ -5,20 +5,33 @@ package prometheusexporter
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
+	"io"
+	"math"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	io_prometheus_client "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/collector/config/configtls"
 	"go.opentelemetry.io/collector/exporter/exportertest"
 	"go.opentelemetry.io/collector/pdata/pcommon"
 	"go.opentelemetry.io/collector/pdata/pmetric"
 	conventions "go.opentelemetry.io/otel/semconv/v1.25.0"
 	"go.uber.org/zap"
+
+	"github.com/ck-otel-collector/internal/coreinternal/testutil"
 )
 
 func TestAccumulatorCleanupMethods(t *testing.T) {
@@ -200,6 +213,589 @@ func TestCleanupAPI(t *testing.T) {
 	})
 }
 
+func TestCleanupAPIBodyLimit(t *testing.T) {
+	config := createDefaultConfig().(*Config)
+	config.ServerConfig.Endpoint = "localhost:0"
+	config.EnableCleanupAPI = true
+	config.CleanupMaxBodyBytes = 64
+
+	exporter, err := newPrometheusExporter(config, exportertest.NewNopSettings(component.MustNewType("prometheus")))
+	require.NoError(t, err)
+
+	cleanupAPI := NewCleanupAPI(exporter, zap.NewNop())
+
+	t.Run("OverLargeBody", func(t *testing.T) {
+		reqBody := CleanupRequest{
+			Type:    "name",
+			Pattern: strings.Repeat("a", 128),
+		}
+		body, _ := json.Marshal(reqBody)
+
+		req := httptest.NewRequest("POST", "/cleanup", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+
+		cleanupAPI.CleanupHandler(w, req)
+
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+		var response CleanupResponse
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		require.NoError(t, err)
+		assert.False(t, response.Success)
+	})
+
+	t.Run("BodyWithinLimit", func(t *testing.T) {
+		// Marshaling a CleanupRequest writes every field, which no longer fits in 64 bytes
+		req := httptest.NewRequest("POST", "/cleanup", strings.NewReader(`{"type": "expired"}`))
+		w := httptest.NewRecorder()
+
+		cleanupAPI.CleanupHandler(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+}
+
+func TestCleanupAPIRequestTimeout(t *testing.T) {
+	config := createDefaultConfig().(*Config)
+	config.ServerConfig.Endpoint = "localhost:0"
+	config.EnableCleanupAPI = true
+	config.CleanupRequestTimeout = 50 * time.Millisecond
+
+	exporter, err := newPrometheusExporter(config, exportertest.NewNopSettings(component.MustNewType("prometheus")))
+	require.NoError(t, err)
+
+	cleanupAPI := NewCleanupAPI(exporter, zap.NewNop())
+
+	// A client that sends part of the body and then stalls. The recorder supports no read deadline,
+	// so only the timeout closing the body ends the read.
+	body, writer := io.Pipe()
+	go func() {
+		_, _ = writer.Write([]byte(`{"type": "exp`))
+	}()
+	t.Cleanup(func() {
+		_ = writer.Close()
+	})
+
+	req := httptest.NewRequest("POST", "/cleanup", body)
+	w := httptest.NewRecorder()
+
+	done := make(chan struct{})
+	go func() {
+		cleanupAPI.CleanupHandler(w, req)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the cleanup request did not time out while reading a stalled body")
+	}
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	var response CleanupResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.False(t, response.Success)
+}
+
+func TestCleanupAPIAll(t *testing.T) {
+	config := createDefaultConfig().(*Config)
+	config.ServerConfig.Endpoint = "localhost:0"
+	config.EnableCleanupAPI = true
+
+	exporter, err := newPrometheusExporter(config, exportertest.NewNopSettings(component.MustNewType("prometheus")))
+	require.NoError(t, err)
+
+	cleanupAPI := NewCleanupAPI(exporter, zap.NewNop())
+
+	acc := exporter.collector.accumulator
+	acc.Accumulate(createTestResourceMetrics("test_metric_1", "test-job", "test-instance-1", map[string]interface{}{"service": "web"}))
+	acc.Accumulate(createTestResourceMetrics("test_metric_2", "test-job", "test-instance-2", map[string]interface{}{"service": "db"}))
+	acc.Accumulate(createTestResourceMetrics("another_metric", "other-job", "test-instance-1", map[string]interface{}{"service": "web"}))
+
+	metrics, _, _, _, _, _ := acc.Collect()
+	require.Len(t, metrics, 3)
+
+	body, _ := json.Marshal(CleanupRequest{Type: "all"})
+	req := httptest.NewRequest("POST", "/cleanup", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+
+	cleanupAPI.CleanupHandler(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response CleanupResponse
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	require.NoError(t, err)
+	assert.True(t, response.Success)
+	assert.Equal(t, 3, response.DeletedCount)
+
+	metrics, _, _, _, _, _ = acc.Collect()
+	assert.Empty(t, metrics)
+}
+
+func TestCleanupAPICollect(t *testing.T) {
+	config := createDefaultConfig().(*Config)
+	config.ServerConfig.Endpoint = "localhost:0"
+	config.EnableCleanupAPI = true
+
+	exporter, err := newPrometheusExporter(config, exportertest.NewNopSettings(component.MustNewType("prometheus")))
+	require.NoError(t, err)
+
+	cleanupAPI := NewCleanupAPI(exporter, zap.NewNop())
+
+	acc := exporter.collector.accumulator
+	acc.Accumulate(createTestResourceMetrics("test_metric_1", "test-job", "test-instance-1", map[string]interface{}{"service": "web"}))
+	acc.Accumulate(createTestResourceMetrics("test_metric_2", "test-job", "test-instance-2", map[string]interface{}{"service": "db"}))
+	acc.Accumulate(createTestResourceMetrics("another_metric", "other-job", "test-instance-1", map[string]interface{}{"service": "web"}))
+
+	req := httptest.NewRequest("POST", "/api/collect", nil)
+	w := httptest.NewRecorder()
+
+	cleanupAPI.CollectHandler(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, 3.0, response["series_count"])
+	assert.Contains(t, response, "collect_duration_ms")
+
+	req = httptest.NewRequest("GET", "/api/collect", nil)
+	w = httptest.NewRecorder()
+
+	cleanupAPI.CollectHandler(w, req)
+
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
+
+func TestCleanupAPICollectInvalidatesCachedCollection(t *testing.T) {
+	config := createDefaultConfig().(*Config)
+	config.ServerConfig.Endpoint = "localhost:0"
+	config.EnableCleanupAPI = true
+	config.MetricExpiration = 50 * time.Millisecond
+	config.MinScrapeInterval = time.Hour
+
+	exporter, err := newPrometheusExporter(config, exportertest.NewNopSettings(component.MustNewType("prometheus")))
+	require.NoError(t, err)
+	cleanupAPI := NewCleanupAPI(exporter, zap.NewNop())
+
+	// scrape returns the number of test_metric_1 series a scrape gets
+	scrape := func() int {
+		ch := make(chan prometheus.Metric, 10)
+		exporter.collector.Collect(ch)
+		close(ch)
+		count := 0
+		for m := range ch {
+			if strings.Contains(m.Desc().String(), `"test_metric_1"`) {
+				count++
+			}
+		}
+		return count
+	}
+
+	acc := exporter.collector.accumulator
+	acc.Accumulate(createTestResourceMetrics("test_metric_1", "test-job", "test-instance-1", map[string]interface{}{"service": "web"}))
+	require.Equal(t, 1, scrape())
+	time.Sleep(100 * time.Millisecond)
+
+	// Read-only callers leave the expired series to the next collection
+	metrics, _, _, _, _, _ := acc.Snapshot()
+	assert.Empty(t, metrics)
+	assert.Equal(t, int64(1), acc.(*lastValueAccumulator).seriesCount.Load())
+
+	// A forced collection deleting it invalidates the collection cached for the scrapes
+	w := httptest.NewRecorder()
+	cleanupAPI.CollectHandler(w, httptest.NewRequest("POST", "/api/collect", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, int64(0), acc.(*lastValueAccumulator).seriesCount.Load())
+	assert.Equal(t, 0, scrape())
+}
+
+func TestCleanupAPIRequestID(t *testing.T) {
+	config := createDefaultConfig().(*Config)
+	config.ServerConfig.Endpoint = "localhost:0"
+	config.EnableCleanupAPI = true
+
+	exporter, err := newPrometheusExporter(config, exportertest.NewNopSettings(component.MustNewType("prometheus")))
+	require.NoError(t, err)
+
+	cleanupAPI := NewCleanupAPI(exporter, zap.NewNop())
+
+	t.Run("EchoesIncomingID", func(t *testing.T) {
+		body, _ := json.Marshal(CleanupRequest{Type: "expired"})
+		req := httptest.NewRequest("POST", "/cleanup", bytes.NewReader(body))
+		req.Header.Set("X-Request-ID", "req-1234")
+		w := httptest.NewRecorder()
+
+		cleanupAPI.CleanupHandler(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "req-1234", w.Header().Get("X-Request-ID"))
+	})
+
+	t.Run("EchoesIncomingIDOnError", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/cleanup/status", nil)
+		req.Header.Set("X-Request-ID", "req-5678")
+		w := httptest.NewRecorder()
+
+		cleanupAPI.StatusHandler(w, req)
+
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+		assert.Equal(t, "req-5678", w.Header().Get("X-Request-ID"))
+	})
+
+	t.Run("GeneratesIDWhenAbsent", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/cleanup/status", nil)
+		w := httptest.NewRecorder()
+
+		cleanupAPI.StatusHandler(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		firstID := w.Header().Get("X-Request-ID")
+		assert.Len(t, firstID, 32)
+
+		w = httptest.NewRecorder()
+		cleanupAPI.StatusHandler(w, httptest.NewRequest("GET", "/cleanup/status", nil))
+		assert.NotEqual(t, firstID, w.Header().Get("X-Request-ID"), "generated IDs should be unique")
+	})
+}
+
+func TestCleanupAPIByService(t *testing.T) {
+	config := createDefaultConfig().(*Config)
+	config.ServerConfig.Endpoint = "localhost:0"
+	config.EnableCleanupAPI = true
+
+	exporter, err := newPrometheusExporter(config, exportertest.NewNopSettings(component.MustNewType("prometheus")))
+	require.NoError(t, err)
+
+	cleanupAPI := NewCleanupAPI(exporter, zap.NewNop())
+
+	acc := exporter.collector.accumulator
+	acc.Accumulate(createTestResourceMetrics("checkout_requests", "checkout", "checkout-1", map[string]interface{}{}))
+	acc.Accumulate(createTestResourceMetrics("checkout_errors", "checkout", "checkout-2", map[string]interface{}{}))
+	acc.Accumulate(createTestResourceMetrics("payment_requests", "payment", "payment-1", map[string]interface{}{}))
+
+	t.Run("DeletesServiceMetrics", func(t *testing.T) {
+		body, _ := json.Marshal(CleanupRequest{Type: "service", Service: "checkout"})
+		req := httptest.NewRequest("POST", "/cleanup", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+
+		cleanupAPI.CleanupHandler(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response CleanupResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.True(t, response.Success)
+		assert.Equal(t, 2, response.DeletedCount)
+
+		metrics, _, _, _, _, _ := acc.Collect()
+		require.Len(t, metrics, 1)
+		assert.Equal(t, "payment_requests", metrics[0].Name())
+	})
+
+	t.Run("MissingService", func(t *testing.T) {
+		body, _ := json.Marshal(CleanupRequest{Type: "service"})
+		req := httptest.NewRequest("POST", "/cleanup", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+
+		cleanupAPI.CleanupHandler(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestCleanByLabelsWildcard(t *testing.T) {
+	logger := zap.NewNop()
+	acc := newAccumulator(logger, time.Minute*5).(*lastValueAccumulator)
+
+	acc.Accumulate(createTestResourceMetrics("debug_metric_1", "test-job", "test-instance-1", map[string]interface{}{
+		"debug":       "true",
+		"environment": "staging",
+	}))
+	acc.Accumulate(createTestResourceMetrics("debug_metric_2", "test-job", "test-instance-2", map[string]interface{}{
+		"debug":       "verbose",
+		"environment": "production",
+	}))
+	acc.Accumulate(createTestResourceMetrics("regular_metric", "test-job", "test-instance-1", map[string]interface{}{
+		"environment": "staging",
+	}))
+
+	t.Run("CombinedWithExactFilter", func(t *testing.T) {
+		deleted := acc.CleanByLabels(map[string]string{
+			"debug":       labelFilterWildcard,
+			"environment": "production",
+		})
+		assert.Equal(t, 1, deleted)
+	})
+
+	t.Run("AnyValue", func(t *testing.T) {
+		deleted := acc.CleanByLabels(map[string]string{"debug": labelFilterWildcard})
+		assert.Equal(t, 1, deleted)
+
+		metrics, _, _, _, _, _ := acc.Collect()
+		require.Len(t, metrics, 1)
+		assert.Equal(t, "regular_metric", metrics[0].Name())
+	})
+}
+
+func TestCleanByLabelsEmptyValue(t *testing.T) {
+	config := createDefaultConfig().(*Config)
+	config.ServerConfig.Endpoint = "localhost:0"
+	config.EnableCleanupAPI = true
+
+	exporter, err := newPrometheusExporter(config, exportertest.NewNopSettings(component.MustNewType("prometheus")))
+	require.NoError(t, err)
+
+	cleanupAPI := NewCleanupAPI(exporter, zap.NewNop())
+
+	acc := exporter.collector.accumulator
+	acc.Accumulate(createTestResourceMetrics("absent_region", "test-job", "test-instance-1", map[string]interface{}{}))
+	acc.Accumulate(createTestResourceMetrics("empty_region", "test-job", "test-instance-1", map[string]interface{}{"region": ""}))
+	acc.Accumulate(createTestResourceMetrics("set_region", "test-job", "test-instance-1", map[string]interface{}{"region": "eu"}))
+
+	cleanup := func(request CleanupRequest) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(request)
+		req := httptest.NewRequest("POST", "/cleanup", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		cleanupAPI.CleanupHandler(w, req)
+		return w
+	}
+
+	t.Run("WithoutMatchEmpty", func(t *testing.T) {
+		w := cleanup(CleanupRequest{Type: "labels", Filters: map[string]string{"region": ""}})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "match_empty")
+
+		metrics, _, _, _, _, _ := acc.Collect()
+		assert.Len(t, metrics, 3)
+	})
+
+	t.Run("MatchEmpty", func(t *testing.T) {
+		w := cleanup(CleanupRequest{Type: "labels", Filters: map[string]string{"region": ""}, MatchEmpty: true})
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response CleanupResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, 1, response.DeletedCount)
+
+		// Only the series with a blank region is deleted, not the one without a region
+		metrics, _, _, _, _, _ := acc.Collect()
+		names := make([]string, 0, len(metrics))
+		for _, metric := range metrics {
+			names = append(names, metric.Name())
+		}
+		assert.ElementsMatch(t, []string{"absent_region", "set_region"}, names)
+	})
+
+	t.Run("NonEmptyValue", func(t *testing.T) {
+		w := cleanup(CleanupRequest{Type: "labels", Filters: map[string]string{"region": "eu"}, MatchEmpty: true})
+		require.Equal(t, http.StatusOK, w.Code)
+
+		metrics, _, _, _, _, _ := acc.Collect()
+		require.Len(t, metrics, 1)
+		assert.Equal(t, "absent_region", metrics[0].Name())
+	})
+}
+
+func TestCleanupStaleMarkers(t *testing.T) {
+	acc := newBoundedAccumulator(zap.NewNop(), time.Minute*5, 0, 0, nil, true)
+	acc.Accumulate(createTestResourceMetrics("queue_depth", "checkout", "checkout-1", map[string]interface{}{"queue": "orders"}))
+	acc.Accumulate(createTestResourceMetrics("queue_depth", "checkout", "checkout-1", map[string]interface{}{"queue": "refunds"}))
+	acc.Accumulate(createTestResourceMetrics("uptime", "checkout", "checkout-1", map[string]interface{}{}))
+
+	generation := acc.Generation()
+	require.Equal(t, 2, acc.CleanByMetricName("queue_depth"))
+	require.Greater(t, acc.Generation(), generation)
+
+	// The cleaned series are gone, but the next scrape gets a NaN marker for each of them
+	metrics, _, _, _, _, _ := acc.Collect()
+	require.Len(t, metrics, 1)
+	assert.Equal(t, "uptime", metrics[0].Name())
+
+	// A collection computed before the cleanup still has the series, so it gets no marker
+	markers, _, _, _, _, _ := acc.CollectStaleMarkers(generation)
+	assert.Empty(t, markers)
+
+	markers, resourceAttrs, _, _, _, _ := acc.CollectStaleMarkers(acc.Generation())
+	require.Len(t, markers, 2)
+	require.Len(t, resourceAttrs, 2)
+	for _, marker := range markers {
+		assert.Equal(t, "queue_depth", marker.Name())
+		assert.Equal(t, staleNaN, math.Float64bits(marker.Gauge().DataPoints().At(0).DoubleValue()))
+	}
+
+	// Markers are served once
+	markers, _, _, _, _, _ = acc.CollectStaleMarkers(acc.Generation())
+	assert.Empty(t, markers)
+
+	// A series accumulated again before the next scrape gets no marker
+	require.Equal(t, 1, acc.CleanAll())
+	acc.Accumulate(createTestResourceMetrics("uptime", "checkout", "checkout-1", map[string]interface{}{}))
+	markers, _, _, _, _, _ = acc.CollectStaleMarkers(acc.Generation())
+	assert.Empty(t, markers)
+
+	// The collector exposes the marker on the scrape after a cleanup
+	config := createDefaultConfig().(*Config)
+	config.EmitStaleMarkersOnCleanup = true
+	c := newCollector(config, zap.NewNop())
+	c.accumulator.Accumulate(createTestResourceMetrics("queue_depth", "checkout", "checkout-1", map[string]interface{}{"queue": "orders"}))
+	require.Equal(t, 1, c.CleanByMetricName("queue_depth"))
+
+	ch := make(chan prometheus.Metric, 10)
+	c.Collect(ch)
+	close(ch)
+	var values []float64
+	for m := range ch {
+		pbMetric := io_prometheus_client.Metric{}
+		require.NoError(t, m.Write(&pbMetric))
+		if pbMetric.Gauge != nil {
+			values = append(values, pbMetric.Gauge.GetValue())
+		}
+	}
+	require.Len(t, values, 1)
+	assert.Equal(t, staleNaN, math.Float64bits(values[0]))
+}
+
+func TestCleanupAPIAudit(t *testing.T) {
+	config := createDefaultConfig().(*Config)
+	config.ServerConfig.Endpoint = "localhost:0"
+	config.EnableCleanupAPI = true
+
+	exporter, err := newPrometheusExporter(config, exportertest.NewNopSettings(component.MustNewType("prometheus")))
+	require.NoError(t, err)
+
+	cleanupAPI := NewCleanupAPI(exporter, zap.NewNop())
+
+	acc := exporter.collector.accumulator
+	acc.Accumulate(createTestResourceMetrics("test_metric_1", "test-job", "test-instance-1", map[string]interface{}{"service": "web"}))
+	acc.Accumulate(createTestResourceMetrics("another_metric", "other-job", "test-instance-1", map[string]interface{}{"service": "web"}))
+
+	for i, cleanupReq := range []CleanupRequest{
+		{Type: "name", Pattern: "test_metric_.*"},
+		{Type: "labels", Filters: map[string]string{"service": "web"}},
+		{Type: "invalid"},
+	} {
+		body, _ := json.Marshal(cleanupReq)
+		req := httptest.NewRequest("POST", "/cleanup", bytes.NewReader(body))
+		req.Header.Set(requestIDHeader, fmt.Sprintf("audit-%d", i))
+		cleanupAPI.CleanupHandler(httptest.NewRecorder(), req)
+	}
+
+	req := httptest.NewRequest("GET", "/cleanup/audit", nil)
+	w := httptest.NewRecorder()
+	cleanupAPI.AuditHandler(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response struct {
+		Entries []CleanupAuditEntry `json:"entries"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+
+	// Failed requests are not recorded, the others are returned oldest first
+	require.Len(t, response.Entries, 2)
+	assert.Equal(t, "name", response.Entries[0].Type)
+	assert.Equal(t, "test_metric_.*", response.Entries[0].Pattern)
+	assert.Equal(t, 1, response.Entries[0].DeletedCount)
+	assert.Equal(t, "audit-0", response.Entries[0].RequestID)
+	assert.NotEmpty(t, response.Entries[0].Timestamp)
+	assert.NotEmpty(t, response.Entries[0].RemoteAddr)
+	assert.Equal(t, "labels", response.Entries[1].Type)
+	assert.Equal(t, map[string]string{"service": "web"}, response.Entries[1].Filters)
+	assert.Equal(t, 1, response.Entries[1].DeletedCount)
+	assert.Equal(t, "audit-1", response.Entries[1].RequestID)
+
+	t.Run("Bounded", func(t *testing.T) {
+		auditLog := newCleanupAuditLog(3)
+		for i := 0; i < 5; i++ {
+			auditLog.add(CleanupAuditEntry{RequestID: fmt.Sprintf("req-%d", i)})
+		}
+
+		var requestIDs []string
+		for _, entry := range auditLog.list() {
+			requestIDs = append(requestIDs, entry.RequestID)
+		}
+		assert.Equal(t, []string{"req-2", "req-3", "req-4"}, requestIDs)
+	})
+}
+
+func TestCleanupAPIRequiresTLS(t *testing.T) {
+	config := createDefaultConfig().(*Config)
+	config.ServerConfig.Endpoint = "localhost:0"
+	config.EnableCleanupAPI = true
+
+	// Plaintext is rejected without the override
+	err := config.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "allow_insecure_cleanup")
+
+	config.AllowInsecureCleanup = true
+	require.NoError(t, config.Validate())
+
+	// The cleanup API is served with the TLS settings of the server, like /metrics
+	config.AllowInsecureCleanup = false
+	config.TLS = &configtls.ServerConfig{
+		Config: configtls.Config{
+			CertFile: "./testdata/certs/server.crt",
+			KeyFile:  "./testdata/certs/server.key",
+		},
+		ClientCAFile: "./testdata/certs/ca.crt",
+	}
+	require.NoError(t, config.Validate())
+
+	// Without the cleanup API, plaintext is fine
+	config.EnableCleanupAPI = false
+	config.TLS = nil
+	require.NoError(t, config.Validate())
+}
+
+func TestScheduledCleanups(t *testing.T) {
+	config := createDefaultConfig().(*Config)
+	config.ServerConfig.Endpoint = testutil.GetAvailableLocalAddress(t)
+	config.ScheduledCleanups = []ScheduledCleanup{
+		{
+			Interval: 10 * time.Millisecond,
+			Request:  CleanupRequest{Type: "labels", Filters: map[string]string{"env": "ephemeral"}},
+		},
+	}
+	require.NoError(t, config.Validate())
+
+	exporter, err := newPrometheusExporter(config, exportertest.NewNopSettings(component.MustNewType("prometheus")))
+	require.NoError(t, err)
+
+	acc := exporter.collector.accumulator
+	acc.Accumulate(createTestResourceMetrics("preview_requests", "preview", "preview-1", map[string]interface{}{"env": "ephemeral"}))
+	acc.Accumulate(createTestResourceMetrics("checkout_requests", "checkout", "checkout-1", map[string]interface{}{"env": "production"}))
+
+	require.NoError(t, exporter.Start(context.Background(), componenttest.NewNopHost()))
+
+	require.Eventually(t, func() bool {
+		metrics, _, _, _, _, _ := acc.Collect()
+		return len(metrics) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	metrics, _, _, _, _, _ := acc.Collect()
+	assert.Equal(t, "checkout_requests", metrics[0].Name())
+
+	// Scheduled runs are audited like cleanup API requests, under a generated request ID
+	require.Eventually(t, func() bool {
+		return len(exporter.cleanupAuditLog.list()) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	entries := exporter.cleanupAuditLog.list()
+	assert.Equal(t, "labels", entries[0].Type)
+	assert.Equal(t, map[string]string{"env": "ephemeral"}, entries[0].Filters)
+	assert.Equal(t, 1, entries[0].DeletedCount)
+	assert.True(t, strings.HasPrefix(entries[0].RequestID, scheduledCleanupRequestIDPrefix), entries[0].RequestID)
+	assert.Empty(t, entries[0].RemoteAddr)
+
+	require.NoError(t, exporter.Shutdown(context.Background()))
+
+	// No cleanup runs after shutdown
+	acc.Accumulate(createTestResourceMetrics("preview_requests", "preview", "preview-1", map[string]interface{}{"env": "ephemeral"}))
+	time.Sleep(50 * time.Millisecond)
+	metrics, _, _, _, _, _ = acc.Collect()
+	assert.Len(t, metrics, 2)
+}
+
 func TestLabelExtraction(t *testing.T) {
 	logger := zap.NewNop()
 	acc := newAccumulator(logger, time.Minute*5).(*lastValueAccumulator)
@@ -373,6 +969,55 @@ func TestCleanupByResourceAttributes(t *testing.T) {
 	})
 }
 
+// TestConcurrentAccumulateAndCleanByLabels is meant to be run with -race
+func TestConcurrentAccumulateAndCleanByLabels(t *testing.T) {
+	acc := newAccumulator(zap.NewNop(), time.Hour).(*lastValueAccumulator)
+
+	const (
+		writers          = 8
+		seriesPerWriter  = 200
+		cleaners         = 4
+		cleansPerCleaner = 50
+	)
+
+	var deleted atomic.Int64
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < seriesPerWriter; i++ {
+				service := "web"
+				if i%2 == 1 {
+					service = "db"
+				}
+				acc.Accumulate(createTestResourceMetrics("test_metric", "test-job", fmt.Sprintf("instance-%d-%d", w, i), map[string]interface{}{"service": service}))
+			}
+		}(w)
+	}
+	for c := 0; c < cleaners; c++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < cleansPerCleaner; i++ {
+				deleted.Add(int64(acc.CleanByLabels(map[string]string{"service": "web"})))
+			}
+		}()
+	}
+	wg.Wait()
+
+	deleted.Add(int64(acc.CleanByLabels(map[string]string{"service": "web"})))
+
+	// Every web series was deleted exactly once and every db series is left
+	assert.Equal(t, int64(writers*seriesPerWriter/2), deleted.Load())
+	metrics, _, _, _, _, _ := acc.Collect()
+	assert.Len(t, metrics, writers*seriesPerWriter/2)
+	for _, metric := range metrics {
+		value, _ := metric.Gauge().DataPoints().At(0).Attributes().Get("service")
+		assert.Equal(t, "db", value.Str())
+	}
+}
+
 // Helper function to create test resource metrics
 func createTestResourceMetrics(metricName, job, instance string, attributes map[string]interface{}) pmetric.ResourceMetrics {
 	rm := pmetric.NewResourceMetrics()
@@ -25,6 +25,15 @@ import (
 
 var separatorString = string([]byte{model.SeparatorByte})
 
+// collectDurationMetricName is the name of the histogram of the Collect durations
+const collectDurationMetricName = "prometheusexporter_collect_duration_seconds"
+
+// targetInfoHelp is the help text of the target_info metric
+const targetInfoHelp = "Target metadata"
+
+// evictedSeriesMetricName is the name of the counter of the series evicted because max_series was exceeded
+const evictedSeriesMetricName = "prometheusexporter_evicted_series_total"
+
 type collector struct {
 	accumulator accumulator
 	logger      *zap.Logger
@@ -33,8 +42,31 @@ type collector struct {
 	addMetricSuffixes bool
 	namespace         string
 	constLabels       prometheus.Labels
+	defaultHelp       string
 	metricFamilies    sync.Map
 	metricExpiration  time.Duration
+	metricDenylist    *metricNameFilter
+	metricRenames     map[string]string
+	labelNormalizer   *labelNormalizer
+	targetLabels      *targetLabels
+
+	includeScopeAttributes  bool
+	scopeAttributeAllowlist map[string]bool
+
+	// minScrapeInterval is how long a collection is served again to scrapers before it is recomputed.
+	// A change of the accumulator generation invalidates the cached collection.
+	minScrapeInterval time.Duration
+	// cacheMu guards the cached collection
+	cacheMu          sync.Mutex
+	cached           []prometheus.Metric
+	cachedAt         time.Time
+	cachedGeneration uint64
+	cacheValid       bool
+
+	// collectDuration records the duration of every Collect, nil unless emit_collect_duration is set
+	collectDuration prometheus.Histogram
+	// evictedSeries exposes the number of series evicted by the accumulator, nil unless max_series is set
+	evictedSeries prometheus.CounterFunc
 }
 
 type metricFamily struct {
@@ -43,14 +75,60 @@ type metricFamily struct {
 }
 
 func newCollector(config *Config, logger *zap.Logger) *collector {
+	metricDenylist, err := newMetricNameFilter(config.MetricDenylist)
+	if err != nil {
+		logger.Error("Ignoring invalid metric denylist", zap.Error(err))
+	}
+
+	targetLabels := newTargetLabels(config.JobLabelOverride, config.InstanceLabelOverride)
+
+	var scopeAttributeAllowlist map[string]bool
+	if len(config.ScopeAttributeAllowlist) > 0 {
+		scopeAttributeAllowlist = make(map[string]bool, len(config.ScopeAttributeAllowlist))
+		for _, name := range config.ScopeAttributeAllowlist {
+			scopeAttributeAllowlist[name] = true
+		}
+	}
+
+	var collectDuration prometheus.Histogram
+	if config.EmitCollectDuration {
+		collectDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    collectDurationMetricName,
+			Help:    "Time taken by the Prometheus exporter to collect the accumulated series for a scrape.",
+			Buckets: prometheus.DefBuckets,
+		})
+	}
+
+	acc := newBoundedAccumulator(logger, config.MetricExpiration, config.ExpirationGracePeriod, config.MaxSeries, targetLabels, config.EmitStaleMarkersOnCleanup)
+	var evictedSeries prometheus.CounterFunc
+	if config.MaxSeries > 0 {
+		evictedSeries = prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: evictedSeriesMetricName,
+			Help: "Number of series evicted by the Prometheus exporter because max_series was exceeded.",
+		}, func() float64 {
+			return float64(acc.evictedSeries.Load())
+		})
+	}
+
 	return &collector{
-		accumulator:       newAccumulator(logger, config.MetricExpiration),
+		accumulator:       acc,
 		logger:            logger,
 		namespace:         prometheustranslator.CleanUpString(config.Namespace),
 		sendTimestamps:    config.SendTimestamps,
 		constLabels:       config.ConstLabels,
+		defaultHelp:       config.DefaultHelp,
 		addMetricSuffixes: config.AddMetricSuffixes,
 		metricExpiration:  config.MetricExpiration,
+		metricDenylist:    metricDenylist,
+		metricRenames:     config.MetricRenames,
+		labelNormalizer:   newLabelNormalizer(config.NormalizeLabels, config.LabelNameReplacements, config.MaxLabelValueLength),
+		targetLabels:      targetLabels,
+
+		includeScopeAttributes:  config.IncludeScopeAttributes,
+		scopeAttributeAllowlist: scopeAttributeAllowlist,
+		minScrapeInterval:       config.MinScrapeInterval,
+		collectDuration:         collectDuration,
+		evictedSeries:           evictedSeries,
 	}
 }
 
@@ -95,9 +173,61 @@ func (c *collector) Describe(_ chan<- *prometheus.Desc) {}
 Processing
 */
 func (c *collector) processMetrics(rm pmetric.ResourceMetrics) (n int) {
+	c.dropDeniedMetrics(rm)
+	c.renameMetrics(rm)
+	c.filterScopeAttributes(rm)
+	c.labelNormalizer.normalizeResourceMetrics(rm)
 	return c.accumulator.Accumulate(rm)
 }
 
+// dropDeniedMetrics removes denylisted metrics so they are never accumulated
+func (c *collector) dropDeniedMetrics(rm pmetric.ResourceMetrics) {
+	if c.metricDenylist == nil {
+		return
+	}
+
+	for i := 0; i < rm.ScopeMetrics().Len(); i++ {
+		rm.ScopeMetrics().At(i).Metrics().RemoveIf(func(metric pmetric.Metric) bool {
+			if c.metricDenylist.matches(metric.Name()) {
+				c.logger.Debug("Dropping denylisted metric", zap.String("metric_name", metric.Name()))
+				return true
+			}
+			return false
+		})
+	}
+}
+
+// filterScopeAttributes drops the scope attributes that must not become labels before the metrics are
+// accumulated, so they do not split series either
+func (c *collector) filterScopeAttributes(rm pmetric.ResourceMetrics) {
+	if c.includeScopeAttributes && c.scopeAttributeAllowlist == nil {
+		return
+	}
+
+	for i := 0; i < rm.ScopeMetrics().Len(); i++ {
+		rm.ScopeMetrics().At(i).Scope().Attributes().RemoveIf(func(k string, _ pcommon.Value) bool {
+			return !c.includeScopeAttributes || !c.scopeAttributeAllowlist[k]
+		})
+	}
+}
+
+// renameMetrics applies the configured metric renames before the metrics are accumulated
+func (c *collector) renameMetrics(rm pmetric.ResourceMetrics) {
+	if len(c.metricRenames) == 0 {
+		return
+	}
+
+	for i := 0; i < rm.ScopeMetrics().Len(); i++ {
+		metrics := rm.ScopeMetrics().At(i).Metrics()
+		for j := 0; j < metrics.Len(); j++ {
+			metric := metrics.At(j)
+			if newName, ok := c.metricRenames[metric.Name()]; ok {
+				metric.SetName(newName)
+			}
+		}
+	}
+}
+
 var errUnknownMetricType = errors.New("unknown metric type")
 
 func (c *collector) convertMetric(metric pmetric.Metric, resourceAttrs pcommon.Map, scopeName string, scopeVersion string, scopeSchemaURL string, scopeAttributes pcommon.Map) (prometheus.Metric, error) {
@@ -117,7 +247,11 @@ func (c *collector) convertMetric(metric pmetric.Metric, resourceAttrs pcommon.M
 
 func (c *collector) getMetricMetadata(metric pmetric.Metric, mType *dto.MetricType, attributes pcommon.Map, resourceAttrs pcommon.Map, scopeName string, scopeVersion string, scopeSchemaURL string, scopeAttributes pcommon.Map) (*prometheus.Desc, []string, error) {
 	name := prometheustranslator.BuildCompliantName(metric, c.namespace, c.addMetricSuffixes)
-	help, err := c.validateMetrics(name, metric.Description(), mType)
+	description := metric.Description()
+	if description == "" {
+		description = c.defaultHelp
+	}
+	help, err := c.validateMetrics(name, description, mType)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -142,11 +276,11 @@ func (c *collector) getMetricMetadata(metric pmetric.Metric, mType *dto.MetricTy
 	keys = append(keys, "otel_scope_schema_url")
 	values = append(values, scopeSchemaURL)
 
-	if job, ok := extractJob(resourceAttrs); ok {
+	if job, ok := c.targetLabels.extractJob(resourceAttrs); ok {
 		keys = append(keys, model.JobLabel)
 		values = append(values, job)
 	}
-	if instance, ok := extractInstance(resourceAttrs); ok {
+	if instance, ok := c.targetLabels.extractInstance(resourceAttrs); ok {
 		keys = append(keys, model.InstanceLabel)
 		values = append(values, instance)
 	}
@@ -331,7 +465,7 @@ func (c *collector) createTargetInfoMetrics(resourceAttrs []pcommon.Map) ([]prom
 	deduplicatedResourceAttrs := make([]pcommon.Map, 0, len(resourceAttrs))
 	seenResource := map[string]struct{}{}
 	for _, attrs := range resourceAttrs {
-		sig := resourceSignature(attrs)
+		sig := c.targetLabels.resourceSignature(attrs)
 		if sig == "" {
 			continue
 		}
@@ -370,18 +504,15 @@ func (c *collector) createTargetInfoMetrics(resourceAttrs []pcommon.Map) ([]prom
 		}
 
 		// Map service.name + service.namespace to job
-		if job, ok := extractJob(rAttributes); ok {
+		if job, ok := c.targetLabels.extractJob(rAttributes); ok {
 			labels[model.JobLabel] = job
 		}
 		// Map service.instance.id to instance
-		if instance, ok := extractInstance(rAttributes); ok {
+		if instance, ok := c.targetLabels.extractInstance(rAttributes); ok {
 			labels[model.InstanceLabel] = instance
 		}
 
-		name := prometheustranslator.TargetInfoMetricName
-		if len(c.namespace) > 0 {
-			name = c.namespace + "_" + name
-		}
+		name := c.targetInfoMetricName()
 
 		keys := make([]string, 0, len(labels))
 		values := make([]string, 0, len(labels))
@@ -391,7 +522,7 @@ func (c *collector) createTargetInfoMetrics(resourceAttrs []pcommon.Map) ([]prom
 		}
 
 		metric, err := prometheus.NewConstMetric(
-			prometheus.NewDesc(name, "Target metadata", keys, nil),
+			prometheus.NewDesc(name, targetInfoHelp, keys, nil),
 			prometheus.GaugeValue,
 			1,
 			values...,
@@ -406,23 +537,135 @@ func (c *collector) createTargetInfoMetrics(resourceAttrs []pcommon.Map) ([]prom
 	return metrics, lastErr
 }
 
+// targetInfoMetricName returns the name of the target_info metric, prefixed by the namespace
+func (c *collector) targetInfoMetricName() string {
+	if len(c.namespace) > 0 {
+		return c.namespace + "_" + prometheustranslator.TargetInfoMetricName
+	}
+	return prometheustranslator.TargetInfoMetricName
+}
+
 /*
 Reporting
 */
+
+// Collect serves a scrape: the accumulated series, followed by the stale markers of the series cleaned
+// since the previous scrape. Only the /metrics handler gathers the collector, since each marker is served once.
 func (c *collector) Collect(ch chan<- prometheus.Metric) {
 	c.logger.Debug("collect called")
+	if c.collectDuration != nil {
+		defer prometheus.NewTimer(c.collectDuration).ObserveDuration()
+	}
 
+	metrics, generation := c.currentMetrics()
+	for _, m := range metrics {
+		ch <- m
+	}
+
+	// Stale markers are never part of the cached collection. Only the markers of series deleted by the
+	// generation the collection was computed at are served, the others wait for a collection without the series.
+	for _, m := range c.collectStaleMarkers(generation) {
+		ch <- m
+	}
+}
+
+// currentMetrics returns the collection to serve and the accumulator generation it was computed at.
+// Scrapes within min_scrape_interval of the previous one get the same metrics, unless series changed since.
+func (c *collector) currentMetrics() ([]prometheus.Metric, uint64) {
+	if c.minScrapeInterval <= 0 {
+		generation := c.accumulator.Generation()
+		return c.collectMetrics(), generation
+	}
+
+	c.cacheMu.Lock()
+	defer c.cacheMu.Unlock()
+
+	generation := c.accumulator.Generation()
+	if !c.cacheValid || c.cachedGeneration != generation || time.Since(c.cachedAt) >= c.minScrapeInterval {
+		c.cached = c.collectMetrics()
+		c.cachedAt = time.Now()
+		c.cachedGeneration = generation
+		c.cacheValid = true
+	} else {
+		c.logger.Debug("serving cached collection", zap.Duration("age", time.Since(c.cachedAt)))
+	}
+
+	return c.cached, c.cachedGeneration
+}
+
+// forEachSeries converts the accumulated series one at a time, followed by target_info, and calls fn with
+// the exposed name and help of each, until fn fails. Unlike Collect it deletes no series and serves no
+// stale markers, and only one series is converted at a time rather than the whole collection.
+func (c *collector) forEachSeries(fn func(name string, help string, m prometheus.Metric) error) error {
+	var err error
+	// Only one resource per job and instance is kept for target_info
+	var resourceAttrs []pcommon.Map
+	seenResource := map[string]struct{}{}
+
+	c.accumulator.RangeSeries(func(v *accumulatedValue) bool {
+		if sig := c.targetLabels.resourceSignature(v.resourceAttrs); sig != "" {
+			if _, ok := seenResource[sig]; !ok {
+				seenResource[sig] = struct{}{}
+				resourceAttrs = append(resourceAttrs, v.resourceAttrs)
+			}
+		}
+
+		m, convErr := c.convertMetric(v.value, v.resourceAttrs, v.scopeName, v.scopeVersion, v.scopeSchemaURL, v.scopeAttributes)
+		if convErr != nil {
+			c.logger.Error(fmt.Sprintf("failed to convert metric %s: %s", v.value.Name(), convErr.Error()))
+			return true
+		}
+		name := prometheustranslator.BuildCompliantName(v.value, c.namespace, c.addMetricSuffixes)
+		var help string
+		if family, ok := c.metricFamilies.Load(name); ok {
+			help = family.(metricFamily).mf.GetHelp()
+		}
+		err = fn(name, help, m)
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+
+	targetMetrics, convErr := c.createTargetInfoMetrics(resourceAttrs)
+	if convErr != nil {
+		c.logger.Error(fmt.Sprintf("failed to convert metric %s: %s", prometheustranslator.TargetInfoMetricName, convErr.Error()))
+	}
+	for _, m := range targetMetrics {
+		if err := fn(c.targetInfoMetricName(), targetInfoHelp, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// collectMetrics converts the accumulated series and target_info into Prometheus metrics
+func (c *collector) collectMetrics() []prometheus.Metric {
 	inMetrics, resourceAttrs, scopeNames, scopeVersions, scopeSchemaURLs, scopeAttributes := c.accumulator.Collect()
 
 	targetMetrics, err := c.createTargetInfoMetrics(resourceAttrs)
 	if err != nil {
 		c.logger.Error(fmt.Sprintf("failed to convert metric %s: %s", prometheustranslator.TargetInfoMetricName, err.Error()))
 	}
+	metrics := make([]prometheus.Metric, 0, len(targetMetrics)+len(inMetrics))
 	for _, m := range targetMetrics {
-		ch <- m
+		metrics = append(metrics, m)
 		c.logger.Debug(fmt.Sprintf("metric served: %s", m.Desc().String()))
 	}
 
+	metrics = append(metrics, c.convertMetrics(inMetrics, resourceAttrs, scopeNames, scopeVersions, scopeSchemaURLs, scopeAttributes)...)
+	c.cleanupMetricFamilies()
+	return metrics
+}
+
+// collectStaleMarkers converts the stale markers of the series deleted by a cleanup up to generation into Prometheus metrics
+func (c *collector) collectStaleMarkers(generation uint64) []prometheus.Metric {
+	return c.convertMetrics(c.accumulator.CollectStaleMarkers(generation))
+}
+
+// convertMetrics converts accumulated metrics into Prometheus metrics, skipping the ones that fail to convert
+func (c *collector) convertMetrics(inMetrics []pmetric.Metric, resourceAttrs []pcommon.Map, scopeNames []string, scopeVersions []string, scopeSchemaURLs []string, scopeAttributes []pcommon.Map) []prometheus.Metric {
+	metrics := make([]prometheus.Metric, 0, len(inMetrics))
 	for i := range inMetrics {
 		pMetric := inMetrics[i]
 		rAttr := resourceAttrs[i]
@@ -433,10 +676,10 @@ func (c *collector) Collect(ch chan<- prometheus.Metric) {
 			continue
 		}
 
-		ch <- m
+		metrics = append(metrics, m)
 		c.logger.Debug(fmt.Sprintf("metric served: %s", m.Desc().String()))
 	}
-	c.cleanupMetricFamilies()
+	return metrics
 }
 
 func (c *collector) validateMetrics(name, description string, metricType *dto.MetricType) (help string, err error) {
@@ -488,6 +731,14 @@ func (c *collector) cleanupMetricFamilies() {
 
 // CleanByLabels removes metrics based on label filters
 func (c *collector) CleanByLabels(filters map[string]string) int {
+	if c.labelNormalizer != nil {
+		// Labels are stored under their canonical names, so filters must use them as well
+		normalizedFilters := make(map[string]string, len(filters))
+		for k, v := range filters {
+			normalizedFilters[c.labelNormalizer.canonicalName(k)] = v
+		}
+		filters = normalizedFilters
+	}
 	return c.accumulator.CleanByLabels(filters)
 }
 
@@ -501,4 +752,9 @@ func (c *collector) CleanExpired() int {
 	return c.accumulator.CleanExpired()
 }
 
+// CleanAll removes all metrics
+func (c *collector) CleanAll() int {
+	return c.accumulator.CleanAll()
+}
+
 // ================================================================
\ No newline at end of file
@@ -4,13 +4,18 @@
 package prometheusexporter
 
 import (
+	"bytes"
 	"encoding/hex"
+	"math"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	io_prometheus_client "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
 	"github.com/stretchr/testify/require"
 	"go.opentelemetry.io/collector/pdata/pcommon"
 	"go.opentelemetry.io/collector/pdata/pmetric"
@@ -53,6 +58,26 @@ func (a *mockAccumulator) Collect() ([]pmetric.Metric, []pcommon.Map, []string,
 	return a.metrics, rAttrs, scopeNames, scopeVersions, scopeSchemaURLs, scopeAttributes
 }
 
+func (a *mockAccumulator) Snapshot() ([]pmetric.Metric, []pcommon.Map, []string, []string, []string, []pcommon.Map) {
+	return a.Collect()
+}
+
+func (a *mockAccumulator) RangeSeries(fn func(v *accumulatedValue) bool) {
+	for i, metric := range a.metrics {
+		v := &accumulatedValue{
+			value:           metric,
+			resourceAttrs:   a.resourceAttributes,
+			scopeName:       a.scopeNames[i],
+			scopeVersion:    a.scopeVersions[i],
+			scopeSchemaURL:  a.scopeSchemaURLs[i],
+			scopeAttributes: a.scopeAttributes[i],
+		}
+		if !fn(v) {
+			return
+		}
+	}
+}
+
 // ========== ENHANCEMENT: Mock Cleanup Methods for Testing ==========
 
 // CleanByLabels mock implementation
@@ -70,6 +95,21 @@ func (a *mockAccumulator) CleanExpired() int {
 	return 0
 }
 
+// CleanAll mock implementation
+func (a *mockAccumulator) CleanAll() int {
+	return 0
+}
+
+// CollectStaleMarkers mock implementation
+func (a *mockAccumulator) CollectStaleMarkers(uint64) ([]pmetric.Metric, []pcommon.Map, []string, []string, []string, []pcommon.Map) {
+	return nil, nil, nil, nil, nil, nil
+}
+
+// Generation mock implementation
+func (a *mockAccumulator) Generation() uint64 {
+	return 0
+}
+
 // =====================================================================
 
 func TestConvertInvalidDataType(t *testing.T) {
@@ -862,3 +902,574 @@ func TestAccumulateSummary(t *testing.T) {
 		}
 	}
 }
+
+func TestCollectMetricDenylist(t *testing.T) {
+	config := createDefaultConfig().(*Config)
+	config.MetricDenylist = []string{"noisy_metric", "internal_.*"}
+	c := newCollector(config, zap.NewNop())
+
+	rm := pmetric.NewResourceMetrics()
+	sm := rm.ScopeMetrics().AppendEmpty()
+	for _, name := range []string{"kept_metric", "noisy_metric", "internal_queue_size", "noisy_metric_total"} {
+		metric := sm.Metrics().AppendEmpty()
+		metric.SetName(name)
+		dp := metric.SetEmptyGauge().DataPoints().AppendEmpty()
+		dp.SetDoubleValue(1)
+		dp.SetTimestamp(pcommon.NewTimestampFromTime(time.Now()))
+	}
+
+	require.Equal(t, 2, c.processMetrics(rm))
+
+	names := collectMetricNames(t, c)
+	require.ElementsMatch(t, []string{"kept_metric", "noisy_metric_total"}, names)
+}
+
+func TestCollectMetricSuffixes(t *testing.T) {
+	newResourceMetrics := func() pmetric.ResourceMetrics {
+		rm := pmetric.NewResourceMetrics()
+		sm := rm.ScopeMetrics().AppendEmpty()
+
+		counter := sm.Metrics().AppendEmpty()
+		counter.SetName("http_requests")
+		counter.SetEmptySum().SetIsMonotonic(true)
+		counter.Sum().SetAggregationTemporality(pmetric.AggregationTemporalityCumulative)
+		counterDp := counter.Sum().DataPoints().AppendEmpty()
+		counterDp.SetIntValue(10)
+		counterDp.SetTimestamp(pcommon.NewTimestampFromTime(time.Now()))
+
+		upDownCounter := sm.Metrics().AppendEmpty()
+		upDownCounter.SetName("queue_depth")
+		upDownCounter.SetEmptySum().SetIsMonotonic(false)
+		upDownCounter.Sum().SetAggregationTemporality(pmetric.AggregationTemporalityCumulative)
+		upDownCounterDp := upDownCounter.Sum().DataPoints().AppendEmpty()
+		upDownCounterDp.SetIntValue(3)
+		upDownCounterDp.SetTimestamp(pcommon.NewTimestampFromTime(time.Now()))
+
+		gauge := sm.Metrics().AppendEmpty()
+		gauge.SetName("request_duration")
+		gauge.SetUnit("s")
+		gaugeDp := gauge.SetEmptyGauge().DataPoints().AppendEmpty()
+		gaugeDp.SetDoubleValue(0.5)
+		gaugeDp.SetTimestamp(pcommon.NewTimestampFromTime(time.Now()))
+
+		return rm
+	}
+
+	t.Run("enabled", func(t *testing.T) {
+		config := createDefaultConfig().(*Config)
+		c := newCollector(config, zap.NewNop())
+		require.Equal(t, 3, c.processMetrics(newResourceMetrics()))
+
+		// Monotonic cumulative sums are counters and get _total, units become suffixes
+		names := collectMetricNames(t, c)
+		require.ElementsMatch(t, []string{"http_requests_total", "queue_depth", "request_duration_seconds"}, names)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		config := createDefaultConfig().(*Config)
+		config.AddMetricSuffixes = false
+		c := newCollector(config, zap.NewNop())
+		require.Equal(t, 3, c.processMetrics(newResourceMetrics()))
+
+		names := collectMetricNames(t, c)
+		require.ElementsMatch(t, []string{"http_requests", "queue_depth", "request_duration"}, names)
+	})
+}
+
+// collectMetricNames runs a collection and returns the fully qualified names of the served metrics
+func collectMetricNames(t *testing.T, c *collector) []string {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		c.Collect(ch)
+		close(ch)
+	}()
+
+	var names []string
+	for m := range ch {
+		pbMetric := io_prometheus_client.Metric{}
+		require.NoError(t, m.Write(&pbMetric))
+		desc := m.Desc().String()
+		start := strings.Index(desc, "fqName: \"") + len("fqName: \"")
+		names = append(names, desc[start:start+strings.Index(desc[start:], "\"")])
+	}
+	return names
+}
+
+func TestCollectMetricRenames(t *testing.T) {
+	config := createDefaultConfig().(*Config)
+	config.MetricRenames = map[string]string{"legacy_requests": "http_requests"}
+	c := newCollector(config, zap.NewNop())
+
+	rm := pmetric.NewResourceMetrics()
+	sm := rm.ScopeMetrics().AppendEmpty()
+	for _, name := range []string{"legacy_requests", "other_metric"} {
+		metric := sm.Metrics().AppendEmpty()
+		metric.SetName(name)
+		dp := metric.SetEmptyGauge().DataPoints().AppendEmpty()
+		dp.SetDoubleValue(1)
+		dp.SetTimestamp(pcommon.NewTimestampFromTime(time.Now()))
+	}
+
+	require.Equal(t, 2, c.processMetrics(rm))
+
+	names := collectMetricNames(t, c)
+	require.ElementsMatch(t, []string{"http_requests", "other_metric"}, names)
+
+	// Cleanup by name only knows the renamed metric
+	require.Equal(t, 0, c.CleanByMetricName("legacy_requests"))
+	require.Equal(t, 1, c.CleanByMetricName("http_requests"))
+	require.ElementsMatch(t, []string{"other_metric"}, collectMetricNames(t, c))
+}
+
+// collectMetricLabels runs a collection and returns the label set of every collected metric
+func collectMetricLabels(t *testing.T, c *collector) []map[string]string {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		c.Collect(ch)
+		close(ch)
+	}()
+
+	var labelSets []map[string]string
+	for m := range ch {
+		pbMetric := io_prometheus_client.Metric{}
+		require.NoError(t, m.Write(&pbMetric))
+		labels := make(map[string]string)
+		for _, label := range pbMetric.GetLabel() {
+			labels[label.GetName()] = label.GetValue()
+		}
+		labelSets = append(labelSets, labels)
+	}
+	return labelSets
+}
+
+func TestCollectNormalizeLabels(t *testing.T) {
+	config := createDefaultConfig().(*Config)
+	config.NormalizeLabels = true
+	config.LabelNameReplacements = map[string]string{"svc": "service_tier"}
+	c := newCollector(config, zap.NewNop())
+
+	rm := pmetric.NewResourceMetrics()
+	sm := rm.ScopeMetrics().AppendEmpty()
+
+	// Two SDKs reporting the same series with differently cased attribute names
+	for _, key := range []string{"Http.Method", "http.method"} {
+		metric := sm.Metrics().AppendEmpty()
+		metric.SetName("http_requests")
+		dp := metric.SetEmptyGauge().DataPoints().AppendEmpty()
+		dp.SetDoubleValue(1)
+		dp.SetTimestamp(pcommon.NewTimestampFromTime(time.Now()))
+		dp.Attributes().PutStr(key, "GET")
+		dp.Attributes().PutStr("Svc", "frontend")
+	}
+
+	// A single data point carrying both spellings keeps the canonical one
+	metric := sm.Metrics().AppendEmpty()
+	metric.SetName("http_errors")
+	dp := metric.SetEmptyGauge().DataPoints().AppendEmpty()
+	dp.SetDoubleValue(1)
+	dp.SetTimestamp(pcommon.NewTimestampFromTime(time.Now()))
+	dp.Attributes().PutStr("HTTP.METHOD", "POST")
+	dp.Attributes().PutStr("http.method", "GET")
+
+	c.processMetrics(rm)
+
+	require.ElementsMatch(t, []string{"http_requests", "http_errors"}, collectMetricNames(t, c))
+
+	replaced := 0
+	for _, labels := range collectMetricLabels(t, c) {
+		require.Equal(t, "GET", labels["http_method"])
+		require.NotContains(t, labels, "svc")
+		for name := range labels {
+			require.Equal(t, strings.ToLower(name), name, "label %q should be lowercased", name)
+		}
+		if labels["service_tier"] == "frontend" {
+			replaced++
+		}
+	}
+	require.Equal(t, 1, replaced)
+
+	// Cleanup filters are canonicalized the same way
+	require.Equal(t, 1, c.CleanByLabels(map[string]string{"SVC": "frontend"}))
+	require.ElementsMatch(t, []string{"http_errors"}, collectMetricNames(t, c))
+}
+
+func TestCollectScopeAttributes(t *testing.T) {
+	newScopeMetrics := func() pmetric.ResourceMetrics {
+		rm := pmetric.NewResourceMetrics()
+		sm := rm.ScopeMetrics().AppendEmpty()
+		sm.Scope().SetName("http-instrumentation")
+		sm.Scope().Attributes().PutStr("library.version", "1.4.2")
+		sm.Scope().Attributes().PutStr("build.id", "a1b2c3")
+
+		metric := sm.Metrics().AppendEmpty()
+		metric.SetName("http_requests")
+		dp := metric.SetEmptyGauge().DataPoints().AppendEmpty()
+		dp.SetDoubleValue(1)
+		dp.SetTimestamp(pcommon.NewTimestampFromTime(time.Now()))
+		return rm
+	}
+
+	tests := []struct {
+		name          string
+		include       bool
+		allowlist     []string
+		wantLabels    []string
+		notWantLabels []string
+	}{
+		{
+			name:       "AllIncluded",
+			include:    true,
+			wantLabels: []string{"otel_scope_library_version", "otel_scope_build_id"},
+		},
+		{
+			name:          "Allowlist",
+			include:       true,
+			allowlist:     []string{"library.version"},
+			wantLabels:    []string{"otel_scope_library_version"},
+			notWantLabels: []string{"otel_scope_build_id"},
+		},
+		{
+			name:          "Excluded",
+			include:       false,
+			notWantLabels: []string{"otel_scope_library_version", "otel_scope_build_id"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := createDefaultConfig().(*Config)
+			config.IncludeScopeAttributes = tt.include
+			config.ScopeAttributeAllowlist = tt.allowlist
+			require.NoError(t, config.Validate())
+			c := newCollector(config, zap.NewNop())
+
+			require.Equal(t, 1, c.processMetrics(newScopeMetrics()))
+
+			labelSets := collectMetricLabels(t, c)
+			require.Len(t, labelSets, 1)
+			require.Equal(t, "http-instrumentation", labelSets[0]["otel_scope_name"])
+			for _, label := range tt.wantLabels {
+				require.Contains(t, labelSets[0], label)
+			}
+			for _, label := range tt.notWantLabels {
+				require.NotContains(t, labelSets[0], label)
+			}
+		})
+	}
+}
+
+func TestCollectResourceAttributesOnlyOnTargetInfo(t *testing.T) {
+	c := newCollector(createDefaultConfig().(*Config), zap.NewNop())
+
+	rm := pmetric.NewResourceMetrics()
+	rm.Resource().Attributes().PutStr(string(conventions.ServiceNameKey), "checkout")
+	rm.Resource().Attributes().PutStr(string(conventions.ServiceInstanceIDKey), "checkout-1")
+	rm.Resource().Attributes().PutStr("k8s.namespace.name", "shop")
+	metric := rm.ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+	metric.SetName("http_requests")
+	dp := metric.SetEmptyGauge().DataPoints().AppendEmpty()
+	dp.SetDoubleValue(1)
+	dp.SetTimestamp(pcommon.NewTimestampFromTime(time.Now()))
+	dp.Attributes().PutStr("method", "GET")
+
+	require.Equal(t, 1, c.processMetrics(rm))
+
+	ch := make(chan prometheus.Metric)
+	go func() {
+		c.Collect(ch)
+		close(ch)
+	}()
+
+	labelsByName := make(map[string]map[string]string)
+	for m := range ch {
+		pbMetric := io_prometheus_client.Metric{}
+		require.NoError(t, m.Write(&pbMetric))
+		labels := make(map[string]string)
+		for _, label := range pbMetric.GetLabel() {
+			labels[label.GetName()] = label.GetValue()
+		}
+		name := "series"
+		if strings.Contains(m.Desc().String(), `fqName: "target_info"`) {
+			name = "target_info"
+		}
+		labelsByName[name] = labels
+	}
+
+	// Resource attributes are exposed once on target_info, joined to the series on job and instance
+	require.Contains(t, labelsByName, "target_info")
+	require.Equal(t, map[string]string{"job": "checkout", "instance": "checkout-1", "k8s_namespace_name": "shop"}, labelsByName["target_info"])
+
+	require.Contains(t, labelsByName, "series")
+	require.NotContains(t, labelsByName["series"], "k8s_namespace_name")
+	require.Equal(t, "GET", labelsByName["series"]["method"])
+	require.Equal(t, "checkout", labelsByName["series"]["job"])
+	require.Equal(t, "checkout-1", labelsByName["series"]["instance"])
+}
+
+func TestCollectMaxLabelValueLength(t *testing.T) {
+	config := createDefaultConfig().(*Config)
+	config.MaxLabelValueLength = 10
+	c := newCollector(config, zap.NewNop())
+
+	rm := pmetric.NewResourceMetrics()
+	metric := rm.ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+	metric.SetName("http_requests")
+	dp := metric.SetEmptyGauge().DataPoints().AppendEmpty()
+	dp.SetDoubleValue(1)
+	dp.SetTimestamp(pcommon.NewTimestampFromTime(time.Now()))
+	dp.Attributes().PutStr("http.target", "/api/v1/"+strings.Repeat("x", 1024))
+	dp.Attributes().PutStr("http.method", "GET")
+	dp.Attributes().PutStr("exact", "0123456789")
+	dp.Attributes().PutStr("unicode", "äöüäöüäöüäöü")
+
+	c.processMetrics(rm)
+
+	labelSets := collectMetricLabels(t, c)
+	require.Len(t, labelSets, 1)
+	labels := labelSets[0]
+
+	require.Equal(t, "/api/v1/xx...", labels["http_target"])
+	require.Equal(t, "äöüäöüäöüä...", labels["unicode"])
+	// Values within the limit are left untouched
+	require.Equal(t, "GET", labels["http_method"])
+	require.Equal(t, "0123456789", labels["exact"])
+}
+
+func TestCollectJobInstanceOverride(t *testing.T) {
+	config := createDefaultConfig().(*Config)
+	config.JobLabelOverride = LabelOverride{Value: "federated"}
+	config.InstanceLabelOverride = LabelOverride{FromResourceAttribute: "k8s.pod.name"}
+	require.NoError(t, config.Validate())
+	c := newCollector(config, zap.NewNop())
+
+	// Two pods reporting with the same service.instance.id
+	for _, pod := range []string{"checkout-abc", "checkout-def"} {
+		rm := pmetric.NewResourceMetrics()
+		rm.Resource().Attributes().PutStr(string(conventions.ServiceNameKey), "checkout")
+		rm.Resource().Attributes().PutStr(string(conventions.ServiceInstanceIDKey), "shared-id")
+		rm.Resource().Attributes().PutStr("k8s.pod.name", pod)
+		metric := rm.ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+		metric.SetName("http_requests")
+		dp := metric.SetEmptyGauge().DataPoints().AppendEmpty()
+		dp.SetDoubleValue(1)
+		dp.SetTimestamp(pcommon.NewTimestampFromTime(time.Now()))
+		c.processMetrics(rm)
+	}
+
+	var instances []string
+	for _, labels := range collectMetricLabels(t, c) {
+		require.Equal(t, "federated", labels[model.JobLabel])
+		instances = append(instances, labels[model.InstanceLabel])
+	}
+	// The override takes effect over service.name/service.instance.id on the series and target_info
+	require.ElementsMatch(t, []string{"checkout-abc", "checkout-def", "checkout-abc", "checkout-def"}, instances)
+
+	// Cleanup filters see the overridden labels
+	require.Equal(t, 1, c.CleanByLabels(map[string]string{model.InstanceLabel: "checkout-abc"}))
+
+	config.JobLabelOverride.FromResourceAttribute = "k8s.namespace.name"
+	require.Error(t, config.Validate())
+}
+
+// countingAccumulator counts the collections of the wrapped accumulator
+type countingAccumulator struct {
+	accumulator
+	collects atomic.Int32
+}
+
+func (a *countingAccumulator) Collect() ([]pmetric.Metric, []pcommon.Map, []string, []string, []string, []pcommon.Map) {
+	a.collects.Add(1)
+	return a.accumulator.Collect()
+}
+
+func TestCollectMinScrapeInterval(t *testing.T) {
+	config := createDefaultConfig().(*Config)
+	config.MinScrapeInterval = time.Hour
+	require.NoError(t, config.Validate())
+	c := newCollector(config, zap.NewNop())
+	acc := &countingAccumulator{accumulator: c.accumulator}
+	c.accumulator = acc
+
+	newResourceMetrics := func(value float64) pmetric.ResourceMetrics {
+		rm := pmetric.NewResourceMetrics()
+		metric := rm.ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+		metric.SetName("http_requests")
+		dp := metric.SetEmptyGauge().DataPoints().AppendEmpty()
+		dp.SetDoubleValue(value)
+		dp.SetTimestamp(pcommon.NewTimestampFromTime(time.Now()))
+		return rm
+	}
+
+	scrape := func() []*io_prometheus_client.Metric {
+		ch := make(chan prometheus.Metric)
+		go func() {
+			c.Collect(ch)
+			close(ch)
+		}()
+
+		var scraped []*io_prometheus_client.Metric
+		for m := range ch {
+			pbMetric := &io_prometheus_client.Metric{}
+			require.NoError(t, m.Write(pbMetric))
+			scraped = append(scraped, pbMetric)
+		}
+		return scraped
+	}
+
+	require.Equal(t, 1, c.processMetrics(newResourceMetrics(1)))
+
+	first := scrape()
+	require.Len(t, first, 1)
+	second := scrape()
+	require.Equal(t, first, second)
+	require.Equal(t, int32(1), acc.collects.Load())
+
+	// A new value invalidates the cached collection
+	require.Equal(t, 1, c.processMetrics(newResourceMetrics(2)))
+	third := scrape()
+	require.Len(t, third, 1)
+	require.Equal(t, 2.0, third[0].GetGauge().GetValue())
+	require.Equal(t, int32(2), acc.collects.Load())
+
+	// So does a cleanup that deleted series
+	require.Equal(t, 1, c.CleanAll())
+	require.Empty(t, scrape())
+	require.Equal(t, int32(3), acc.collects.Load())
+
+	config.MinScrapeInterval = -time.Second
+	require.Error(t, config.Validate())
+}
+
+func TestCollectMinScrapeIntervalStaleMarkers(t *testing.T) {
+	config := createDefaultConfig().(*Config)
+	config.MinScrapeInterval = time.Hour
+	config.EmitStaleMarkersOnCleanup = true
+	c := newCollector(config, zap.NewNop())
+
+	for _, queue := range []string{"orders", "refunds"} {
+		rm := pmetric.NewResourceMetrics()
+		metric := rm.ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+		metric.SetName("queue_depth")
+		dp := metric.SetEmptyGauge().DataPoints().AppendEmpty()
+		dp.Attributes().PutStr("queue", queue)
+		dp.SetDoubleValue(1)
+		dp.SetTimestamp(pcommon.NewTimestampFromTime(time.Now()))
+		require.Equal(t, 1, c.processMetrics(rm))
+	}
+
+	// scrape returns the scraped gauge values by queue label
+	scrape := func() map[string]float64 {
+		ch := make(chan prometheus.Metric, 10)
+		c.Collect(ch)
+		close(ch)
+
+		values := make(map[string]float64)
+		for m := range ch {
+			pbMetric := io_prometheus_client.Metric{}
+			require.NoError(t, m.Write(&pbMetric))
+			for _, label := range pbMetric.GetLabel() {
+				if label.GetName() == "queue" {
+					values[label.GetValue()] = pbMetric.GetGauge().GetValue()
+				}
+			}
+		}
+		return values
+	}
+
+	require.Equal(t, map[string]float64{"orders": 1, "refunds": 1}, scrape())
+	require.Equal(t, 1, c.CleanByLabels(map[string]string{"queue": "orders"}))
+
+	// The scrape after the cleanup gets the marker alongside the recomputed collection
+	values := scrape()
+	require.Len(t, values, 2)
+	require.Equal(t, 1.0, values["refunds"])
+	require.Equal(t, staleNaN, math.Float64bits(values["orders"]))
+
+	// The marker is not part of the cached collection served within min_scrape_interval
+	require.Equal(t, map[string]float64{"refunds": 1}, scrape())
+}
+
+func TestCollectHelpText(t *testing.T) {
+	config := createDefaultConfig().(*Config)
+	config.DefaultHelp = "Exported from OTLP"
+	c := newCollector(config, zap.NewNop())
+
+	for _, source := range []struct {
+		name        string
+		description string
+	}{
+		{"http_requests", "Number of HTTP requests"},
+		{"queue_depth", ""},
+	} {
+		rm := pmetric.NewResourceMetrics()
+		metric := rm.ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+		metric.SetName(source.name)
+		metric.SetDescription(source.description)
+		dp := metric.SetEmptyGauge().DataPoints().AppendEmpty()
+		dp.SetDoubleValue(1)
+		dp.SetTimestamp(pcommon.NewTimestampFromTime(time.Now()))
+		require.Equal(t, 1, c.processMetrics(rm))
+	}
+
+	registry := prometheus.NewRegistry()
+	require.NoError(t, registry.Register(c))
+	families, err := registry.Gather()
+	require.NoError(t, err)
+
+	var exposition bytes.Buffer
+	for _, family := range families {
+		_, err = expfmt.MetricFamilyToText(&exposition, family)
+		require.NoError(t, err)
+	}
+
+	// The OTLP description is the help text, the default only applies to metrics without one
+	require.Contains(t, exposition.String(), "# HELP http_requests Number of HTTP requests\n")
+	require.Contains(t, exposition.String(), "# HELP queue_depth Exported from OTLP\n")
+}
+
+func TestCollectSendTimestampsBackfill(t *testing.T) {
+	config := createDefaultConfig().(*Config)
+	config.SendTimestamps = true
+	config.EmitStaleMarkersOnCleanup = true
+	c := newCollector(config, zap.NewNop())
+
+	// A backfilled data point, an hour older than the scrape
+	sourceTime := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+	rm := pmetric.NewResourceMetrics()
+	metric := rm.ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+	metric.SetName("http_requests")
+	dp := metric.SetEmptyGauge().DataPoints().AppendEmpty()
+	dp.SetDoubleValue(5)
+	dp.SetTimestamp(pcommon.NewTimestampFromTime(sourceTime))
+	require.Equal(t, 1, c.processMetrics(rm))
+
+	scrape := func() []*io_prometheus_client.Metric {
+		ch := make(chan prometheus.Metric, 10)
+		c.Collect(ch)
+		close(ch)
+
+		var scraped []*io_prometheus_client.Metric
+		for m := range ch {
+			pbMetric := &io_prometheus_client.Metric{}
+			require.NoError(t, m.Write(pbMetric))
+			if pbMetric.Gauge != nil {
+				scraped = append(scraped, pbMetric)
+			}
+		}
+		return scraped
+	}
+
+	// The sample carries the source timestamp rather than the scrape time
+	scraped := scrape()
+	require.Len(t, scraped, 1)
+	require.Equal(t, 5.0, scraped[0].GetGauge().GetValue())
+	require.Equal(t, sourceTime.UnixMilli(), scraped[0].GetTimestampMs())
+
+	// A stale marker carries the time of the cleanup, since Prometheus drops a sample older than the
+	// last one of its series
+	require.Equal(t, 1, c.CleanAll())
+	scraped = scrape()
+	require.Len(t, scraped, 1)
+	require.True(t, math.IsNaN(scraped[0].GetGauge().GetValue()))
+	require.Greater(t, scraped[0].GetTimestampMs(), sourceTime.UnixMilli())
+}
@@ -4,6 +4,9 @@
 package prometheusexporter // import "github.com/open-telemetry/opentelemetry-collector-contrib/exporter/prometheusexporter"
 
 import (
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -23,12 +26,18 @@ type Config struct {
 	// ConstLabels are values that are applied for every exported metric.
 	ConstLabels prometheus.Labels `mapstructure:"const_labels"`
 
-	// SendTimestamps will send the underlying scrape timestamp with the export
+	// SendTimestamps exposes every sample with the timestamp of its accumulated data point instead of
+	// letting Prometheus use the scrape time, e.g. to keep the original timestamps of backfilled data.
 	SendTimestamps bool `mapstructure:"send_timestamps"`
 
 	// MetricExpiration defines how long metrics are kept without updates
 	MetricExpiration time.Duration `mapstructure:"metric_expiration"`
 
+	// ExpirationGracePeriod keeps expired series in memory for this long before they are deleted.
+	// During the grace period the series is stale: it is not exported, but an update resumes it
+	// with its accumulated state. Zero deletes series as soon as they expire.
+	ExpirationGracePeriod time.Duration `mapstructure:"expiration_grace_period"`
+
 	// ResourceToTelemetrySettings defines configuration for converting resource attributes to metric labels.
 	ResourceToTelemetrySettings resourcetotelemetry.Settings `mapstructure:"resource_to_telemetry_conversion"`
 
@@ -38,15 +47,206 @@ type Config struct {
 	// AddMetricSuffixes controls whether suffixes are added to metric names. Defaults to true.
 	AddMetricSuffixes bool `mapstructure:"add_metric_suffixes"`
 
+	// DefaultHelp is the help text of metrics without a description. The description of a metric,
+	// when it has one, is always used as its help text.
+	DefaultHelp string `mapstructure:"default_help"`
+
 	// ========== ENHANCEMENT: Cleanup API Configuration ==========
 	// EnableCleanupAPI controls whether the cleanup API endpoints are exposed. Defaults to false for security.
 	EnableCleanupAPI bool `mapstructure:"enable_cleanup_api"`
+	// AllowInsecureCleanup allows the cleanup API to be enabled without tls, serving it over plaintext HTTP.
+	AllowInsecureCleanup bool `mapstructure:"allow_insecure_cleanup"`
+	// CleanupMaxBodyBytes limits the size of a cleanup request body. Larger requests are rejected with 413.
+	CleanupMaxBodyBytes int64 `mapstructure:"cleanup_max_body_bytes"`
+	// CleanupRequestTimeout bounds how long a single cleanup request may take, including reading its body.
+	CleanupRequestTimeout time.Duration `mapstructure:"cleanup_request_timeout"`
+	// EmitStaleMarkersOnCleanup exposes the gauges and sums deleted by a cleanup once more with a NaN
+	// value on the next scrape, so that alerts on them stop firing right away.
+	EmitStaleMarkersOnCleanup bool `mapstructure:"emit_stale_markers_on_cleanup"`
+	// ScheduledCleanups run cleanup requests periodically in the background, independently of EnableCleanupAPI.
+	ScheduledCleanups []ScheduledCleanup `mapstructure:"scheduled_cleanups"`
 	// =============================================================
+
+	// EnableWebUI controls whether the Web UI and its JSON endpoints under /api/metrics/ are exposed.
+	// Defaults to true.
+	EnableWebUI bool `mapstructure:"enable_web_ui"`
+
+	// EnableDebugAPI controls whether the read-only debug endpoints, such as /debug/config, are exposed.
+	// Defaults to false, since they reveal how the exporter is configured.
+	EnableDebugAPI bool `mapstructure:"enable_debug_api"`
+
+	// MetricDenylist lists OTLP metric names that are never accumulated or exported.
+	// Entries containing regex characters are treated as anchored regular expressions.
+	MetricDenylist []string `mapstructure:"metric_denylist"`
+
+	// MetricRenames maps OTLP metric names to the names they are exposed under.
+	// Renames are applied before accumulation, so cleanup and the Web UI see the new name.
+	MetricRenames map[string]string `mapstructure:"metric_renames"`
+
+	// NormalizeLabels lowercases resource and data point attribute names before they become labels,
+	// so attributes that only differ by case (e.g. Http.Method and http.method) collapse into one label.
+	NormalizeLabels bool `mapstructure:"normalize_labels"`
+
+	// LabelNameReplacements maps attribute names to the label names they are exposed under.
+	// Keys are matched after lowercasing when NormalizeLabels is enabled.
+	LabelNameReplacements map[string]string `mapstructure:"label_name_replacements"`
+
+	// MaxLabelValueLength truncates resource and data point attribute values longer than this many
+	// characters before they become label values. Zero means unlimited.
+	MaxLabelValueLength int `mapstructure:"max_label_value_length"`
+
+	// IncludeScopeAttributes exposes the instrumentation scope attributes as otel_scope_<name> labels.
+	// Defaults to true.
+	IncludeScopeAttributes bool `mapstructure:"include_scope_attributes"`
+
+	// ScopeAttributeAllowlist restricts the scope attributes exposed with IncludeScopeAttributes to these
+	// names. Empty exposes every scope attribute.
+	ScopeAttributeAllowlist []string `mapstructure:"scope_attribute_allowlist"`
+
+	// MaxSeries caps the number of series kept in memory. When it is exceeded, the least recently
+	// updated series are evicted until 10% below it. Zero means unlimited.
+	MaxSeries int `mapstructure:"max_series"`
+
+	// AllowedOrigins lists the browser origins allowed to call the cleanup and JSON endpoints
+	// cross-origin. "*" allows every origin. Empty disables CORS.
+	AllowedOrigins []string `mapstructure:"allowed_origins"`
+
+	// AggregationMarkerAttributes are the resource attributes marking the outputs of the metrics aggregator
+	// processor, i.e. its output_resource_attributes. The Web UI uses them to tell aggregated series apart
+	// from the original ones.
+	AggregationMarkerAttributes map[string]string `mapstructure:"aggregation_marker_attributes"`
+
+	// MinScrapeInterval serves the previous collection again to scrapes arriving within this interval of it,
+	// instead of converting every series again, as long as no series was accumulated or cleaned since.
+	// Zero recomputes the collection on every scrape.
+	MinScrapeInterval time.Duration `mapstructure:"min_scrape_interval"`
+
+	// MaxHeaderBytes limits the size of the request headers read by the server, including the
+	// request line. Zero uses the net/http default (1 MB).
+	MaxHeaderBytes int `mapstructure:"max_header_bytes"`
+
+	// DisableKeepAlives closes the connection after every response. Keep-alives are enabled by default.
+	DisableKeepAlives bool `mapstructure:"disable_keep_alives"`
+
+	// JobLabelOverride sets the job label from a resource attribute or a static value instead of
+	// service.namespace/service.name.
+	JobLabelOverride LabelOverride `mapstructure:"job_label_override"`
+
+	// InstanceLabelOverride sets the instance label from a resource attribute or a static value
+	// instead of service.instance.id.
+	InstanceLabelOverride LabelOverride `mapstructure:"instance_label_override"`
+
+	// BuildInfo exposes a collector_build_info gauge with value 1 and the configured version and commit
+	// as labels. The gauge is only exposed when at least one of them is set.
+	BuildInfo BuildInfo `mapstructure:"build_info"`
+
+	// EmitCollectDuration exposes a prometheusexporter_collect_duration_seconds histogram of the time
+	// taken to collect the accumulated series on each scrape.
+	EmitCollectDuration bool `mapstructure:"emit_collect_duration"`
+}
+
+// BuildInfo is the version information the exporter reports about the collector running it.
+type BuildInfo struct {
+	// Version is the value of the version label.
+	Version string `mapstructure:"version"`
+	// Commit is the value of the commit label.
+	Commit string `mapstructure:"commit"`
+}
+
+// LabelOverride sets a label from a resource attribute or a static value.
+// When the resource attribute is missing, the default mapping applies.
+type LabelOverride struct {
+	// FromResourceAttribute is the resource attribute the label value is read from.
+	FromResourceAttribute string `mapstructure:"from_resource_attribute"`
+	// Value is a static label value.
+	Value string `mapstructure:"value"`
 }
 
 var _ component.Config = (*Config)(nil)
 
 // Validate checks if the exporter configuration is valid
 func (cfg *Config) Validate() error {
+	if cfg.CleanupMaxBodyBytes < 0 {
+		return fmt.Errorf("cleanup_max_body_bytes cannot be negative, got %d", cfg.CleanupMaxBodyBytes)
+	}
+
+	if cfg.ExpirationGracePeriod < 0 {
+		return fmt.Errorf("expiration_grace_period cannot be negative, got %s", cfg.ExpirationGracePeriod)
+	}
+
+	if cfg.MaxLabelValueLength < 0 {
+		return fmt.Errorf("max_label_value_length cannot be negative, got %d", cfg.MaxLabelValueLength)
+	}
+
+	if cfg.MaxSeries < 0 {
+		return fmt.Errorf("max_series cannot be negative, got %d", cfg.MaxSeries)
+	}
+
+	if cfg.MinScrapeInterval < 0 {
+		return fmt.Errorf("min_scrape_interval cannot be negative, got %s", cfg.MinScrapeInterval)
+	}
+
+	if cfg.MaxHeaderBytes < 0 {
+		return fmt.Errorf("max_header_bytes cannot be negative, got %d", cfg.MaxHeaderBytes)
+	}
+
+	for i, origin := range cfg.AllowedOrigins {
+		if strings.TrimSpace(origin) == "" {
+			return fmt.Errorf("allowed_origins[%d] cannot be empty", i)
+		}
+	}
+
+	if cfg.EnableCleanupAPI && cfg.TLS == nil && !cfg.AllowInsecureCleanup {
+		return errors.New("enable_cleanup_api requires tls to be configured, set allow_insecure_cleanup to serve the cleanup API over plaintext")
+	}
+
+	for key := range cfg.AggregationMarkerAttributes {
+		if key == "" {
+			return errors.New("aggregation_marker_attributes cannot have an empty name")
+		}
+	}
+
+	if cfg.CleanupRequestTimeout < 0 {
+		return fmt.Errorf("cleanup_request_timeout cannot be negative, got %s", cfg.CleanupRequestTimeout)
+	}
+
+	for i, schedule := range cfg.ScheduledCleanups {
+		if schedule.Interval <= 0 {
+			return fmt.Errorf("scheduled_cleanups[%d]: interval must be positive, got %s", i, schedule.Interval)
+		}
+		if err := validateCleanupRequest(schedule.Request); err != nil {
+			return fmt.Errorf("scheduled_cleanups[%d]: %w", i, err)
+		}
+	}
+
+	for name, override := range map[string]LabelOverride{
+		"job_label_override":      cfg.JobLabelOverride,
+		"instance_label_override": cfg.InstanceLabelOverride,
+	} {
+		if override.FromResourceAttribute != "" && override.Value != "" {
+			return fmt.Errorf("%s: from_resource_attribute and value cannot both be set", name)
+		}
+	}
+
+	if _, err := newMetricNameFilter(cfg.MetricDenylist); err != nil {
+		return fmt.Errorf("metric_denylist: %w", err)
+	}
+
+	for oldName, newName := range cfg.MetricRenames {
+		if newName == "" {
+			return fmt.Errorf("metric_renames: new name for metric '%s' cannot be empty", oldName)
+		}
+	}
+
+	if !cfg.IncludeScopeAttributes && len(cfg.ScopeAttributeAllowlist) > 0 {
+		return errors.New("scope_attribute_allowlist requires include_scope_attributes")
+	}
+
+	for oldName, newName := range cfg.LabelNameReplacements {
+		if newName == "" {
+			return fmt.Errorf("label_name_replacements: new name for label '%s' cannot be empty", oldName)
+		}
+	}
+
 	return nil
 }
@@ -54,6 +54,12 @@ func TestLoadConfig(t *testing.T) {
 				SendTimestamps:    true,
 				MetricExpiration:  60 * time.Minute,
 				AddMetricSuffixes: false,
+
+				IncludeScopeAttributes: true,
+				EnableWebUI:            true,
+
+				CleanupMaxBodyBytes:   defaultCleanupMaxBodyBytes,
+				CleanupRequestTimeout: defaultCleanupRequestTimeout,
 			},
 		},
 	}
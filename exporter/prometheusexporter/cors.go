@@ -0,0 +1,65 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package prometheusexporter // import "github.com/open-telemetry/opentelemetry-collector-contrib/exporter/prometheusexporter"
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+const (
+	// corsAllowedMethods are the methods browsers may use on the cleanup and JSON endpoints
+	corsAllowedMethods = "GET, POST, OPTIONS"
+	// corsAllowedHeaders are the request headers browsers may send on the cleanup and JSON endpoints
+	corsAllowedHeaders = "Content-Type, " + requestIDHeader
+	// corsMaxAge is how long (in seconds) browsers may cache a preflight response
+	corsMaxAge = "600"
+)
+
+// withCORS wraps a handler so that requests from the allowed origins get CORS headers and
+// preflight requests are answered. An allowed origin of "*" allows every origin.
+// Without allowed origins the handler is returned unchanged.
+func withCORS(allowedOrigins []string, next http.HandlerFunc) http.HandlerFunc {
+	if len(allowedOrigins) == 0 {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" || !isOriginAllowed(allowedOrigins, origin) {
+			next(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Origin")
+		if slices.Contains(allowedOrigins, "*") {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+		w.Header().Set("Access-Control-Expose-Headers", requestIDHeader)
+
+		// Answer preflight requests without calling the handler
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", corsAllowedMethods)
+			w.Header().Set("Access-Control-Allow-Headers", corsAllowedHeaders)
+			w.Header().Set("Access-Control-Max-Age", corsMaxAge)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// isOriginAllowed reports whether the origin is in the allowed origins, ignoring case
+func isOriginAllowed(allowedOrigins []string, origin string) bool {
+	for _, allowed := range allowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
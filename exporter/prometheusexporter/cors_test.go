@@ -0,0 +1,79 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package prometheusexporter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/exporter/exportertest"
+	"go.uber.org/zap"
+)
+
+func TestCORS(t *testing.T) {
+	config := createDefaultConfig().(*Config)
+	config.ServerConfig.Endpoint = "localhost:0"
+	config.EnableCleanupAPI = true
+
+	exporter, err := newPrometheusExporter(config, exportertest.NewNopSettings(component.MustNewType("prometheus")))
+	require.NoError(t, err)
+
+	cleanupAPI := NewCleanupAPI(exporter, zap.NewNop())
+	handler := withCORS([]string{"https://admin.example.com"}, cleanupAPI.CleanupHandler)
+
+	t.Run("Preflight", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodOptions, "/cleanup", nil)
+		req.Header.Set("Origin", "https://admin.example.com")
+		req.Header.Set("Access-Control-Request-Method", "POST")
+		req.Header.Set("Access-Control-Request-Headers", "Content-Type")
+		w := httptest.NewRecorder()
+
+		handler(w, req)
+
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Equal(t, "https://admin.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+		assert.Contains(t, w.Header().Get("Access-Control-Allow-Methods"), "POST")
+		assert.Contains(t, w.Header().Get("Access-Control-Allow-Headers"), "Content-Type")
+	})
+
+	t.Run("AllowedOrigin", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/cleanup", strings.NewReader(`{"type":"expired"}`))
+		req.Header.Set("Origin", "https://admin.example.com")
+		w := httptest.NewRecorder()
+
+		handler(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "https://admin.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, requestIDHeader, w.Header().Get("Access-Control-Expose-Headers"))
+	})
+
+	t.Run("DisallowedOrigin", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodOptions, "/cleanup", nil)
+		req.Header.Set("Origin", "https://evil.example.com")
+		req.Header.Set("Access-Control-Request-Method", "POST")
+		w := httptest.NewRecorder()
+
+		handler(w, req)
+
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/cleanup", strings.NewReader(`{"type":"expired"}`))
+		req.Header.Set("Origin", "https://admin.example.com")
+		w := httptest.NewRecorder()
+
+		withCORS(nil, cleanupAPI.CleanupHandler)(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+	})
+}
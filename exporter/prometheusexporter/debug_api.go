@@ -0,0 +1,122 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package prometheusexporter // import "github.com/open-telemetry/opentelemetry-collector-contrib/exporter/prometheusexporter"
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/collector/confmap"
+	"go.uber.org/zap"
+)
+
+// DebugAPI provides read-only HTTP endpoints for inspecting the running exporter
+type DebugAPI struct {
+	exporter *prometheusExporter
+	logger   *zap.Logger
+}
+
+// NewDebugAPI creates a new debug API instance
+func NewDebugAPI(exporter *prometheusExporter, logger *zap.Logger) *DebugAPI {
+	return &DebugAPI{
+		exporter: exporter,
+		logger:   logger,
+	}
+}
+
+// ConfigHandler returns the effective exporter configuration as JSON.
+// The config is marshaled the same way the collector marshals component configs,
+// so keys match the YAML configuration and opaque values (secrets) are redacted.
+func (api *DebugAPI) ConfigHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	effectiveConfig, err := api.effectiveConfig()
+	if err != nil {
+		api.logger.Error("Failed to marshal effective config", zap.Error(err))
+		http.Error(w, fmt.Sprintf("Failed to marshal config: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"component": api.exporter.name,
+		"config":    effectiveConfig,
+		"timestamp": time.Now().UTC().Format(time.RFC3339),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// effectiveConfig converts the exporter config into a string map keyed by the mapstructure tags
+func (api *DebugAPI) effectiveConfig() (map[string]any, error) {
+	conf := confmap.New()
+	if err := conf.Marshal(&api.exporter.config); err != nil {
+		return nil, err
+	}
+
+	effectiveConfig := conf.ToStringMap()
+	formatDurations(reflect.ValueOf(api.exporter.config), effectiveConfig)
+
+	return effectiveConfig, nil
+}
+
+// durationType is the type of the config fields formatDurations renders as strings
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// formatDurations replaces the durations of a marshaled config struct, which are nanoseconds in conf, by
+// their string form (e.g. "5m0s"), the way they are configured. It follows the mapstructure tags into
+// squashed and nested structs and slices of structs, such as the intervals of scheduled_cleanups.
+func formatDurations(value reflect.Value, conf map[string]any) {
+	for value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return
+	}
+
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, options, _ := strings.Cut(field.Tag.Get("mapstructure"), ",")
+		if strings.Contains(options, "squash") {
+			formatDurations(value.Field(i), conf)
+			continue
+		}
+		entry, ok := conf[name]
+		if name == "" || !ok {
+			continue
+		}
+
+		switch nested := entry.(type) {
+		case map[string]any:
+			formatDurations(value.Field(i), nested)
+		case []any:
+			if value.Field(i).Kind() != reflect.Slice {
+				continue
+			}
+			for j := 0; j < len(nested) && j < value.Field(i).Len(); j++ {
+				if element, ok := nested[j].(map[string]any); ok {
+					formatDurations(value.Field(i).Index(j), element)
+				}
+			}
+		default:
+			if field.Type == durationType {
+				conf[name] = time.Duration(value.Field(i).Int()).String()
+			}
+		}
+	}
+}
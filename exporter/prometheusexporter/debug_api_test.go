@@ -0,0 +1,87 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package prometheusexporter
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/config/configopaque"
+	"go.opentelemetry.io/collector/exporter/exportertest"
+	"go.uber.org/zap"
+)
+
+func TestDebugAPIConfigHandler(t *testing.T) {
+	config := createDefaultConfig().(*Config)
+	config.ServerConfig.Endpoint = "localhost:0"
+	config.ServerConfig.ResponseHeaders = map[string]configopaque.String{
+		"X-Api-Token": "super-secret-token",
+	}
+	config.Namespace = "debug"
+	config.EnableCleanupAPI = true
+	config.ExpirationGracePeriod = 90 * time.Second
+	config.MinScrapeInterval = 500 * time.Millisecond
+	config.ScheduledCleanups = []ScheduledCleanup{
+		{Interval: time.Hour, Request: CleanupRequest{Type: "expired"}},
+		{Interval: 10 * time.Minute, Request: CleanupRequest{Type: "name", Pattern: "^temp_"}},
+	}
+	config.ServerConfig.ReadHeaderTimeout = 15 * time.Second
+
+	exporter, err := newPrometheusExporter(config, exportertest.NewNopSettings(component.MustNewType("prometheus")))
+	require.NoError(t, err)
+
+	debugAPI := NewDebugAPI(exporter, zap.NewNop())
+
+	t.Run("ConfigHandler", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/debug/config", nil)
+		w := httptest.NewRecorder()
+
+		debugAPI.ConfigHandler(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+		assert.NotContains(t, w.Body.String(), "super-secret-token")
+
+		var response map[string]interface{}
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		require.NoError(t, err)
+
+		effectiveConfig, ok := response["config"].(map[string]interface{})
+		require.True(t, ok)
+		assert.Equal(t, "localhost:0", effectiveConfig["endpoint"])
+		assert.Equal(t, "debug", effectiveConfig["namespace"])
+		assert.Equal(t, true, effectiveConfig["enable_cleanup_api"])
+		assert.Equal(t, "5m0s", effectiveConfig["metric_expiration"])
+		assert.Equal(t, "1m30s", effectiveConfig["expiration_grace_period"])
+		assert.Equal(t, "500ms", effectiveConfig["min_scrape_interval"])
+		assert.Equal(t, "30s", effectiveConfig["cleanup_request_timeout"])
+		assert.Equal(t, "15s", effectiveConfig["read_header_timeout"])
+
+		scheduledCleanups, ok := effectiveConfig["scheduled_cleanups"].([]interface{})
+		require.True(t, ok)
+		require.Len(t, scheduledCleanups, 2)
+		assert.Equal(t, "1h0m0s", scheduledCleanups[0].(map[string]interface{})["interval"])
+		assert.Equal(t, "10m0s", scheduledCleanups[1].(map[string]interface{})["interval"])
+		assert.Equal(t, "^temp_", scheduledCleanups[1].(map[string]interface{})["request"].(map[string]interface{})["pattern"])
+
+		headers, ok := effectiveConfig["response_headers"].(map[string]interface{})
+		require.True(t, ok)
+		assert.Equal(t, "[REDACTED]", headers["X-Api-Token"])
+	})
+
+	t.Run("ConfigHandler_InvalidMethod", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/debug/config", nil)
+		w := httptest.NewRecorder()
+
+		debugAPI.ConfigHandler(w, req)
+
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	})
+}
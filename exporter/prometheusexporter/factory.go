@@ -32,6 +32,13 @@ func createDefaultConfig() component.Config {
 		EnableOpenMetrics: false,
 		AddMetricSuffixes: true,
 		EnableCleanupAPI:  false,
+
+		IncludeScopeAttributes: true,
+		EnableWebUI:            true,
+		EnableDebugAPI:         false,
+
+		CleanupMaxBodyBytes:   defaultCleanupMaxBodyBytes,
+		CleanupRequestTimeout: defaultCleanupRequestTimeout,
 	}
 }
 
@@ -88,4 +95,9 @@ func (w *wrapMetricsExporter) CleanExpired() int {
 	return w.exporter.CleanExpired()
 }
 
+// CleanAll removes all metrics
+func (w *wrapMetricsExporter) CleanAll() int {
+	return w.exporter.CleanAll()
+}
+
 // ========================================================================
@@ -0,0 +1,168 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package prometheusexporter // import "github.com/open-telemetry/opentelemetry-collector-contrib/exporter/prometheusexporter"
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+)
+
+// truncatedValueSuffix marks label values that were cut to the maximum length
+const truncatedValueSuffix = "..."
+
+// labelNormalizer canonicalizes attribute names and bounds attribute values before they become Prometheus labels
+type labelNormalizer struct {
+	lowercase      bool
+	replacements   map[string]string
+	maxValueLength int
+}
+
+// newLabelNormalizer returns a normalizer for the given settings, or nil when there is nothing to normalize
+func newLabelNormalizer(lowercase bool, replacements map[string]string, maxValueLength int) *labelNormalizer {
+	if !lowercase && len(replacements) == 0 && maxValueLength <= 0 {
+		return nil
+	}
+
+	return &labelNormalizer{
+		lowercase:      lowercase,
+		replacements:   replacements,
+		maxValueLength: maxValueLength,
+	}
+}
+
+// canonicalName returns the name a label is exposed under.
+// Names are lowercased first (if enabled), then looked up in the replacements.
+func (n *labelNormalizer) canonicalName(name string) string {
+	if n == nil {
+		return name
+	}
+
+	if n.lowercase {
+		name = strings.ToLower(name)
+	}
+	if replacement, ok := n.replacements[name]; ok {
+		return replacement
+	}
+	return name
+}
+
+// normalizeResourceMetrics rewrites the resource and data point attribute names of rm in place
+func (n *labelNormalizer) normalizeResourceMetrics(rm pmetric.ResourceMetrics) {
+	if n == nil {
+		return
+	}
+
+	n.normalizeAttributes(rm.Resource().Attributes())
+	for i := 0; i < rm.ScopeMetrics().Len(); i++ {
+		metrics := rm.ScopeMetrics().At(i).Metrics()
+		for j := 0; j < metrics.Len(); j++ {
+			n.normalizeMetric(metrics.At(j))
+		}
+	}
+}
+
+func (n *labelNormalizer) normalizeMetric(metric pmetric.Metric) {
+	switch metric.Type() {
+	case pmetric.MetricTypeGauge:
+		dps := metric.Gauge().DataPoints()
+		for i := 0; i < dps.Len(); i++ {
+			n.normalizeAttributes(dps.At(i).Attributes())
+		}
+	case pmetric.MetricTypeSum:
+		dps := metric.Sum().DataPoints()
+		for i := 0; i < dps.Len(); i++ {
+			n.normalizeAttributes(dps.At(i).Attributes())
+		}
+	case pmetric.MetricTypeHistogram:
+		dps := metric.Histogram().DataPoints()
+		for i := 0; i < dps.Len(); i++ {
+			n.normalizeAttributes(dps.At(i).Attributes())
+		}
+	case pmetric.MetricTypeExponentialHistogram:
+		dps := metric.ExponentialHistogram().DataPoints()
+		for i := 0; i < dps.Len(); i++ {
+			n.normalizeAttributes(dps.At(i).Attributes())
+		}
+	case pmetric.MetricTypeSummary:
+		dps := metric.Summary().DataPoints()
+		for i := 0; i < dps.Len(); i++ {
+			n.normalizeAttributes(dps.At(i).Attributes())
+		}
+	}
+}
+
+// normalizeAttributes renames the attributes to their canonical names and truncates long values
+func (n *labelNormalizer) normalizeAttributes(attrs pcommon.Map) {
+	n.canonicalizeNames(attrs)
+	n.truncateValues(attrs)
+}
+
+// canonicalizeNames renames the attributes to their canonical names.
+// When several attributes collapse into the same name, the one that already has the
+// canonical name wins; otherwise the first one in attribute order is kept.
+func (n *labelNormalizer) canonicalizeNames(attrs pcommon.Map) {
+	if !n.lowercase && len(n.replacements) == 0 {
+		return
+	}
+
+	changed := false
+	for k := range attrs.All() {
+		if n.canonicalName(k) != k {
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		return
+	}
+
+	normalized := pcommon.NewMap()
+	normalized.EnsureCapacity(attrs.Len())
+	for k, v := range attrs.All() {
+		if n.canonicalName(k) == k {
+			v.CopyTo(normalized.PutEmpty(k))
+		}
+	}
+	for k, v := range attrs.All() {
+		name := n.canonicalName(k)
+		if name == k {
+			continue
+		}
+		if _, exists := normalized.Get(name); !exists {
+			v.CopyTo(normalized.PutEmpty(name))
+		}
+	}
+
+	normalized.MoveTo(attrs)
+}
+
+// truncateValues cuts string values longer than the maximum length (in characters) and appends a marker
+func (n *labelNormalizer) truncateValues(attrs pcommon.Map) {
+	if n.maxValueLength <= 0 {
+		return
+	}
+
+	for _, v := range attrs.All() {
+		if v.Type() != pcommon.ValueTypeStr {
+			continue
+		}
+		if truncated, ok := truncateLabelValue(v.Str(), n.maxValueLength); ok {
+			v.SetStr(truncated)
+		}
+	}
+}
+
+// truncateLabelValue shortens value to maxLength characters plus the truncation marker.
+// It reports whether the value had to be truncated.
+func truncateLabelValue(value string, maxLength int) (string, bool) {
+	if utf8.RuneCountInString(value) <= maxLength {
+		return value, false
+	}
+
+	runes := []rune(value)
+	return string(runes[:maxLength]) + truncatedValueSuffix, true
+}
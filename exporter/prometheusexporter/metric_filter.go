@@ -0,0 +1,65 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package prometheusexporter // import "github.com/open-telemetry/opentelemetry-collector-contrib/exporter/prometheusexporter"
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// metricNameFilter matches OTLP metric names against a list of exact names and regular expressions
+type metricNameFilter struct {
+	names    map[string]struct{}
+	patterns []*regexp.Regexp
+}
+
+// newMetricNameFilter builds a filter from a list of entries.
+// Entries containing regex characters are compiled as anchored regular expressions,
+// all other entries are matched exactly.
+func newMetricNameFilter(entries []string) (*metricNameFilter, error) {
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	filter := &metricNameFilter{
+		names: make(map[string]struct{}),
+	}
+	for _, entry := range entries {
+		if !isRegexPattern(entry) {
+			filter.names[entry] = struct{}{}
+			continue
+		}
+
+		regex, err := regexp.Compile("^(?:" + entry + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex pattern '%s': %w", entry, err)
+		}
+		filter.patterns = append(filter.patterns, regex)
+	}
+
+	return filter, nil
+}
+
+// matches reports whether the metric name is matched by the filter. A nil filter matches nothing.
+func (f *metricNameFilter) matches(name string) bool {
+	if f == nil {
+		return false
+	}
+
+	if _, ok := f.names[name]; ok {
+		return true
+	}
+	for _, regex := range f.patterns {
+		if regex.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// isRegexPattern reports whether a pattern contains regex characters
+func isRegexPattern(pattern string) bool {
+	return strings.ContainsAny(pattern, ".*+?^${}()[]|\\")
+}
@@ -0,0 +1,208 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package prometheusexporter // import "github.com/open-telemetry/opentelemetry-collector-contrib/exporter/prometheusexporter"
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"go.uber.org/zap"
+)
+
+// jsonFlushInterval is the number of series written between flushes of a streamed JSON response
+const jsonFlushInterval = 500
+
+// JSONMetric is a single series as exposed on /metrics, in the format returned by /metrics.json
+type JSONMetric struct {
+	Name   string            `json:"name"`
+	Type   string            `json:"type"`
+	Help   string            `json:"help"`
+	Labels map[string]string `json:"labels"`
+	// Value is the sample value for counters and gauges, and the sum for histograms and summaries
+	Value     jsonFloat            `json:"value"`
+	Count     uint64               `json:"count,omitempty"`
+	Buckets   map[string]uint64    `json:"buckets,omitempty"`   // cumulative count per upper bound, histograms only
+	Quantiles map[string]jsonFloat `json:"quantiles,omitempty"` // summaries only
+}
+
+// jsonFloat is a sample value that encodes NaN and ±Inf as the strings "NaN", "+Inf" and "-Inf", the way the
+// Prometheus text format writes them, since JSON numbers cannot represent them
+type jsonFloat float64
+
+// MarshalJSON implements json.Marshaler
+func (f jsonFloat) MarshalJSON() ([]byte, error) {
+	value := float64(f)
+	switch {
+	case math.IsNaN(value):
+		return []byte(`"NaN"`), nil
+	case math.IsInf(value, 1):
+		return []byte(`"+Inf"`), nil
+	case math.IsInf(value, -1):
+		return []byte(`"-Inf"`), nil
+	}
+	return json.Marshal(value)
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (f *jsonFloat) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		var value float64
+		if err := json.Unmarshal(data, &value); err != nil {
+			return err
+		}
+		*f = jsonFloat(value)
+		return nil
+	}
+	value, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return err
+	}
+	*f = jsonFloat(value)
+	return nil
+}
+
+// newMetricsJSONHandler returns a handler exposing the same series as the /metrics handler as JSON, without
+// the stale markers. The accumulated series are converted and written one at a time, then the exporter's own
+// metrics gathered from the gatherer, so memory does not grow with the number of series.
+func newMetricsJSONHandler(c *collector, gatherer prometheus.Gatherer, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// Like the /metrics handler, expose what could be gathered even if some metrics failed
+		families, err := gatherer.Gather()
+		if err != nil {
+			logger.Warn("Error gathering metrics for JSON output", zap.Error(err))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		out := newJSONArrayWriter(w)
+		err = c.forEachSeries(func(name string, help string, m prometheus.Metric) error {
+			var pbMetric dto.Metric
+			if err := m.Write(&pbMetric); err != nil {
+				logger.Warn("Error writing metric for JSON output", zap.String("metric_name", name), zap.Error(err))
+				return nil
+			}
+			return out.write(newJSONMetric(name, help, &pbMetric))
+		})
+		for _, family := range families {
+			for _, m := range family.GetMetric() {
+				if err != nil {
+					break
+				}
+				err = out.write(newJSONMetric(family.GetName(), family.GetHelp(), m))
+			}
+		}
+		if err == nil {
+			err = out.close()
+		}
+		if err != nil {
+			logger.Debug("Error writing metrics JSON output", zap.Error(err))
+		}
+	}
+}
+
+// jsonArrayWriter streams a JSON array one element at a time, flushing the output regularly
+type jsonArrayWriter struct {
+	w       io.Writer
+	flusher http.Flusher
+	encoder *json.Encoder
+	written int
+}
+
+// newJSONArrayWriter starts a JSON array on w
+func newJSONArrayWriter(w io.Writer) *jsonArrayWriter {
+	flusher, _ := w.(http.Flusher)
+	return &jsonArrayWriter{
+		w:       w,
+		flusher: flusher,
+		encoder: json.NewEncoder(w),
+	}
+}
+
+// write appends an element to the array
+func (a *jsonArrayWriter) write(v any) error {
+	separator := "["
+	if a.written > 0 {
+		separator = ","
+	}
+	if _, err := io.WriteString(a.w, separator); err != nil {
+		return err
+	}
+	if err := a.encoder.Encode(v); err != nil {
+		return err
+	}
+	a.written++
+	if a.flusher != nil && a.written%jsonFlushInterval == 0 {
+		a.flusher.Flush()
+	}
+	return nil
+}
+
+// close ends the array
+func (a *jsonArrayWriter) close() error {
+	if a.written == 0 {
+		_, err := io.WriteString(a.w, "[]\n")
+		return err
+	}
+	_, err := io.WriteString(a.w, "]\n")
+	return err
+}
+
+// newJSONMetric converts an exposed series into its JSON representation
+func newJSONMetric(name string, help string, m *dto.Metric) JSONMetric {
+	jsonMetric := JSONMetric{
+		Name:   name,
+		Help:   help,
+		Labels: make(map[string]string, len(m.GetLabel())),
+	}
+	for _, label := range m.GetLabel() {
+		jsonMetric.Labels[label.GetName()] = label.GetValue()
+	}
+
+	var metricType dto.MetricType
+	switch {
+	case m.Counter != nil:
+		metricType = dto.MetricType_COUNTER
+		jsonMetric.Value = jsonFloat(m.GetCounter().GetValue())
+	case m.Gauge != nil:
+		metricType = dto.MetricType_GAUGE
+		jsonMetric.Value = jsonFloat(m.GetGauge().GetValue())
+	case m.Untyped != nil:
+		metricType = dto.MetricType_UNTYPED
+		jsonMetric.Value = jsonFloat(m.GetUntyped().GetValue())
+	case m.Histogram != nil:
+		metricType = dto.MetricType_HISTOGRAM
+		histogram := m.GetHistogram()
+		jsonMetric.Value = jsonFloat(histogram.GetSampleSum())
+		jsonMetric.Count = histogram.GetSampleCount()
+		jsonMetric.Buckets = make(map[string]uint64, len(histogram.GetBucket()))
+		for _, bucket := range histogram.GetBucket() {
+			jsonMetric.Buckets[strconv.FormatFloat(bucket.GetUpperBound(), 'g', -1, 64)] = bucket.GetCumulativeCount()
+		}
+	case m.Summary != nil:
+		metricType = dto.MetricType_SUMMARY
+		summary := m.GetSummary()
+		jsonMetric.Value = jsonFloat(summary.GetSampleSum())
+		jsonMetric.Count = summary.GetSampleCount()
+		jsonMetric.Quantiles = make(map[string]jsonFloat, len(summary.GetQuantile()))
+		for _, quantile := range summary.GetQuantile() {
+			jsonMetric.Quantiles[strconv.FormatFloat(quantile.GetQuantile(), 'g', -1, 64)] = jsonFloat(quantile.GetValue())
+		}
+	}
+	jsonMetric.Type = strings.ToLower(metricType.String())
+
+	return jsonMetric
+}
@@ -0,0 +1,168 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package prometheusexporter
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/exporter/exportertest"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.uber.org/zap"
+)
+
+func TestMetricsJSONHandler(t *testing.T) {
+	config := createDefaultConfig().(*Config)
+	config.ServerConfig.Endpoint = "localhost:0"
+
+	exporter, err := newPrometheusExporter(config, exportertest.NewNopSettings(component.MustNewType("prometheus")))
+	require.NoError(t, err)
+
+	md := pmetric.NewMetrics()
+	rm := md.ResourceMetrics().AppendEmpty()
+	rm.Resource().Attributes().PutStr("service.name", "checkout")
+	rm.Resource().Attributes().PutStr("service.instance.id", "checkout-1")
+	metric := rm.ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+	metric.SetName("cpu_temperature")
+	metric.SetDescription("CPU temperature")
+	dp := metric.SetEmptyGauge().DataPoints().AppendEmpty()
+	dp.Attributes().PutStr("core", "0")
+	dp.SetDoubleValue(42.5)
+	dp.SetTimestamp(pcommon.NewTimestampFromTime(time.Now()))
+	require.NoError(t, exporter.ConsumeMetrics(context.Background(), md))
+
+	handler := newMetricsJSONHandler(exporter.collector, exporter.selfRegistry, zap.NewNop())
+
+	t.Run("SameSeriesAsMetrics", func(t *testing.T) {
+		textRecorder := httptest.NewRecorder()
+		exporter.handler.ServeHTTP(textRecorder, httptest.NewRequest("GET", "/metrics", nil))
+		require.Equal(t, http.StatusOK, textRecorder.Code)
+
+		var textLine string
+		for _, line := range strings.Split(textRecorder.Body.String(), "\n") {
+			if strings.HasPrefix(line, "cpu_temperature{") {
+				textLine = line
+			}
+		}
+		require.NotEmpty(t, textLine, "cpu_temperature should be exposed on /metrics")
+
+		jsonRecorder := httptest.NewRecorder()
+		handler(jsonRecorder, httptest.NewRequest("GET", "/metrics.json", nil))
+		require.Equal(t, http.StatusOK, jsonRecorder.Code)
+		assert.Equal(t, "application/json", jsonRecorder.Header().Get("Content-Type"))
+
+		var metrics []JSONMetric
+		require.NoError(t, json.Unmarshal(jsonRecorder.Body.Bytes(), &metrics))
+
+		var found *JSONMetric
+		for i := range metrics {
+			if metrics[i].Name == "cpu_temperature" {
+				found = &metrics[i]
+			}
+		}
+		require.NotNil(t, found, "cpu_temperature should be exposed on /metrics.json")
+
+		assert.Equal(t, "gauge", found.Type)
+		assert.Equal(t, "CPU temperature", found.Help)
+		assert.Equal(t, 42.5, float64(found.Value))
+		assert.Equal(t, "0", found.Labels["core"])
+		assert.True(t, strings.HasSuffix(textLine, " 42.5"), "unexpected /metrics line %q", textLine)
+		for name, value := range found.Labels {
+			assert.Contains(t, textLine, name+`="`+value+`"`)
+		}
+	})
+
+	t.Run("InvalidMethod", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("POST", "/metrics.json", nil))
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	})
+}
+
+func TestMetricsJSONHandlerStreaming(t *testing.T) {
+	config := createDefaultConfig().(*Config)
+	config.ServerConfig.Endpoint = "localhost:0"
+
+	exporter, err := newPrometheusExporter(config, exportertest.NewNopSettings(component.MustNewType("prometheus")))
+	require.NoError(t, err)
+
+	const seriesCount = 2000
+	md := pmetric.NewMetrics()
+	metric := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+	metric.SetName("queue_depth")
+	gauge := metric.SetEmptyGauge()
+	for i := 0; i < seriesCount; i++ {
+		dp := gauge.DataPoints().AppendEmpty()
+		dp.Attributes().PutInt("queue", int64(i))
+		dp.SetIntValue(int64(i))
+		dp.SetTimestamp(pcommon.NewTimestampFromTime(time.Now()))
+	}
+	require.NoError(t, exporter.ConsumeMetrics(context.Background(), md))
+
+	w := httptest.NewRecorder()
+	newMetricsJSONHandler(exporter.collector, exporter.selfRegistry, zap.NewNop())(w, httptest.NewRequest("GET", "/metrics.json", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, w.Flushed, "large responses should be flushed while streaming")
+	require.True(t, json.Valid(w.Body.Bytes()), "streamed output should be valid JSON")
+
+	var metrics []JSONMetric
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &metrics))
+	queues := 0
+	for _, metric := range metrics {
+		if metric.Name == "queue_depth" {
+			queues++
+		}
+	}
+	assert.Equal(t, seriesCount, queues)
+
+	// Streaming neither deletes nor changes the accumulated series
+	assert.Equal(t, int64(seriesCount), exporter.collector.accumulator.(*lastValueAccumulator).seriesCount.Load())
+
+	// An empty exporter still returns an array
+	w = httptest.NewRecorder()
+	newMetricsJSONHandler(newCollector(config, zap.NewNop()), prometheus.NewRegistry(), zap.NewNop())(w, httptest.NewRequest("GET", "/metrics.json", nil))
+	assert.JSONEq(t, "[]", w.Body.String())
+}
+
+func TestMetricsJSONHandlerNonFiniteValues(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "temperature"}, []string{"sensor"})
+	registry.MustRegister(gauge)
+	gauge.WithLabelValues("stale").Set(math.NaN())
+	gauge.WithLabelValues("hot").Set(math.Inf(1))
+	gauge.WithLabelValues("cold").Set(math.Inf(-1))
+	gauge.WithLabelValues("ok").Set(21.5)
+
+	w := httptest.NewRecorder()
+	newMetricsJSONHandler(newCollector(createDefaultConfig().(*Config), zap.NewNop()), registry, zap.NewNop())(w, httptest.NewRequest("GET", "/metrics.json", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.True(t, json.Valid(w.Body.Bytes()), "non-finite values should not break the JSON output: %s", w.Body.String())
+
+	var raw []map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &raw))
+	values := make(map[string]any)
+	for _, metric := range raw {
+		values[metric["labels"].(map[string]any)["sensor"].(string)] = metric["value"]
+	}
+	assert.Equal(t, map[string]any{"stale": "NaN", "hot": "+Inf", "cold": "-Inf", "ok": 21.5}, values)
+
+	var metrics []JSONMetric
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &metrics))
+	for _, metric := range metrics {
+		if metric.Labels["sensor"] == "stale" {
+			assert.True(t, math.IsNaN(float64(metric.Value)))
+		}
+	}
+}
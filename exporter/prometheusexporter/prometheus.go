@@ -8,6 +8,7 @@ import (
 	"errors"
 	"net/http"
 	"strings"
+	"sync"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -25,11 +26,23 @@ type prometheusExporter struct {
 	handler      http.Handler
 	collector    *collector
 	registry     *prometheus.Registry
+	// selfRegistry holds the exporter's own metrics, also registered in registry. /metrics.json gathers them
+	// from it and streams the accumulated series from the collector.
+	selfRegistry *prometheus.Registry
 	settings     component.TelemetrySettings
+
+	// cleanupAuditLog records the cleanups run through the cleanup API and the scheduled ones
+	cleanupAuditLog *cleanupAuditLog
+
+	cancelScheduledCleanups context.CancelFunc
+	scheduledCleanupsWG     sync.WaitGroup
 }
 
 var errBlankPrometheusAddress = errors.New("expecting a non-blank address to run the Prometheus metrics handler")
 
+// buildInfoMetricName is the name of the gauge reporting the configured build info
+const buildInfoMetricName = "collector_build_info"
+
 func newPrometheusExporter(config *Config, set exporter.Settings) (*prometheusExporter, error) {
 	addr := strings.TrimSpace(config.Endpoint)
 	if strings.TrimSpace(config.Endpoint) == "" {
@@ -39,12 +52,25 @@ func newPrometheusExporter(config *Config, set exporter.Settings) (*prometheusEx
 	collector := newCollector(config, set.Logger)
 	registry := prometheus.NewRegistry()
 	_ = registry.Register(collector)
+	selfRegistry := prometheus.NewRegistry()
+	for _, r := range []*prometheus.Registry{registry, selfRegistry} {
+		if buildInfo := newBuildInfoGauge(config.BuildInfo); buildInfo != nil {
+			_ = r.Register(buildInfo)
+		}
+		if collector.collectDuration != nil {
+			_ = r.Register(collector.collectDuration)
+		}
+		if collector.evictedSeries != nil {
+			_ = r.Register(collector.evictedSeries)
+		}
+	}
 	return &prometheusExporter{
 		config:       *config,
 		name:         set.ID.String(),
 		endpoint:     addr,
 		collector:    collector,
 		registry:     registry,
+		selfRegistry: selfRegistry,
 		shutdownFunc: func(_ context.Context) error { return nil },
 		handler: promhttp.HandlerFor(
 			registry,
@@ -52,12 +78,32 @@ func newPrometheusExporter(config *Config, set exporter.Settings) (*prometheusEx
 				ErrorHandling:     promhttp.ContinueOnError,
 				ErrorLog:          newPromLogger(set.Logger),
 				EnableOpenMetrics: config.EnableOpenMetrics,
+				// Expose start timestamps of counters, histograms and summaries as _created series
+				EnableOpenMetricsTextCreatedSamples: config.EnableOpenMetrics,
 			},
 		),
-		settings: set.TelemetrySettings,
+		settings:        set.TelemetrySettings,
+		cleanupAuditLog: newCleanupAuditLog(defaultCleanupAuditLogSize),
 	}, nil
 }
 
+// newBuildInfoGauge returns a gauge always set to 1 and labeled with the build info,
+// or nil when no build info is configured
+func newBuildInfoGauge(info BuildInfo) prometheus.Collector {
+	if info.Version == "" && info.Commit == "" {
+		return nil
+	}
+
+	return prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: buildInfoMetricName,
+		Help: "A metric with a constant '1' value labeled by the version and commit of the collector.",
+		ConstLabels: prometheus.Labels{
+			"version": info.Version,
+			"commit":  info.Commit,
+		},
+	}, func() float64 { return 1 })
+}
+
 func (pe *prometheusExporter) Start(ctx context.Context, host component.Host) error {
 	ln, err := pe.config.ToListener(ctx)
 	if err != nil {
@@ -66,6 +112,7 @@ func (pe *prometheusExporter) Start(ctx context.Context, host component.Host) er
 
 	mux := http.NewServeMux()
 	mux.Handle("/metrics", pe.handler)
+	mux.HandleFunc("/metrics.json", withCORS(pe.config.AllowedOrigins, newMetricsJSONHandler(pe.collector, pe.selfRegistry, pe.settings.Logger)))
 
 	// ========== ENHANCEMENT: Cleanup API Endpoints ==========
 	// Register cleanup API endpoints only if enabled in configuration
@@ -73,25 +120,46 @@ func (pe *prometheusExporter) Start(ctx context.Context, host component.Host) er
 		cleanupAPI := NewCleanupAPI(pe, pe.settings.Logger)
 		// HandleFunc is used instead of Handle because our cleanup handlers are functions,
 		// not types implementing http.Handler interface. HandleFunc converts function to Handler.
-		mux.HandleFunc("/cleanup", cleanupAPI.CleanupHandler)
-		mux.HandleFunc("/cleanup/status", cleanupAPI.StatusHandler)
-		mux.HandleFunc("/cleanup/metrics", cleanupAPI.MetricsHandler)
+		mux.HandleFunc("/cleanup", withCORS(pe.config.AllowedOrigins, cleanupAPI.CleanupHandler))
+		mux.HandleFunc("/cleanup/status", withCORS(pe.config.AllowedOrigins, cleanupAPI.StatusHandler))
+		mux.HandleFunc("/cleanup/metrics", withCORS(pe.config.AllowedOrigins, cleanupAPI.MetricsHandler))
+		mux.HandleFunc("/cleanup/audit", withCORS(pe.config.AllowedOrigins, cleanupAPI.AuditHandler))
+		mux.HandleFunc("/api/collect", withCORS(pe.config.AllowedOrigins, cleanupAPI.CollectHandler))
 		pe.settings.Logger.Info("Cleanup API endpoints enabled",
-			zap.String("endpoints", "/cleanup, /cleanup/status, /cleanup/metrics"))
+			zap.String("endpoints", "/cleanup, /cleanup/status, /cleanup/metrics, /cleanup/audit, /api/collect"))
+		if pe.config.TLS == nil {
+			pe.settings.Logger.Warn("Cleanup API is served over plaintext HTTP, configure tls to protect it")
+		}
 	}
 	// =========================================================
 
+	// ========== ENHANCEMENT: Debug Endpoints ==========
+	// Register read-only debug endpoints for inspecting the running exporter only if enabled in configuration
+	if pe.config.EnableDebugAPI {
+		debugAPI := NewDebugAPI(pe, pe.settings.Logger)
+		mux.HandleFunc("/debug/config", debugAPI.ConfigHandler)
+		pe.settings.Logger.Info("Debug endpoints enabled",
+			zap.String("endpoints", "/debug/config"))
+	}
+	// ==================================================
+
 	// ========== ENHANCEMENT: Web UI Endpoints ==========
-	// Register web UI endpoints
-	webUI := NewWebUI(pe.settings.Logger)
-	mux.HandleFunc("/", webUI.IndexHandler)
-	mux.HandleFunc("/ui", webUI.IndexHandler)
-	mux.HandleFunc("/static/", webUI.StaticHandler)
-	pe.settings.Logger.Info("Web UI endpoints enabled",
-		zap.String("endpoints", "/, /ui, /static/"))
+	// Register web UI endpoints only if enabled in configuration
+	if pe.config.EnableWebUI {
+		webUI := NewWebUI(pe, pe.settings.Logger)
+		mux.HandleFunc("/", webUI.IndexHandler)
+		mux.HandleFunc("/ui", webUI.IndexHandler)
+		mux.HandleFunc("/static/", webUI.StaticHandler)
+		mux.HandleFunc("/api/metrics/by-service", withCORS(pe.config.AllowedOrigins, webUI.MetricsByServiceHandler))
+		mux.HandleFunc("/api/metrics/search", withCORS(pe.config.AllowedOrigins, webUI.SearchHandler))
+		mux.HandleFunc("/api/metrics/cardinality", withCORS(pe.config.AllowedOrigins, webUI.CardinalityHandler))
+		mux.HandleFunc("/api/metrics/detail", withCORS(pe.config.AllowedOrigins, webUI.DetailHandler))
+		pe.settings.Logger.Info("Web UI endpoints enabled",
+			zap.String("endpoints", "/, /ui, /static/, /api/metrics/by-service, /api/metrics/search, /api/metrics/cardinality, /api/metrics/detail"))
+	}
 	// ===================================================
 
-	srv, err := pe.config.ToServer(ctx, host, pe.settings, mux)
+	srv, err := pe.newServer(ctx, host, mux)
 	if err != nil {
 		lnerr := ln.Close()
 		return errors.Join(err, lnerr)
@@ -103,9 +171,29 @@ func (pe *prometheusExporter) Start(ctx context.Context, host component.Host) er
 		_ = srv.Serve(ln)
 	}()
 
+	pe.startScheduledCleanups()
+
 	return nil
 }
 
+// newServer builds the HTTP server serving the metrics, cleanup and UI endpoints.
+// The read, read header, write and idle timeouts come from the embedded ServerConfig.
+func (pe *prometheusExporter) newServer(ctx context.Context, host component.Host, handler http.Handler) (*http.Server, error) {
+	srv, err := pe.config.ToServer(ctx, host, pe.settings, handler)
+	if err != nil {
+		return nil, err
+	}
+
+	if pe.config.MaxHeaderBytes > 0 {
+		srv.MaxHeaderBytes = pe.config.MaxHeaderBytes
+	}
+	if pe.config.DisableKeepAlives {
+		srv.SetKeepAlivesEnabled(false)
+	}
+
+	return srv, nil
+}
+
 func (pe *prometheusExporter) ConsumeMetrics(_ context.Context, md pmetric.Metrics) error {
 	n := 0
 	rmetrics := md.ResourceMetrics()
@@ -117,6 +205,7 @@ func (pe *prometheusExporter) ConsumeMetrics(_ context.Context, md pmetric.Metri
 }
 
 func (pe *prometheusExporter) Shutdown(ctx context.Context) error {
+	pe.stopScheduledCleanups()
 	return pe.shutdownFunc(ctx)
 }
 
@@ -137,4 +226,9 @@ func (pe *prometheusExporter) CleanExpired() int {
 	return pe.collector.CleanExpired()
 }
 
+// CleanAll removes all metrics
+func (pe *prometheusExporter) CleanAll() int {
+	return pe.collector.CleanAll()
+}
+
 // ================================================================
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"regexp"
 	"testing"
 	"time"
 
@@ -385,6 +386,57 @@ func TestPrometheusExporter_endToEndWithTimestamps(t *testing.T) {
 	require.Emptyf(t, string(blob), "Metrics did not expire")
 }
 
+func TestPrometheusExporter_endToEndWithOpenMetricsCreated(t *testing.T) {
+	addr := testutil.GetAvailableLocalAddress(t)
+	cfg := &Config{
+		Namespace: "test",
+		ServerConfig: confighttp.ServerConfig{
+			Endpoint: addr,
+		},
+		MetricExpiration:  120 * time.Minute,
+		EnableOpenMetrics: true,
+	}
+
+	factory := NewFactory()
+	set := exportertest.NewNopSettings(metadata.Type)
+	exp, err := factory.CreateMetrics(context.Background(), set, cfg)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		require.NoError(t, exp.Shutdown(context.Background()))
+	})
+
+	require.NoError(t, exp.Start(context.Background(), componenttest.NewNopHost()))
+	require.NoError(t, exp.ConsumeMetrics(context.Background(), metricBuilder(128, "metric_1_", "cpu-exporter", "localhost:8080")))
+
+	req, err := http.NewRequest(http.MethodGet, "http://"+addr+"/metrics", nil)
+	require.NoError(t, err)
+	req.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err, "Failed to perform a scrape")
+
+	assert.Equal(t, http.StatusOK, res.StatusCode, "Mismatched HTTP response status code")
+	blob, _ := io.ReadAll(res.Body)
+	_ = res.Body.Close()
+
+	// The _created sample carries the start timestamp of the accumulated cumulative sum
+	want := []*regexp.Regexp{
+		regexp.MustCompile(`test_metric_1_this_one_there_where_created\{[^}]*os="windows"[^}]*\} 1\.543160426`),
+		regexp.MustCompile(`test_metric_1_this_one_there_where_created\{[^}]*os="linux"[^}]*\} 1\.543160298`),
+	}
+	for _, w := range want {
+		assert.Regexp(t, w, string(blob), "Missing %v from response:\n%v", w, string(blob))
+	}
+
+	// The classic text format has no _created series
+	res, err = http.Get("http://" + addr + "/metrics")
+	require.NoError(t, err, "Failed to perform a scrape")
+	blob, _ = io.ReadAll(res.Body)
+	_ = res.Body.Close()
+	assert.NotContains(t, string(blob), "_created")
+}
+
 func TestPrometheusExporter_endToEndWithResource(t *testing.T) {
 	addr := testutil.GetAvailableLocalAddress(t)
 	cfg := &Config{
@@ -479,3 +531,251 @@ func metricBuilder(delta int64, prefix, job, instance string) pmetric.Metrics {
 
 	return md
 }
+
+func TestPrometheusExporter_ServerTuning(t *testing.T) {
+	cfg := createDefaultConfig().(*Config)
+	cfg.Endpoint = testutil.GetAvailableLocalAddress(t)
+	cfg.ReadTimeout = 5 * time.Second
+	cfg.ReadHeaderTimeout = 2 * time.Second
+	cfg.WriteTimeout = 10 * time.Second
+	cfg.IdleTimeout = 2 * time.Minute
+	cfg.MaxHeaderBytes = 16 * 1024
+	cfg.DisableKeepAlives = true
+	require.NoError(t, cfg.Validate())
+
+	exp, err := newPrometheusExporter(cfg, exportertest.NewNopSettings(metadata.Type))
+	require.NoError(t, err)
+
+	srv, err := exp.newServer(context.Background(), componenttest.NewNopHost(), http.NewServeMux())
+	require.NoError(t, err)
+
+	assert.Equal(t, 5*time.Second, srv.ReadTimeout)
+	assert.Equal(t, 2*time.Second, srv.ReadHeaderTimeout)
+	assert.Equal(t, 10*time.Second, srv.WriteTimeout)
+	assert.Equal(t, 2*time.Minute, srv.IdleTimeout)
+	assert.Equal(t, 16*1024, srv.MaxHeaderBytes)
+
+	cfg.MaxHeaderBytes = -1
+	assert.Error(t, cfg.Validate())
+}
+
+func TestPrometheusExporter_DisableWebUI(t *testing.T) {
+	// get starts an exporter with the given Web UI setting and returns the status code of each path
+	get := func(t *testing.T, enableWebUI bool, paths ...string) map[string]int {
+		addr := testutil.GetAvailableLocalAddress(t)
+		cfg := createDefaultConfig().(*Config)
+		cfg.ServerConfig.Endpoint = addr
+		cfg.EnableWebUI = enableWebUI
+
+		exp, err := NewFactory().CreateMetrics(context.Background(), exportertest.NewNopSettings(metadata.Type), cfg)
+		require.NoError(t, err)
+		require.NoError(t, exp.Start(context.Background(), componenttest.NewNopHost()))
+		t.Cleanup(func() {
+			require.NoError(t, exp.Shutdown(context.Background()))
+		})
+
+		codes := make(map[string]int, len(paths))
+		for _, path := range paths {
+			res, err := http.Get("http://" + addr + path)
+			require.NoError(t, err)
+			_ = res.Body.Close()
+			codes[path] = res.StatusCode
+		}
+		return codes
+	}
+
+	paths := []string{"/", "/ui", "/static/app.js", "/api/metrics/search?regex=.", "/metrics"}
+
+	assert.Equal(t, map[string]int{
+		"/":                           http.StatusOK,
+		"/ui":                         http.StatusOK,
+		"/static/app.js":              http.StatusOK,
+		"/api/metrics/search?regex=.": http.StatusOK,
+		"/metrics":                    http.StatusOK,
+	}, get(t, true, paths...))
+
+	assert.Equal(t, map[string]int{
+		"/":                           http.StatusNotFound,
+		"/ui":                         http.StatusNotFound,
+		"/static/app.js":              http.StatusNotFound,
+		"/api/metrics/search?regex=.": http.StatusNotFound,
+		"/metrics":                    http.StatusOK,
+	}, get(t, false, paths...))
+}
+
+func TestPrometheusExporter_BuildInfo(t *testing.T) {
+	// scrape starts an exporter with the given build info and returns its /metrics page
+	scrape := func(t *testing.T, buildInfo BuildInfo) string {
+		addr := testutil.GetAvailableLocalAddress(t)
+		cfg := createDefaultConfig().(*Config)
+		cfg.ServerConfig.Endpoint = addr
+		cfg.BuildInfo = buildInfo
+
+		exp, err := NewFactory().CreateMetrics(context.Background(), exportertest.NewNopSettings(metadata.Type), cfg)
+		require.NoError(t, err)
+		require.NoError(t, exp.Start(context.Background(), componenttest.NewNopHost()))
+		t.Cleanup(func() {
+			require.NoError(t, exp.Shutdown(context.Background()))
+		})
+
+		res, err := http.Get("http://" + addr + "/metrics")
+		require.NoError(t, err)
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		require.NoError(t, res.Body.Close())
+		return string(body)
+	}
+
+	body := scrape(t, BuildInfo{Version: "1.2.3", Commit: "abc123"})
+	assert.Contains(t, body, "# TYPE collector_build_info gauge")
+	assert.Contains(t, body, `collector_build_info{commit="abc123",version="1.2.3"} 1`)
+
+	assert.NotContains(t, scrape(t, BuildInfo{}), "collector_build_info")
+}
+
+func TestPrometheusExporter_EnableDebugAPI(t *testing.T) {
+	// get starts an exporter with the given debug API setting and returns the status code of /debug/config
+	get := func(t *testing.T, enableDebugAPI bool) int {
+		addr := testutil.GetAvailableLocalAddress(t)
+		cfg := createDefaultConfig().(*Config)
+		cfg.ServerConfig.Endpoint = addr
+		cfg.EnableDebugAPI = enableDebugAPI
+		// The Web UI index is served on every path not registered otherwise
+		cfg.EnableWebUI = false
+
+		exp, err := NewFactory().CreateMetrics(context.Background(), exportertest.NewNopSettings(metadata.Type), cfg)
+		require.NoError(t, err)
+		require.NoError(t, exp.Start(context.Background(), componenttest.NewNopHost()))
+		t.Cleanup(func() {
+			require.NoError(t, exp.Shutdown(context.Background()))
+		})
+
+		res, err := http.Get("http://" + addr + "/debug/config")
+		require.NoError(t, err)
+		_ = res.Body.Close()
+		return res.StatusCode
+	}
+
+	assert.Equal(t, http.StatusNotFound, get(t, false))
+	assert.Equal(t, http.StatusOK, get(t, true))
+}
+
+func TestPrometheusExporter_CollectDuration(t *testing.T) {
+	// collectDurationCount gathers the registry and returns the sample count of the collect duration
+	// histogram, or false when it is not registered
+	collectDurationCount := func(t *testing.T, pe *prometheusExporter) (uint64, bool) {
+		families, err := pe.registry.Gather()
+		require.NoError(t, err)
+		for _, family := range families {
+			if family.GetName() == collectDurationMetricName {
+				require.Len(t, family.GetMetric(), 1)
+				return family.GetMetric()[0].GetHistogram().GetSampleCount(), true
+			}
+		}
+		return 0, false
+	}
+
+	cfg := createDefaultConfig().(*Config)
+	cfg.ServerConfig.Endpoint = testutil.GetAvailableLocalAddress(t)
+	cfg.EmitCollectDuration = true
+	pe, err := newPrometheusExporter(cfg, exportertest.NewNopSettings(metadata.Type))
+	require.NoError(t, err)
+
+	_, ok := collectDurationCount(t, pe)
+	require.True(t, ok)
+
+	// The histogram may be gathered before the collection it runs alongside, but the previous one is recorded
+	count, ok := collectDurationCount(t, pe)
+	require.True(t, ok)
+	assert.GreaterOrEqual(t, count, uint64(1))
+
+	cfg.EmitCollectDuration = false
+	pe, err = newPrometheusExporter(cfg, exportertest.NewNopSettings(metadata.Type))
+	require.NoError(t, err)
+	_, ok = collectDurationCount(t, pe)
+	assert.False(t, ok)
+}
+
+func TestPrometheusExporter_EvictedSeries(t *testing.T) {
+	// evictedSeries gathers the registry and returns the value of the evicted series counter, or false
+	// when it is not registered
+	evictedSeries := func(t *testing.T, pe *prometheusExporter) (float64, bool) {
+		families, err := pe.registry.Gather()
+		require.NoError(t, err)
+		for _, family := range families {
+			if family.GetName() == evictedSeriesMetricName {
+				require.Len(t, family.GetMetric(), 1)
+				return family.GetMetric()[0].GetCounter().GetValue(), true
+			}
+		}
+		return 0, false
+	}
+
+	cfg := createDefaultConfig().(*Config)
+	cfg.ServerConfig.Endpoint = testutil.GetAvailableLocalAddress(t)
+	cfg.MaxSeries = 2
+	pe, err := newPrometheusExporter(cfg, exportertest.NewNopSettings(metadata.Type))
+	require.NoError(t, err)
+
+	md := pmetric.NewMetrics()
+	metric := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+	metric.SetName("queue_depth")
+	gauge := metric.SetEmptyGauge()
+	for i := 0; i < 3; i++ {
+		dp := gauge.DataPoints().AppendEmpty()
+		dp.Attributes().PutInt("queue", int64(i))
+		dp.SetIntValue(int64(i))
+		dp.SetTimestamp(pcommon.NewTimestampFromTime(time.Now()))
+	}
+	require.NoError(t, pe.ConsumeMetrics(context.Background(), md))
+
+	value, ok := evictedSeries(t, pe)
+	require.True(t, ok)
+	assert.Equal(t, 1.0, value)
+
+	cfg.MaxSeries = 0
+	pe, err = newPrometheusExporter(cfg, exportertest.NewNopSettings(metadata.Type))
+	require.NoError(t, err)
+	_, ok = evictedSeries(t, pe)
+	assert.False(t, ok)
+}
+
+func TestPrometheusExporter_StaleMarkersAfterJSONRequest(t *testing.T) {
+	addr := testutil.GetAvailableLocalAddress(t)
+	cfg := createDefaultConfig().(*Config)
+	cfg.ServerConfig.Endpoint = addr
+	cfg.EmitStaleMarkersOnCleanup = true
+	pe, err := newPrometheusExporter(cfg, exportertest.NewNopSettings(metadata.Type))
+	require.NoError(t, err)
+	require.NoError(t, pe.Start(context.Background(), componenttest.NewNopHost()))
+	t.Cleanup(func() {
+		require.NoError(t, pe.Shutdown(context.Background()))
+	})
+
+	get := func(t *testing.T, path string) string {
+		res, err := http.Get("http://" + addr + path)
+		require.NoError(t, err)
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		require.NoError(t, res.Body.Close())
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		return string(body)
+	}
+
+	md := pmetric.NewMetrics()
+	metric := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+	metric.SetName("queue_depth")
+	dp := metric.SetEmptyGauge().DataPoints().AppendEmpty()
+	dp.Attributes().PutStr("queue", "orders")
+	dp.SetDoubleValue(3)
+	dp.SetTimestamp(pcommon.NewTimestampFromTime(time.Now()))
+	require.NoError(t, pe.ConsumeMetrics(context.Background(), md))
+	require.Equal(t, 1, pe.CleanAll())
+
+	// A JSON request between the cleanup and the scrape neither shows nor takes the marker
+	assert.NotContains(t, get(t, "/metrics.json"), "queue_depth")
+
+	marker := regexp.MustCompile(`(?m)^queue_depth\{[^}]*queue="orders"[^}]*\} NaN$`)
+	assert.Regexp(t, marker, get(t, "/metrics"))
+	assert.NotContains(t, get(t, "/metrics"), "queue_depth")
+}
@@ -0,0 +1,145 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package prometheusexporter // import "github.com/open-telemetry/opentelemetry-collector-contrib/exporter/prometheusexporter"
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	conventions "go.opentelemetry.io/otel/semconv/v1.25.0"
+	"go.uber.org/zap"
+)
+
+// ScheduledCleanup runs a cleanup request periodically, without going through the cleanup API.
+type ScheduledCleanup struct {
+	// Interval is the time between two runs of the cleanup.
+	Interval time.Duration `mapstructure:"interval"`
+	// Request is the cleanup to run. It takes the same fields as a cleanup API request body.
+	Request CleanupRequest `mapstructure:"request"`
+}
+
+// scheduledCleanupRequestIDPrefix starts the request IDs generated for the scheduled cleanups, so their
+// log lines and audit log entries are told apart from the cleanup API requests
+const scheduledCleanupRequestIDPrefix = "scheduled-"
+
+// validateCleanupRequest checks that req has a supported type and the fields that type requires
+func validateCleanupRequest(req CleanupRequest) error {
+	switch req.Type {
+	case "labels":
+		if len(req.Filters) == 0 {
+			return errors.New("filters are required for label-based cleanup")
+		}
+		if !req.MatchEmpty {
+			for key, value := range req.Filters {
+				if value == "" {
+					return fmt.Errorf("filter '%s' has an empty value, set match_empty to target series where the label is present but empty", key)
+				}
+			}
+		}
+	case "name":
+		if req.Pattern == "" {
+			return errors.New("pattern is required for name-based cleanup")
+		}
+	case "service":
+		if req.Service == "" {
+			return errors.New("service is required for service-based cleanup")
+		}
+	case "expired", "all":
+	default:
+		return fmt.Errorf("invalid cleanup type '%s', supported types: 'labels', 'name', 'service', 'expired', 'all'", req.Type)
+	}
+	return nil
+}
+
+// runCleanup runs a validated cleanup request, logs it and records it in the audit log.
+// remoteAddr is the address of the client, empty for scheduled cleanups.
+func (pe *prometheusExporter) runCleanup(req CleanupRequest, requestID string, remoteAddr string) CleanupAuditEntry {
+	logger := pe.settings.Logger.With(zap.String("request_id", requestID))
+
+	var deletedCount int
+	switch req.Type {
+	case "labels":
+		deletedCount = pe.CleanByLabels(req.Filters)
+		logger.Info("Cleanup by labels completed",
+			zap.Any("filters", req.Filters),
+			zap.Int("deleted_count", deletedCount))
+	case "name":
+		deletedCount = pe.CleanByMetricName(req.Pattern)
+		logger.Info("Cleanup by name completed",
+			zap.String("pattern", req.Pattern),
+			zap.Int("deleted_count", deletedCount))
+	case "service":
+		// Shortcut for a label cleanup on the service.name resource attribute
+		deletedCount = pe.CleanByLabels(map[string]string{
+			string(conventions.ServiceNameKey): req.Service,
+		})
+		logger.Info("Cleanup by service completed",
+			zap.String("service", req.Service),
+			zap.Int("deleted_count", deletedCount))
+	case "expired":
+		deletedCount = pe.CleanExpired()
+		logger.Info("Cleanup expired metrics completed",
+			zap.Int("deleted_count", deletedCount))
+	case "all":
+		deletedCount = pe.CleanAll()
+		logger.Info("Cleanup of all metrics completed",
+			zap.Int("deleted_count", deletedCount))
+	}
+
+	entry := CleanupAuditEntry{
+		Type:         req.Type,
+		Filters:      req.Filters,
+		MatchEmpty:   req.MatchEmpty,
+		Pattern:      req.Pattern,
+		Service:      req.Service,
+		DeletedCount: deletedCount,
+		Timestamp:    time.Now().UTC().Format(time.RFC3339),
+		RequestID:    requestID,
+		RemoteAddr:   remoteAddr,
+	}
+	pe.cleanupAuditLog.add(entry)
+	return entry
+}
+
+// startScheduledCleanups runs every scheduled cleanup on its own ticker until stopScheduledCleanups is called
+func (pe *prometheusExporter) startScheduledCleanups() {
+	if len(pe.config.ScheduledCleanups) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	pe.cancelScheduledCleanups = cancel
+	for _, schedule := range pe.config.ScheduledCleanups {
+		pe.scheduledCleanupsWG.Add(1)
+		go func() {
+			defer pe.scheduledCleanupsWG.Done()
+
+			ticker := time.NewTicker(schedule.Interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					pe.runCleanup(schedule.Request, scheduledCleanupRequestIDPrefix+generateRequestID(), "")
+				}
+			}
+		}()
+	}
+
+	pe.settings.Logger.Info("Scheduled cleanups started", zap.Int("count", len(pe.config.ScheduledCleanups)))
+}
+
+// stopScheduledCleanups stops the scheduled cleanups and waits for a running one to finish
+func (pe *prometheusExporter) stopScheduledCleanups() {
+	if pe.cancelScheduledCleanups == nil {
+		return
+	}
+
+	pe.cancelScheduledCleanups()
+	pe.scheduledCleanupsWG.Wait()
+	pe.cancelScheduledCleanups = nil
+}
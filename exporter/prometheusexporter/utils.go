@@ -6,6 +6,7 @@ package prometheusexporter // import "github.com/open-telemetry/opentelemetry-co
 import (
 	"fmt"
 
+	"github.com/prometheus/common/model"
 	"go.opentelemetry.io/collector/pdata/pcommon"
 	conventions "go.opentelemetry.io/otel/semconv/v1.25.0"
 )
@@ -39,3 +40,84 @@ func extractJob(attributes pcommon.Map) (string, bool) {
 	}
 	return "", false
 }
+
+// targetLabels derives the job and instance labels from the resource attributes, applying the
+// configured overrides. A nil targetLabels uses the default service.* mapping.
+type targetLabels struct {
+	job      LabelOverride
+	instance LabelOverride
+}
+
+// newTargetLabels returns the target labels for the given overrides, or nil when nothing is overridden
+func newTargetLabels(job LabelOverride, instance LabelOverride) *targetLabels {
+	if !job.isSet() && !instance.isSet() {
+		return nil
+	}
+	return &targetLabels{job: job, instance: instance}
+}
+
+func (o LabelOverride) isSet() bool {
+	return o.FromResourceAttribute != "" || o.Value != ""
+}
+
+// resolve returns the overridden label value, if any
+func (o LabelOverride) resolve(attributes pcommon.Map) (string, bool) {
+	if o.Value != "" {
+		return o.Value, true
+	}
+	if o.FromResourceAttribute != "" {
+		if value, ok := attributes.Get(o.FromResourceAttribute); ok {
+			return value.AsString(), true
+		}
+	}
+	return "", false
+}
+
+func (t *targetLabels) extractJob(attributes pcommon.Map) (string, bool) {
+	if t != nil {
+		if job, ok := t.job.resolve(attributes); ok {
+			return job, true
+		}
+	}
+	return extractJob(attributes)
+}
+
+func (t *targetLabels) extractInstance(attributes pcommon.Map) (string, bool) {
+	if t != nil {
+		if instance, ok := t.instance.resolve(attributes); ok {
+			return instance, true
+		}
+	}
+	return extractInstance(attributes)
+}
+
+func (t *targetLabels) resourceSignature(attributes pcommon.Map) string {
+	if t == nil {
+		return resourceSignature(attributes)
+	}
+
+	job, _ := t.extractJob(attributes)
+	instance, _ := t.extractInstance(attributes)
+	if job == "" || instance == "" {
+		return ""
+	}
+
+	return job + separatorString + instance
+}
+
+// signatureSuffix distinguishes series whose overridden job or instance differ while their
+// service.* attributes are the same. It is empty without overrides.
+func (t *targetLabels) signatureSuffix(attributes pcommon.Map) string {
+	if t == nil {
+		return ""
+	}
+
+	var suffix string
+	if job, ok := t.extractJob(attributes); ok {
+		suffix += "*" + model.JobLabel + "*" + job
+	}
+	if instance, ok := t.extractInstance(attributes); ok {
+		suffix += "*" + model.InstanceLabel + "*" + instance
+	}
+	return suffix
+}
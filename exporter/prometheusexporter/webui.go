@@ -5,25 +5,78 @@ package prometheusexporter // import "github.com/open-telemetry/opentelemetry-co
 
 import (
 	"embed"
+	"encoding/json"
+	"maps"
 	"net/http"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
+	"time"
 
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	conventions "go.opentelemetry.io/otel/semconv/v1.25.0"
 	"go.uber.org/zap"
 )
 
+// unknownServiceBucket groups metrics that have no service.name label
+const unknownServiceBucket = "__unknown__"
+
+// maxSearchResults caps the number of series returned by the metrics search API
+const maxSearchResults = 1000
+
 //go:embed static/*
 var staticFiles embed.FS
 
 // WebUI provides HTTP endpoints for the metrics visualization UI
 type WebUI struct {
-	logger *zap.Logger
+	exporter *prometheusExporter
+	logger   *zap.Logger
+}
+
+// ServiceMetric is a single accumulated series as returned by the metrics-by-service API
+type ServiceMetric struct {
+	Name   string            `json:"name"`
+	Type   string            `json:"type"`
+	Labels map[string]string `json:"labels"`
+	Value  jsonFloat         `json:"value"`
+	Count  uint64            `json:"count,omitempty"` // histograms and summaries only
+}
+
+// SearchResponse is the response of the metrics search API
+type SearchResponse struct {
+	Metrics []ServiceMetric `json:"metrics"`
+	// Truncated is true when more series matched than were returned
+	Truncated bool `json:"truncated"`
+}
+
+// MetricCardinality is the number of distinct label sets of a metric name as returned by the cardinality API
+type MetricCardinality struct {
+	Name   string `json:"name"`
+	Series int    `json:"series"`
+}
+
+// MetricDetail is everything known about a single accumulated series as returned by the metric detail API
+type MetricDetail struct {
+	ServiceMetric
+	Description string `json:"description,omitempty"`
+	Unit        string `json:"unit,omitempty"`
+	// ResourceLabels and DataPointLabels split Labels by where the attributes come from
+	ResourceLabels  map[string]string `json:"resource_labels"`
+	DataPointLabels map[string]string `json:"data_point_labels"`
+	ScopeName       string            `json:"scope_name,omitempty"`
+	ScopeVersion    string            `json:"scope_version,omitempty"`
+	// StartTimestamp is only set for cumulative series, histograms and summaries
+	StartTimestamp string `json:"start_timestamp,omitempty"`
+	Timestamp      string `json:"timestamp"`
 }
 
 // NewWebUI creates a new web UI instance
-func NewWebUI(logger *zap.Logger) *WebUI {
+func NewWebUI(exporter *prometheusExporter, logger *zap.Logger) *WebUI {
 	return &WebUI{
-		logger: logger,
+		exporter: exporter,
+		logger:   logger,
 	}
 }
 
@@ -114,6 +167,288 @@ func (ui *WebUI) IndexHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(indexHTML))
 }
 
+// MetricsByServiceHandler returns the accumulated series as JSON, grouped by their service.name label.
+// Series without a service.name label are grouped under "__unknown__".
+// The kind query parameter restricts the series to the "aggregated" or the "original" ones.
+func (ui *WebUI) MetricsByServiceHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	kind := r.URL.Query().Get("kind")
+	switch kind {
+	case "", "aggregated", "original":
+	default:
+		http.Error(w, "Invalid kind, supported kinds: 'aggregated', 'original'", http.StatusBadRequest)
+		return
+	}
+	markerAttrs := ui.exporter.config.AggregationMarkerAttributes
+	if kind != "" && len(markerAttrs) == 0 {
+		http.Error(w, "Filtering by kind requires aggregation_marker_attributes to be configured", http.StatusBadRequest)
+		return
+	}
+
+	metrics, resourceAttrs, _, _, _, _ := ui.exporter.collector.accumulator.Snapshot()
+
+	services := make(map[string][]ServiceMetric)
+	for i, metric := range metrics {
+		if kind != "" && hasMarkerAttributes(resourceAttrs[i], markerAttrs) != (kind == "aggregated") {
+			continue
+		}
+
+		labels := extractMetricLabels(metric, resourceAttrs[i])
+		service, ok := labels[string(conventions.ServiceNameKey)]
+		if !ok || service == "" {
+			service = unknownServiceBucket
+		}
+
+		services[service] = append(services[service], newServiceMetric(metric, labels))
+	}
+
+	for _, serviceMetrics := range services {
+		sort.Slice(serviceMetrics, func(i, j int) bool {
+			return serviceMetrics[i].Name < serviceMetrics[j].Name
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(services)
+}
+
+// hasMarkerAttributes reports whether a resource carries every marker attribute with its value, the way
+// the metrics aggregator processor recognizes the resources of its outputs
+func hasMarkerAttributes(resourceAttrs pcommon.Map, markerAttrs map[string]string) bool {
+	for key, expectedValue := range markerAttrs {
+		if actualValue, exists := resourceAttrs.Get(key); !exists || actualValue.AsString() != expectedValue {
+			return false
+		}
+	}
+	return true
+}
+
+// SearchHandler returns the accumulated series whose metric name matches the regex query parameter,
+// sorted by name. At most maxSearchResults series are returned.
+func (ui *WebUI) SearchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	regex, err := regexp.Compile(r.URL.Query().Get("regex"))
+	if err != nil {
+		http.Error(w, "Invalid regex: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	metrics, resourceAttrs, _, _, _, _ := ui.exporter.collector.accumulator.Snapshot()
+
+	response := SearchResponse{Metrics: []ServiceMetric{}}
+	for i, metric := range metrics {
+		if !regex.MatchString(metric.Name()) {
+			continue
+		}
+		response.Metrics = append(response.Metrics, newServiceMetric(metric, extractMetricLabels(metric, resourceAttrs[i])))
+	}
+
+	sort.SliceStable(response.Metrics, func(i, j int) bool {
+		return response.Metrics[i].Name < response.Metrics[j].Name
+	})
+	if len(response.Metrics) > maxSearchResults {
+		response.Metrics = response.Metrics[:maxSearchResults]
+		response.Truncated = true
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// CardinalityHandler returns, per metric name, the number of distinct label sets accumulated for it.
+// Names are sorted by descending series count, then by name.
+func (ui *WebUI) CardinalityHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	metrics, resourceAttrs, _, _, _, _ := ui.exporter.collector.accumulator.Snapshot()
+
+	labelSets := make(map[string]map[string]struct{})
+	for i, metric := range metrics {
+		labels := extractMetricLabels(metric, resourceAttrs[i])
+		keys := make([]string, 0, len(labels))
+		for k := range labels {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		var labelSet strings.Builder
+		for _, k := range keys {
+			labelSet.WriteString(k)
+			labelSet.WriteString(separatorString)
+			labelSet.WriteString(labels[k])
+			labelSet.WriteString(separatorString)
+		}
+
+		if labelSets[metric.Name()] == nil {
+			labelSets[metric.Name()] = make(map[string]struct{})
+		}
+		labelSets[metric.Name()][labelSet.String()] = struct{}{}
+	}
+
+	response := make([]MetricCardinality, 0, len(labelSets))
+	for name, sets := range labelSets {
+		response = append(response, MetricCardinality{Name: name, Series: len(sets)})
+	}
+	sort.Slice(response, func(i, j int) bool {
+		if response[i].Series != response[j].Series {
+			return response[i].Series > response[j].Series
+		}
+		return response[i].Name < response[j].Name
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// DetailHandler returns the accumulated series with the metric name given by the name query parameter whose
+// labels are exactly the JSON object given by the labels query parameter, e.g. labels={"method":"GET"}.
+// The labels are the same as in the other APIs: resource attributes and data point attributes together.
+func (ui *WebUI) DetailHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		http.Error(w, "The name query parameter is required", http.StatusBadRequest)
+		return
+	}
+	wantLabels := map[string]string{}
+	if rawLabels := r.URL.Query().Get("labels"); rawLabels != "" {
+		if err := json.Unmarshal([]byte(rawLabels), &wantLabels); err != nil {
+			http.Error(w, "Invalid labels: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	metrics, resourceAttrs, scopeNames, scopeVersions, _, _ := ui.exporter.collector.accumulator.Snapshot()
+
+	for i, metric := range metrics {
+		if metric.Name() != name {
+			continue
+		}
+		labels := extractMetricLabels(metric, resourceAttrs[i])
+		if !maps.Equal(labels, wantLabels) {
+			continue
+		}
+
+		detail := MetricDetail{
+			ServiceMetric:   newServiceMetric(metric, labels),
+			Description:     metric.Description(),
+			Unit:            metric.Unit(),
+			ResourceLabels:  attributesToLabels(resourceAttrs[i]),
+			DataPointLabels: map[string]string{},
+			ScopeName:       scopeNames[i],
+			ScopeVersion:    scopeVersions[i],
+		}
+		if attrs, start, timestamp, ok := firstDataPoint(metric); ok {
+			detail.DataPointLabels = attributesToLabels(attrs)
+			if start != 0 {
+				detail.StartTimestamp = start.AsTime().UTC().Format(time.RFC3339Nano)
+			}
+			detail.Timestamp = timestamp.AsTime().UTC().Format(time.RFC3339Nano)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(detail)
+		return
+	}
+
+	http.Error(w, "Series not found", http.StatusNotFound)
+}
+
+// firstDataPoint returns the attributes and timestamps of the data point of an accumulated metric
+func firstDataPoint(metric pmetric.Metric) (attrs pcommon.Map, start pcommon.Timestamp, timestamp pcommon.Timestamp, ok bool) {
+	switch metric.Type() {
+	case pmetric.MetricTypeGauge:
+		if metric.Gauge().DataPoints().Len() > 0 {
+			dp := metric.Gauge().DataPoints().At(0)
+			return dp.Attributes(), dp.StartTimestamp(), dp.Timestamp(), true
+		}
+	case pmetric.MetricTypeSum:
+		if metric.Sum().DataPoints().Len() > 0 {
+			dp := metric.Sum().DataPoints().At(0)
+			return dp.Attributes(), dp.StartTimestamp(), dp.Timestamp(), true
+		}
+	case pmetric.MetricTypeHistogram:
+		if metric.Histogram().DataPoints().Len() > 0 {
+			dp := metric.Histogram().DataPoints().At(0)
+			return dp.Attributes(), dp.StartTimestamp(), dp.Timestamp(), true
+		}
+	case pmetric.MetricTypeSummary:
+		if metric.Summary().DataPoints().Len() > 0 {
+			dp := metric.Summary().DataPoints().At(0)
+			return dp.Attributes(), dp.StartTimestamp(), dp.Timestamp(), true
+		}
+	}
+	return pcommon.Map{}, 0, 0, false
+}
+
+// attributesToLabels returns the attributes as a map of string values
+func attributesToLabels(attrs pcommon.Map) map[string]string {
+	labels := make(map[string]string, attrs.Len())
+	for k, v := range attrs.All() {
+		labels[k] = v.AsString()
+	}
+	return labels
+}
+
+// newServiceMetric converts an accumulated metric into its API representation
+func newServiceMetric(metric pmetric.Metric, labels map[string]string) ServiceMetric {
+	serviceMetric := ServiceMetric{
+		Name:   metric.Name(),
+		Type:   metric.Type().String(),
+		Labels: labels,
+	}
+
+	switch metric.Type() {
+	case pmetric.MetricTypeGauge:
+		if metric.Gauge().DataPoints().Len() > 0 {
+			serviceMetric.Value = jsonFloat(numberDataPointValue(metric.Gauge().DataPoints().At(0)))
+		}
+	case pmetric.MetricTypeSum:
+		if metric.Sum().DataPoints().Len() > 0 {
+			serviceMetric.Value = jsonFloat(numberDataPointValue(metric.Sum().DataPoints().At(0)))
+		}
+	case pmetric.MetricTypeHistogram:
+		if metric.Histogram().DataPoints().Len() > 0 {
+			serviceMetric.Value = jsonFloat(metric.Histogram().DataPoints().At(0).Sum())
+			serviceMetric.Count = metric.Histogram().DataPoints().At(0).Count()
+		}
+	case pmetric.MetricTypeSummary:
+		if metric.Summary().DataPoints().Len() > 0 {
+			serviceMetric.Value = jsonFloat(metric.Summary().DataPoints().At(0).Sum())
+			serviceMetric.Count = metric.Summary().DataPoints().At(0).Count()
+		}
+	}
+
+	return serviceMetric
+}
+
+// numberDataPointValue returns the value of a number data point as a float
+func numberDataPointValue(dp pmetric.NumberDataPoint) float64 {
+	if dp.ValueType() == pmetric.NumberDataPointValueTypeInt {
+		return float64(dp.IntValue())
+	}
+	return dp.DoubleValue()
+}
+
 // StaticHandler serves static files (CSS, JS)
 func (ui *WebUI) StaticHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
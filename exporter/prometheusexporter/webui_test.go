@@ -0,0 +1,342 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package prometheusexporter
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/exporter/exportertest"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	conventions "go.opentelemetry.io/otel/semconv/v1.25.0"
+	"go.uber.org/zap"
+)
+
+func TestWebUIMetricsByServiceHandler(t *testing.T) {
+	config := createDefaultConfig().(*Config)
+	config.ServerConfig.Endpoint = "localhost:0"
+
+	exporter, err := newPrometheusExporter(config, exportertest.NewNopSettings(component.MustNewType("prometheus")))
+	require.NoError(t, err)
+
+	acc := exporter.collector.accumulator
+	acc.Accumulate(createTestResourceMetrics("checkout_requests", "checkout", "checkout-1", map[string]interface{}{"method": "GET"}))
+	acc.Accumulate(createTestResourceMetrics("checkout_errors", "checkout", "checkout-1", map[string]interface{}{"method": "GET"}))
+	acc.Accumulate(createTestResourceMetrics("payment_requests", "payment", "payment-1", map[string]interface{}{"method": "POST"}))
+
+	// A metric without any service.name
+	rm := pmetric.NewResourceMetrics()
+	metric := rm.ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+	metric.SetName("orphan_metric")
+	dp := metric.SetEmptyGauge().DataPoints().AppendEmpty()
+	dp.SetIntValue(3)
+	dp.SetTimestamp(pcommon.NewTimestampFromTime(time.Now()))
+	acc.Accumulate(rm)
+
+	webUI := NewWebUI(exporter, zap.NewNop())
+
+	t.Run("MetricsByService", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/metrics/by-service", nil)
+		w := httptest.NewRecorder()
+
+		webUI.MetricsByServiceHandler(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+		var response map[string][]ServiceMetric
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.Len(t, response, 3)
+
+		require.Len(t, response["checkout"], 2)
+		assert.Equal(t, "checkout_errors", response["checkout"][0].Name)
+		assert.Equal(t, "checkout_requests", response["checkout"][1].Name)
+		assert.Equal(t, "checkout", response["checkout"][1].Labels[string(conventions.ServiceNameKey)])
+		assert.Equal(t, "GET", response["checkout"][1].Labels["method"])
+
+		require.Len(t, response["payment"], 1)
+		assert.Equal(t, "payment_requests", response["payment"][0].Name)
+
+		require.Len(t, response[unknownServiceBucket], 1)
+		assert.Equal(t, "orphan_metric", response[unknownServiceBucket][0].Name)
+		assert.Equal(t, "Gauge", response[unknownServiceBucket][0].Type)
+		assert.Equal(t, 3.0, float64(response[unknownServiceBucket][0].Value))
+	})
+
+	t.Run("MetricsByService_InvalidMethod", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/api/metrics/by-service", nil)
+		w := httptest.NewRecorder()
+
+		webUI.MetricsByServiceHandler(w, req)
+
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	})
+}
+
+func TestWebUIMetricsByServiceKindFilter(t *testing.T) {
+	config := createDefaultConfig().(*Config)
+	config.ServerConfig.Endpoint = "localhost:0"
+	config.AggregationMarkerAttributes = map[string]string{"aggregation.level": "cluster"}
+	require.NoError(t, config.Validate())
+
+	exporter, err := newPrometheusExporter(config, exportertest.NewNopSettings(component.MustNewType("prometheus")))
+	require.NoError(t, err)
+
+	acc := exporter.collector.accumulator
+	acc.Accumulate(createTestResourceMetrics("checkout_requests", "checkout", "checkout-1", map[string]interface{}{"method": "GET"}))
+	acc.Accumulate(createTestResourceMetricsWithResourceAttrs("cluster_requests", map[string]interface{}{
+		string(conventions.ServiceNameKey): "checkout",
+		"aggregation.level":                "cluster",
+	}, map[string]interface{}{}))
+	// A marker attribute with another value is not an aggregation output
+	acc.Accumulate(createTestResourceMetricsWithResourceAttrs("node_requests", map[string]interface{}{
+		string(conventions.ServiceNameKey): "checkout",
+		"aggregation.level":                "node",
+	}, map[string]interface{}{}))
+
+	webUI := NewWebUI(exporter, zap.NewNop())
+
+	list := func(kind string) (int, []string) {
+		req := httptest.NewRequest("GET", "/api/metrics/by-service?kind="+kind, nil)
+		w := httptest.NewRecorder()
+		webUI.MetricsByServiceHandler(w, req)
+		if w.Code != http.StatusOK {
+			return w.Code, nil
+		}
+
+		var response map[string][]ServiceMetric
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		var names []string
+		for _, metric := range response["checkout"] {
+			names = append(names, metric.Name)
+		}
+		return w.Code, names
+	}
+
+	t.Run("Aggregated", func(t *testing.T) {
+		code, names := list("aggregated")
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, []string{"cluster_requests"}, names)
+	})
+
+	t.Run("Original", func(t *testing.T) {
+		code, names := list("original")
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, []string{"checkout_requests", "node_requests"}, names)
+	})
+
+	t.Run("All", func(t *testing.T) {
+		code, names := list("")
+		require.Equal(t, http.StatusOK, code)
+		assert.Len(t, names, 3)
+	})
+
+	t.Run("InvalidKind", func(t *testing.T) {
+		code, _ := list("rollup")
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+
+	t.Run("NoMarkerAttributes", func(t *testing.T) {
+		exporter.config.AggregationMarkerAttributes = nil
+		code, _ := list("aggregated")
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+}
+
+func TestWebUISearchHandler(t *testing.T) {
+	config := createDefaultConfig().(*Config)
+	config.ServerConfig.Endpoint = "localhost:0"
+
+	exporter, err := newPrometheusExporter(config, exportertest.NewNopSettings(component.MustNewType("prometheus")))
+	require.NoError(t, err)
+
+	acc := exporter.collector.accumulator
+	acc.Accumulate(createTestResourceMetrics("checkout_requests", "checkout", "checkout-1", map[string]interface{}{"method": "GET"}))
+	acc.Accumulate(createTestResourceMetrics("checkout_errors", "checkout", "checkout-1", map[string]interface{}{"method": "GET"}))
+	acc.Accumulate(createTestResourceMetrics("payment_requests", "payment", "payment-1", map[string]interface{}{"method": "POST"}))
+
+	webUI := NewWebUI(exporter, zap.NewNop())
+
+	search := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/metrics/search?"+query, nil)
+		w := httptest.NewRecorder()
+		webUI.SearchHandler(w, req)
+		return w
+	}
+
+	t.Run("Matching", func(t *testing.T) {
+		w := search("regex=" + url.QueryEscape("_requests$"))
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response SearchResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.Len(t, response.Metrics, 2)
+		assert.Equal(t, "checkout_requests", response.Metrics[0].Name)
+		assert.Equal(t, "payment_requests", response.Metrics[1].Name)
+		assert.Equal(t, "POST", response.Metrics[1].Labels["method"])
+		assert.False(t, response.Truncated)
+	})
+
+	t.Run("NonMatching", func(t *testing.T) {
+		w := search("regex=" + url.QueryEscape("^inventory_"))
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response SearchResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Empty(t, response.Metrics)
+		assert.NotNil(t, response.Metrics)
+		assert.False(t, response.Truncated)
+	})
+
+	t.Run("InvalidRegex", func(t *testing.T) {
+		w := search("regex=" + url.QueryEscape("(unclosed"))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestWebUICardinalityHandler(t *testing.T) {
+	config := createDefaultConfig().(*Config)
+	config.ServerConfig.Endpoint = "localhost:0"
+
+	exporter, err := newPrometheusExporter(config, exportertest.NewNopSettings(component.MustNewType("prometheus")))
+	require.NoError(t, err)
+
+	acc := exporter.collector.accumulator
+	for _, method := range []string{"GET", "POST", "PUT"} {
+		acc.Accumulate(createTestResourceMetrics("http_requests", "checkout", "checkout-1", map[string]interface{}{"method": method}))
+	}
+	acc.Accumulate(createTestResourceMetrics("http_requests", "payment", "payment-1", map[string]interface{}{"method": "GET"}))
+	acc.Accumulate(createTestResourceMetrics("queue_depth", "checkout", "checkout-1", map[string]interface{}{"queue": "orders"}))
+	acc.Accumulate(createTestResourceMetrics("queue_depth", "checkout", "checkout-1", map[string]interface{}{"queue": "refunds"}))
+	acc.Accumulate(createTestResourceMetrics("uptime", "checkout", "checkout-1", map[string]interface{}{}))
+
+	webUI := NewWebUI(exporter, zap.NewNop())
+
+	req := httptest.NewRequest("GET", "/api/metrics/cardinality", nil)
+	w := httptest.NewRecorder()
+	webUI.CardinalityHandler(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	var response []MetricCardinality
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, []MetricCardinality{
+		{Name: "http_requests", Series: 4},
+		{Name: "queue_depth", Series: 2},
+		{Name: "uptime", Series: 1},
+	}, response)
+
+	req = httptest.NewRequest("POST", "/api/metrics/cardinality", nil)
+	w = httptest.NewRecorder()
+	webUI.CardinalityHandler(w, req)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
+
+func TestWebUIDetailHandler(t *testing.T) {
+	config := createDefaultConfig().(*Config)
+	config.ServerConfig.Endpoint = "localhost:0"
+
+	exporter, err := newPrometheusExporter(config, exportertest.NewNopSettings(component.MustNewType("prometheus")))
+	require.NoError(t, err)
+
+	acc := exporter.collector.accumulator
+	acc.Accumulate(createTestResourceMetrics("checkout_requests", "checkout", "checkout-1", map[string]interface{}{"method": "GET"}))
+	acc.Accumulate(createTestResourceMetrics("checkout_requests", "checkout", "checkout-1", map[string]interface{}{"method": "POST"}))
+
+	webUI := NewWebUI(exporter, zap.NewNop())
+
+	detail := func(name string, labels map[string]string) *httptest.ResponseRecorder {
+		rawLabels, err := json.Marshal(labels)
+		require.NoError(t, err)
+		req := httptest.NewRequest("GET", "/api/metrics/detail?name="+url.QueryEscape(name)+"&labels="+url.QueryEscape(string(rawLabels)), nil)
+		w := httptest.NewRecorder()
+		webUI.DetailHandler(w, req)
+		return w
+	}
+
+	t.Run("KnownSeries", func(t *testing.T) {
+		w := detail("checkout_requests", map[string]string{
+			string(conventions.ServiceNameKey):       "checkout",
+			string(conventions.ServiceInstanceIDKey): "checkout-1",
+			"method":                                 "POST",
+		})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+		var response MetricDetail
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "checkout_requests", response.Name)
+		assert.Equal(t, "Gauge", response.Type)
+		assert.Equal(t, "Test metric", response.Description)
+		assert.Equal(t, 42.0, float64(response.Value))
+		assert.Equal(t, map[string]string{"method": "POST"}, response.DataPointLabels)
+		assert.Equal(t, "checkout", response.ResourceLabels[string(conventions.ServiceNameKey)])
+		assert.NotContains(t, response.ResourceLabels, "method")
+		assert.Equal(t, "test-scope", response.ScopeName)
+		assert.NotEmpty(t, response.Timestamp)
+	})
+
+	t.Run("Miss", func(t *testing.T) {
+		w := detail("checkout_requests", map[string]string{"method": "DELETE"})
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		w = detail("unknown_metric", map[string]string{})
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("InvalidLabels", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/metrics/detail?name=checkout_requests&labels=not-json", nil)
+		w := httptest.NewRecorder()
+		webUI.DetailHandler(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestWebUINonFiniteValues(t *testing.T) {
+	config := createDefaultConfig().(*Config)
+	config.ServerConfig.Endpoint = "localhost:0"
+
+	exporter, err := newPrometheusExporter(config, exportertest.NewNopSettings(component.MustNewType("prometheus")))
+	require.NoError(t, err)
+
+	rm := pmetric.NewResourceMetrics()
+	rm.Resource().Attributes().PutStr(string(conventions.ServiceNameKey), "checkout")
+	metric := rm.ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+	metric.SetName("queue_ratio")
+	dp := metric.SetEmptyGauge().DataPoints().AppendEmpty()
+	dp.SetDoubleValue(math.NaN())
+	dp.SetTimestamp(pcommon.NewTimestampFromTime(time.Now()))
+	exporter.collector.accumulator.Accumulate(rm)
+
+	webUI := NewWebUI(exporter, zap.NewNop())
+	labels, err := json.Marshal(map[string]string{string(conventions.ServiceNameKey): "checkout"})
+	require.NoError(t, err)
+
+	for name, tt := range map[string]struct {
+		handler http.HandlerFunc
+		target  string
+	}{
+		"MetricsByService": {webUI.MetricsByServiceHandler, "/api/metrics/by-service"},
+		"Search":           {webUI.SearchHandler, "/api/metrics/search?regex=queue_ratio"},
+		"Detail":           {webUI.DetailHandler, "/api/metrics/detail?name=queue_ratio&labels=" + url.QueryEscape(string(labels))},
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			tt.handler(w, httptest.NewRequest("GET", tt.target, nil))
+			require.Equal(t, http.StatusOK, w.Code)
+			require.True(t, json.Valid(w.Body.Bytes()), "a NaN value should not break the JSON output: %q", w.Body.String())
+			assert.Contains(t, w.Body.String(), `"value":"NaN"`)
+		})
+	}
+}
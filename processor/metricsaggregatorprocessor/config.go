@@ -6,30 +6,216 @@ package metricsaggregatorprocessor
 import (
 	"errors"
 	"fmt"
+	"reflect"
 	"regexp"
+	"slices"
+	"time"
 
 	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/config/configopaque"
 )
 
 // Config represents the receiver configuration.
 type Config struct {
-	GroupByLabels            []string          `mapstructure:"group_by_labels"`
-	OutputResourceAttributes map[string]string `mapstructure:"output_resource_attributes"`
-	AggregationRules         []AggregationRule `mapstructure:"aggregation_rules"`
+	GroupByLabels                    []string          `mapstructure:"group_by_labels"`
+	OutputResourceAttributes         map[string]string `mapstructure:"output_resource_attributes"`
+	AggregationRules                 []AggregationRule `mapstructure:"aggregation_rules"`
+	AutoPreserveUniformResourceAttrs bool              `mapstructure:"auto_preserve_uniform_resource_attrs"`
+	OnRuleError                      string            `mapstructure:"on_rule_error"`
+	StrictCollisions                 bool              `mapstructure:"strict_collisions"`
+	// EmitOriginalMetrics keeps the metrics that are not aggregator outputs in the batch
+	EmitOriginalMetrics bool `mapstructure:"emit_original_metrics"`
+	// NormalizeGroupValues normalizes group-by label values before grouping, so that
+	// e.g. "Service-A" and "service-a" end up in the same group
+	NormalizeGroupValues bool `mapstructure:"normalize_group_values"`
+	// GroupValueTransforms are the transforms applied by NormalizeGroupValues, in order (default: trim, lowercase)
+	GroupValueTransforms []string `mapstructure:"group_value_transforms"`
+	// RulesAPIEndpoint is the address of the HTTP server used to replace the aggregation rules at
+	// runtime via POST /aggregator/rules. Empty disables the server.
+	RulesAPIEndpoint string `mapstructure:"rules_api_endpoint"`
+	// RulesAPIToken, if set, must be sent as a bearer token with every rules API request
+	RulesAPIToken configopaque.String `mapstructure:"rules_api_token"`
+	// MaxTotalGroups caps the number of distinct groups a rule creates per batch. Data points that
+	// would create more groups are folded into a single __overflow__ group. Zero means unlimited.
+	MaxTotalGroups int `mapstructure:"max_total_groups"`
+	// HashGroupKeys keys the groups of a rule by a short hash of their group-by labels and values instead of
+	// the labels and values themselves, to save memory with many or long group-by labels. Outputs keep the values.
+	HashGroupKeys bool `mapstructure:"hash_group_keys"`
+	// OutputMode is "append" (default) to add the aggregated metrics to the incoming batch, or
+	// "replace" to return a new batch with only the aggregated metrics and leave the input untouched
+	OutputMode string `mapstructure:"output_mode"`
+	// RouteByResourceAttribute names the scope of each aggregated resource after the value of this
+	// resource attribute, e.g. metricsaggregator/team-a. Empty uses the single metricsaggregator scope.
+	RouteByResourceAttribute string `mapstructure:"route_by_resource_attribute"`
+	// MissingLabelPolicy decides how a group-by label missing from a data point is handled:
+	// "exclude" (default) leaves it out of the group key, "placeholder" groups such data points
+	// under MissingLabelPlaceholder
+	MissingLabelPolicy string `mapstructure:"missing_label_policy"`
+	// MissingLabelPlaceholder is the value of missing group-by labels with the placeholder policy (default: __missing__)
+	MissingLabelPlaceholder string `mapstructure:"missing_label_placeholder"`
+	// LabelPrecedence decides where a group-by label present both on the data point and on its resource
+	// is read from: "datapoint" (default) or "resource"
+	LabelPrecedence string `mapstructure:"label_precedence"`
+	// EmitHeartbeat adds a metricsaggregator_last_run_timestamp_seconds gauge set to the current time
+	// to every processed batch, so operators can check that the processor is running
+	EmitHeartbeat bool `mapstructure:"emit_heartbeat"`
+	// EmitOriginalsRemoved adds a metricsaggregator_originals_removed gauge to every processed batch, with the
+	// number of original metrics removed by each rule that does not preserve them
+	EmitOriginalsRemoved bool `mapstructure:"emit_originals_removed"`
+	// PreserveSourceType makes rules without an output_metric_type emit a sum when all their sources
+	// are sums, instead of always emitting a gauge
+	PreserveSourceType bool `mapstructure:"preserve_source_type"`
+	// RuleTemplates are named partial rules that aggregation rules can inherit from with extends
+	RuleTemplates map[string]AggregationRule `mapstructure:"rule_templates"`
 }
 
 // AggregationRule defines how to aggregate metrics
 type AggregationRule struct {
-	MetricPattern           string `mapstructure:"metric_pattern"`
-	MatchType               string `mapstructure:"match_type"`
-	OutputMetricName        string `mapstructure:"output_metric_name"`
-	AggregationType         string `mapstructure:"aggregation_type"`
-	PreserveOriginalMetrics bool   `mapstructure:"preserve_original_metrics"`
-	OutputMetricType        string `mapstructure:"output_metric_type"`
+	// Extends names the rule template this rule inherits its fields from. Fields set on the rule
+	// override the template's.
+	Extends string `mapstructure:"extends" json:"extends,omitempty"`
+	// RuleName identifies the rule on the scope of the metrics it emits; defaults to output_metric_name
+	RuleName                string `mapstructure:"rule_name" json:"rule_name,omitempty"`
+	MetricPattern           string `mapstructure:"metric_pattern" json:"metric_pattern,omitempty"`
+	MatchType               string `mapstructure:"match_type" json:"match_type,omitempty"`
+	OutputMetricName        string `mapstructure:"output_metric_name" json:"output_metric_name,omitempty"`
+	AggregationType         string `mapstructure:"aggregation_type" json:"aggregation_type,omitempty"`
+	PreserveOriginalMetrics bool   `mapstructure:"preserve_original_metrics" json:"preserve_original_metrics,omitempty"`
+	OutputMetricType        string `mapstructure:"output_metric_type" json:"output_metric_type,omitempty"`
+	TimestampStrategy       string `mapstructure:"timestamp_strategy" json:"timestamp_strategy,omitempty"`
+	SplitByLabel            string `mapstructure:"split_by_label" json:"split_by_label,omitempty"`
+	DetectCounterResets     bool   `mapstructure:"detect_counter_resets" json:"detect_counter_resets,omitempty"`
+	MergeIntoExisting       bool   `mapstructure:"merge_into_existing" json:"merge_into_existing,omitempty"`
+	ConsumeMatched          bool   `mapstructure:"consume_matched" json:"consume_matched,omitempty"`
+	// MetricPatterns are further patterns matched like metric_pattern, e.g. ["cpu_usage", "mem_usage"].
+	// A metric matching any of the patterns is aggregated by the rule.
+	MetricPatterns []string `mapstructure:"metric_patterns" json:"metric_patterns,omitempty"`
+	// EnrichOriginalsWithAggregate adds the aggregate of its group to every preserved original data point, as an
+	// aggregation.<aggregation_type> attribute (e.g. aggregation.mean). Requires preserve_original_metrics.
+	EnrichOriginalsWithAggregate bool `mapstructure:"enrich_originals_with_aggregate" json:"enrich_originals_with_aggregate,omitempty"`
+	// HistogramBounds are the explicit bucket bounds used to distribute source values when
+	// output_metric_type is histogram
+	HistogramBounds []float64 `mapstructure:"histogram_bounds" json:"histogram_bounds,omitempty"`
+	// AddDataAge adds a data.age.seconds data point attribute with the time elapsed since the
+	// latest source data point of the group
+	AddDataAge bool `mapstructure:"add_data_age" json:"add_data_age,omitempty"`
+	// GroupBySets aggregates the matched metrics once per set of labels, emitting a separate output
+	// named <output_metric_name>_by_<labels> for each set instead of grouping by group_by_labels
+	GroupBySets [][]string `mapstructure:"group_by_sets" json:"group_by_sets,omitempty"`
+	// GroupByNameRegex is matched against the names of the matched metrics. Its named captures
+	// (e.g. (?P<tenant>[a-z]+)) are grouped on as if they were data point labels.
+	GroupByNameRegex string `mapstructure:"group_by_name_regex" json:"group_by_name_regex,omitempty"`
+	// EmitPerScopeSubtotals emits, next to the aggregate, one aggregate per contributing scope
+	// labeled with scope.name
+	EmitPerScopeSubtotals bool `mapstructure:"emit_per_scope_subtotals" json:"emit_per_scope_subtotals,omitempty"`
+	// EmitLineage adds an aggregation.lineage data point attribute describing how the value was
+	// computed, e.g. "sum(throughput) over 4 series"
+	EmitLineage bool `mapstructure:"emit_lineage" json:"emit_lineage,omitempty"`
+	// EmitMatchInfo adds aggregation.source_pattern and aggregation.match_type data point attributes
+	// recording which pattern captured the source metrics
+	EmitMatchInfo bool `mapstructure:"emit_match_info" json:"emit_match_info,omitempty"`
+	// TimeWindowStart and TimeWindowEnd restrict the aggregation to source data points whose timestamp
+	// falls in [start, end]. Either bound may be left unset. Out-of-window data points are left untouched.
+	TimeWindowStart time.Time `mapstructure:"time_window_start" json:"time_window_start,omitempty"`
+	TimeWindowEnd   time.Time `mapstructure:"time_window_end" json:"time_window_end,omitempty"`
+	// MaxAge restricts the aggregation to source data points not older than this duration
+	MaxAge time.Duration `mapstructure:"max_age" json:"max_age,omitempty"`
+	// OutputMonotonic sets whether a sum output is monotonic. When unset, it is monotonic only if
+	// all sources are monotonic sums.
+	OutputMonotonic *bool `mapstructure:"output_monotonic" json:"output_monotonic,omitempty"`
+	// OutputTemporality sets the aggregation temporality of a sum output: "cumulative" (default) or "delta".
+	// It only changes the declared temporality, values are not accumulated across batches.
+	OutputTemporality string `mapstructure:"output_temporality" json:"output_temporality,omitempty"`
+	// UnitMismatchPolicy decides what happens when the matched metrics have different units:
+	// "ignore" (default) aggregates them together, "skip" only aggregates the unit shared by the most
+	// metrics and "split" aggregates each unit separately
+	UnitMismatchPolicy string `mapstructure:"unit_mismatch_policy" json:"unit_mismatch_policy,omitempty"`
+	// RuleResourceAttributes are added to the resources of this rule's outputs, in addition to the
+	// global output_resource_attributes, which take precedence on conflicting keys
+	RuleResourceAttributes map[string]string `mapstructure:"rule_resource_attributes" json:"rule_resource_attributes,omitempty"`
+	// MatchUnit restricts the rule to metrics with exactly this unit, e.g. "By". Empty matches any unit.
+	MatchUnit string `mapstructure:"match_unit" json:"match_unit,omitempty"`
+	// MatchDescriptionRegex restricts the rule to metrics whose description matches this regex.
+	// Empty matches any description.
+	MatchDescriptionRegex string `mapstructure:"match_description_regex" json:"match_description_regex,omitempty"`
+	// EmitContributors adds an aggregation.contributors data point attribute with the number of source data
+	// points to histogram outputs, whose count does not always reflect the observations of the sources.
+	// Requires output_metric_type "histogram".
+	EmitContributors bool `mapstructure:"emit_contributors" json:"emit_contributors,omitempty"`
+	// HistogramValueSource is the field histogram sources are aggregated on: "sum" (default) or "count",
+	// for exporters that only encode counts
+	HistogramValueSource string `mapstructure:"histogram_value_source" json:"histogram_value_source,omitempty"`
+	// ExpectedSources is the number of data points a complete group has, e.g. the size of the cluster.
+	// Together with MinFraction it suppresses the output of groups with too few sources. Zero disables the check.
+	ExpectedSources int `mapstructure:"expected_sources" json:"expected_sources,omitempty"`
+	// MinFraction is the fraction of ExpectedSources that must contribute to a group for it to be emitted
+	MinFraction float64 `mapstructure:"min_fraction" json:"min_fraction,omitempty"`
+	// EmitIncompleteMarker emits an aggregation_incomplete gauge in place of a suppressed group's output
+	EmitIncompleteMarker bool `mapstructure:"emit_incomplete_marker" json:"emit_incomplete_marker,omitempty"`
+	// WithStdDev emits <output_metric_name>_stddev, the population standard deviation of the values of
+	// each group, next to the mean. Requires aggregation_type "mean".
+	WithStdDev bool `mapstructure:"with_stddev" json:"with_stddev,omitempty"`
+	// CumulativeMergeStrategy decides how cumulative sum sources are merged: "none" (default) sums every
+	// data point, "latest" only sums the latest data point of each source series and emits it at the latest
+	// timestamp of the group. Requires aggregation_type "sum".
+	CumulativeMergeStrategy string `mapstructure:"cumulative_merge_strategy" json:"cumulative_merge_strategy,omitempty"`
+	// ValueTransform is applied to every source value before aggregation: "abs", "multiply:<factor>"
+	// (e.g. multiply:0.001 to scale bytes to kilobytes) or "clamp_min:<min>". Empty leaves values unchanged.
+	ValueTransform string `mapstructure:"value_transform" json:"value_transform,omitempty"`
+	// TrimFraction is the fraction of the sorted values of a group dropped at each end before a
+	// trimmed_mean averages the rest, e.g. 0.1 drops the lowest and the highest 10%
+	TrimFraction float64 `mapstructure:"trim_fraction" json:"trim_fraction,omitempty"`
+	// EmitSourceRanks emits <output_metric_name>_source_ranks next to the aggregate, with one data point per
+	// source of the group carrying its value, labels and rank. Experimental, meant for diagnostics.
+	EmitSourceRanks bool `mapstructure:"emit_source_ranks" json:"emit_source_ranks,omitempty"`
+	// MaxRankedSources is the largest group whose sources are ranked with EmitSourceRanks
+	// (default: 10, at most 100)
+	MaxRankedSources int `mapstructure:"max_ranked_sources" json:"max_ranked_sources,omitempty"`
+	// SampleRate is the fraction of the source series aggregated, for cheap approximate aggregation of
+	// high-volume metrics. Series are sampled deterministically, and sum and count results are scaled
+	// by 1/SampleRate. Zero or 1 aggregates every series.
+	SampleRate float64 `mapstructure:"sample_rate" json:"sample_rate,omitempty"`
+	// Quantiles are the quantiles, between 0 and 1 exclusive, computed over the values of each group when
+	// output_metric_type is summary, e.g. [0.5, 0.99]
+	Quantiles []float64 `mapstructure:"quantiles" json:"quantiles,omitempty"`
 }
 
 var _ component.Config = (*Config)(nil)
 
+// validAggregationTypes are the aggregation types supported by calculateAggregatedValue
+var validAggregationTypes = map[string]bool{
+	"sum":          true,
+	"mean":         true,
+	"min":          true,
+	"max":          true,
+	"count":        true,
+	"mode":         true,
+	"trimmed_mean": true,
+}
+
+// defaultGroupValueTransforms are applied when normalize_group_values is set without explicit transforms
+var defaultGroupValueTransforms = []string{"trim", "lowercase"}
+
+// defaultMissingLabelPlaceholder is the group value of missing group-by labels with the placeholder policy
+const defaultMissingLabelPlaceholder = "__missing__"
+
+// missingLabelPlaceholder returns the group value of a missing group-by label, or false when
+// missing labels are excluded from the group key
+func (cfg *Config) missingLabelPlaceholder() (string, bool) {
+	if cfg.MissingLabelPolicy != "placeholder" {
+		return "", false
+	}
+	if cfg.MissingLabelPlaceholder == "" {
+		return defaultMissingLabelPlaceholder, true
+	}
+	return cfg.MissingLabelPlaceholder, true
+}
+
+// replacesOutput reports whether aggregated metrics are returned in a new batch instead of the input
+func (cfg *Config) replacesOutput() bool {
+	return cfg.OutputMode == "replace"
+}
+
 // Validate checks the receiver configuration is valid
 func (cfg *Config) Validate() error {
 	if len(cfg.GroupByLabels) == 0 {
@@ -44,7 +230,50 @@ func (cfg *Config) Validate() error {
 		return errors.New("at least one aggregation rule must be specified")
 	}
 
-	for i, rule := range cfg.AggregationRules {
+	validOnRuleErrors := map[string]bool{
+		"skip": true,
+		"fail": true,
+	}
+	if cfg.OnRuleError != "" && !validOnRuleErrors[cfg.OnRuleError] {
+		return fmt.Errorf("invalid on_rule_error '%s', must be 'skip' or 'fail'", cfg.OnRuleError)
+	}
+
+	if cfg.MissingLabelPolicy != "" && cfg.MissingLabelPolicy != "exclude" && cfg.MissingLabelPolicy != "placeholder" {
+		return fmt.Errorf("invalid missing_label_policy '%s', must be 'exclude' or 'placeholder'", cfg.MissingLabelPolicy)
+	}
+
+	if cfg.LabelPrecedence != "" && cfg.LabelPrecedence != "datapoint" && cfg.LabelPrecedence != "resource" {
+		return fmt.Errorf("invalid label_precedence '%s', must be 'datapoint' or 'resource'", cfg.LabelPrecedence)
+	}
+
+	if cfg.OutputMode != "" && cfg.OutputMode != "append" && cfg.OutputMode != "replace" {
+		return fmt.Errorf("invalid output_mode '%s', must be 'append' or 'replace'", cfg.OutputMode)
+	}
+
+	if cfg.MaxTotalGroups < 0 {
+		return fmt.Errorf("max_total_groups cannot be negative, got %d", cfg.MaxTotalGroups)
+	}
+
+	// Anyone reaching the rules API can change what the processor emits
+	if cfg.RulesAPIEndpoint != "" && cfg.RulesAPIToken == "" && !isLoopbackEndpoint(cfg.RulesAPIEndpoint) {
+		return fmt.Errorf("rules_api_token is required when rules_api_endpoint '%s' is not a loopback address", cfg.RulesAPIEndpoint)
+	}
+
+	validGroupValueTransforms := map[string]bool{
+		"trim":      true,
+		"lowercase": true,
+	}
+	for _, transform := range cfg.GroupValueTransforms {
+		if !validGroupValueTransforms[transform] {
+			return fmt.Errorf("invalid group_value_transforms entry '%s', must be 'trim' or 'lowercase'", transform)
+		}
+	}
+
+	rules, err := resolveRuleTemplates(cfg.AggregationRules, cfg.RuleTemplates)
+	if err != nil {
+		return err
+	}
+	for i, rule := range rules {
 		if err := validateAggregationRule(rule, i); err != nil {
 			return err
 		}
@@ -53,9 +282,52 @@ func (cfg *Config) Validate() error {
 	return nil
 }
 
+// resolveRuleTemplates returns the rules with the fields of the template they extend filled in
+func resolveRuleTemplates(rules []AggregationRule, templates map[string]AggregationRule) ([]AggregationRule, error) {
+	for name, template := range templates {
+		if template.Extends != "" {
+			return nil, fmt.Errorf("rule template '%s': templates cannot extend another template", name)
+		}
+	}
+
+	resolved := make([]AggregationRule, len(rules))
+	for i, rule := range rules {
+		if rule.Extends == "" {
+			resolved[i] = rule
+			continue
+		}
+
+		template, ok := templates[rule.Extends]
+		if !ok {
+			return nil, fmt.Errorf("aggregation rule %d: unknown rule template '%s'", i, rule.Extends)
+		}
+		resolved[i] = applyRuleTemplate(template, rule)
+	}
+	return resolved, nil
+}
+
+// applyRuleTemplate returns the template with every field set on the rule overriding it.
+// A field is set when it is not its zero value, so a rule cannot turn off a boolean the template enables.
+func applyRuleTemplate(template AggregationRule, rule AggregationRule) AggregationRule {
+	resolved := template
+	ruleValue := reflect.ValueOf(rule)
+	resolvedValue := reflect.ValueOf(&resolved).Elem()
+	for i := 0; i < ruleValue.NumField(); i++ {
+		if field := ruleValue.Field(i); !field.IsZero() {
+			resolvedValue.Field(i).Set(field)
+		}
+	}
+	return resolved
+}
+
 func validateAggregationRule(rule AggregationRule, index int) error {
-	if rule.MetricPattern == "" {
-		return fmt.Errorf("aggregation rule %d: metric_pattern cannot be empty", index)
+	if rule.MetricPattern == "" && len(rule.MetricPatterns) == 0 {
+		return fmt.Errorf("aggregation rule %d: metric_pattern cannot be empty unless metric_patterns is set", index)
+	}
+	for i, pattern := range rule.MetricPatterns {
+		if pattern == "" {
+			return fmt.Errorf("aggregation rule %d: metric_patterns[%d] cannot be empty", index, i)
+		}
 	}
 
 	if rule.MatchType == "" {
@@ -70,10 +342,18 @@ func validateAggregationRule(rule AggregationRule, index int) error {
 		return fmt.Errorf("aggregation rule %d: invalid match_type '%s', must be 'strict' or 'regex'", index, rule.MatchType)
 	}
 
-	// Validate regex pattern if match_type is regex
+	// Validate regex patterns if match_type is regex
 	if rule.MatchType == "regex" {
-		if _, err := regexp.Compile(rule.MetricPattern); err != nil {
-			return fmt.Errorf("aggregation rule %d: invalid regex pattern '%s': %w", index, rule.MetricPattern, err)
+		for _, pattern := range getMetricPatterns(rule) {
+			if _, err := regexp.Compile(pattern); err != nil {
+				return fmt.Errorf("aggregation rule %d: invalid regex pattern '%s': %w", index, pattern, err)
+			}
+		}
+	}
+
+	if rule.MatchDescriptionRegex != "" {
+		if _, err := regexp.Compile(rule.MatchDescriptionRegex); err != nil {
+			return fmt.Errorf("aggregation rule %d: invalid match_description_regex '%s': %w", index, rule.MatchDescriptionRegex, err)
 		}
 	}
 
@@ -81,27 +361,173 @@ func validateAggregationRule(rule AggregationRule, index int) error {
 		return fmt.Errorf("aggregation rule %d: output_metric_name cannot be empty", index)
 	}
 
-	validAggregationTypes := map[string]bool{
-		"sum":   true,
-		"mean":  true,
-		"min":   true,
-		"max":   true,
-		"count": true,
-	}
 	if rule.AggregationType == "" {
 		rule.AggregationType = "sum" // default
 	}
 	if !validAggregationTypes[rule.AggregationType] {
-		return fmt.Errorf("aggregation rule %d: invalid aggregation_type '%s', must be one of: sum, mean, min, max, count", index, rule.AggregationType)
+		return fmt.Errorf("aggregation rule %d: invalid aggregation_type '%s', must be one of: sum, mean, min, max, count, mode, trimmed_mean", index, rule.AggregationType)
 	}
 
 	validOutputTypes := map[string]bool{
 		"gauge":     true,
 		"sum":       true,
 		"histogram": true,
+		"summary":   true,
 	}
 	if rule.OutputMetricType != "" && !validOutputTypes[rule.OutputMetricType] {
-		return fmt.Errorf("aggregation rule %d: invalid output_metric_type '%s', must be one of: gauge, sum, histogram", index, rule.OutputMetricType)
+		return fmt.Errorf("aggregation rule %d: invalid output_metric_type '%s', must be one of: gauge, sum, histogram, summary", index, rule.OutputMetricType)
+	}
+
+	if rule.OutputMonotonic != nil && rule.OutputMetricType != "sum" {
+		return fmt.Errorf("aggregation rule %d: output_monotonic requires output_metric_type 'sum'", index)
+	}
+
+	if rule.OutputTemporality != "" {
+		if rule.OutputTemporality != "cumulative" && rule.OutputTemporality != "delta" {
+			return fmt.Errorf("aggregation rule %d: invalid output_temporality '%s', must be 'cumulative' or 'delta'", index, rule.OutputTemporality)
+		}
+		if rule.OutputMetricType != "sum" {
+			return fmt.Errorf("aggregation rule %d: output_temporality requires output_metric_type 'sum'", index)
+		}
+	}
+
+	if rule.EmitContributors && rule.OutputMetricType != "histogram" {
+		return fmt.Errorf("aggregation rule %d: emit_contributors requires output_metric_type 'histogram'", index)
+	}
+
+	if rule.WithStdDev {
+		if rule.AggregationType != "mean" {
+			return fmt.Errorf("aggregation rule %d: with_stddev requires aggregation_type 'mean'", index)
+		}
+		if rule.OutputMetricType == "histogram" || rule.OutputMetricType == "summary" {
+			return fmt.Errorf("aggregation rule %d: with_stddev cannot be used with output_metric_type '%s'", index, rule.OutputMetricType)
+		}
+	}
+
+	if rule.CumulativeMergeStrategy != "" {
+		if rule.CumulativeMergeStrategy != "none" && rule.CumulativeMergeStrategy != "latest" {
+			return fmt.Errorf("aggregation rule %d: invalid cumulative_merge_strategy '%s', must be 'none' or 'latest'", index, rule.CumulativeMergeStrategy)
+		}
+		if rule.CumulativeMergeStrategy == "latest" && rule.AggregationType != "sum" {
+			return fmt.Errorf("aggregation rule %d: cumulative_merge_strategy 'latest' requires aggregation_type 'sum'", index)
+		}
+		if rule.CumulativeMergeStrategy == "latest" && rule.TimestampStrategy != "" && rule.TimestampStrategy != "latest" {
+			return fmt.Errorf("aggregation rule %d: cumulative_merge_strategy 'latest' requires timestamp_strategy 'latest'", index)
+		}
+	}
+
+	if rule.TrimFraction < 0 || rule.TrimFraction >= 0.5 {
+		return fmt.Errorf("aggregation rule %d: trim_fraction must be at least 0 and below 0.5, got %g", index, rule.TrimFraction)
+	}
+	if rule.TrimFraction > 0 && rule.AggregationType != "trimmed_mean" {
+		return fmt.Errorf("aggregation rule %d: trim_fraction requires aggregation_type 'trimmed_mean'", index)
+	}
+
+	if rule.SampleRate < 0 || rule.SampleRate > 1 {
+		return fmt.Errorf("aggregation rule %d: sample_rate must be between 0 and 1, got %g", index, rule.SampleRate)
+	}
+
+	if rule.MaxRankedSources < 0 || rule.MaxRankedSources > maxRankedSourcesLimit {
+		return fmt.Errorf("aggregation rule %d: max_ranked_sources must be between 0 and %d, got %d", index, maxRankedSourcesLimit, rule.MaxRankedSources)
+	}
+	if rule.MaxRankedSources > 0 && !rule.EmitSourceRanks {
+		return fmt.Errorf("aggregation rule %d: max_ranked_sources requires emit_source_ranks", index)
+	}
+
+	if _, err := parseValueTransform(rule.ValueTransform); err != nil {
+		return fmt.Errorf("aggregation rule %d: invalid value_transform: %w", index, err)
+	}
+
+	if rule.ExpectedSources < 0 {
+		return fmt.Errorf("aggregation rule %d: expected_sources cannot be negative, got %d", index, rule.ExpectedSources)
+	}
+	if rule.MinFraction < 0 || rule.MinFraction > 1 {
+		return fmt.Errorf("aggregation rule %d: min_fraction must be between 0 and 1, got %g", index, rule.MinFraction)
+	}
+	if (rule.MinFraction > 0 || rule.EmitIncompleteMarker) && rule.ExpectedSources == 0 {
+		return fmt.Errorf("aggregation rule %d: min_fraction and emit_incomplete_marker require expected_sources", index)
+	}
+
+	if rule.HistogramValueSource != "" && rule.HistogramValueSource != "sum" && rule.HistogramValueSource != "count" {
+		return fmt.Errorf("aggregation rule %d: invalid histogram_value_source '%s', must be 'sum' or 'count'", index, rule.HistogramValueSource)
+	}
+
+	validUnitMismatchPolicies := map[string]bool{
+		"ignore": true,
+		"skip":   true,
+		"split":  true,
+	}
+	if rule.UnitMismatchPolicy != "" && !validUnitMismatchPolicies[rule.UnitMismatchPolicy] {
+		return fmt.Errorf("aggregation rule %d: invalid unit_mismatch_policy '%s', must be one of: ignore, skip, split", index, rule.UnitMismatchPolicy)
+	}
+
+	if len(rule.HistogramBounds) > 0 {
+		if rule.OutputMetricType != "histogram" {
+			return fmt.Errorf("aggregation rule %d: histogram_bounds requires output_metric_type 'histogram'", index)
+		}
+		for i := 1; i < len(rule.HistogramBounds); i++ {
+			if rule.HistogramBounds[i] <= rule.HistogramBounds[i-1] {
+				return fmt.Errorf("aggregation rule %d: histogram_bounds must be strictly increasing", index)
+			}
+		}
+	}
+
+	if rule.OutputMetricType == "summary" && len(rule.Quantiles) == 0 {
+		return fmt.Errorf("aggregation rule %d: output_metric_type 'summary' requires quantiles", index)
+	}
+	if len(rule.Quantiles) > 0 && rule.OutputMetricType != "summary" {
+		return fmt.Errorf("aggregation rule %d: quantiles requires output_metric_type 'summary'", index)
+	}
+	for _, quantile := range rule.Quantiles {
+		if quantile <= 0 || quantile >= 1 {
+			return fmt.Errorf("aggregation rule %d: quantiles must be between 0 and 1 exclusive, got %g", index, quantile)
+		}
+	}
+
+	if rule.GroupByNameRegex != "" {
+		regex, err := regexp.Compile(rule.GroupByNameRegex)
+		if err != nil {
+			return fmt.Errorf("aggregation rule %d: invalid group_by_name_regex '%s': %w", index, rule.GroupByNameRegex, err)
+		}
+		if !slices.ContainsFunc(regex.SubexpNames(), func(name string) bool { return name != "" }) {
+			return fmt.Errorf("aggregation rule %d: group_by_name_regex '%s' must contain a named capture group", index, rule.GroupByNameRegex)
+		}
+	}
+
+	for i, groupBySet := range rule.GroupBySets {
+		if len(groupBySet) == 0 {
+			return fmt.Errorf("aggregation rule %d: group_by_sets[%d] cannot be empty", index, i)
+		}
+	}
+
+	if rule.ConsumeMatched && rule.PreserveOriginalMetrics {
+		return fmt.Errorf("aggregation rule %d: consume_matched removes the matched metrics and cannot be combined with preserve_original_metrics", index)
+	}
+
+	if rule.EnrichOriginalsWithAggregate {
+		if !rule.PreserveOriginalMetrics {
+			return fmt.Errorf("aggregation rule %d: enrich_originals_with_aggregate requires preserve_original_metrics", index)
+		}
+		// The originals do not carry the labels of these groupings
+		if len(rule.GroupBySets) > 0 || rule.GroupByNameRegex != "" {
+			return fmt.Errorf("aggregation rule %d: enrich_originals_with_aggregate cannot be combined with group_by_sets or group_by_name_regex", index)
+		}
+	}
+
+	if !rule.TimeWindowStart.IsZero() && !rule.TimeWindowEnd.IsZero() && rule.TimeWindowEnd.Before(rule.TimeWindowStart) {
+		return fmt.Errorf("aggregation rule %d: time_window_end cannot be before time_window_start", index)
+	}
+	if rule.MaxAge < 0 {
+		return fmt.Errorf("aggregation rule %d: max_age cannot be negative, got %s", index, rule.MaxAge)
+	}
+
+	validTimestampStrategies := map[string]bool{
+		"latest":   true,
+		"earliest": true,
+		"now":      true,
+	}
+	if rule.TimestampStrategy != "" && !validTimestampStrategies[rule.TimestampStrategy] {
+		return fmt.Errorf("aggregation rule %d: invalid timestamp_strategy '%s', must be one of: latest, earliest, now", index, rule.TimestampStrategy)
 	}
 
 	return nil
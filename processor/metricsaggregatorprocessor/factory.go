@@ -30,7 +30,9 @@ func NewFactory() processor.Factory {
 
 func createDefaultConfig() component.Config {
 	return &Config{
-		AggregationRules: []AggregationRule{},
+		AggregationRules:    []AggregationRule{},
+		OnRuleError:         "skip",
+		EmitOriginalMetrics: true,
 	}
 }
 
@@ -41,14 +43,24 @@ func createMetricsProcessor(
 	nextConsumer consumer.Metrics,
 ) (processor.Metrics, error) {
 	processorConfig := cfg.(*Config)
+	// Instances created for other pipelines with the same ID share the rule set and the rules API server,
+	// which is started by the first of them and stopped with the first one shut down
+	rules, err := rulesAPIs.LoadOrStore(set.ID, func() (*rulesAPI, error) {
+		return newRulesAPI(processorConfig, set.Logger), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	metricsProcessor := newMetricsAggregatorProcessorWithRules(rules.Unwrap(), set.Logger)
 	return processorhelper.NewMetrics(
 		ctx,
 		set,
 		cfg,
 		nextConsumer,
-		newMetricsAggregatorProcessor(processorConfig, set.Logger).processMetrics,
-		processorhelper.WithCapabilities(consumer.Capabilities{MutatesData: true}),
-		processorhelper.WithStart(func(context.Context, component.Host) error { return nil }),
-		processorhelper.WithShutdown(func(context.Context) error { return nil }),
+		metricsProcessor.processMetrics,
+		// In replace mode the incoming batch is only read, the pipeline does not need to clone it for us
+		processorhelper.WithCapabilities(consumer.Capabilities{MutatesData: !processorConfig.replacesOutput()}),
+		processorhelper.WithStart(rules.Start),
+		processorhelper.WithShutdown(rules.Shutdown),
 	)
 }
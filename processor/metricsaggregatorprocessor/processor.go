@@ -6,8 +6,18 @@ package metricsaggregatorprocessor
 import (
 	"context"
 	"fmt"
+	"hash/fnv"
+	"maps"
+	"math"
+	"os"
+	"reflect"
 	"regexp"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"go.opentelemetry.io/collector/pdata/pcommon"
@@ -15,10 +25,128 @@ import (
 	"go.uber.org/zap"
 )
 
+const (
+	// ruleNameScopeAttribute is the scope attribute carrying the name of the rule that produced an aggregated metric
+	ruleNameScopeAttribute = "metricsaggregator.rule"
+
+	// dataAgeAttribute is the data point attribute carrying the age of the latest source data point of an aggregate
+	dataAgeAttribute = "data.age.seconds"
+
+	// scopeNameAttribute is the data point attribute carrying the source scope of a per-scope subtotal
+	scopeNameAttribute = "scope.name"
+
+	// overflowGroupKey is the group collecting the data points beyond max_total_groups
+	overflowGroupKey = "__overflow__"
+
+	// outputScopeName is the name of the scope of the aggregated metrics
+	outputScopeName = "metricsaggregator"
+
+	// lineageAttribute is the data point attribute describing how an aggregated value was computed
+	lineageAttribute = "aggregation.lineage"
+
+	// sourcePatternAttribute and matchTypeAttribute are the data point attributes recording the
+	// metric_pattern and match_type of the rule that produced an aggregate
+	sourcePatternAttribute = "aggregation.source_pattern"
+	matchTypeAttribute     = "aggregation.match_type"
+
+	// heartbeatMetricName is the gauge emitted with emit_heartbeat, set to the time of the last run
+	heartbeatMetricName = "metricsaggregator_last_run_timestamp_seconds"
+
+	// originalsRemovedMetricName is the gauge emitted with emit_originals_removed, with one data point per rule
+	// labelled with ruleAttribute
+	originalsRemovedMetricName = "metricsaggregator_originals_removed"
+	ruleAttribute              = "rule"
+
+	// groupOverflowMetricName is the counter of the data points folded into the overflow group, emitted
+	// with max_total_groups
+	groupOverflowMetricName = "metricsaggregator_group_overflow_total"
+
+	// outputCollisionsMetricName is the counter of the aggregated series that collided with another one,
+	// emitted once a collision happened
+	outputCollisionsMetricName = "metricsaggregator_output_collisions_total"
+
+	// incompleteMetricName is the gauge emitted with emit_incomplete_marker in place of a group with too few
+	// sources, and incompleteOutputAttribute names the output it replaces
+	incompleteMetricName      = "aggregation_incomplete"
+	incompleteOutputAttribute = "aggregation.output_metric"
+
+	// contributorsAttribute is the data point attribute of histogram outputs carrying the number of source data points
+	contributorsAttribute = "aggregation.contributors"
+
+	// sourceRankAttribute and sourceQuantileAttribute are the data point attributes of emit_source_ranks
+	// companions, carrying the rank of a source in its group (1 is the lowest value) and its quantile rank
+	// (0 for the lowest value, 1 for the highest)
+	sourceRankAttribute     = "aggregation.source_rank"
+	sourceQuantileAttribute = "aggregation.source_quantile"
+
+	// samplingBuckets is the number of hash buckets used to turn a rule's sample_rate into a decision
+	samplingBuckets = 10000
+
+	// defaultMaxRankedSources is the largest group ranked by emit_source_ranks when max_ranked_sources is
+	// unset, and maxRankedSourcesLimit the largest max_ranked_sources allowed, since every ranked source
+	// becomes a series
+	defaultMaxRankedSources = 10
+	maxRankedSourcesLimit   = 100
+
+	// counterResetStateTTL is how long detect_counter_resets keeps the state of an input series after its
+	// last data point, and counterResetSweepInterval how often the expired state is dropped
+	counterResetStateTTL      = time.Hour
+	counterResetSweepInterval = time.Minute
+)
+
 // metricsAggregatorProcessor implements cross-resource metric aggregation
 type metricsAggregatorProcessor struct {
-	config *Config
+	// rules holds the config, shared with the other instances of the processor ID so that the
+	// rules API replaces the aggregation rules of all of them
+	rules  *rulesAPI
 	logger *zap.Logger
+
+	// startTime is the start timestamp of the counters the processor emits about itself
+	startTime time.Time
+
+	// outputResourceAttributes are the configured output resource attributes with environment variables expanded
+	outputResourceAttributes map[string]string
+
+	// counterResets tracks cumulative sum series for rules with detect_counter_resets, keyed by series.
+	// counterResetsConfig is the config the state was built for, so that it is dropped when the rules
+	// are replaced, and counterResetsSwept the last time expired state was dropped.
+	counterResetsMu     sync.Mutex
+	counterResets       map[string]*counterResetState
+	counterResetsConfig *Config
+	counterResetsSwept  time.Time
+
+	// outputCollisions counts aggregated series that collided with another one on name and labels
+	outputCollisions atomic.Int64
+
+	// groupOverflows counts the data points folded into the overflow group because of max_total_groups
+	groupOverflows atomic.Int64
+}
+
+// GroupLabelUsage tells which group-by labels of a rule were present on the data points it matched
+// in its last run. Missing labels are left out of the group key, so unused labels did not split any group.
+type GroupLabelUsage struct {
+	Rule          string    `json:"rule"`
+	GroupByLabels []string  `json:"group_by_labels"`
+	UsedLabels    []string  `json:"used_labels"`
+	UnusedLabels  []string  `json:"unused_labels"`
+	DataPoints    int       `json:"data_points"`
+	LastRun       time.Time `json:"last_run"`
+}
+
+// counterResetState holds the last observed data point of a cumulative series and the
+// total of the values lost to resets, which is added back to every later value.
+// Int series are tracked in int64, so their sums stay exact.
+type counterResetState struct {
+	valueType      pmetric.NumberDataPointValueType
+	startTimestamp pcommon.Timestamp
+	timestamp      pcommon.Timestamp
+	lastSeen       time.Time
+
+	lastInt   int64
+	intOffset int64
+
+	lastDouble   float64
+	doubleOffset float64
 }
 
 // aggregationState holds the state for ongoing aggregations
@@ -29,43 +157,285 @@ type aggregationState struct {
 
 // newMetricsAggregatorProcessor creates a new cross-resource aggregation processor
 func newMetricsAggregatorProcessor(config *Config, logger *zap.Logger) *metricsAggregatorProcessor {
+	return newMetricsAggregatorProcessorWithRules(newRulesAPI(config, logger), logger)
+}
+
+// newMetricsAggregatorProcessorWithRules creates a processor running the rules shared by its processor ID
+func newMetricsAggregatorProcessorWithRules(rules *rulesAPI, logger *zap.Logger) *metricsAggregatorProcessor {
 	return &metricsAggregatorProcessor{
-		config: config,
-		logger: logger,
+		rules:                    rules,
+		logger:                   logger,
+		startTime:                time.Now(),
+		outputResourceAttributes: expandOutputResourceAttributes(rules.config.OutputResourceAttributes, logger),
+		counterResets:            make(map[string]*counterResetState),
+	}
+}
+
+// envVarPattern matches ${NAME} references to environment variables
+var envVarPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandOutputResourceAttributes returns a copy of the output resource attributes with ${NAME} references
+// replaced by the value of the environment variable. Unset variables expand to an empty string.
+func expandOutputResourceAttributes(attrs map[string]string, logger *zap.Logger) map[string]string {
+	expanded := make(map[string]string, len(attrs))
+	for key, value := range attrs {
+		expanded[key] = envVarPattern.ReplaceAllStringFunc(value, func(reference string) string {
+			name := envVarPattern.FindStringSubmatch(reference)[1]
+			envValue, found := os.LookupEnv(name)
+			if !found {
+				logger.Warn("Environment variable referenced in output_resource_attributes is not set",
+					zap.String("attribute", key),
+					zap.String("variable", name))
+			}
+			return envValue
+		})
 	}
+	return expanded
 }
 
 // processMetrics processes metrics through cross-resource aggregation rules
 func (p *metricsAggregatorProcessor) processMetrics(ctx context.Context, md pmetric.Metrics) (pmetric.Metrics, error) {
+	p.rules.configMu.RLock()
+	defer p.rules.configMu.RUnlock()
+
+	// In replace mode the rules run on a copy, so the input stays untouched for other consumers
+	if p.rules.config.replacesOutput() {
+		input := md
+		md = pmetric.NewMetrics()
+		input.CopyTo(md)
+	}
+
+	// Rules that do not consume their matched metrics leave them visible to later rules
+	var deferredRemovals []AggregationRule
+
+	// Number of original metrics removed by each rule that does not preserve them, in rule order
+	var originalsRemoved []ruleCount
+
 	// Process each aggregation rule sequentially
-	for _, rule := range p.config.AggregationRules {
-		if err := p.processAggregationRule(md, rule); err != nil {
+	for _, rule := range p.rules.config.AggregationRules {
+		consumed, err := p.processAggregationRule(md, rule)
+		if err != nil {
+			if p.rules.config.OnRuleError == "fail" {
+				return md, fmt.Errorf("aggregation rule %s failed: %w", rule.OutputMetricName, err)
+			}
 			p.logger.Error("Failed to process aggregation rule",
 				zap.String("rule", rule.OutputMetricName),
 				zap.Error(err))
 			continue
 		}
+
+		if rule.ConsumeMatched {
+			originalsRemoved = append(originalsRemoved, ruleCount{rule: getRuleName(rule), count: consumed})
+		} else if !rule.PreserveOriginalMetrics {
+			deferredRemovals = append(deferredRemovals, rule)
+		}
+	}
+
+	// Remove the originals only once every rule has seen them
+	for _, rule := range deferredRemovals {
+		removed := p.removeOriginalMetrics(md, rule)
+		originalsRemoved = append(originalsRemoved, ruleCount{rule: getRuleName(rule), count: removed})
+	}
+
+	// In emit-only and replace modes just the aggregator's outputs leave the processor
+	if !p.rules.config.EmitOriginalMetrics || p.rules.config.replacesOutput() {
+		md.ResourceMetrics().RemoveIf(func(rm pmetric.ResourceMetrics) bool {
+			return !p.hasAggregatedMarkerAttributes(rm.Resource().Attributes(), p.outputResourceAttributes)
+		})
+	}
+
+	// Series with the same name and labels collapse into one Prometheus series and break scrapes
+	if collisions := p.detectOutputCollisions(md); len(collisions) > 0 {
+		total := p.outputCollisions.Add(int64(len(collisions)))
+		p.logger.Warn("Aggregated metrics collide on name and labels, check the output names of the aggregation rules",
+			zap.Strings("metrics", collisions),
+			zap.Int64("collisions_total", total))
+		if p.rules.config.StrictCollisions {
+			return md, fmt.Errorf("aggregated metrics collide on name and labels: %s", strings.Join(collisions, ", "))
+		}
+	}
+
+	if collisions := p.outputCollisions.Load(); collisions > 0 {
+		p.appendCounter(md, outputCollisionsMetricName, "Number of aggregated series that collided with another one on name and labels",
+			"{series}", collisions, time.Now())
+	}
+
+	if p.rules.config.MaxTotalGroups > 0 {
+		p.appendCounter(md, groupOverflowMetricName, "Number of data points folded into the overflow group because of max_total_groups",
+			"{datapoint}", p.groupOverflows.Load(), time.Now())
+	}
+
+	if p.rules.config.EmitHeartbeat {
+		p.appendHeartbeat(md, time.Now())
+	}
+
+	if p.rules.config.EmitOriginalsRemoved && len(originalsRemoved) > 0 {
+		p.appendOriginalsRemoved(md, originalsRemoved, time.Now())
 	}
 
 	return md, nil
 }
 
-// processAggregationRule processes a single aggregation rule
-func (p *metricsAggregatorProcessor) processAggregationRule(md pmetric.Metrics, rule AggregationRule) error {
+// ruleCount is a count reported for one aggregation rule
+type ruleCount struct {
+	rule  string
+	count int
+}
+
+// appendOriginalsRemoved adds the originals removed gauge, with one data point per rule carrying the
+// number of original metrics the rule removed from the batch
+func (p *metricsAggregatorProcessor) appendOriginalsRemoved(md pmetric.Metrics, counts []ruleCount, now time.Time) {
+	metric := p.appendSelfMetric(md)
+	metric.SetName(originalsRemovedMetricName)
+	metric.SetDescription("Number of original metrics removed from the last batch by each aggregation rule")
+	metric.SetUnit("{metric}")
+	dps := metric.SetEmptyGauge().DataPoints()
+	for _, count := range counts {
+		dp := dps.AppendEmpty()
+		dp.SetTimestamp(pcommon.NewTimestampFromTime(now))
+		dp.SetIntValue(int64(count.count))
+		dp.Attributes().PutStr(ruleAttribute, count.rule)
+	}
+}
+
+// appendHeartbeat adds the heartbeat gauge, carrying the output resource attributes, to the batch
+func (p *metricsAggregatorProcessor) appendHeartbeat(md pmetric.Metrics, now time.Time) {
+	metric := p.appendSelfMetric(md)
+	metric.SetName(heartbeatMetricName)
+	metric.SetDescription("Time of the last metrics aggregator run")
+	metric.SetUnit("s")
+	dp := metric.SetEmptyGauge().DataPoints().AppendEmpty()
+	dp.SetTimestamp(pcommon.NewTimestampFromTime(now))
+	dp.SetDoubleValue(float64(now.UnixNano()) / float64(time.Second))
+}
+
+// appendCounter adds a monotonic cumulative counter, counting since the processor started, to the batch
+func (p *metricsAggregatorProcessor) appendCounter(md pmetric.Metrics, name string, description string, unit string, value int64, now time.Time) {
+	metric := p.appendSelfMetric(md)
+	metric.SetName(name)
+	metric.SetDescription(description)
+	metric.SetUnit(unit)
+	sum := metric.SetEmptySum()
+	sum.SetIsMonotonic(true)
+	sum.SetAggregationTemporality(pmetric.AggregationTemporalityCumulative)
+	dp := sum.DataPoints().AppendEmpty()
+	dp.SetStartTimestamp(pcommon.NewTimestampFromTime(p.startTime))
+	dp.SetTimestamp(pcommon.NewTimestampFromTime(now))
+	dp.SetIntValue(value)
+}
+
+// appendSelfMetric adds a resource carrying the output resource attributes to the batch, and returns a new
+// metric in its aggregator scope for the processor to report about itself
+func (p *metricsAggregatorProcessor) appendSelfMetric(md pmetric.Metrics) pmetric.Metric {
+	rm := md.ResourceMetrics().AppendEmpty()
+	for key, value := range p.outputResourceAttributes {
+		rm.Resource().Attributes().PutStr(key, value)
+	}
+
+	sm := rm.ScopeMetrics().AppendEmpty()
+	sm.Scope().SetName(outputScopeName)
+	sm.Scope().SetVersion("1.0.0")
+	return sm.Metrics().AppendEmpty()
+}
+
+// detectOutputCollisions returns the names of the aggregated series that have the same name, resource
+// attributes and data point attributes as another aggregated series in the batch, once per collision
+func (p *metricsAggregatorProcessor) detectOutputCollisions(md pmetric.Metrics) []string {
+	seen := make(map[string]bool)
+	var collisions []string
+
+	for i := 0; i < md.ResourceMetrics().Len(); i++ {
+		rm := md.ResourceMetrics().At(i)
+		if !p.hasAggregatedMarkerAttributes(rm.Resource().Attributes(), p.outputResourceAttributes) {
+			continue
+		}
+
+		for j := 0; j < rm.ScopeMetrics().Len(); j++ {
+			metrics := rm.ScopeMetrics().At(j).Metrics()
+			for k := 0; k < metrics.Len(); k++ {
+				metric := metrics.At(k)
+				for _, dpAttrs := range getDataPointAttributes(metric) {
+					key := p.buildSeriesKey("", metric.Name(), rm.Resource().Attributes(), dpAttrs)
+					if seen[key] {
+						collisions = append(collisions, metric.Name())
+						continue
+					}
+					seen[key] = true
+				}
+			}
+		}
+	}
+
+	return collisions
+}
+
+// getDataPointAttributes returns the attributes of every data point of a metric
+func getDataPointAttributes(metric pmetric.Metric) []pcommon.Map {
+	var attrs []pcommon.Map
+	switch metric.Type() {
+	case pmetric.MetricTypeGauge:
+		for i := 0; i < metric.Gauge().DataPoints().Len(); i++ {
+			attrs = append(attrs, metric.Gauge().DataPoints().At(i).Attributes())
+		}
+	case pmetric.MetricTypeSum:
+		for i := 0; i < metric.Sum().DataPoints().Len(); i++ {
+			attrs = append(attrs, metric.Sum().DataPoints().At(i).Attributes())
+		}
+	case pmetric.MetricTypeHistogram:
+		for i := 0; i < metric.Histogram().DataPoints().Len(); i++ {
+			attrs = append(attrs, metric.Histogram().DataPoints().At(i).Attributes())
+		}
+	case pmetric.MetricTypeSummary:
+		for i := 0; i < metric.Summary().DataPoints().Len(); i++ {
+			attrs = append(attrs, metric.Summary().DataPoints().At(i).Attributes())
+		}
+	}
+	return attrs
+}
+
+// processAggregationRule processes a single aggregation rule and returns the number of originals it consumed
+func (p *metricsAggregatorProcessor) processAggregationRule(md pmetric.Metrics, rule AggregationRule) (int, error) {
+	if rule.MatchType == "regex" {
+		for _, pattern := range getMetricPatterns(rule) {
+			if _, err := regexp.Compile(pattern); err != nil {
+				return 0, fmt.Errorf("invalid regex pattern '%s': %w", pattern, err)
+			}
+		}
+	}
+	if rule.GroupByNameRegex != "" {
+		if _, err := regexp.Compile(rule.GroupByNameRegex); err != nil {
+			return 0, fmt.Errorf("invalid group_by_name_regex '%s': %w", rule.GroupByNameRegex, err)
+		}
+	}
+	if rule.MatchDescriptionRegex != "" {
+		if _, err := regexp.Compile(rule.MatchDescriptionRegex); err != nil {
+			return 0, fmt.Errorf("invalid match_description_regex '%s': %w", rule.MatchDescriptionRegex, err)
+		}
+	}
+
 	// Step 1: Collect matching metrics
 	matchingMetrics := p.collectMatchingMetrics(md, rule)
+	p.recordGroupLabelUsage(rule, matchingMetrics)
 	if len(matchingMetrics) == 0 {
-		return nil // No metrics to aggregate
+		return 0, nil // No metrics to aggregate
 	}
 
 	// Step 2: Aggregate collected metrics and get grouped results using global config
-	groupedResults := p.aggregateMetricsByResourceContext(matchingMetrics, rule)
+	groupedResults := p.aggregateMetricsByUnit(matchingMetrics, rule)
 	if len(groupedResults) == 0 {
-		return nil // Nothing to aggregate
+		return 0, nil // Nothing to aggregate
 	}
 
 	// Step 3: Create separate resources for each resource context
 	for _, result := range groupedResults {
+		// Rule-specific markers let downstream tell the outputs of different rules apart
+		result.ResourceAttrs = addRuleResourceAttributes(result.ResourceAttrs, rule.RuleResourceAttributes)
+
+		// Merge into an aggregated metric of the same name and resource if the batch already contains one
+		if rule.MergeIntoExisting && p.mergeIntoExistingMetric(md, result) {
+			continue
+		}
+
 		aggregatedRM := md.ResourceMetrics().AppendEmpty()
 
 		// Set resource attributes for this specific resource context
@@ -74,157 +444,1362 @@ func (p *metricsAggregatorProcessor) processAggregationRule(md pmetric.Metrics,
 		}
 
 		// Apply global output resource attributes (these mark the resource as aggregated)
-		for key, value := range p.config.OutputResourceAttributes {
+		for key, value := range p.outputResourceAttributes {
 			aggregatedRM.Resource().Attributes().PutStr(key, value)
 		}
 
 		// Add the aggregated metric to this resource
 		sm := aggregatedRM.ScopeMetrics().AppendEmpty()
-		sm.Scope().SetName("metricsaggregator")
+		sm.Scope().SetName(p.getOutputScopeName(aggregatedRM.Resource().Attributes()))
 		sm.Scope().SetVersion("1.0.0")
+		sm.Scope().Attributes().PutStr(ruleNameScopeAttribute, getRuleName(rule))
 		result.Metric.CopyTo(sm.Metrics().AppendEmpty())
 	}
 
-	// Step 4: Remove original metrics if needed (skip aggregated resources)
-	if !rule.PreserveOriginalMetrics {
-		p.removeOriginalMetrics(md, rule)
+	// Step 4: Remove original metrics right away if the rule consumes them (skip aggregated resources).
+	// Otherwise removal is deferred until all rules ran, see processMetrics.
+	if rule.ConsumeMatched {
+		return p.removeOriginalMetrics(md, rule), nil
+	}
+
+	return 0, nil
+}
+
+// recordGroupLabelUsage records which of the rule's group-by labels are present, on the data point or
+// its resource, on at least one of the matched data points
+func (p *metricsAggregatorProcessor) recordGroupLabelUsage(rule AggregationRule, metrics []MetricWithResource) {
+	groupByLabels := p.getRuleGroupByLabels(rule)
+	present := make(map[string]bool, len(groupByLabels))
+	dataPoints := 0
+	for _, metricWithResource := range metrics {
+		for _, dpAttrs := range getDataPointAttributes(metricWithResource.Metric) {
+			dataPoints++
+			for _, label := range groupByLabels {
+				if _, ok := dpAttrs.Get(label); ok {
+					present[label] = true
+				} else if _, ok := metricWithResource.ResourceAttrs.Get(label); ok {
+					present[label] = true
+				}
+			}
+		}
+	}
+
+	usage := GroupLabelUsage{
+		Rule:          getRuleName(rule),
+		GroupByLabels: groupByLabels,
+		UsedLabels:    []string{},
+		UnusedLabels:  []string{},
+		DataPoints:    dataPoints,
+		LastRun:       time.Now(),
+	}
+	for _, label := range groupByLabels {
+		if present[label] {
+			usage.UsedLabels = append(usage.UsedLabels, label)
+		} else {
+			usage.UnusedLabels = append(usage.UnusedLabels, label)
+		}
+	}
+
+	p.rules.groupLabelUsageMu.Lock()
+	p.rules.groupLabelUsage[usage.Rule] = usage
+	p.rules.groupLabelUsageMu.Unlock()
+}
+
+// getRuleGroupByLabels returns every label a rule groups on: the labels of its group_by_sets, or the global
+// group_by_labels, and its split_by_label. Labels extracted with group_by_name_regex are not included.
+func (p *metricsAggregatorProcessor) getRuleGroupByLabels(rule AggregationRule) []string {
+	var labels []string
+	if len(rule.GroupBySets) == 0 {
+		labels = slices.Clone(p.rules.config.GroupByLabels)
+	}
+	for _, groupBySet := range rule.GroupBySets {
+		for _, label := range groupBySet {
+			if !slices.Contains(labels, label) {
+				labels = append(labels, label)
+			}
+		}
+	}
+	if rule.SplitByLabel != "" && !slices.Contains(labels, rule.SplitByLabel) {
+		labels = append(labels, rule.SplitByLabel)
+	}
+	if labels == nil {
+		labels = []string{}
+	}
+	return labels
+}
+
+// getOutputScopeName returns the scope name of an aggregated resource. With route_by_resource_attribute,
+// resources carrying that attribute get a scope named after its value, e.g. metricsaggregator/team-a.
+func (p *metricsAggregatorProcessor) getOutputScopeName(resourceAttrs pcommon.Map) string {
+	if p.rules.config.RouteByResourceAttribute == "" {
+		return outputScopeName
+	}
+	if value, ok := resourceAttrs.Get(p.rules.config.RouteByResourceAttribute); ok && value.AsString() != "" {
+		return outputScopeName + "/" + value.AsString()
+	}
+	return outputScopeName
+}
+
+// addRuleResourceAttributes returns a copy of the result's resource attributes with the rule's attributes added
+func addRuleResourceAttributes(resourceAttrs map[string]string, ruleAttrs map[string]string) map[string]string {
+	if len(ruleAttrs) == 0 {
+		return resourceAttrs
+	}
+
+	merged := make(map[string]string, len(resourceAttrs)+len(ruleAttrs))
+	for key, value := range resourceAttrs {
+		merged[key] = value
+	}
+	for key, value := range ruleAttrs {
+		merged[key] = value
+	}
+	return merged
+}
+
+// getRuleName returns the name identifying a rule, falling back to its output metric name
+func getRuleName(rule AggregationRule) string {
+	if rule.RuleName != "" {
+		return rule.RuleName
+	}
+	return rule.OutputMetricName
+}
+
+// mergeIntoExistingMetric looks for a metric with the result's name in an aggregated resource with the same
+// resource attributes and merges the result's data points into it. A data point with the same attributes
+// is replaced, others are appended. Returns false if there is no such metric to merge into.
+func (p *metricsAggregatorProcessor) mergeIntoExistingMetric(md pmetric.Metrics, result ResourceContextResult) bool {
+	expectedResourceAttrs := make(map[string]any, len(result.ResourceAttrs)+len(p.outputResourceAttributes))
+	for key, value := range result.ResourceAttrs {
+		expectedResourceAttrs[key] = value
+	}
+	for key, value := range p.outputResourceAttributes {
+		expectedResourceAttrs[key] = value
+	}
+
+	for i := 0; i < md.ResourceMetrics().Len(); i++ {
+		rm := md.ResourceMetrics().At(i)
+		if !p.hasAggregatedMarkerAttributes(rm.Resource().Attributes(), p.outputResourceAttributes) {
+			continue
+		}
+		if !reflect.DeepEqual(rm.Resource().Attributes().AsRaw(), expectedResourceAttrs) {
+			continue
+		}
+
+		for j := 0; j < rm.ScopeMetrics().Len(); j++ {
+			metrics := rm.ScopeMetrics().At(j).Metrics()
+			for k := 0; k < metrics.Len(); k++ {
+				existing := metrics.At(k)
+				if existing.Name() != result.Metric.Name() {
+					continue
+				}
+				if existing.Type() != result.Metric.Type() {
+					p.logger.Warn("Cannot merge into existing metric of a different type, appending instead",
+						zap.String("metric", existing.Name()),
+						zap.String("existing_type", existing.Type().String()),
+						zap.String("aggregated_type", result.Metric.Type().String()))
+					return false
+				}
+
+				p.mergeDataPoints(existing, result.Metric)
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// mergeDataPoints copies the data points of src into dest, replacing data points with identical attributes
+func (p *metricsAggregatorProcessor) mergeDataPoints(dest pmetric.Metric, src pmetric.Metric) {
+	switch src.Type() {
+	case pmetric.MetricTypeGauge:
+		p.mergeNumberDataPoints(dest.Gauge().DataPoints(), src.Gauge().DataPoints())
+	case pmetric.MetricTypeSum:
+		p.mergeNumberDataPoints(dest.Sum().DataPoints(), src.Sum().DataPoints())
+	case pmetric.MetricTypeHistogram:
+		destDps := dest.Histogram().DataPoints()
+		srcDps := src.Histogram().DataPoints()
+		for i := 0; i < srcDps.Len(); i++ {
+			srcDp := srcDps.At(i)
+			merged := false
+			for j := 0; j < destDps.Len(); j++ {
+				if reflect.DeepEqual(destDps.At(j).Attributes().AsRaw(), srcDp.Attributes().AsRaw()) {
+					srcDp.CopyTo(destDps.At(j))
+					merged = true
+					break
+				}
+			}
+			if !merged {
+				srcDp.CopyTo(destDps.AppendEmpty())
+			}
+		}
+	case pmetric.MetricTypeSummary:
+		destDps := dest.Summary().DataPoints()
+		srcDps := src.Summary().DataPoints()
+		for i := 0; i < srcDps.Len(); i++ {
+			srcDp := srcDps.At(i)
+			merged := false
+			for j := 0; j < destDps.Len(); j++ {
+				if reflect.DeepEqual(destDps.At(j).Attributes().AsRaw(), srcDp.Attributes().AsRaw()) {
+					srcDp.CopyTo(destDps.At(j))
+					merged = true
+					break
+				}
+			}
+			if !merged {
+				srcDp.CopyTo(destDps.AppendEmpty())
+			}
+		}
+	}
+}
+
+// mergeNumberDataPoints copies the data points of src into dest, replacing data points with identical attributes
+func (p *metricsAggregatorProcessor) mergeNumberDataPoints(dest pmetric.NumberDataPointSlice, src pmetric.NumberDataPointSlice) {
+	for i := 0; i < src.Len(); i++ {
+		srcDp := src.At(i)
+		merged := false
+		for j := 0; j < dest.Len(); j++ {
+			if reflect.DeepEqual(dest.At(j).Attributes().AsRaw(), srcDp.Attributes().AsRaw()) {
+				srcDp.CopyTo(dest.At(j))
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			srcDp.CopyTo(dest.AppendEmpty())
+		}
+	}
+}
+
+// MetricWithResource holds a metric along with its resource attributes
+type MetricWithResource struct {
+	Metric        pmetric.Metric
+	ResourceAttrs pcommon.Map
+	ScopeName     string
+}
+
+// collectMatchingMetrics finds all metrics that match the rule pattern.
+// With the skip unit mismatch policy, only the metrics with the richest unit are returned.
+func (p *metricsAggregatorProcessor) collectMatchingMetrics(md pmetric.Metrics, rule AggregationRule) []MetricWithResource {
+	matchingMetrics := p.findMatchingMetrics(md, rule)
+	if rule.UnitMismatchPolicy != "skip" {
+		return matchingMetrics
+	}
+
+	units, metricsByUnit := partitionByUnit(matchingMetrics)
+	if len(units) > 1 {
+		var skipped int
+		for _, unit := range units[1:] {
+			skipped += len(metricsByUnit[unit])
+		}
+		p.logger.Warn("Skipping matched metrics with a different unit",
+			zap.String("rule", getRuleName(rule)),
+			zap.String("unit", units[0]),
+			zap.Strings("skipped_units", units[1:]),
+			zap.Int("skipped_metrics", skipped))
+		return metricsByUnit[units[0]]
+	}
+	return matchingMetrics
+}
+
+// findMatchingMetrics returns every metric that matches the rule pattern, regardless of its unit
+func (p *metricsAggregatorProcessor) findMatchingMetrics(md pmetric.Metrics, rule AggregationRule) []MetricWithResource {
+	var matchingMetrics []MetricWithResource
+
+	for i := 0; i < md.ResourceMetrics().Len(); i++ {
+		rm := md.ResourceMetrics().At(i)
+		resourceAttrs := rm.Resource().Attributes()
+		for j := 0; j < rm.ScopeMetrics().Len(); j++ {
+			sm := rm.ScopeMetrics().At(j)
+			for k := 0; k < sm.Metrics().Len(); k++ {
+				metric := sm.Metrics().At(k)
+				if p.matchesMetric(metric, rule) {
+					matchingMetrics = append(matchingMetrics, MetricWithResource{
+						Metric:        metric,
+						ResourceAttrs: resourceAttrs,
+						ScopeName:     sm.Scope().Name(),
+					})
+				}
+			}
+		}
+	}
+
+	return matchingMetrics
+}
+
+// partitionByUnit groups metrics by their unit. The units are ordered from the richest one, shared by
+// the most metrics, to the poorest one; units with as many metrics keep the order they were first seen in.
+func partitionByUnit(metrics []MetricWithResource) ([]string, map[string][]MetricWithResource) {
+	var units []string
+	metricsByUnit := make(map[string][]MetricWithResource)
+	for _, metric := range metrics {
+		unit := metric.Metric.Unit()
+		if _, exists := metricsByUnit[unit]; !exists {
+			units = append(units, unit)
+		}
+		metricsByUnit[unit] = append(metricsByUnit[unit], metric)
+	}
+
+	sort.SliceStable(units, func(i, j int) bool {
+		return len(metricsByUnit[units[i]]) > len(metricsByUnit[units[j]])
+	})
+	return units, metricsByUnit
+}
+
+// matchesMetric checks if a metric matches the rule pattern and the rule's unit and description constraints
+func (p *metricsAggregatorProcessor) matchesMetric(metric pmetric.Metric, rule AggregationRule) bool {
+	if !p.matchesPattern(metric.Name(), rule) {
+		return false
+	}
+	if rule.MatchUnit != "" && metric.Unit() != rule.MatchUnit {
+		return false
+	}
+	if rule.MatchDescriptionRegex != "" {
+		matched, err := regexp.MatchString(rule.MatchDescriptionRegex, metric.Description())
+		if err != nil {
+			p.logger.Error("Invalid description regex",
+				zap.String("pattern", rule.MatchDescriptionRegex),
+				zap.Error(err))
+			return false
+		}
+		return matched
+	}
+	return true
+}
+
+// matchesPattern checks if a metric name matches any of the rule patterns
+func (p *metricsAggregatorProcessor) matchesPattern(metricName string, rule AggregationRule) bool {
+	for _, pattern := range getMetricPatterns(rule) {
+		switch rule.MatchType {
+		case "strict", "":
+			if metricName == pattern {
+				return true
+			}
+		case "regex":
+			matched, err := regexp.MatchString(pattern, metricName)
+			if err != nil {
+				p.logger.Error("Invalid regex pattern",
+					zap.String("pattern", pattern),
+					zap.Error(err))
+				continue
+			}
+			if matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// getMetricPatterns returns the metric_pattern of a rule, when set, followed by its metric_patterns
+func getMetricPatterns(rule AggregationRule) []string {
+	if rule.MetricPattern == "" {
+		return rule.MetricPatterns
+	}
+	return append([]string{rule.MetricPattern}, rule.MetricPatterns...)
+}
+
+// ResourceContextResult represents an aggregated metric for a specific resource context
+type ResourceContextResult struct {
+	Metric        pmetric.Metric
+	ResourceAttrs map[string]string
+}
+
+// aggregateMetricsByUnit aggregates the metrics according to the rule's unit mismatch policy.
+// With the split policy each unit is aggregated separately: the richest unit keeps the output metric
+// name and the others get it suffixed with their unit. With skip and split the outputs carry the unit.
+func (p *metricsAggregatorProcessor) aggregateMetricsByUnit(metrics []MetricWithResource, rule AggregationRule) []ResourceContextResult {
+	switch rule.UnitMismatchPolicy {
+	case "skip":
+		results := p.aggregateMetricsByResourceContext(metrics, rule)
+		setResultsUnit(results, metrics[0].Metric.Unit())
+		return results
+	case "split":
+		units, metricsByUnit := partitionByUnit(metrics)
+		var results []ResourceContextResult
+		for i, unit := range units {
+			unitRule := rule
+			if i > 0 {
+				unitRule.OutputMetricName = p.getUnitOutputName(rule.OutputMetricName, unit)
+			}
+			unitResults := p.aggregateMetricsByResourceContext(metricsByUnit[unit], unitRule)
+			setResultsUnit(unitResults, unit)
+			results = append(results, unitResults...)
+		}
+		return results
+	default:
+		return p.aggregateMetricsByResourceContext(metrics, rule)
+	}
+}
+
+// getUnitOutputName returns the output metric name of the metrics with the given unit, e.g. latency_ms
+func (p *metricsAggregatorProcessor) getUnitOutputName(outputMetricName string, unit string) string {
+	if unit == "" {
+		return outputMetricName + "_unitless"
+	}
+	return outputMetricName + "_" + p.sanitizeMetricName(unit)
+}
+
+func setResultsUnit(results []ResourceContextResult, unit string) {
+	for _, result := range results {
+		result.Metric.SetUnit(unit)
+	}
+}
+
+// aggregateMetricsByResourceContext groups metrics and creates separate results for each resource context.
+// Rules with group_by_sets produce one output per set, otherwise the global group_by_labels are used.
+func (p *metricsAggregatorProcessor) aggregateMetricsByResourceContext(metrics []MetricWithResource, rule AggregationRule) []ResourceContextResult {
+	if len(rule.GroupBySets) == 0 {
+		return p.aggregateMetricsWithSubtotals(metrics, rule, p.rules.config.GroupByLabels)
+	}
+
+	var results []ResourceContextResult
+	for _, groupBySet := range rule.GroupBySets {
+		setRule := rule
+		setRule.OutputMetricName = getGroupBySetOutputName(rule.OutputMetricName, groupBySet)
+		results = append(results, p.aggregateMetricsWithSubtotals(metrics, setRule, groupBySet)...)
+	}
+	return results
+}
+
+// aggregateMetricsWithSubtotals aggregates metrics by the given labels. Rules with emit_per_scope_subtotals
+// additionally get one result per contributing scope, grouped on the scope.name label as well.
+func (p *metricsAggregatorProcessor) aggregateMetricsWithSubtotals(metrics []MetricWithResource, rule AggregationRule, groupByLabels []string) []ResourceContextResult {
+	results := p.aggregateMetricsByLabels(metrics, rule, groupByLabels)
+	if !rule.EmitPerScopeSubtotals {
+		return results
+	}
+
+	scopedLabels := append(slices.Clone(groupByLabels), scopeNameAttribute)
+	return append(results, p.aggregateMetricsByLabels(addScopeNameLabel(metrics), rule, scopedLabels)...)
+}
+
+// addScopeNameLabel returns copies of the metrics whose data points carry the name of their scope as
+// the scope.name attribute
+func addScopeNameLabel(metrics []MetricWithResource) []MetricWithResource {
+	result := make([]MetricWithResource, 0, len(metrics))
+	for _, metricWithResource := range metrics {
+		metric := pmetric.NewMetric()
+		metricWithResource.Metric.CopyTo(metric)
+		for _, dpAttrs := range getDataPointAttributes(metric) {
+			dpAttrs.PutStr(scopeNameAttribute, metricWithResource.ScopeName)
+		}
+
+		result = append(result, MetricWithResource{
+			Metric:        metric,
+			ResourceAttrs: metricWithResource.ResourceAttrs,
+			ScopeName:     metricWithResource.ScopeName,
+		})
+	}
+	return result
+}
+
+// addNameRegexLabels returns copies of the metrics whose data points carry the named captures of the
+// regex, matched against the metric name, as attributes. It also returns the names of the captures.
+// Metrics whose name does not match are returned unchanged.
+func (p *metricsAggregatorProcessor) addNameRegexLabels(metrics []MetricWithResource, pattern string) ([]MetricWithResource, []string) {
+	regex, err := regexp.Compile(pattern)
+	if err != nil {
+		return metrics, nil
+	}
+
+	var labels []string
+	for _, name := range regex.SubexpNames() {
+		if name != "" {
+			labels = append(labels, name)
+		}
+	}
+
+	result := make([]MetricWithResource, 0, len(metrics))
+	for _, metricWithResource := range metrics {
+		match := regex.FindStringSubmatch(metricWithResource.Metric.Name())
+		if match == nil {
+			result = append(result, metricWithResource)
+			continue
+		}
+
+		// Copy the metric so the extracted labels do not leak into the original metrics
+		metric := pmetric.NewMetric()
+		metricWithResource.Metric.CopyTo(metric)
+		for _, dpAttrs := range getDataPointAttributes(metric) {
+			for i, name := range regex.SubexpNames() {
+				if name != "" && match[i] != "" {
+					dpAttrs.PutStr(name, match[i])
+				}
+			}
+		}
+
+		result = append(result, MetricWithResource{
+			Metric:        metric,
+			ResourceAttrs: metricWithResource.ResourceAttrs,
+			ScopeName:     metricWithResource.ScopeName,
+		})
+	}
+
+	return result, labels
+}
+
+// getGroupBySetOutputName returns the output metric name for one group-by set, e.g. cluster_requests_by_service
+func getGroupBySetOutputName(outputMetricName string, groupBySet []string) string {
+	return outputMetricName + "_by_" + strings.Join(groupBySet, "_")
+}
+
+// aggregateMetricsByLabels groups metrics by the given labels and creates separate results for each resource context
+func (p *metricsAggregatorProcessor) aggregateMetricsByLabels(metrics []MetricWithResource, rule AggregationRule, groupByLabels []string) []ResourceContextResult {
+	// Unknown aggregation types compute 0, which would look like real data
+	if rule.AggregationType != "" && !validAggregationTypes[rule.AggregationType] {
+		p.logger.Warn("Skipping aggregation with unknown aggregation type",
+			zap.String("rule", getRuleName(rule)),
+			zap.String("aggregation_type", rule.AggregationType))
+		return nil
+	}
+
+	transform, err := parseValueTransform(rule.ValueTransform)
+	if err != nil {
+		p.logger.Warn("Skipping aggregation with invalid value transform",
+			zap.String("rule", getRuleName(rule)),
+			zap.Error(err))
+		return nil
+	}
+
+	// The original metrics are kept to be enriched, the name regex labels are only added to copies
+	originals := metrics
+	window := getTimeWindow(rule, time.Now())
+
+	// Labels extracted from the metric names are grouped on like any other label
+	if rule.GroupByNameRegex != "" {
+		var nameLabels []string
+		metrics, nameLabels = p.addNameRegexLabels(metrics, rule.GroupByNameRegex)
+		groupByLabels = append(slices.Clone(groupByLabels), nameLabels...)
+	}
+
+	// The split label is added as an extra grouping label so that each of its values ends up in its own group.
+	splitLabelAdded := rule.SplitByLabel != "" && !slices.Contains(groupByLabels, rule.SplitByLabel)
+	if splitLabelAdded {
+		groupByLabels = append(slices.Clone(groupByLabels), rule.SplitByLabel)
+	}
+	groups := p.groupMetricsByLabels(metrics, groupByLabels, window, rule.SampleRate)
+	if overflow, exists := groups[overflowGroupKey]; exists {
+		p.logger.Warn("Too many groups, folding the remaining data points into the overflow group",
+			zap.String("rule", getRuleName(rule)),
+			zap.Int("max_total_groups", p.rules.config.MaxTotalGroups),
+			zap.Int("overflow_data_points", len(overflow)),
+			zap.Int64("group_overflow_total", p.groupOverflows.Load()))
+	}
+
+	// Data points without a recorded value (e.g. from a target that went away) have no value to aggregate.
+	// Groups made only of such data points are set aside, and emitted flagged as having no recorded value.
+	noRecordedValueGroups := splitNoRecordedValueGroups(groups)
+
+	if rule.DetectCounterResets {
+		p.compensateCounterResets(groups, rule, time.Now())
+	}
+
+	if rule.CumulativeMergeStrategy == "latest" {
+		for groupKey, groupMetrics := range groups {
+			groups[groupKey] = p.latestCumulativePoints(groupMetrics, rule)
+		}
+	}
+
+	maps.Copy(groups, noRecordedValueGroups)
+
+	var results []ResourceContextResult
+	aggregates := make(map[string]float64, len(groups))
+
+	// Process each group separately to create individual resource contexts
+	for groupKey, groupMetrics := range groups {
+		_, noRecordedValue := noRecordedValueGroups[groupKey]
+
+		// A sum over a fraction of the expected sources looks like a real drop
+		if !noRecordedValue && !hasEnoughSources(rule, len(groupMetrics)) {
+			p.logger.Debug("Suppressing aggregation of a group with too few sources",
+				zap.String("rule", getRuleName(rule)),
+				zap.String("group", groupKey),
+				zap.Int("sources", len(groupMetrics)),
+				zap.Int("expected_sources", rule.ExpectedSources))
+			if rule.EmitIncompleteMarker {
+				results = append(results, p.newIncompleteMarker(rule, groupKey, groupByLabels, groupMetrics))
+			}
+			continue
+		}
+
+		// Create result metric for this group
+		resultMetric := pmetric.NewMetric()
+		resultMetric.SetName(p.sanitizeMetricName(p.getOutputMetricName(rule, groupMetrics)))
+		resultMetric.SetDescription(fmt.Sprintf("Aggregated metric using %s aggregation", rule.AggregationType))
+
+		outputType := p.getOutputMetricType(rule, groupMetrics)
+
+		// Create the metric type
+		switch outputType {
+		case "gauge":
+			resultMetric.SetEmptyGauge()
+		case "sum":
+			resultMetric.SetEmptySum()
+			resultMetric.Sum().SetAggregationTemporality(outputTemporality(rule))
+			resultMetric.Sum().SetIsMonotonic(isOutputMonotonic(rule, groupMetrics))
+		case "histogram":
+			resultMetric.SetEmptyHistogram()
+		case "summary":
+			resultMetric.SetEmptySummary()
+		}
+
+		// Calculate aggregated value and timestamps
+		var aggregatedValue float64
+		var intSum int64
+		isIntSum := false
+		flags := pmetric.DefaultDataPointFlags
+		if noRecordedValue {
+			flags = flags.WithNoRecordedValue(true)
+		} else {
+			if intSum, isIntSum = p.exactIntSum(rule, groupMetrics, transform); isIntSum {
+				aggregatedValue = float64(intSum)
+			} else {
+				aggregatedValue = p.calculateAggregatedValue(groupMetrics, rule.AggregationType, rule.HistogramValueSource, transform, rule.TrimFraction)
+				aggregatedValue = scaleSampledValue(aggregatedValue, rule)
+			}
+			aggregates[groupKey] = aggregatedValue
+		}
+		timestamp := p.getOutputTimestamp(groupMetrics, rule.TimestampStrategy)
+
+		// Add single data point for this group
+		var dpAttrs pcommon.Map
+		switch outputType {
+		case "gauge":
+			dp := resultMetric.Gauge().DataPoints().AppendEmpty()
+			setAggregatedValue(dp, aggregatedValue, intSum, isIntSum)
+			dp.SetTimestamp(timestamp)
+			dp.SetFlags(flags)
+			dpAttrs = dp.Attributes()
+		case "sum":
+			dp := resultMetric.Sum().DataPoints().AppendEmpty()
+			setAggregatedValue(dp, aggregatedValue, intSum, isIntSum)
+			dp.SetTimestamp(timestamp)
+			// TODO : Is this needed ?
+			dp.SetStartTimestamp(p.getEarliestTimestamp(groupMetrics)) // Set start timestamp for sum..
+			dp.SetFlags(flags)
+			dpAttrs = dp.Attributes()
+		case "histogram":
+			dp := resultMetric.Histogram().DataPoints().AppendEmpty()
+			switch {
+			case noRecordedValue:
+				// Neither observations nor a sum were recorded
+			case len(rule.HistogramBounds) > 0:
+				p.bucketValues(dp, groupMetrics, rule.HistogramBounds, rule.HistogramValueSource, transform)
+			default:
+				dp.SetSum(aggregatedValue)
+				dp.SetCount(uint64(len(groupMetrics)))
+			}
+			dp.SetTimestamp(timestamp)
+			dp.SetFlags(flags)
+			dpAttrs = dp.Attributes()
+		case "summary":
+			dp := resultMetric.Summary().DataPoints().AppendEmpty()
+			if !noRecordedValue {
+				p.summarizeValues(dp, groupMetrics, rule.Quantiles, rule.HistogramValueSource, transform)
+				scaleSampledSummary(dp, rule)
+			}
+			dp.SetTimestamp(timestamp)
+			dp.SetFlags(flags)
+			dpAttrs = dp.Attributes()
+		}
+		p.setDataPointLabelsFromGroupKey(dpAttrs, groupKey, groupByLabels, groupMetrics)
+
+		// Extract resource attributes for this group
+		resourceAttrs := p.extractResourceAttrsFromGroup(groupKey, groupByLabels, groupMetrics)
+
+		// The split label value is carried by the metric name, so it is not kept as a label
+		if splitLabelAdded {
+			dpAttrs.Remove(rule.SplitByLabel)
+			delete(resourceAttrs, rule.SplitByLabel)
+		}
+
+		// The count of a histogram output is not the number of observations of its sources
+		if rule.EmitContributors && outputType == "histogram" {
+			dpAttrs.PutInt(contributorsAttribute, int64(len(groupMetrics)))
+		}
+
+		if rule.AddDataAge {
+			dpAttrs.PutDouble(dataAgeAttribute, p.getDataAge(groupMetrics).Seconds())
+		}
+
+		if rule.EmitLineage {
+			dpAttrs.PutStr(lineageAttribute, getLineage(rule, groupMetrics))
+		}
+
+		if rule.EmitMatchInfo {
+			matchType := rule.MatchType
+			if matchType == "" {
+				matchType = "strict"
+			}
+			dpAttrs.PutStr(sourcePatternAttribute, strings.Join(getMetricPatterns(rule), ","))
+			dpAttrs.PutStr(matchTypeAttribute, matchType)
+		}
+
+		results = append(results, ResourceContextResult{
+			Metric:        resultMetric,
+			ResourceAttrs: resourceAttrs,
+		})
+
+		// The companions of a group without recorded values would only hold misleading zeros
+		if noRecordedValue {
+			continue
+		}
+
+		if rule.WithStdDev {
+			results = append(results, ResourceContextResult{
+				Metric:        p.newStdDevMetric(resultMetric, groupMetrics, rule.HistogramValueSource, transform),
+				ResourceAttrs: resourceAttrs,
+			})
+		}
+
+		if rule.EmitSourceRanks {
+			if len(groupMetrics) > getMaxRankedSources(rule) {
+				p.logger.Debug("Not ranking the sources of a group with too many sources",
+					zap.String("rule", getRuleName(rule)),
+					zap.String("group", groupKey),
+					zap.Int("sources", len(groupMetrics)),
+					zap.Int("max_ranked_sources", getMaxRankedSources(rule)))
+			} else {
+				results = append(results, ResourceContextResult{
+					Metric:        p.newSourceRanksMetric(resultMetric.Name(), groupMetrics, rule, transform),
+					ResourceAttrs: resourceAttrs,
+				})
+			}
+		}
+	}
+
+	if rule.EnrichOriginalsWithAggregate {
+		p.enrichOriginals(originals, rule, groupByLabels, window, aggregates)
+	}
+
+	return results
+}
+
+// scaleSampledValue scales the sum or count of a group aggregated with a sample_rate to estimate the result
+// over every series. Other aggregation types, e.g. mean, are estimated by the sample as it is.
+func scaleSampledValue(value float64, rule AggregationRule) float64 {
+	if rule.SampleRate <= 0 || rule.SampleRate >= 1 {
+		return value
+	}
+	switch rule.AggregationType {
+	case "", "sum", "count":
+		return value / rule.SampleRate
+	}
+	return value
+}
+
+// scaleSampledSummary scales the count and sum of a summary output of a rule with a sample_rate, so that they
+// estimate the count and sum over every series. Quantiles are left as computed on the sample.
+func scaleSampledSummary(dp pmetric.SummaryDataPoint, rule AggregationRule) {
+	if rule.SampleRate <= 0 || rule.SampleRate >= 1 {
+		return
+	}
+	dp.SetCount(uint64(math.Round(float64(dp.Count()) / rule.SampleRate)))
+	dp.SetSum(dp.Sum() / rule.SampleRate)
+}
+
+// splitNoRecordedValueGroups removes the data points flagged as having no recorded value from the groups.
+// Groups that only had such data points are removed too, and returned with their data points.
+func splitNoRecordedValueGroups(groups map[string][]MetricWithResource) map[string][]MetricWithResource {
+	noRecordedValueGroups := make(map[string][]MetricWithResource)
+	for groupKey, groupMetrics := range groups {
+		recorded := slices.DeleteFunc(slices.Clone(groupMetrics), hasNoRecordedValue)
+		switch {
+		case len(recorded) == 0:
+			noRecordedValueGroups[groupKey] = groupMetrics
+			delete(groups, groupKey)
+		case len(recorded) < len(groupMetrics):
+			groups[groupKey] = recorded
+		}
+	}
+	return noRecordedValueGroups
+}
+
+// hasNoRecordedValue reports whether the data point of a grouped metric is flagged as having no recorded value
+func hasNoRecordedValue(metric MetricWithResource) bool {
+	switch metric.Metric.Type() {
+	case pmetric.MetricTypeGauge:
+		return metric.Metric.Gauge().DataPoints().At(0).Flags().NoRecordedValue()
+	case pmetric.MetricTypeSum:
+		return metric.Metric.Sum().DataPoints().At(0).Flags().NoRecordedValue()
+	case pmetric.MetricTypeHistogram:
+		return metric.Metric.Histogram().DataPoints().At(0).Flags().NoRecordedValue()
+	case pmetric.MetricTypeSummary:
+		return metric.Metric.Summary().DataPoints().At(0).Flags().NoRecordedValue()
+	}
+	return false
+}
+
+// enrichOriginals adds the aggregate of its group to each original data point that was aggregated.
+// Data points of suppressed groups, of the overflow group, outside the time window or without a recorded value
+// are left untouched.
+func (p *metricsAggregatorProcessor) enrichOriginals(metrics []MetricWithResource, rule AggregationRule, groupByLabels []string, window timeWindow, aggregates map[string]float64) {
+	aggregationType := rule.AggregationType
+	if aggregationType == "" {
+		aggregationType = "sum"
+	}
+	attributeName := "aggregation." + aggregationType
+
+	enrich := func(resourceAttrs pcommon.Map, timestamp pcommon.Timestamp, flags pmetric.DataPointFlags, attrs pcommon.Map) {
+		if !window.contains(timestamp) || flags.NoRecordedValue() {
+			return
+		}
+		if aggregate, ok := aggregates[p.buildGroupKeyFromPresentAttributes(resourceAttrs, attrs, groupByLabels)]; ok {
+			attrs.PutDouble(attributeName, aggregate)
+		}
+	}
+
+	for _, metricWithResource := range metrics {
+		metric := metricWithResource.Metric
+		switch metric.Type() {
+		case pmetric.MetricTypeGauge:
+			dps := metric.Gauge().DataPoints()
+			for i := 0; i < dps.Len(); i++ {
+				enrich(metricWithResource.ResourceAttrs, dps.At(i).Timestamp(), dps.At(i).Flags(), dps.At(i).Attributes())
+			}
+		case pmetric.MetricTypeSum:
+			dps := metric.Sum().DataPoints()
+			for i := 0; i < dps.Len(); i++ {
+				enrich(metricWithResource.ResourceAttrs, dps.At(i).Timestamp(), dps.At(i).Flags(), dps.At(i).Attributes())
+			}
+		case pmetric.MetricTypeHistogram:
+			dps := metric.Histogram().DataPoints()
+			for i := 0; i < dps.Len(); i++ {
+				enrich(metricWithResource.ResourceAttrs, dps.At(i).Timestamp(), dps.At(i).Flags(), dps.At(i).Attributes())
+			}
+		}
+	}
+}
+
+// newStdDevMetric returns a copy of a mean output, with the same labels and timestamps, named
+// <name>_stddev and holding the population standard deviation of the group's values
+func (p *metricsAggregatorProcessor) newStdDevMetric(meanMetric pmetric.Metric, metrics []MetricWithResource, histogramValueSource string, transform valueTransform) pmetric.Metric {
+	var values []float64
+	for _, metricWithResource := range metrics {
+		values = append(values, p.extractValuesFromMetric(metricWithResource.Metric, histogramValueSource, transform)...)
+	}
+
+	stdDevMetric := pmetric.NewMetric()
+	meanMetric.CopyTo(stdDevMetric)
+	stdDevMetric.SetName(meanMetric.Name() + "_stddev")
+	stdDevMetric.SetDescription("Standard deviation of the values aggregated by mean")
+
+	var dps pmetric.NumberDataPointSlice
+	switch stdDevMetric.Type() {
+	case pmetric.MetricTypeGauge:
+		dps = stdDevMetric.Gauge().DataPoints()
+	case pmetric.MetricTypeSum:
+		// A standard deviation can go down whatever the sources are
+		stdDevMetric.Sum().SetIsMonotonic(false)
+		dps = stdDevMetric.Sum().DataPoints()
+	}
+	for i := 0; i < dps.Len(); i++ {
+		dps.At(i).SetDoubleValue(stdDev(values))
+	}
+	return stdDevMetric
+}
+
+// getMaxRankedSources returns the largest group whose sources are ranked with emit_source_ranks
+func getMaxRankedSources(rule AggregationRule) int {
+	if rule.MaxRankedSources > 0 {
+		return rule.MaxRankedSources
+	}
+	return defaultMaxRankedSources
+}
+
+// newSourceRanksMetric returns <outputName>_source_ranks, a gauge with one data point per source of a group.
+// Each data point carries the value of the source, the resource and data point attributes identifying it,
+// and its rank among the values of the group. Sources with equal values are ranked in their group order.
+func (p *metricsAggregatorProcessor) newSourceRanksMetric(outputName string, metrics []MetricWithResource, rule AggregationRule, transform valueTransform) pmetric.Metric {
+	type rankedSource struct {
+		source MetricWithResource
+		value  float64
+	}
+
+	var sources []rankedSource
+	for _, metricWithResource := range metrics {
+		// Grouped metrics hold a single data point
+		values := p.extractValuesFromMetric(metricWithResource.Metric, rule.HistogramValueSource, transform)
+		if len(values) == 0 {
+			continue
+		}
+		sources = append(sources, rankedSource{source: metricWithResource, value: values[0]})
+	}
+	sort.SliceStable(sources, func(i, j int) bool {
+		return sources[i].value < sources[j].value
+	})
+
+	ranksMetric := pmetric.NewMetric()
+	ranksMetric.SetName(outputName + "_source_ranks")
+	ranksMetric.SetDescription("Values of the sources of an aggregate, ranked from the lowest")
+	dps := ranksMetric.SetEmptyGauge().DataPoints()
+	timestamp := p.getOutputTimestamp(metrics, rule.TimestampStrategy)
+	for i, ranked := range sources {
+		dp := dps.AppendEmpty()
+		dp.SetDoubleValue(ranked.value)
+		dp.SetTimestamp(timestamp)
+		for k, v := range ranked.source.ResourceAttrs.All() {
+			v.CopyTo(dp.Attributes().PutEmpty(k))
+		}
+		for _, attrs := range getDataPointAttributes(ranked.source.Metric) {
+			for k, v := range attrs.All() {
+				v.CopyTo(dp.Attributes().PutEmpty(k))
+			}
+		}
+		dp.Attributes().PutInt(sourceRankAttribute, int64(i+1))
+		dp.Attributes().PutDouble(sourceQuantileAttribute, quantileRank(i, len(sources)))
+	}
+	return ranksMetric
+}
+
+// quantileRank returns the quantile rank of the i-th lowest of n values, from 0 for the lowest to 1 for
+// the highest. A single value has the quantile rank 0.
+func quantileRank(i int, n int) float64 {
+	if n <= 1 {
+		return 0
+	}
+	return float64(i) / float64(n-1)
+}
+
+// stdDev returns the population standard deviation of values, 0 when there are none
+func stdDev(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+
+	mean := 0.0
+	for _, v := range values {
+		mean += v
+	}
+	mean /= float64(len(values))
+
+	variance := 0.0
+	for _, v := range values {
+		variance += (v - mean) * (v - mean)
+	}
+	return math.Sqrt(variance / float64(len(values)))
+}
+
+// hasEnoughSources reports whether a group with the given number of source data points reaches the rule's
+// min_fraction of expected_sources
+func hasEnoughSources(rule AggregationRule, sources int) bool {
+	if rule.ExpectedSources == 0 {
+		return true
+	}
+	return float64(sources) >= rule.MinFraction*float64(rule.ExpectedSources)
+}
+
+// newIncompleteMarker returns the aggregation_incomplete gauge of a suppressed group. Its value is the number
+// of sources that did contribute, and it carries the group labels and the name of the suppressed output.
+func (p *metricsAggregatorProcessor) newIncompleteMarker(rule AggregationRule, groupKey string, groupByLabels []string, groupMetrics []MetricWithResource) ResourceContextResult {
+	marker := pmetric.NewMetric()
+	marker.SetName(incompleteMetricName)
+	marker.SetDescription(fmt.Sprintf("Sources of a group suppressed for having fewer than %g of %d expected sources", rule.MinFraction, rule.ExpectedSources))
+
+	dp := marker.SetEmptyGauge().DataPoints().AppendEmpty()
+	dp.SetDoubleValue(float64(len(groupMetrics)))
+	dp.SetTimestamp(p.getOutputTimestamp(groupMetrics, rule.TimestampStrategy))
+	p.setDataPointLabelsFromGroupKey(dp.Attributes(), groupKey, groupByLabels, groupMetrics)
+	dp.Attributes().PutStr(incompleteOutputAttribute, p.sanitizeMetricName(p.getOutputMetricName(rule, groupMetrics)))
+
+	return ResourceContextResult{
+		Metric:        marker,
+		ResourceAttrs: p.extractResourceAttrsFromGroup(groupKey, groupByLabels, groupMetrics),
+	}
+}
+
+// isOutputMonotonic reports whether a sum output is monotonic. Unless the rule sets output_monotonic,
+// it is monotonic only when every source is a monotonic sum, since e.g. summed gauges can go down.
+func isOutputMonotonic(rule AggregationRule, metrics []MetricWithResource) bool {
+	if rule.OutputMonotonic != nil {
+		return *rule.OutputMonotonic
+	}
+
+	for _, metricWithResource := range metrics {
+		metric := metricWithResource.Metric
+		if metric.Type() != pmetric.MetricTypeSum || !metric.Sum().IsMonotonic() {
+			return false
+		}
+	}
+	return len(metrics) > 0
+}
+
+// getOutputMetricType returns the output_metric_type of the rule. When it is unset, the output is a gauge,
+// or a sum if preserve_source_type is enabled and every source is a sum.
+func (p *metricsAggregatorProcessor) getOutputMetricType(rule AggregationRule, metrics []MetricWithResource) string {
+	if rule.OutputMetricType != "" {
+		return rule.OutputMetricType
+	}
+	if !p.rules.config.PreserveSourceType || len(metrics) == 0 {
+		return "gauge"
+	}
+
+	for _, metricWithResource := range metrics {
+		if metricWithResource.Metric.Type() != pmetric.MetricTypeSum {
+			return "gauge"
+		}
+	}
+	return "sum"
+}
+
+// outputTemporality returns the aggregation temporality of a sum output, cumulative unless the rule sets output_temporality
+func outputTemporality(rule AggregationRule) pmetric.AggregationTemporality {
+	if rule.OutputTemporality == "delta" {
+		return pmetric.AggregationTemporalityDelta
+	}
+	return pmetric.AggregationTemporalityCumulative
+}
+
+// bucketValues fills a histogram data point with the distribution of the source values of a group.
+// Each value is counted in the first bucket whose upper bound is greater than or equal to it.
+func (p *metricsAggregatorProcessor) bucketValues(dp pmetric.HistogramDataPoint, metrics []MetricWithResource, bounds []float64, histogramValueSource string, transform valueTransform) {
+	bucketCounts := make([]uint64, len(bounds)+1)
+	sum := 0.0
+	count := uint64(0)
+
+	for _, metricWithResource := range metrics {
+		for _, value := range p.extractValuesFromMetric(metricWithResource.Metric, histogramValueSource, transform) {
+			bucketCounts[sort.SearchFloat64s(bounds, value)]++
+			sum += value
+			if count == 0 || value < dp.Min() {
+				dp.SetMin(value)
+			}
+			if count == 0 || value > dp.Max() {
+				dp.SetMax(value)
+			}
+			count++
+		}
+	}
+
+	dp.ExplicitBounds().FromRaw(bounds)
+	dp.BucketCounts().FromRaw(bucketCounts)
+	dp.SetSum(sum)
+	dp.SetCount(count)
+}
+
+// summarizeValues fills a summary data point with the count, sum and given quantiles of the source values of a group
+func (p *metricsAggregatorProcessor) summarizeValues(dp pmetric.SummaryDataPoint, metrics []MetricWithResource, quantiles []float64, histogramValueSource string, transform valueTransform) {
+	var values []float64
+	for _, metricWithResource := range metrics {
+		values = append(values, p.extractValuesFromMetric(metricWithResource.Metric, histogramValueSource, transform)...)
+	}
+	if len(values) == 0 {
+		return
+	}
+	slices.Sort(values)
+
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	dp.SetSum(sum)
+	dp.SetCount(uint64(len(values)))
+
+	for _, q := range quantiles {
+		quantileValue := dp.QuantileValues().AppendEmpty()
+		quantileValue.SetQuantile(q)
+		quantileValue.SetValue(quantile(values, q))
+	}
+}
+
+// quantile returns the q quantile of sorted values, interpolating linearly between the two closest ranks
+func quantile(sorted []float64, q float64) float64 {
+	pos := q * float64(len(sorted)-1)
+	lower := int(pos)
+	if lower+1 >= len(sorted) {
+		return sorted[lower]
+	}
+	return sorted[lower] + (pos-float64(lower))*(sorted[lower+1]-sorted[lower])
+}
+
+// getDataAge returns the time elapsed since the latest source data point of a group
+func (p *metricsAggregatorProcessor) getDataAge(metrics []MetricWithResource) time.Duration {
+	age := time.Since(p.getLatestTimestamp(metrics).AsTime())
+	if age < 0 {
+		// Sources with clocks ahead of the collector
+		return 0
+	}
+	return age
+}
+
+// getLineage describes how the value of a group was computed, e.g. "sum(throughput) over 4 series".
+// Several source metric names (regex rules) are listed sorted and comma separated.
+func getLineage(rule AggregationRule, metrics []MetricWithResource) string {
+	aggregationType := rule.AggregationType
+	if aggregationType == "" {
+		aggregationType = "sum"
+	}
+
+	var sourceNames []string
+	for _, metricWithResource := range metrics {
+		if !slices.Contains(sourceNames, metricWithResource.Metric.Name()) {
+			sourceNames = append(sourceNames, metricWithResource.Metric.Name())
+		}
+	}
+	sort.Strings(sourceNames)
+
+	return fmt.Sprintf("%s(%s) over %d series", aggregationType, strings.Join(sourceNames, ","), len(metrics))
+}
+
+// getOutputMetricName returns the name of the aggregated metric for a group.
+// When the rule splits by a label, the label value of the group is appended to the output metric name.
+func (p *metricsAggregatorProcessor) getOutputMetricName(rule AggregationRule, metrics []MetricWithResource) string {
+	if rule.SplitByLabel == "" || len(metrics) == 0 {
+		return rule.OutputMetricName
+	}
+
+	// All metrics in a group share the split label value, so the first one is enough
+	value, found := p.getLabelValue(metrics[0], rule.SplitByLabel)
+	if !found || value == "" {
+		return rule.OutputMetricName
+	}
+
+	return rule.OutputMetricName + "_" + value
+}
+
+// getLabelValue looks up a label on the (single) data point of a grouped metric, then on its resource
+func (p *metricsAggregatorProcessor) getLabelValue(metric MetricWithResource, label string) (string, bool) {
+	dataPointAttrs := pcommon.NewMap()
+	switch metric.Metric.Type() {
+	case pmetric.MetricTypeGauge:
+		if metric.Metric.Gauge().DataPoints().Len() > 0 {
+			dataPointAttrs = metric.Metric.Gauge().DataPoints().At(0).Attributes()
+		}
+	case pmetric.MetricTypeSum:
+		if metric.Metric.Sum().DataPoints().Len() > 0 {
+			dataPointAttrs = metric.Metric.Sum().DataPoints().At(0).Attributes()
+		}
+	case pmetric.MetricTypeHistogram:
+		if metric.Metric.Histogram().DataPoints().Len() > 0 {
+			dataPointAttrs = metric.Metric.Histogram().DataPoints().At(0).Attributes()
+		}
+	}
+
+	if val, _, exists := p.lookupLabel(metric.ResourceAttrs, dataPointAttrs, label); exists {
+		return p.normalizeGroupValue(val.AsString()), true
+	}
+
+	return "", false
+}
+
+// lookupLabel returns the value of a label of a data point from its attributes or its resource attributes,
+// and whether it was read from the resource. The label_precedence decides which one wins when both have it.
+func (p *metricsAggregatorProcessor) lookupLabel(resourceAttrs pcommon.Map, dataPointAttrs pcommon.Map, label string) (pcommon.Value, bool, bool) {
+	first, second := dataPointAttrs, resourceAttrs
+	if p.rules.config.LabelPrecedence == "resource" {
+		first, second = resourceAttrs, dataPointAttrs
+	}
+
+	if val, exists := first.Get(label); exists {
+		return val, p.rules.config.LabelPrecedence == "resource", true
+	}
+	if val, exists := second.Get(label); exists {
+		return val, p.rules.config.LabelPrecedence != "resource", true
+	}
+	return pcommon.Value{}, false, false
+}
+
+// isResourceLabel reports whether a group-by label of a group is read from the resource of its sources,
+// in which case the output carries it as a resource attribute instead of a data point attribute
+func (p *metricsAggregatorProcessor) isResourceLabel(metric MetricWithResource, label string) bool {
+	dataPointAttrs := pcommon.NewMap()
+	if attrs := getDataPointAttributes(metric.Metric); len(attrs) > 0 {
+		dataPointAttrs = attrs[0]
+	}
+	_, fromResource, found := p.lookupLabel(metric.ResourceAttrs, dataPointAttrs, label)
+	return found && fromResource
+}
+
+// normalizeGroupValue applies the configured group value transforms to a group-by label value.
+// The group key carries the normalized value, so the output labels are normalized as well.
+func (p *metricsAggregatorProcessor) normalizeGroupValue(value string) string {
+	if !p.rules.config.NormalizeGroupValues {
+		return value
+	}
+
+	transforms := p.rules.config.GroupValueTransforms
+	if len(transforms) == 0 {
+		transforms = defaultGroupValueTransforms
+	}
+	for _, transform := range transforms {
+		switch transform {
+		case "trim":
+			value = strings.TrimSpace(value)
+		case "lowercase":
+			value = strings.ToLower(value)
+		}
 	}
-
-	return nil
+	return value
 }
 
-// MetricWithResource holds a metric along with its resource attributes
-type MetricWithResource struct {
-	Metric        pmetric.Metric
-	ResourceAttrs pcommon.Map
-}
+// compensateCounterResets adjusts the values of cumulative sum data points so that a counter reset
+// (e.g. a pod restart) does not make the aggregate dip. The value seen before the reset is remembered
+// and added to every later value of the series.
+// A reset is a new start timestamp, or a lower value when the series has no start timestamp. Data points
+// not newer than the last one seen of their series do not count as a reset.
+// The grouped metrics are per-datapoint copies, so the original metrics in the batch are left untouched.
+func (p *metricsAggregatorProcessor) compensateCounterResets(groups map[string][]MetricWithResource, rule AggregationRule, now time.Time) {
+	p.counterResetsMu.Lock()
+	defer p.counterResetsMu.Unlock()
+
+	// Offsets tracked for replaced rules do not carry over to the new ones
+	if p.counterResetsConfig != p.rules.config {
+		clear(p.counterResets)
+		p.counterResetsConfig = p.rules.config
+	}
+	p.expireCounterResets(now)
 
-// collectMatchingMetrics finds all metrics that match the rule pattern
-func (p *metricsAggregatorProcessor) collectMatchingMetrics(md pmetric.Metrics, rule AggregationRule) []MetricWithResource {
-	var matchingMetrics []MetricWithResource
+	for _, groupMetrics := range groups {
+		for _, metricWithResource := range groupMetrics {
+			metric := metricWithResource.Metric
+			if metric.Type() != pmetric.MetricTypeSum || metric.Sum().AggregationTemporality() != pmetric.AggregationTemporalityCumulative {
+				continue
+			}
 
-	for i := 0; i < md.ResourceMetrics().Len(); i++ {
-		rm := md.ResourceMetrics().At(i)
-		resourceAttrs := rm.Resource().Attributes()
-		for j := 0; j < rm.ScopeMetrics().Len(); j++ {
-			sm := rm.ScopeMetrics().At(j)
-			for k := 0; k < sm.Metrics().Len(); k++ {
-				metric := sm.Metrics().At(k)
-				if p.matchesPattern(metric.Name(), rule) {
-					matchingMetrics = append(matchingMetrics, MetricWithResource{
-						Metric:        metric,
-						ResourceAttrs: resourceAttrs,
-					})
+			dps := metric.Sum().DataPoints()
+			for i := 0; i < dps.Len(); i++ {
+				dp := dps.At(i)
+				if dp.ValueType() != pmetric.NumberDataPointValueTypeInt && dp.ValueType() != pmetric.NumberDataPointValueTypeDouble {
+					continue
+				}
+				key := p.buildSeriesKey(rule.OutputMetricName, metric.Name(), metricWithResource.ResourceAttrs, dp.Attributes())
+
+				state, exists := p.counterResets[key]
+				switch {
+				case !exists || state.valueType != dp.ValueType():
+					state = &counterResetState{valueType: dp.ValueType()}
+					p.counterResets[key] = state
+					state.observe(dp)
+				case !state.isNewer(dp):
+					// The offset applies to the current run of the counter, a late data point of an
+					// earlier run is left as is
+					if !state.isSameRun(dp) {
+						continue
+					}
+				default:
+					if state.isReset(dp) {
+						p.logger.Debug("Counter reset detected",
+							zap.String("metric", metric.Name()),
+							zap.Stringer("previous_start_timestamp", state.startTimestamp),
+							zap.Stringer("start_timestamp", dp.StartTimestamp()))
+						state.intOffset += state.lastInt
+						state.doubleOffset += state.lastDouble
+					}
+					state.observe(dp)
+				}
+				state.lastSeen = now
+
+				switch dp.ValueType() {
+				case pmetric.NumberDataPointValueTypeInt:
+					if state.intOffset != 0 {
+						dp.SetIntValue(dp.IntValue() + state.intOffset)
+					}
+				case pmetric.NumberDataPointValueTypeDouble:
+					if state.doubleOffset != 0 {
+						dp.SetDoubleValue(dp.DoubleValue() + state.doubleOffset)
+					}
 				}
 			}
 		}
 	}
-
-	return matchingMetrics
 }
 
-// matchesPattern checks if a metric name matches the rule pattern
-func (p *metricsAggregatorProcessor) matchesPattern(metricName string, rule AggregationRule) bool {
-	switch rule.MatchType {
-	case "strict", "":
-		return metricName == rule.MetricPattern
-	case "regex":
-		matched, err := regexp.MatchString(rule.MetricPattern, metricName)
-		if err != nil {
-			p.logger.Error("Invalid regex pattern",
-				zap.String("pattern", rule.MetricPattern),
-				zap.Error(err))
-			return false
+// expireCounterResets drops the counter reset state of the series without a data point within
+// counterResetStateTTL. A series reporting again afterwards is tracked from scratch, without offset.
+func (p *metricsAggregatorProcessor) expireCounterResets(now time.Time) {
+	if now.Sub(p.counterResetsSwept) < counterResetSweepInterval {
+		return
+	}
+	p.counterResetsSwept = now
+	for key, state := range p.counterResets {
+		if now.Sub(state.lastSeen) > counterResetStateTTL {
+			delete(p.counterResets, key)
 		}
-		return matched
-	default:
-		return false
 	}
 }
 
-// ResourceContextResult represents an aggregated metric for a specific resource context
-type ResourceContextResult struct {
-	Metric        pmetric.Metric
-	ResourceAttrs map[string]string
+// observe records a data point as the last one of the series
+func (s *counterResetState) observe(dp pmetric.NumberDataPoint) {
+	s.startTimestamp = dp.StartTimestamp()
+	s.timestamp = dp.Timestamp()
+	s.lastInt = dp.IntValue()
+	s.lastDouble = dp.DoubleValue()
 }
 
-// aggregateMetricsByResourceContext groups metrics and creates separate results for each resource context
-func (p *metricsAggregatorProcessor) aggregateMetricsByResourceContext(metrics []MetricWithResource, rule AggregationRule) []ResourceContextResult {
-	// Group metrics by labels using global configuration
-	groups := p.groupMetricsByLabels(metrics, p.config.GroupByLabels)
+// isNewer reports whether a data point comes after the last one of the series. Without timestamps
+// the data points are taken in the order they arrive.
+func (s *counterResetState) isNewer(dp pmetric.NumberDataPoint) bool {
+	return dp.Timestamp() == 0 || s.timestamp == 0 || dp.Timestamp() > s.timestamp
+}
 
-	var results []ResourceContextResult
+// isSameRun reports whether a data point belongs to the same run of the counter as the last one of the series
+func (s *counterResetState) isSameRun(dp pmetric.NumberDataPoint) bool {
+	return dp.StartTimestamp() == 0 || s.startTimestamp == 0 || dp.StartTimestamp() == s.startTimestamp
+}
 
-	// Process each group separately to create individual resource contexts
-	for groupKey, groupMetrics := range groups {
-		// Create result metric for this group
-		resultMetric := pmetric.NewMetric()
-		resultMetric.SetName(p.sanitizeMetricName(rule.OutputMetricName))
-		resultMetric.SetDescription(fmt.Sprintf("Aggregated metric using %s aggregation", rule.AggregationType))
+// isReset reports whether a newer data point of the series starts a new run of the counter
+func (s *counterResetState) isReset(dp pmetric.NumberDataPoint) bool {
+	if dp.StartTimestamp() != 0 && s.startTimestamp != 0 {
+		return dp.StartTimestamp() != s.startTimestamp
+	}
+	if dp.ValueType() == pmetric.NumberDataPointValueTypeInt {
+		return dp.IntValue() < s.lastInt
+	}
+	return dp.DoubleValue() < s.lastDouble
+}
 
-		// Determine output type
-		outputType := rule.OutputMetricType
-		if outputType == "" {
-			outputType = "gauge" // default
+// latestCumulativePoints keeps only the latest data point of each cumulative sum source series of a group.
+// A cumulative value holds until the next data point of its series, so summing the latest value of every
+// series gives the group total at the latest timestamp, while summing every data point would count the
+// older values of a series again. Other data points are kept as they are.
+func (p *metricsAggregatorProcessor) latestCumulativePoints(metrics []MetricWithResource, rule AggregationRule) []MetricWithResource {
+	latest := make(map[string]int, len(metrics))
+	var kept []MetricWithResource
+	for _, metricWithResource := range metrics {
+		metric := metricWithResource.Metric
+		if metric.Type() != pmetric.MetricTypeSum || metric.Sum().AggregationTemporality() != pmetric.AggregationTemporalityCumulative || metric.Sum().DataPoints().Len() != 1 {
+			kept = append(kept, metricWithResource)
+			continue
 		}
 
-		// Create the metric type
-		switch outputType {
-		case "gauge":
-			resultMetric.SetEmptyGauge()
-		case "sum":
-			resultMetric.SetEmptySum()
-			resultMetric.Sum().SetAggregationTemporality(pmetric.AggregationTemporalityCumulative)
-			resultMetric.Sum().SetIsMonotonic(true)
-		case "histogram":
-			resultMetric.SetEmptyHistogram()
+		dp := metric.Sum().DataPoints().At(0)
+		key := p.buildSeriesKey(rule.OutputMetricName, metric.Name(), metricWithResource.ResourceAttrs, dp.Attributes())
+		index, exists := latest[key]
+		if !exists {
+			latest[key] = len(kept)
+			kept = append(kept, metricWithResource)
+			continue
 		}
-
-		// Calculate aggregated value and timestamps
-		aggregatedValue := p.calculateAggregatedValue(groupMetrics, rule.AggregationType)
-		timestamp := p.getLatestTimestamp(groupMetrics)
-
-		// Add single data point for this group
-		switch outputType {
-		case "gauge":
-			dp := resultMetric.Gauge().DataPoints().AppendEmpty()
-			dp.SetDoubleValue(aggregatedValue)
-			dp.SetTimestamp(timestamp)
-			p.setDataPointLabelsFromGroupKey(dp.Attributes(), groupKey, p.config.GroupByLabels, groupMetrics)
-		case "sum":
-			dp := resultMetric.Sum().DataPoints().AppendEmpty()
-			dp.SetDoubleValue(aggregatedValue)
-			dp.SetTimestamp(timestamp)
-			// TODO : Is this needed ?
-			dp.SetStartTimestamp(p.getEarliestTimestamp(groupMetrics)) // Set start timestamp for sum..
-			p.setDataPointLabelsFromGroupKey(dp.Attributes(), groupKey, p.config.GroupByLabels, groupMetrics)
-		case "histogram":
-			dp := resultMetric.Histogram().DataPoints().AppendEmpty()
-			dp.SetSum(aggregatedValue)
-			dp.SetCount(uint64(len(groupMetrics)))
-			dp.SetTimestamp(timestamp)
-			p.setDataPointLabelsFromGroupKey(dp.Attributes(), groupKey, p.config.GroupByLabels, groupMetrics)
+		if dp.Timestamp() >= kept[index].Metric.Sum().DataPoints().At(0).Timestamp() {
+			kept[index] = metricWithResource
 		}
+	}
+	return kept
+}
 
-		// Extract resource attributes for this group
-		resourceAttrs := p.extractResourceAttrsFromGroup(groupKey, p.config.GroupByLabels, groupMetrics)
-
-		results = append(results, ResourceContextResult{
-			Metric:        resultMetric,
-			ResourceAttrs: resourceAttrs,
-		})
+// buildSeriesKey creates a stable identifier for a single series of a rule from its metric name and attributes
+func (p *metricsAggregatorProcessor) buildSeriesKey(ruleName string, metricName string, resourceAttrs pcommon.Map, dataPointAttrs pcommon.Map) string {
+	keyParts := []string{ruleName, metricName}
+	for _, attrs := range []pcommon.Map{resourceAttrs, dataPointAttrs} {
+		var pairs []string
+		for key, value := range attrs.All() {
+			pairs = append(pairs, key+"="+value.AsString())
+		}
+		sort.Strings(pairs)
+		keyParts = append(keyParts, strings.Join(pairs, ","))
 	}
 
-	return results
+	return strings.Join(keyParts, "|")
 }
 
 // groupMetricsByLabels groups metrics by specified label keys
-func (p *metricsAggregatorProcessor) groupMetricsByLabels(metrics []MetricWithResource, groupByLabels []string) map[string][]MetricWithResource {
+func (p *metricsAggregatorProcessor) groupMetricsByLabels(metrics []MetricWithResource, groupByLabels []string, window timeWindow, sampleRate float64) map[string][]MetricWithResource {
 	groups := make(map[string][]MetricWithResource)
 
 	for _, metricWithResource := range metrics {
 		// Group each data point separately instead of the entire metric
-		p.groupDataPointsByLabels(metricWithResource.Metric, metricWithResource.ResourceAttrs, groupByLabels, groups)
+		p.groupDataPointsByLabels(metricWithResource.Metric, metricWithResource.ResourceAttrs, groupByLabels, window, sampleRate, groups)
 	}
 
 	return groups
@@ -237,13 +1812,16 @@ func (p *metricsAggregatorProcessor) groupMetricsByLabels(metrics []MetricWithRe
 // 2. Use lightweight value cache (MetricValueWithContext struct)
 // 3. Smart filtering during extraction (re-evaluate grouping)
 // See discussion: https://github.com/your-repo/issues/XXX
-func (p *metricsAggregatorProcessor) groupDataPointsByLabels(metric pmetric.Metric, resourceAttrs pcommon.Map, groupByLabels []string, groups map[string][]MetricWithResource) {
+func (p *metricsAggregatorProcessor) groupDataPointsByLabels(metric pmetric.Metric, resourceAttrs pcommon.Map, groupByLabels []string, window timeWindow, sampleRate float64, groups map[string][]MetricWithResource) {
 	switch metric.Type() {
 	case pmetric.MetricTypeGauge:
 		dataPoints := metric.Gauge().DataPoints()
 		for i := 0; i < dataPoints.Len(); i++ {
 			dp := dataPoints.At(i)
-			groupKey := p.buildGroupKeyFromPresentAttributes(resourceAttrs, dp.Attributes(), groupByLabels)
+			if !window.contains(dp.Timestamp()) || !p.isSampled(metric.Name(), resourceAttrs, dp.Attributes(), sampleRate) {
+				continue
+			}
+			groupKey := p.capGroupKey(p.buildGroupKeyFromPresentAttributes(resourceAttrs, dp.Attributes(), groupByLabels), groups)
 
 			// TODO: MEMORY INEFFICIENT - Creating new metric for each datapoint
 			// This ensures functional correctness but uses excessive memory
@@ -262,7 +1840,10 @@ func (p *metricsAggregatorProcessor) groupDataPointsByLabels(metric pmetric.Metr
 		dataPoints := metric.Sum().DataPoints()
 		for i := 0; i < dataPoints.Len(); i++ {
 			dp := dataPoints.At(i)
-			groupKey := p.buildGroupKeyFromPresentAttributes(resourceAttrs, dp.Attributes(), groupByLabels)
+			if !window.contains(dp.Timestamp()) || !p.isSampled(metric.Name(), resourceAttrs, dp.Attributes(), sampleRate) {
+				continue
+			}
+			groupKey := p.capGroupKey(p.buildGroupKeyFromPresentAttributes(resourceAttrs, dp.Attributes(), groupByLabels), groups)
 
 			// TODO: MEMORY INEFFICIENT - Creating new metric for each datapoint
 			newMetric := pmetric.NewMetric()
@@ -282,7 +1863,10 @@ func (p *metricsAggregatorProcessor) groupDataPointsByLabels(metric pmetric.Metr
 		dataPoints := metric.Histogram().DataPoints()
 		for i := 0; i < dataPoints.Len(); i++ {
 			dp := dataPoints.At(i)
-			groupKey := p.buildGroupKeyFromPresentAttributes(resourceAttrs, dp.Attributes(), groupByLabels)
+			if !window.contains(dp.Timestamp()) || !p.isSampled(metric.Name(), resourceAttrs, dp.Attributes(), sampleRate) {
+				continue
+			}
+			groupKey := p.capGroupKey(p.buildGroupKeyFromPresentAttributes(resourceAttrs, dp.Attributes(), groupByLabels), groups)
 
 			// TODO: MEMORY INEFFICIENT - Creating new metric for each datapoint
 			newMetric := pmetric.NewMetric()
@@ -300,9 +1884,115 @@ func (p *metricsAggregatorProcessor) groupDataPointsByLabels(metric pmetric.Metr
 	}
 }
 
-// buildGroupKeyFromPresentAttributes creates a group key from both resource and datapoint attributes
-// Returns the group key constructed from present labels only
+// isSampled reports whether the series of a data point is kept by a rule's sample_rate. The decision only
+// depends on the series, so a series is either aggregated in every batch or in none.
+func (p *metricsAggregatorProcessor) isSampled(metricName string, resourceAttrs pcommon.Map, dataPointAttrs pcommon.Map, sampleRate float64) bool {
+	if sampleRate <= 0 || sampleRate >= 1 {
+		return true
+	}
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(p.buildSeriesKey("", metricName, resourceAttrs, dataPointAttrs)))
+	return float64(h.Sum64()%samplingBuckets) < sampleRate*samplingBuckets
+}
+
+// timeWindow bounds the timestamps of the source data points a rule aggregates. Zero bounds are open.
+type timeWindow struct {
+	start pcommon.Timestamp
+	end   pcommon.Timestamp
+}
+
+// getTimeWindow returns the window of a rule from its time_window_start, time_window_end and max_age.
+// When both a start and a max_age are set, the later of the two bounds applies.
+func getTimeWindow(rule AggregationRule, now time.Time) timeWindow {
+	var window timeWindow
+	if !rule.TimeWindowStart.IsZero() {
+		window.start = pcommon.NewTimestampFromTime(rule.TimeWindowStart)
+	}
+	if !rule.TimeWindowEnd.IsZero() {
+		window.end = pcommon.NewTimestampFromTime(rule.TimeWindowEnd)
+	}
+	if rule.MaxAge > 0 {
+		if maxAgeStart := pcommon.NewTimestampFromTime(now.Add(-rule.MaxAge)); maxAgeStart > window.start {
+			window.start = maxAgeStart
+		}
+	}
+	return window
+}
+
+// isSet reports whether the window restricts timestamps at all
+func (w timeWindow) isSet() bool {
+	return w.start != 0 || w.end != 0
+}
+
+// contains reports whether a timestamp falls in the window, bounds included
+func (w timeWindow) contains(ts pcommon.Timestamp) bool {
+	if w.start != 0 && ts < w.start {
+		return false
+	}
+	if w.end != 0 && ts > w.end {
+		return false
+	}
+	return true
+}
+
+// capGroupKey returns the overflow group key instead of groupKey when groupKey would create a group
+// beyond max_total_groups. The overflow group itself does not count towards the cap.
+func (p *metricsAggregatorProcessor) capGroupKey(groupKey string, groups map[string][]MetricWithResource) string {
+	if p.rules.config.MaxTotalGroups <= 0 {
+		return groupKey
+	}
+	if _, exists := groups[groupKey]; exists {
+		return groupKey
+	}
+
+	groupCount := len(groups)
+	if _, exists := groups[overflowGroupKey]; exists {
+		groupCount--
+	}
+	if groupCount < p.rules.config.MaxTotalGroups {
+		return groupKey
+	}
+
+	p.groupOverflows.Add(1)
+	return overflowGroupKey
+}
+
+// buildGroupKeyFromPresentAttributes creates a group key from both resource and datapoint attributes.
+// With hash_group_keys, the key is a short hash of the readable key.
 func (p *metricsAggregatorProcessor) buildGroupKeyFromPresentAttributes(resourceAttrs pcommon.Map, dataPointAttrs pcommon.Map, groupByLabels []string) string {
+	groupKey := p.buildReadableGroupKey(resourceAttrs, dataPointAttrs, groupByLabels)
+	if !p.rules.config.HashGroupKeys || groupKey == "all" {
+		return groupKey
+	}
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(groupKey))
+	return strconv.FormatUint(h.Sum64(), 16)
+}
+
+// unhashedGroupKey returns the readable key of a group, which the group-by labels of its output are parsed from.
+// A hashed key is rebuilt from the first data point of the group, since every data point of a group has the
+// same group-by values. The overflow group mixes many values, so each of its group-by labels is __overflow__.
+func (p *metricsAggregatorProcessor) unhashedGroupKey(groupKey string, groupByLabels []string, metrics []MetricWithResource) string {
+	if groupKey == overflowGroupKey {
+		keyParts := make([]string, 0, len(groupByLabels))
+		for _, label := range groupByLabels {
+			keyParts = append(keyParts, label+"="+overflowGroupKey)
+		}
+		return strings.Join(keyParts, "|")
+	}
+	if !p.rules.config.HashGroupKeys || groupKey == "all" || len(metrics) == 0 {
+		return groupKey
+	}
+	dpAttrs := getDataPointAttributes(metrics[0].Metric)
+	if len(dpAttrs) == 0 {
+		return groupKey
+	}
+	return p.buildReadableGroupKey(metrics[0].ResourceAttrs, dpAttrs[0], groupByLabels)
+}
+
+// buildReadableGroupKey creates the "label1=value1|label2=value2" group key of a data point
+// Returns the group key constructed from present labels only
+func (p *metricsAggregatorProcessor) buildReadableGroupKey(resourceAttrs pcommon.Map, dataPointAttrs pcommon.Map, groupByLabels []string) string {
 	if len(groupByLabels) == 0 {
 		return "all" // Single group for all metrics
 	}
@@ -310,23 +2000,16 @@ func (p *metricsAggregatorProcessor) buildGroupKeyFromPresentAttributes(resource
 	var keyParts []string
 
 	for _, label := range groupByLabels {
-		// Look in datapoint attributes first, then resource attributes
-		var value string
-		var found bool
-
-		if val, exists := dataPointAttrs.Get(label); exists {
-			value = val.AsString()
-			found = true
-		} else if val, exists := resourceAttrs.Get(label); exists {
-			value = val.AsString()
-			found = true
-		}
+		value, _, found := p.lookupLabel(resourceAttrs, dataPointAttrs, label)
 
 		// Only include labels that are actually present (even if empty)
 		if found {
-			keyParts = append(keyParts, label+"="+value)
+			keyParts = append(keyParts, label+"="+p.normalizeGroupValue(value.AsString()))
+		} else if placeholder, ok := p.rules.config.missingLabelPlaceholder(); ok {
+			// Data points without the label form their own group
+			keyParts = append(keyParts, label+"="+placeholder)
 		}
-		// Missing labels are completely excluded
+		// Otherwise missing labels are completely excluded
 	}
 
 	// Build group key from present labels only
@@ -337,6 +2020,18 @@ func (p *metricsAggregatorProcessor) buildGroupKeyFromPresentAttributes(resource
 	return strings.Join(keyParts, "|")
 }
 
+// getOutputTimestamp picks the timestamp of the aggregated data point according to the rule's timestamp strategy
+func (p *metricsAggregatorProcessor) getOutputTimestamp(metrics []MetricWithResource, strategy string) pcommon.Timestamp {
+	switch strategy {
+	case "earliest":
+		return p.getEarliestDataPointTimestamp(metrics)
+	case "now":
+		return pcommon.NewTimestampFromTime(time.Now())
+	default:
+		return p.getLatestTimestamp(metrics)
+	}
+}
+
 // getLatestTimestamp gets the latest timestamp from a group of metrics
 func (p *metricsAggregatorProcessor) getLatestTimestamp(metrics []MetricWithResource) pcommon.Timestamp {
 	var latestTimestamp pcommon.Timestamp = 0
@@ -379,6 +2074,49 @@ func (p *metricsAggregatorProcessor) getLatestTimestamp(metrics []MetricWithReso
 	return latestTimestamp
 }
 
+// getEarliestDataPointTimestamp gets the earliest data point timestamp from a group of metrics
+// Unlike getEarliestTimestamp, start timestamps are ignored for all metric types
+func (p *metricsAggregatorProcessor) getEarliestDataPointTimestamp(metrics []MetricWithResource) pcommon.Timestamp {
+	var earliestTimestamp pcommon.Timestamp = 0
+
+	for _, metricWithResource := range metrics {
+		metric := metricWithResource.Metric
+		switch metric.Type() {
+		case pmetric.MetricTypeGauge:
+			dataPoints := metric.Gauge().DataPoints()
+			for i := 0; i < dataPoints.Len(); i++ {
+				ts := dataPoints.At(i).Timestamp()
+				if ts > 0 && (earliestTimestamp == 0 || ts < earliestTimestamp) {
+					earliestTimestamp = ts
+				}
+			}
+		case pmetric.MetricTypeSum:
+			dataPoints := metric.Sum().DataPoints()
+			for i := 0; i < dataPoints.Len(); i++ {
+				ts := dataPoints.At(i).Timestamp()
+				if ts > 0 && (earliestTimestamp == 0 || ts < earliestTimestamp) {
+					earliestTimestamp = ts
+				}
+			}
+		case pmetric.MetricTypeHistogram:
+			dataPoints := metric.Histogram().DataPoints()
+			for i := 0; i < dataPoints.Len(); i++ {
+				ts := dataPoints.At(i).Timestamp()
+				if ts > 0 && (earliestTimestamp == 0 || ts < earliestTimestamp) {
+					earliestTimestamp = ts
+				}
+			}
+		}
+	}
+
+	// If no timestamp found, use current time
+	if earliestTimestamp == 0 {
+		earliestTimestamp = pcommon.NewTimestampFromTime(time.Now())
+	}
+
+	return earliestTimestamp
+}
+
 // getEarliestTimestamp gets the earliest timestamp from a group of metrics
 func (p *metricsAggregatorProcessor) getEarliestTimestamp(metrics []MetricWithResource) pcommon.Timestamp {
 	var earliestTimestamp pcommon.Timestamp = pcommon.Timestamp(^uint64(0)) // Max value
@@ -453,12 +2191,12 @@ func (p *metricsAggregatorProcessor) setLabelsFromGroupKey(attributes pcommon.Ma
 }
 
 // calculateAggregatedValue calculates the aggregated value from multiple metrics
-func (p *metricsAggregatorProcessor) calculateAggregatedValue(metrics []MetricWithResource, aggregationType string) float64 {
+func (p *metricsAggregatorProcessor) calculateAggregatedValue(metrics []MetricWithResource, aggregationType string, histogramValueSource string, transform valueTransform, trimFraction float64) float64 {
 	var values []float64
 
 	// Extract values from all metrics
 	for _, metricWithResource := range metrics {
-		metricValues := p.extractValuesFromMetric(metricWithResource.Metric)
+		metricValues := p.extractValuesFromMetric(metricWithResource.Metric, histogramValueSource, transform)
 		values = append(values, metricValues...)
 	}
 
@@ -498,13 +2236,119 @@ func (p *metricsAggregatorProcessor) calculateAggregatedValue(metrics []MetricWi
 		return max
 	case "count":
 		return float64(len(values))
+	case "mode":
+		return mode(values)
+	case "trimmed_mean":
+		return trimmedMean(values, trimFraction)
 	default:
 		return 0
 	}
 }
 
-// extractValuesFromMetric extracts numeric values from a metric
-func (p *metricsAggregatorProcessor) extractValuesFromMetric(metric pmetric.Metric) []float64 {
+// mode returns the most common value, e.g. the prevailing state of enum-coded state gauges.
+// Ties are broken by the smallest value.
+func mode(values []float64) float64 {
+	counts := make(map[float64]int, len(values))
+	for _, v := range values {
+		counts[v]++
+	}
+
+	result, resultCount := values[0], 0
+	for v, count := range counts {
+		if count > resultCount || (count == resultCount && v < result) {
+			result, resultCount = v, count
+		}
+	}
+	return result
+}
+
+// trimmedMean returns the mean of the values once the given fraction of the sorted values is dropped
+// at each end, so that a few outliers (e.g. a stuck node) do not skew it. The fraction is below 0.5,
+// so at least one value is always kept.
+func trimmedMean(values []float64, trimFraction float64) float64 {
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+
+	trim := int(float64(len(sorted)) * trimFraction)
+	kept := sorted[trim : len(sorted)-trim]
+
+	sum := 0.0
+	for _, v := range kept {
+		sum += v
+	}
+	return sum / float64(len(kept))
+}
+
+// exactIntSum returns the sum of a group whose sources are all integers, e.g. byte counters, summed in int64.
+// Summing them as float64 would lose precision beyond 2^53. It returns false for other aggregation types,
+// for transformed or sampled values, and when a source is not an integer.
+func (p *metricsAggregatorProcessor) exactIntSum(rule AggregationRule, metrics []MetricWithResource, transform valueTransform) (int64, bool) {
+	if rule.AggregationType != "sum" && rule.AggregationType != "" {
+		return 0, false
+	}
+	if transform != nil || (rule.SampleRate > 0 && rule.SampleRate < 1) {
+		return 0, false
+	}
+	return p.sumIntValues(metrics)
+}
+
+// setAggregatedValue sets the value of a gauge or sum output data point, as an int when it is an exact integer sum
+func setAggregatedValue(dp pmetric.NumberDataPoint, value float64, intSum int64, isIntSum bool) {
+	if isIntSum {
+		dp.SetIntValue(intSum)
+		return
+	}
+	dp.SetDoubleValue(value)
+}
+
+// sumIntValues sums the values of the metrics in int64. It returns false when a value is not an
+// integer or when the sum overflows, in which case the values have to be summed as float64.
+func (p *metricsAggregatorProcessor) sumIntValues(metrics []MetricWithResource) (int64, bool) {
+	var sum int64
+	for _, metricWithResource := range metrics {
+		values, ok := extractIntValuesFromMetric(metricWithResource.Metric)
+		if !ok {
+			return 0, false
+		}
+		for _, v := range values {
+			if (v > 0 && sum > math.MaxInt64-v) || (v < 0 && sum < math.MinInt64-v) {
+				p.logger.Warn("Integer sum overflows int64, summing as float64",
+					zap.String("metric", metricWithResource.Metric.Name()))
+				return 0, false
+			}
+			sum += v
+		}
+	}
+	return sum, true
+}
+
+// extractIntValuesFromMetric extracts the values of a gauge or sum whose data points are all integers.
+// It returns false for other metric types and for double data points.
+func extractIntValuesFromMetric(metric pmetric.Metric) ([]int64, bool) {
+	var dps pmetric.NumberDataPointSlice
+	switch metric.Type() {
+	case pmetric.MetricTypeGauge:
+		dps = metric.Gauge().DataPoints()
+	case pmetric.MetricTypeSum:
+		dps = metric.Sum().DataPoints()
+	default:
+		return nil, false
+	}
+
+	values := make([]int64, 0, dps.Len())
+	for i := 0; i < dps.Len(); i++ {
+		dp := dps.At(i)
+		if dp.ValueType() != pmetric.NumberDataPointValueTypeInt {
+			return nil, false
+		}
+		values = append(values, dp.IntValue())
+	}
+	return values, true
+}
+
+// extractValuesFromMetric extracts numeric values from a metric.
+// Histograms contribute their sum, or their count when histogramValueSource is "count".
+func (p *metricsAggregatorProcessor) extractValuesFromMetric(metric pmetric.Metric, histogramValueSource string, transform valueTransform) []float64 {
 	var values []float64
 
 	switch metric.Type() {
@@ -531,21 +2375,75 @@ func (p *metricsAggregatorProcessor) extractValuesFromMetric(metric pmetric.Metr
 	case pmetric.MetricTypeHistogram:
 		for i := 0; i < metric.Histogram().DataPoints().Len(); i++ {
 			dp := metric.Histogram().DataPoints().At(i)
-			values = append(values, dp.Sum())
+			if histogramValueSource == "count" {
+				values = append(values, float64(dp.Count()))
+			} else {
+				values = append(values, dp.Sum())
+			}
 		}
 	}
 
+	if transform != nil {
+		for i, value := range values {
+			values[i] = transform(value)
+		}
+	}
 	return values
 }
 
-// removeOriginalMetrics removes original metrics while preserving aggregated ones
+// valueTransform is applied to every source value of a rule before it is aggregated
+type valueTransform func(float64) float64
+
+// parseValueTransform parses a value_transform expression: abs, multiply:<factor> or clamp_min:<min>.
+// An empty expression returns a nil transform, which leaves the values unchanged.
+func parseValueTransform(expr string) (valueTransform, error) {
+	if expr == "" {
+		return nil, nil
+	}
+
+	name, arg, hasArg := strings.Cut(expr, ":")
+	switch name {
+	case "abs":
+		if hasArg {
+			return nil, fmt.Errorf("value transform '%s' takes no argument", name)
+		}
+		return math.Abs, nil
+	case "multiply", "clamp_min":
+		if !hasArg {
+			return nil, fmt.Errorf("value transform '%s' requires an argument, e.g. %s:1", name, name)
+		}
+		operand, err := strconv.ParseFloat(strings.TrimSpace(arg), 64)
+		if err != nil || math.IsNaN(operand) || math.IsInf(operand, 0) {
+			return nil, fmt.Errorf("value transform '%s' requires a finite number, got '%s'", name, arg)
+		}
+		if name == "multiply" {
+			return func(value float64) float64 { return value * operand }, nil
+		}
+		return func(value float64) float64 { return math.Max(value, operand) }, nil
+	default:
+		return nil, fmt.Errorf("unknown value transform '%s', must be one of: abs, multiply:<factor>, clamp_min:<min>", name)
+	}
+}
+
+// removeOriginalMetrics removes original metrics while preserving aggregated ones and returns the number removed
 // Uses resource attributes to distinguish between original and aggregated resources
-func (p *metricsAggregatorProcessor) removeOriginalMetrics(md pmetric.Metrics, rule AggregationRule) {
+func (p *metricsAggregatorProcessor) removeOriginalMetrics(md pmetric.Metrics, rule AggregationRule) int {
+	window := getTimeWindow(rule, time.Now())
+
+	// Metrics skipped because of their unit were not aggregated, so they are kept
+	skippedUnit := func(pmetric.Metric) bool { return false }
+	if rule.UnitMismatchPolicy == "skip" {
+		if units, _ := partitionByUnit(p.findMatchingMetrics(md, rule)); len(units) > 1 {
+			skippedUnit = func(metric pmetric.Metric) bool { return metric.Unit() != units[0] }
+		}
+	}
+
+	removed := 0
 	for i := 0; i < md.ResourceMetrics().Len(); i++ {
 		rm := md.ResourceMetrics().At(i)
 
 		// Check if this resource has aggregated marker attributes using global config
-		isAggregatedResource := p.hasAggregatedMarkerAttributes(rm.Resource().Attributes(), p.config.OutputResourceAttributes)
+		isAggregatedResource := p.hasAggregatedMarkerAttributes(rm.Resource().Attributes(), p.outputResourceAttributes)
 
 		// Skip removal for aggregated resources (optimization)
 		if isAggregatedResource {
@@ -559,10 +2457,45 @@ func (p *metricsAggregatorProcessor) removeOriginalMetrics(md pmetric.Metrics, r
 			// Remove metrics that match the pattern
 			// RemoveIf handles internal iteration and removal safely
 			sm.Metrics().RemoveIf(func(metric pmetric.Metric) bool {
-				return p.matchesPattern(metric.Name(), rule)
+				if !p.matchesMetric(metric, rule) || skippedUnit(metric) {
+					return false
+				}
+				if window.isSet() {
+					// Out-of-window data points were not aggregated, so they are kept
+					if !removeDataPointsInWindow(metric, window) {
+						return false
+					}
+				}
+				removed++
+				return true
 			})
 		}
 	}
+
+	return removed
+}
+
+// removeDataPointsInWindow removes the data points of a metric whose timestamp falls in the window.
+// It reports whether the metric has no data points left.
+func removeDataPointsInWindow(metric pmetric.Metric, window timeWindow) bool {
+	switch metric.Type() {
+	case pmetric.MetricTypeGauge:
+		metric.Gauge().DataPoints().RemoveIf(func(dp pmetric.NumberDataPoint) bool {
+			return window.contains(dp.Timestamp())
+		})
+		return metric.Gauge().DataPoints().Len() == 0
+	case pmetric.MetricTypeSum:
+		metric.Sum().DataPoints().RemoveIf(func(dp pmetric.NumberDataPoint) bool {
+			return window.contains(dp.Timestamp())
+		})
+		return metric.Sum().DataPoints().Len() == 0
+	case pmetric.MetricTypeHistogram:
+		metric.Histogram().DataPoints().RemoveIf(func(dp pmetric.HistogramDataPoint) bool {
+			return window.contains(dp.Timestamp())
+		})
+		return metric.Histogram().DataPoints().Len() == 0
+	}
+	return true
 }
 
 // hasAggregatedMarkerAttributes checks if a resource has the marker attributes that identify it as aggregated
@@ -579,14 +2512,23 @@ func (p *metricsAggregatorProcessor) hasAggregatedMarkerAttributes(resourceAttrs
 // extractResourceAttrsFromGroup extracts resource attributes for a specific group
 // Only extracts attributes that were actually present in the input data
 func (p *metricsAggregatorProcessor) extractResourceAttrsFromGroup(groupKey string, groupByLabels []string, metrics []MetricWithResource) map[string]string {
+	groupKey = p.unhashedGroupKey(groupKey, groupByLabels, metrics)
 	resourceAttrs := make(map[string]string)
 
-	if groupKey == "all" || len(groupByLabels) == 0 || len(metrics) == 0 {
+	if len(metrics) == 0 {
 		return resourceAttrs
 	}
 
-	// Get the first metric's resource attributes as a reference
-	firstMetricResourceAttrs := metrics[0].ResourceAttrs
+	// Carry over resource attributes that have a single value across all sources in the group
+	if p.rules.config.AutoPreserveUniformResourceAttrs {
+		for key, value := range p.uniformResourceAttrs(metrics) {
+			resourceAttrs[key] = value
+		}
+	}
+
+	if groupKey == "all" || len(groupByLabels) == 0 {
+		return resourceAttrs
+	}
 
 	// Parse group key back into labels
 	// Format: "label1=value1|label2=value2"
@@ -597,9 +2539,9 @@ func (p *metricsAggregatorProcessor) extractResourceAttrsFromGroup(groupKey stri
 			labelName := keyValue[0]
 			labelValue := keyValue[1]
 
-			// Only set as resource attribute if it exists in the original resource attributes
-			// This ensures we only promote actual resource-level attributes, not datapoint attributes
-			if _, exists := firstMetricResourceAttrs.Get(labelName); exists {
+			// Only set as resource attribute if the first metric reads it from its resource, as decided by
+			// the label precedence. This ensures we only promote actual resource-level attributes, not datapoint attributes
+			if p.isResourceLabel(metrics[0], labelName) {
 				resourceAttrs[labelName] = labelValue
 			}
 		}
@@ -608,16 +2550,32 @@ func (p *metricsAggregatorProcessor) extractResourceAttrsFromGroup(groupKey stri
 	return resourceAttrs
 }
 
+// uniformResourceAttrs returns the resource attributes that are present with the same value
+// on every contributing metric of a group
+func (p *metricsAggregatorProcessor) uniformResourceAttrs(metrics []MetricWithResource) map[string]string {
+	uniformAttrs := make(map[string]string)
+	for key, value := range metrics[0].ResourceAttrs.All() {
+		uniformAttrs[key] = value.AsString()
+	}
+
+	for _, metricWithResource := range metrics[1:] {
+		for key, value := range uniformAttrs {
+			if actualValue, exists := metricWithResource.ResourceAttrs.Get(key); !exists || actualValue.AsString() != value {
+				delete(uniformAttrs, key)
+			}
+		}
+	}
+
+	return uniformAttrs
+}
+
 // setDataPointLabelsFromGroupKey sets labels on attributes from group key
 // Only sets labels that were actually present in the input data
 func (p *metricsAggregatorProcessor) setDataPointLabelsFromGroupKey(attributes pcommon.Map, groupKey string, groupByLabels []string, metrics []MetricWithResource) {
 	if groupKey == "all" || len(groupByLabels) == 0 || len(metrics) == 0 {
 		return
 	}
-
-	// Get the first metric to determine which attributes are resource-level vs datapoint-level
-	firstMetric := metrics[0]
-	resourceAttrs := firstMetric.ResourceAttrs
+	groupKey = p.unhashedGroupKey(groupKey, groupByLabels, metrics)
 
 	// Parse group key back into labels
 	// Format: "label1=value1|label2=value2"
@@ -628,9 +2586,9 @@ func (p *metricsAggregatorProcessor) setDataPointLabelsFromGroupKey(attributes p
 			labelKey := keyValue[0]
 			labelValue := keyValue[1]
 
-			// Only set this attribute if it's NOT a resource-level attribute
-			// This ensures we only set datapoint-level attributes
-			if _, isResourceAttr := resourceAttrs.Get(labelKey); !isResourceAttr {
+			// Only set this attribute if it's NOT read from the resource, as decided by the first metric
+			// and the label precedence. This ensures we only set datapoint-level attributes
+			if !p.isResourceLabel(metrics[0], labelKey) {
 				attributes.PutStr(labelKey, labelValue)
 			}
 		}
@@ -6,6 +6,7 @@ package metricsaggregatorprocessor
 import (
 	"context"
 	"fmt"
+	"math"
 	"testing"
 	"time"
 
@@ -27,7 +28,8 @@ func TestMetricsAggregatorProcessor_ProcessMetrics(t *testing.T) {
 		{
 			name: "sum aggregation",
 			config: &Config{
-				GroupByLabels: []string{},
+				EmitOriginalMetrics: true,
+				GroupByLabels:       []string{},
 				OutputResourceAttributes: map[string]string{
 					"aggregation.level": "cluster",
 				},
@@ -48,7 +50,8 @@ func TestMetricsAggregatorProcessor_ProcessMetrics(t *testing.T) {
 		{
 			name: "regex aggregation with mean",
 			config: &Config{
-				GroupByLabels: []string{"service"},
+				EmitOriginalMetrics: true,
+				GroupByLabels:       []string{"service"},
 				OutputResourceAttributes: map[string]string{
 					"aggregation.level": "cluster",
 				},
@@ -69,7 +72,8 @@ func TestMetricsAggregatorProcessor_ProcessMetrics(t *testing.T) {
 		{
 			name: "preserve original metrics",
 			config: &Config{
-				GroupByLabels: []string{},
+				EmitOriginalMetrics: true,
+				GroupByLabels:       []string{},
 				OutputResourceAttributes: map[string]string{
 					"aggregation.level": "cluster",
 				},
@@ -442,7 +446,8 @@ func TestCrossResourceProcessor_MultipleRules(t *testing.T) {
 func TestCrossResourceProcessor_NoMatches(t *testing.T) {
 	// Create processor config that won't match anything
 	cfg := &Config{
-		GroupByLabels: []string{},
+		EmitOriginalMetrics: true,
+		GroupByLabels:       []string{},
 		OutputResourceAttributes: map[string]string{
 			"aggregation.level": "cluster",
 		},
@@ -1266,29 +1271,51 @@ func TestUnknownAggregationType(t *testing.T) {
 	result, err := processor.processMetrics(context.Background(), md)
 	require.NoError(t, err)
 
-	// Find the aggregated metric
-	found := false
-	for i := 0; i < result.ResourceMetrics().Len(); i++ {
-		rm := result.ResourceMetrics().At(i)
-		for j := 0; j < rm.ScopeMetrics().Len(); j++ {
-			sm := rm.ScopeMetrics().At(j)
-			for k := 0; k < sm.Metrics().Len(); k++ {
-				metric := sm.Metrics().At(k)
-				if metric.Name() == "aggregated_metric" {
-					found = true
-					assert.Equal(t, pmetric.MetricTypeGauge, metric.Type())
-
-					dataPoints := metric.Gauge().DataPoints()
-					assert.Equal(t, 1, dataPoints.Len())
+	// Unknown aggregation types would compute 0, which looks like real data, so no metric is emitted
+	assert.Empty(t, findOutputMetrics(result, "aggregated_metric"), "No misleading zero-valued metric should be created for an unknown aggregation type")
+}
 
-					dp := dataPoints.At(0)
-					// Unknown aggregation type should default to 0
-					assert.Equal(t, 0.0, dp.DoubleValue(), "Unknown aggregation type should return 0")
-				}
-			}
-		}
+func TestUnknownAggregationTypeSkipped(t *testing.T) {
+	cfg := &Config{
+		GroupByLabels: []string{},
+		OutputResourceAttributes: map[string]string{
+			"aggregation.level": "cluster",
+		},
+		AggregationRules: []AggregationRule{
+			{
+				MetricPattern:    "test_metric",
+				MatchType:        "strict",
+				OutputMetricName: "aggregated_metric",
+				AggregationType:  "unknown_type",
+			},
+			{
+				MetricPattern:    "test_metric",
+				MatchType:        "strict",
+				OutputMetricName: "summed_metric",
+				AggregationType:  "sum",
+			},
+		},
 	}
-	assert.True(t, found, "Aggregated metric should be created even with unknown aggregation type")
+
+	// Unknown types are always rejected at validation time
+	require.Error(t, validateAggregationRule(cfg.AggregationRules[0], 0))
+
+	processor := newMetricsAggregatorProcessor(cfg, zap.NewNop())
+
+	md := pmetric.NewMetrics()
+	metric := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+	metric.SetName("test_metric")
+	metric.SetEmptyGauge().DataPoints().AppendEmpty().SetDoubleValue(100.0)
+
+	result, err := processor.processMetrics(context.Background(), md)
+	require.NoError(t, err)
+
+	// No misleading zero-valued metric is emitted for the unknown type
+	assert.Empty(t, findOutputMetrics(result, "aggregated_metric"))
+
+	summed := findOutputMetrics(result, "summed_metric")
+	require.Len(t, summed, 1)
+	assert.Equal(t, 100.0, summed[0].metric.Gauge().DataPoints().At(0).DoubleValue())
 }
 
 // CRITICAL: Test smart label filtering - the core new feature
@@ -1392,7 +1419,8 @@ func TestPreserveOriginalMetrics(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			cfg := &Config{
-				GroupByLabels: []string{},
+				EmitOriginalMetrics: true,
+				GroupByLabels:       []string{},
 				OutputResourceAttributes: map[string]string{
 					"aggregated": "true",
 				},
@@ -1874,7 +1902,8 @@ func TestTimestampHandling(t *testing.T) {
 // Test invalid match type
 func TestInvalidMatchType(t *testing.T) {
 	cfg := &Config{
-		GroupByLabels: []string{},
+		EmitOriginalMetrics: true,
+		GroupByLabels:       []string{},
 		OutputResourceAttributes: map[string]string{
 			"test": "invalid_match",
 		},
@@ -1990,3 +2019,3228 @@ func TestEmptyGroupByLabels(t *testing.T) {
 	}
 	assert.True(t, found, "Should find single aggregated metric with no grouping")
 }
+
+func TestAutoPreserveUniformResourceAttrs(t *testing.T) {
+	newInput := func() pmetric.Metrics {
+		md := pmetric.NewMetrics()
+		resources := []map[string]string{
+			{"cloud.region": "us-east-1", "k8s.pod.name": "pod-a"},
+			{"cloud.region": "us-east-1", "k8s.pod.name": "pod-b"},
+		}
+		for i, attrs := range resources {
+			rm := md.ResourceMetrics().AppendEmpty()
+			for k, v := range attrs {
+				rm.Resource().Attributes().PutStr(k, v)
+			}
+			metric := rm.ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+			metric.SetName("test_metric")
+			dp := metric.SetEmptyGauge().DataPoints().AppendEmpty()
+			dp.SetDoubleValue(float64(10 * (i + 1)))
+			dp.Attributes().PutStr("service", "web")
+		}
+		return md
+	}
+
+	for _, enabled := range []bool{true, false} {
+		t.Run(fmt.Sprintf("enabled=%v", enabled), func(t *testing.T) {
+			cfg := &Config{
+				GroupByLabels: []string{"service"},
+				OutputResourceAttributes: map[string]string{
+					"aggregation.level": "cluster",
+				},
+				AggregationRules: []AggregationRule{
+					{
+						MetricPattern:    "test_metric",
+						OutputMetricName: "aggregated_test_metric",
+						AggregationType:  "sum",
+					},
+				},
+				AutoPreserveUniformResourceAttrs: enabled,
+			}
+			processor := newMetricsAggregatorProcessor(cfg, zap.NewNop())
+
+			result, err := processor.processMetrics(context.Background(), newInput())
+			require.NoError(t, err)
+
+			outputs := findOutputMetrics(result, "aggregated_test_metric")
+			require.Len(t, outputs, 1)
+			resourceAttrs := outputs[0].resource.Attributes()
+
+			region, hasRegion := resourceAttrs.Get("cloud.region")
+			assert.Equal(t, enabled, hasRegion, "uniform attribute should only be carried over when enabled")
+			if hasRegion {
+				assert.Equal(t, "us-east-1", region.AsString())
+			}
+			_, hasPod := resourceAttrs.Get("k8s.pod.name")
+			assert.False(t, hasPod, "non-uniform attribute should never be carried over")
+
+			level, _ := resourceAttrs.Get("aggregation.level")
+			assert.Equal(t, "cluster", level.AsString())
+			assert.Equal(t, 30.0, outputs[0].metric.Gauge().DataPoints().At(0).DoubleValue())
+		})
+	}
+}
+
+func TestTimestampStrategy(t *testing.T) {
+	now := time.Now()
+	earliest := now.Add(-10 * time.Minute)
+	latest := now.Add(-5 * time.Minute)
+
+	tests := []struct {
+		strategy string
+		check    func(t *testing.T, ts pcommon.Timestamp)
+	}{
+		{
+			strategy: "",
+			check: func(t *testing.T, ts pcommon.Timestamp) {
+				assert.Equal(t, pcommon.NewTimestampFromTime(latest), ts)
+			},
+		},
+		{
+			strategy: "latest",
+			check: func(t *testing.T, ts pcommon.Timestamp) {
+				assert.Equal(t, pcommon.NewTimestampFromTime(latest), ts)
+			},
+		},
+		{
+			strategy: "earliest",
+			check: func(t *testing.T, ts pcommon.Timestamp) {
+				assert.Equal(t, pcommon.NewTimestampFromTime(earliest), ts)
+			},
+		},
+		{
+			strategy: "now",
+			check: func(t *testing.T, ts pcommon.Timestamp) {
+				assert.False(t, ts.AsTime().Before(now), "now strategy should use the aggregation time")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("strategy=%q", tt.strategy), func(t *testing.T) {
+			cfg := &Config{
+				GroupByLabels: []string{},
+				OutputResourceAttributes: map[string]string{
+					"aggregation.level": "cluster",
+				},
+				AggregationRules: []AggregationRule{
+					{
+						MetricPattern:     "test_metric",
+						OutputMetricName:  "aggregated_test_metric",
+						AggregationType:   "sum",
+						TimestampStrategy: tt.strategy,
+					},
+				},
+			}
+			processor := newMetricsAggregatorProcessor(cfg, zap.NewNop())
+
+			md := pmetric.NewMetrics()
+			for _, ts := range []time.Time{latest, earliest} {
+				metric := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+				metric.SetName("test_metric")
+				dp := metric.SetEmptyGauge().DataPoints().AppendEmpty()
+				dp.SetDoubleValue(1)
+				dp.SetTimestamp(pcommon.NewTimestampFromTime(ts))
+			}
+
+			result, err := processor.processMetrics(context.Background(), md)
+			require.NoError(t, err)
+
+			outputs := findOutputMetrics(result, "aggregated_test_metric")
+			require.Len(t, outputs, 1)
+			tt.check(t, outputs[0].metric.Gauge().DataPoints().At(0).Timestamp())
+		})
+	}
+
+	t.Run("invalid strategy", func(t *testing.T) {
+		err := validateAggregationRule(AggregationRule{
+			MetricPattern:     "test_metric",
+			OutputMetricName:  "aggregated_test_metric",
+			TimestampStrategy: "oldest",
+		}, 0)
+		assert.ErrorContains(t, err, "invalid timestamp_strategy")
+	})
+}
+
+func TestSplitByLabel(t *testing.T) {
+	cfg := &Config{
+		GroupByLabels: []string{"cluster"},
+		OutputResourceAttributes: map[string]string{
+			"aggregation.level": "cluster",
+		},
+		AggregationRules: []AggregationRule{
+			{
+				MetricPattern:    "http_requests",
+				OutputMetricName: "cluster_http_requests",
+				AggregationType:  "sum",
+				SplitByLabel:     "method",
+			},
+		},
+	}
+	processor := newMetricsAggregatorProcessor(cfg, zap.NewNop())
+
+	md := pmetric.NewMetrics()
+	for _, pod := range []string{"pod-1", "pod-2"} {
+		rm := md.ResourceMetrics().AppendEmpty()
+		rm.Resource().Attributes().PutStr("cluster", "prod")
+		rm.Resource().Attributes().PutStr("pod", pod)
+		metric := rm.ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+		metric.SetName("http_requests")
+		gauge := metric.SetEmptyGauge()
+		for method, value := range map[string]float64{"GET": 10, "POST": 3, "PUT/PATCH": 1} {
+			dp := gauge.DataPoints().AppendEmpty()
+			dp.SetDoubleValue(value)
+			dp.SetTimestamp(pcommon.NewTimestampFromTime(time.Now()))
+			dp.Attributes().PutStr("method", method)
+		}
+	}
+
+	result, err := processor.processMetrics(context.Background(), md)
+	require.NoError(t, err)
+
+	assert.Empty(t, findOutputMetrics(result, "cluster_http_requests"), "unsplit metric should not be emitted")
+
+	expected := map[string]float64{
+		"cluster_http_requests_GET":       20,
+		"cluster_http_requests_POST":      6,
+		"cluster_http_requests_PUT_PATCH": 2,
+	}
+	for name, value := range expected {
+		outputs := findOutputMetrics(result, name)
+		require.Len(t, outputs, 1, "expected exactly one metric named %s", name)
+
+		dps := outputs[0].metric.Gauge().DataPoints()
+		require.Equal(t, 1, dps.Len())
+		assert.Equal(t, value, dps.At(0).DoubleValue())
+		_, hasMethod := dps.At(0).Attributes().Get("method")
+		assert.False(t, hasMethod, "split label should be carried by the metric name only")
+
+		cluster, ok := outputs[0].resource.Attributes().Get("cluster")
+		require.True(t, ok)
+		assert.Equal(t, "prod", cluster.Str())
+	}
+}
+
+func TestDetectCounterResets(t *testing.T) {
+	cfg := &Config{
+		GroupByLabels: []string{"cluster"},
+		OutputResourceAttributes: map[string]string{
+			"aggregation.level": "cluster",
+		},
+		AggregationRules: []AggregationRule{
+			{
+				MetricPattern:       "requests_total",
+				OutputMetricName:    "cluster_requests_total",
+				AggregationType:     "sum",
+				OutputMetricType:    "sum",
+				DetectCounterResets: true,
+			},
+		},
+	}
+	processor := newMetricsAggregatorProcessor(cfg, zap.NewNop())
+
+	buildBatch := func(values map[string]int64) pmetric.Metrics {
+		md := pmetric.NewMetrics()
+		for pod, value := range values {
+			rm := md.ResourceMetrics().AppendEmpty()
+			rm.Resource().Attributes().PutStr("cluster", "prod")
+			rm.Resource().Attributes().PutStr("pod", pod)
+			metric := rm.ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+			metric.SetName("requests_total")
+			sum := metric.SetEmptySum()
+			sum.SetAggregationTemporality(pmetric.AggregationTemporalityCumulative)
+			sum.SetIsMonotonic(true)
+			dp := sum.DataPoints().AppendEmpty()
+			dp.SetIntValue(value)
+			dp.SetTimestamp(pcommon.NewTimestampFromTime(time.Now()))
+		}
+		return md
+	}
+
+	clusterSum := func(md pmetric.Metrics) int64 {
+		outputs := findOutputMetrics(md, "cluster_requests_total")
+		require.Len(t, outputs, 1)
+		return outputs[0].metric.Sum().DataPoints().At(0).IntValue()
+	}
+
+	// First batch: both pods are running
+	result, err := processor.processMetrics(context.Background(), buildBatch(map[string]int64{"pod-a": 100, "pod-b": 50}))
+	require.NoError(t, err)
+	assert.Equal(t, int64(150), clusterSum(result))
+
+	// Second batch: pod-a restarted and its counter started again from zero
+	result, err = processor.processMetrics(context.Background(), buildBatch(map[string]int64{"pod-a": 10, "pod-b": 60}))
+	require.NoError(t, err)
+	assert.Equal(t, int64(170), clusterSum(result), "the pre-reset value of pod-a should be carried over")
+
+	// Third batch: pod-a keeps counting after the reset
+	result, err = processor.processMetrics(context.Background(), buildBatch(map[string]int64{"pod-a": 25, "pod-b": 70}))
+	require.NoError(t, err)
+	assert.Equal(t, int64(195), clusterSum(result))
+}
+
+func TestDetectCounterResetsTracking(t *testing.T) {
+	newConfig := func() *Config {
+		return &Config{
+			GroupByLabels: []string{"cluster"},
+			OutputResourceAttributes: map[string]string{
+				"aggregation.level": "cluster",
+			},
+			AggregationRules: []AggregationRule{
+				{
+					MetricPattern:       "requests_total",
+					OutputMetricName:    "cluster_requests_total",
+					AggregationType:     "sum",
+					OutputMetricType:    "sum",
+					DetectCounterResets: true,
+				},
+			},
+		}
+	}
+
+	base := time.Now()
+	at := func(minutes int) pcommon.Timestamp {
+		return pcommon.NewTimestampFromTime(base.Add(time.Duration(minutes) * time.Minute))
+	}
+	// process sends a single data point of pod-a, started and observed at the given minutes,
+	// and returns the cluster sum
+	process := func(t *testing.T, processor *metricsAggregatorProcessor, start, timestamp int, value int64) int64 {
+		md := pmetric.NewMetrics()
+		rm := md.ResourceMetrics().AppendEmpty()
+		rm.Resource().Attributes().PutStr("cluster", "prod")
+		rm.Resource().Attributes().PutStr("pod", "pod-a")
+		metric := rm.ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+		metric.SetName("requests_total")
+		sum := metric.SetEmptySum()
+		sum.SetAggregationTemporality(pmetric.AggregationTemporalityCumulative)
+		sum.SetIsMonotonic(true)
+		dp := sum.DataPoints().AppendEmpty()
+		dp.SetIntValue(value)
+		dp.SetStartTimestamp(at(start))
+		dp.SetTimestamp(at(timestamp))
+
+		result, err := processor.processMetrics(context.Background(), md)
+		require.NoError(t, err)
+		outputs := findOutputMetrics(result, "cluster_requests_total")
+		require.Len(t, outputs, 1)
+		return outputs[0].metric.Sum().DataPoints().At(0).IntValue()
+	}
+
+	t.Run("StartTimestamp", func(t *testing.T) {
+		processor := newMetricsAggregatorProcessor(newConfig(), zap.NewNop())
+		assert.Equal(t, int64(100), process(t, processor, 0, 1, 100))
+
+		// A lower value of the same run of the counter is not a reset
+		assert.Equal(t, int64(90), process(t, processor, 0, 2, 90))
+
+		// A new start timestamp is, and the last value of the previous run is carried over
+		assert.Equal(t, int64(95), process(t, processor, 3, 4, 5))
+		assert.Equal(t, int64(110), process(t, processor, 3, 5, 20))
+
+		// An older data point of the current run gets the offset but does not count as a reset
+		assert.Equal(t, int64(95), process(t, processor, 3, 4, 5))
+		assert.Equal(t, int64(120), process(t, processor, 3, 6, 30))
+
+		// A late data point of the previous run is left as is
+		assert.Equal(t, int64(90), process(t, processor, 0, 2, 90))
+		assert.Equal(t, int64(130), process(t, processor, 3, 7, 40))
+	})
+
+	t.Run("ExactIntSum", func(t *testing.T) {
+		// 2^53+3 cannot be represented as a float64, the offset must be added to the int value
+		processor := newMetricsAggregatorProcessor(newConfig(), zap.NewNop())
+		assert.Equal(t, int64(1<<53+1), process(t, processor, 0, 1, 1<<53+1))
+		assert.Equal(t, int64(1<<53+3), process(t, processor, 2, 3, 2))
+	})
+
+	t.Run("Expiration", func(t *testing.T) {
+		processor := newMetricsAggregatorProcessor(newConfig(), zap.NewNop())
+		process(t, processor, 0, 1, 100)
+		assert.Equal(t, int64(110), process(t, processor, 2, 3, 10))
+		require.Len(t, processor.counterResets, 1)
+
+		// The state of a series is kept while it reports, and dropped once it stopped for counterResetStateTTL
+		processor.counterResetsMu.Lock()
+		processor.expireCounterResets(time.Now().Add(counterResetStateTTL / 2))
+		assert.Len(t, processor.counterResets, 1)
+		processor.expireCounterResets(time.Now().Add(counterResetStateTTL + counterResetSweepInterval))
+		assert.Empty(t, processor.counterResets)
+		processor.counterResetsMu.Unlock()
+	})
+
+	t.Run("RulesReplaced", func(t *testing.T) {
+		processor := newMetricsAggregatorProcessor(newConfig(), zap.NewNop())
+		process(t, processor, 0, 1, 100)
+		assert.Equal(t, int64(110), process(t, processor, 2, 3, 10))
+
+		// Replaced rules start without the offsets of the previous ones
+		processor.rules.replaceAggregationRules(newConfig().AggregationRules)
+		assert.Equal(t, int64(20), process(t, processor, 2, 4, 20))
+		assert.Equal(t, int64(25), process(t, processor, 5, 6, 5))
+	})
+}
+
+func TestMergeIntoExisting(t *testing.T) {
+	cfg := &Config{
+		GroupByLabels: []string{"cluster"},
+		OutputResourceAttributes: map[string]string{
+			"aggregation.level": "cluster",
+		},
+		AggregationRules: []AggregationRule{
+			{
+				MetricPattern:     "throughput",
+				OutputMetricName:  "cluster_throughput",
+				AggregationType:   "sum",
+				MergeIntoExisting: true,
+			},
+		},
+	}
+	processor := newMetricsAggregatorProcessor(cfg, zap.NewNop())
+
+	md := pmetric.NewMetrics()
+
+	// A cluster_throughput metric produced by another source is already in the batch
+	existingRM := md.ResourceMetrics().AppendEmpty()
+	existingRM.Resource().Attributes().PutStr("cluster", "prod")
+	existingRM.Resource().Attributes().PutStr("aggregation.level", "cluster")
+	existing := existingRM.ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+	existing.SetName("cluster_throughput")
+	existingDp := existing.SetEmptyGauge().DataPoints().AppendEmpty()
+	existingDp.SetDoubleValue(5)
+	existingDp.SetTimestamp(pcommon.NewTimestampFromTime(time.Now()))
+
+	for _, value := range []float64{10, 20} {
+		rm := md.ResourceMetrics().AppendEmpty()
+		rm.Resource().Attributes().PutStr("cluster", "prod")
+		metric := rm.ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+		metric.SetName("throughput")
+		dp := metric.SetEmptyGauge().DataPoints().AppendEmpty()
+		dp.SetDoubleValue(value)
+		dp.SetTimestamp(pcommon.NewTimestampFromTime(time.Now()))
+	}
+
+	// A cluster without an existing metric still gets a new one
+	rm := md.ResourceMetrics().AppendEmpty()
+	rm.Resource().Attributes().PutStr("cluster", "staging")
+	metric := rm.ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+	metric.SetName("throughput")
+	dp := metric.SetEmptyGauge().DataPoints().AppendEmpty()
+	dp.SetDoubleValue(7)
+	dp.SetTimestamp(pcommon.NewTimestampFromTime(time.Now()))
+
+	result, err := processor.processMetrics(context.Background(), md)
+	require.NoError(t, err)
+
+	outputs := findOutputMetrics(result, "cluster_throughput")
+	require.Len(t, outputs, 2, "no duplicate cluster_throughput metric should be produced")
+
+	values := make(map[string]float64)
+	for _, output := range outputs {
+		cluster, ok := output.resource.Attributes().Get("cluster")
+		require.True(t, ok)
+		dps := output.metric.Gauge().DataPoints()
+		require.Equal(t, 1, dps.Len(), "data point with identical labels should be replaced")
+		values[cluster.Str()] = dps.At(0).DoubleValue()
+	}
+	assert.Equal(t, map[string]float64{"prod": 30, "staging": 7}, values)
+}
+
+func TestOnRuleError(t *testing.T) {
+	for _, tt := range []struct {
+		onRuleError string
+		expectErr   bool
+	}{
+		{onRuleError: "", expectErr: false},
+		{onRuleError: "skip", expectErr: false},
+		{onRuleError: "fail", expectErr: true},
+	} {
+		t.Run(fmt.Sprintf("on_rule_error=%q", tt.onRuleError), func(t *testing.T) {
+			cfg := &Config{
+				GroupByLabels: []string{},
+				OutputResourceAttributes: map[string]string{
+					"aggregation.level": "cluster",
+				},
+				OnRuleError: tt.onRuleError,
+				AggregationRules: []AggregationRule{
+					{
+						// Bypasses config validation to force a rule failure at processing time
+						MetricPattern:    "[invalid regex pattern",
+						MatchType:        "regex",
+						OutputMetricName: "broken_metric",
+						AggregationType:  "sum",
+					},
+					{
+						MetricPattern:    "test_metric",
+						OutputMetricName: "aggregated_metric",
+						AggregationType:  "sum",
+					},
+				},
+			}
+			processor := newMetricsAggregatorProcessor(cfg, zap.NewNop())
+
+			md := pmetric.NewMetrics()
+			metric := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+			metric.SetName("test_metric")
+			metric.SetEmptyGauge().DataPoints().AppendEmpty().SetDoubleValue(1)
+
+			result, err := processor.processMetrics(context.Background(), md)
+			if tt.expectErr {
+				assert.ErrorContains(t, err, "broken_metric")
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Len(t, findOutputMetrics(result, "aggregated_metric"), 1, "later rules should still run")
+		})
+	}
+
+	t.Run("invalid value", func(t *testing.T) {
+		cfg := &Config{
+			GroupByLabels:            []string{"service"},
+			OutputResourceAttributes: map[string]string{"aggregation.level": "cluster"},
+			OnRuleError:              "ignore",
+			AggregationRules: []AggregationRule{
+				{MetricPattern: "test_metric", OutputMetricName: "aggregated_metric"},
+			},
+		}
+		assert.ErrorContains(t, cfg.Validate(), "invalid on_rule_error")
+	})
+}
+
+func TestConsumeMatched(t *testing.T) {
+	newConfig := func(consumeMatched bool) *Config {
+		return &Config{
+			GroupByLabels: []string{},
+			OutputResourceAttributes: map[string]string{
+				"aggregation.level": "cluster",
+			},
+			AggregationRules: []AggregationRule{
+				{
+					MetricPattern:    "throughput",
+					OutputMetricName: "cluster_throughput_sum",
+					AggregationType:  "sum",
+					ConsumeMatched:   consumeMatched,
+				},
+				{
+					MetricPattern:    "throughput",
+					OutputMetricName: "cluster_throughput_max",
+					AggregationType:  "max",
+				},
+			},
+		}
+	}
+
+	newMetrics := func() pmetric.Metrics {
+		md := pmetric.NewMetrics()
+		for _, value := range []float64{10, 20} {
+			metric := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+			metric.SetName("throughput")
+			dp := metric.SetEmptyGauge().DataPoints().AppendEmpty()
+			dp.SetDoubleValue(value)
+			dp.SetTimestamp(pcommon.NewTimestampFromTime(time.Now()))
+		}
+		return md
+	}
+
+	t.Run("both rules read the same metric", func(t *testing.T) {
+		processor := newMetricsAggregatorProcessor(newConfig(false), zap.NewNop())
+
+		result, err := processor.processMetrics(context.Background(), newMetrics())
+		require.NoError(t, err)
+
+		sums := findOutputMetrics(result, "cluster_throughput_sum")
+		require.Len(t, sums, 1)
+		assert.Equal(t, 30.0, sums[0].metric.Gauge().DataPoints().At(0).DoubleValue())
+
+		maxes := findOutputMetrics(result, "cluster_throughput_max")
+		require.Len(t, maxes, 1)
+		assert.Equal(t, 20.0, maxes[0].metric.Gauge().DataPoints().At(0).DoubleValue())
+
+		assert.Empty(t, findOutputMetrics(result, "throughput"), "originals should still be removed from the output")
+	})
+
+	t.Run("consuming rule hides the metric from later rules", func(t *testing.T) {
+		processor := newMetricsAggregatorProcessor(newConfig(true), zap.NewNop())
+
+		result, err := processor.processMetrics(context.Background(), newMetrics())
+		require.NoError(t, err)
+
+		assert.Len(t, findOutputMetrics(result, "cluster_throughput_sum"), 1)
+		assert.Empty(t, findOutputMetrics(result, "cluster_throughput_max"))
+		assert.Empty(t, findOutputMetrics(result, "throughput"))
+	})
+
+	t.Run("cannot be combined with preserve_original_metrics", func(t *testing.T) {
+		err := validateAggregationRule(AggregationRule{
+			MetricPattern:           "throughput",
+			OutputMetricName:        "cluster_throughput_sum",
+			PreserveOriginalMetrics: true,
+			ConsumeMatched:          true,
+		}, 0)
+		assert.ErrorContains(t, err, "consume_matched")
+	})
+}
+
+func TestHistogramBounds(t *testing.T) {
+	config := &Config{
+		GroupByLabels: []string{},
+		OutputResourceAttributes: map[string]string{
+			"aggregation.level": "cluster",
+		},
+		AggregationRules: []AggregationRule{
+			{
+				MetricPattern:    "request_latency",
+				OutputMetricName: "cluster_request_latency",
+				OutputMetricType: "histogram",
+				HistogramBounds:  []float64{10, 50, 100},
+			},
+		},
+	}
+	processor := newMetricsAggregatorProcessor(config, zap.NewNop())
+
+	md := pmetric.NewMetrics()
+	for _, value := range []float64{5, 10, 15, 60, 200} {
+		metric := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+		metric.SetName("request_latency")
+		dp := metric.SetEmptyGauge().DataPoints().AppendEmpty()
+		dp.SetDoubleValue(value)
+		dp.SetTimestamp(pcommon.NewTimestampFromTime(time.Now()))
+	}
+
+	result, err := processor.processMetrics(context.Background(), md)
+	require.NoError(t, err)
+
+	outputs := findOutputMetrics(result, "cluster_request_latency")
+	require.Len(t, outputs, 1)
+	require.Equal(t, pmetric.MetricTypeHistogram, outputs[0].metric.Type())
+
+	dp := outputs[0].metric.Histogram().DataPoints().At(0)
+	assert.Equal(t, []float64{10, 50, 100}, dp.ExplicitBounds().AsRaw())
+	// Upper bounds are inclusive: 5 and 10 land in (-inf, 10], 15 in (10, 50], 60 in (50, 100], 200 in (100, +inf)
+	assert.Equal(t, []uint64{2, 1, 1, 1}, dp.BucketCounts().AsRaw())
+	assert.Equal(t, uint64(5), dp.Count())
+	assert.Equal(t, 290.0, dp.Sum())
+	assert.Equal(t, 5.0, dp.Min())
+	assert.Equal(t, 200.0, dp.Max())
+
+	t.Run("bounds must be increasing", func(t *testing.T) {
+		err := validateAggregationRule(AggregationRule{
+			MetricPattern:    "request_latency",
+			OutputMetricName: "cluster_request_latency",
+			OutputMetricType: "histogram",
+			HistogramBounds:  []float64{50, 10},
+		}, 0)
+		assert.ErrorContains(t, err, "strictly increasing")
+	})
+}
+
+func TestRuleNameScopeAttribute(t *testing.T) {
+	config := &Config{
+		GroupByLabels: []string{},
+		OutputResourceAttributes: map[string]string{
+			"aggregation.level": "cluster",
+		},
+		AggregationRules: []AggregationRule{
+			{
+				RuleName:         "throughput-total",
+				MetricPattern:    "throughput",
+				OutputMetricName: "cluster_throughput_sum",
+				AggregationType:  "sum",
+			},
+			{
+				MetricPattern:    "throughput",
+				OutputMetricName: "cluster_throughput_max",
+				AggregationType:  "max",
+			},
+		},
+	}
+	processor := newMetricsAggregatorProcessor(config, zap.NewNop())
+
+	md := pmetric.NewMetrics()
+	metric := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+	metric.SetName("throughput")
+	dp := metric.SetEmptyGauge().DataPoints().AppendEmpty()
+	dp.SetDoubleValue(10)
+	dp.SetTimestamp(pcommon.NewTimestampFromTime(time.Now()))
+
+	result, err := processor.processMetrics(context.Background(), md)
+	require.NoError(t, err)
+
+	for metricName, ruleName := range map[string]string{
+		"cluster_throughput_sum": "throughput-total",
+		"cluster_throughput_max": "cluster_throughput_max",
+	} {
+		outputs := findOutputMetrics(result, metricName)
+		require.Len(t, outputs, 1)
+		assert.Equal(t, "metricsaggregator", outputs[0].scope.Name())
+		value, found := outputs[0].scope.Attributes().Get(ruleNameScopeAttribute)
+		require.True(t, found, "scope of %s should carry the rule name", metricName)
+		assert.Equal(t, ruleName, value.Str())
+	}
+}
+
+func TestOutputResourceAttributesEnvExpansion(t *testing.T) {
+	t.Setenv("METRICSAGGREGATOR_TEST_HOSTNAME", "collector-1")
+
+	config := &Config{
+		GroupByLabels: []string{},
+		OutputResourceAttributes: map[string]string{
+			"aggregation.level":     "cluster",
+			"aggregation.collector": "${METRICSAGGREGATOR_TEST_HOSTNAME}",
+			"aggregation.source":    "host-${METRICSAGGREGATOR_TEST_UNSET}",
+		},
+		AggregationRules: []AggregationRule{
+			{
+				MetricPattern:    "throughput",
+				OutputMetricName: "cluster_throughput",
+				AggregationType:  "sum",
+			},
+		},
+	}
+	processor := newMetricsAggregatorProcessor(config, zap.NewNop())
+
+	md := pmetric.NewMetrics()
+	metric := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+	metric.SetName("throughput")
+	dp := metric.SetEmptyGauge().DataPoints().AppendEmpty()
+	dp.SetDoubleValue(10)
+	dp.SetTimestamp(pcommon.NewTimestampFromTime(time.Now()))
+
+	result, err := processor.processMetrics(context.Background(), md)
+	require.NoError(t, err)
+
+	outputs := findOutputMetrics(result, "cluster_throughput")
+	require.Len(t, outputs, 1)
+	assert.Equal(t, map[string]any{
+		"aggregation.level":     "cluster",
+		"aggregation.collector": "collector-1",
+		"aggregation.source":    "host-",
+	}, outputs[0].resource.Attributes().AsRaw())
+
+	// The configuration itself is left untouched
+	assert.Equal(t, "${METRICSAGGREGATOR_TEST_HOSTNAME}", config.OutputResourceAttributes["aggregation.collector"])
+}
+
+func TestAddDataAge(t *testing.T) {
+	config := &Config{
+		GroupByLabels: []string{},
+		OutputResourceAttributes: map[string]string{
+			"aggregation.level": "cluster",
+		},
+		AggregationRules: []AggregationRule{
+			{
+				MetricPattern:    "throughput",
+				OutputMetricName: "cluster_throughput",
+				AggregationType:  "sum",
+				AddDataAge:       true,
+			},
+		},
+	}
+	processor := newMetricsAggregatorProcessor(config, zap.NewNop())
+
+	md := pmetric.NewMetrics()
+	for _, age := range []time.Duration{30 * time.Second, 10 * time.Second} {
+		metric := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+		metric.SetName("throughput")
+		dp := metric.SetEmptyGauge().DataPoints().AppendEmpty()
+		dp.SetDoubleValue(10)
+		dp.SetTimestamp(pcommon.NewTimestampFromTime(time.Now().Add(-age)))
+	}
+
+	result, err := processor.processMetrics(context.Background(), md)
+	require.NoError(t, err)
+
+	outputs := findOutputMetrics(result, "cluster_throughput")
+	require.Len(t, outputs, 1)
+
+	// The age is measured from the latest source data point
+	age, found := outputs[0].metric.Gauge().DataPoints().At(0).Attributes().Get(dataAgeAttribute)
+	require.True(t, found)
+	assert.InDelta(t, 10.0, age.Double(), 2.0)
+}
+
+func TestGroupBySets(t *testing.T) {
+	config := &Config{
+		GroupByLabels: []string{"service"},
+		OutputResourceAttributes: map[string]string{
+			"aggregation.level": "cluster",
+		},
+		AggregationRules: []AggregationRule{
+			{
+				MetricPattern:    "requests",
+				OutputMetricName: "cluster_requests",
+				AggregationType:  "sum",
+				GroupBySets:      [][]string{{"service"}, {"region"}},
+			},
+		},
+	}
+	processor := newMetricsAggregatorProcessor(config, zap.NewNop())
+
+	md := pmetric.NewMetrics()
+	for _, source := range []struct {
+		service string
+		region  string
+		value   float64
+	}{
+		{"checkout", "us", 1},
+		{"payment", "us", 2},
+		{"checkout", "eu", 4},
+	} {
+		metric := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+		metric.SetName("requests")
+		dp := metric.SetEmptyGauge().DataPoints().AppendEmpty()
+		dp.Attributes().PutStr("service", source.service)
+		dp.Attributes().PutStr("region", source.region)
+		dp.SetDoubleValue(source.value)
+		dp.SetTimestamp(pcommon.NewTimestampFromTime(time.Now()))
+	}
+
+	result, err := processor.processMetrics(context.Background(), md)
+	require.NoError(t, err)
+
+	valuesByLabel := func(name string, label string) map[string]float64 {
+		values := make(map[string]float64)
+		for _, output := range findOutputMetrics(result, name) {
+			dp := output.metric.Gauge().DataPoints().At(0)
+			value, found := dp.Attributes().Get(label)
+			require.True(t, found, "%s should carry the %s label", name, label)
+			values[value.Str()] = dp.DoubleValue()
+		}
+		return values
+	}
+
+	assert.Equal(t, map[string]float64{"checkout": 5, "payment": 2}, valuesByLabel("cluster_requests_by_service", "service"))
+	assert.Equal(t, map[string]float64{"us": 3, "eu": 4}, valuesByLabel("cluster_requests_by_region", "region"))
+	assert.Empty(t, findOutputMetrics(result, "cluster_requests"))
+
+	// Each output is only grouped by its own set
+	for _, output := range findOutputMetrics(result, "cluster_requests_by_region") {
+		_, found := output.metric.Gauge().DataPoints().At(0).Attributes().Get("service")
+		assert.False(t, found)
+	}
+}
+
+func TestOutputCollisions(t *testing.T) {
+	newConfig := func(strict bool) *Config {
+		return &Config{
+			GroupByLabels: []string{},
+			OutputResourceAttributes: map[string]string{
+				"aggregation.level": "cluster",
+			},
+			StrictCollisions: strict,
+			AggregationRules: []AggregationRule{
+				{
+					MetricPattern:    "http_requests",
+					OutputMetricName: "cluster_requests",
+					AggregationType:  "sum",
+				},
+				{
+					// Mis-specified: emits the same name without any distinguishing label
+					MetricPattern:    "grpc_requests",
+					OutputMetricName: "cluster_requests",
+					AggregationType:  "sum",
+				},
+				{
+					MetricPattern:    "grpc_requests",
+					OutputMetricName: "cluster_grpc_requests",
+					AggregationType:  "sum",
+				},
+			},
+		}
+	}
+
+	newMetrics := func() pmetric.Metrics {
+		md := pmetric.NewMetrics()
+		for _, name := range []string{"http_requests", "grpc_requests"} {
+			metric := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+			metric.SetName(name)
+			dp := metric.SetEmptyGauge().DataPoints().AppendEmpty()
+			dp.SetDoubleValue(10)
+			dp.SetTimestamp(pcommon.NewTimestampFromTime(time.Now()))
+		}
+		return md
+	}
+
+	t.Run("warns and counts", func(t *testing.T) {
+		processor := newMetricsAggregatorProcessor(newConfig(false), zap.NewNop())
+
+		collisionsTotal := func(result pmetric.Metrics) int64 {
+			outputs := findOutputMetrics(result, outputCollisionsMetricName)
+			require.Len(t, outputs, 1)
+			require.True(t, outputs[0].metric.Sum().IsMonotonic())
+			return outputs[0].metric.Sum().DataPoints().At(0).IntValue()
+		}
+
+		result, err := processor.processMetrics(context.Background(), newMetrics())
+		require.NoError(t, err)
+		assert.Len(t, findOutputMetrics(result, "cluster_requests"), 2)
+		assert.Equal(t, int64(1), collisionsTotal(result))
+
+		result, err = processor.processMetrics(context.Background(), newMetrics())
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), collisionsTotal(result))
+	})
+
+	t.Run("strict collisions fail the batch", func(t *testing.T) {
+		processor := newMetricsAggregatorProcessor(newConfig(true), zap.NewNop())
+
+		_, err := processor.processMetrics(context.Background(), newMetrics())
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "cluster_requests")
+		assert.NotContains(t, err.Error(), "cluster_grpc_requests")
+	})
+}
+
+func TestGroupByNameRegex(t *testing.T) {
+	config := &Config{
+		GroupByLabels: []string{},
+		OutputResourceAttributes: map[string]string{
+			"aggregation.level": "cluster",
+		},
+		AggregationRules: []AggregationRule{
+			{
+				MetricPattern:           "^tenant_.+_requests$",
+				MatchType:               "regex",
+				OutputMetricName:        "cluster_requests",
+				AggregationType:         "sum",
+				GroupByNameRegex:        "^tenant_(?P<tenant>[a-z]+)_requests$",
+				PreserveOriginalMetrics: true,
+			},
+		},
+	}
+	require.NoError(t, validateAggregationRule(config.AggregationRules[0], 0))
+	processor := newMetricsAggregatorProcessor(config, zap.NewNop())
+
+	md := pmetric.NewMetrics()
+	for _, source := range []struct {
+		name  string
+		value float64
+	}{
+		{"tenant_acme_requests", 1},
+		{"tenant_acme_requests", 2},
+		{"tenant_globex_requests", 5},
+	} {
+		metric := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+		metric.SetName(source.name)
+		dp := metric.SetEmptyGauge().DataPoints().AppendEmpty()
+		dp.SetDoubleValue(source.value)
+		dp.SetTimestamp(pcommon.NewTimestampFromTime(time.Now()))
+	}
+
+	result, err := processor.processMetrics(context.Background(), md)
+	require.NoError(t, err)
+
+	values := make(map[string]float64)
+	for _, output := range findOutputMetrics(result, "cluster_requests") {
+		dp := output.metric.Gauge().DataPoints().At(0)
+		tenant, found := dp.Attributes().Get("tenant")
+		require.True(t, found)
+		values[tenant.Str()] = dp.DoubleValue()
+	}
+	assert.Equal(t, map[string]float64{"acme": 3, "globex": 5}, values)
+
+	// The extracted label is not added to the preserved original metrics
+	for _, output := range findOutputMetrics(result, "tenant_acme_requests") {
+		_, found := output.metric.Gauge().DataPoints().At(0).Attributes().Get("tenant")
+		assert.False(t, found)
+	}
+
+	t.Run("requires a named capture", func(t *testing.T) {
+		err := validateAggregationRule(AggregationRule{
+			MetricPattern:    "^tenant_.+_requests$",
+			MatchType:        "regex",
+			OutputMetricName: "cluster_requests",
+			GroupByNameRegex: "^tenant_([a-z]+)_requests$",
+		}, 0)
+		assert.ErrorContains(t, err, "named capture group")
+	})
+}
+
+func TestEmitPerScopeSubtotals(t *testing.T) {
+	config := &Config{
+		GroupByLabels: []string{},
+		OutputResourceAttributes: map[string]string{
+			"aggregation.level": "cluster",
+		},
+		AggregationRules: []AggregationRule{
+			{
+				MetricPattern:         "requests",
+				OutputMetricName:      "cluster_requests",
+				AggregationType:       "sum",
+				EmitPerScopeSubtotals: true,
+			},
+		},
+	}
+	processor := newMetricsAggregatorProcessor(config, zap.NewNop())
+
+	md := pmetric.NewMetrics()
+	for _, source := range []struct {
+		scope string
+		value float64
+	}{
+		{"http", 1},
+		{"http", 2},
+		{"grpc", 4},
+	} {
+		sm := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty()
+		sm.Scope().SetName(source.scope)
+		metric := sm.Metrics().AppendEmpty()
+		metric.SetName("requests")
+		dp := metric.SetEmptyGauge().DataPoints().AppendEmpty()
+		dp.SetDoubleValue(source.value)
+		dp.SetTimestamp(pcommon.NewTimestampFromTime(time.Now()))
+	}
+
+	result, err := processor.processMetrics(context.Background(), md)
+	require.NoError(t, err)
+
+	var total float64
+	subtotals := make(map[string]float64)
+	for _, output := range findOutputMetrics(result, "cluster_requests") {
+		dp := output.metric.Gauge().DataPoints().At(0)
+		if scope, found := dp.Attributes().Get(scopeNameAttribute); found {
+			subtotals[scope.Str()] = dp.DoubleValue()
+		} else {
+			total = dp.DoubleValue()
+		}
+	}
+
+	assert.Equal(t, 7.0, total)
+	assert.Equal(t, map[string]float64{"http": 3, "grpc": 4}, subtotals)
+}
+
+func TestEmitOriginalMetricsDisabled(t *testing.T) {
+	cfg := &Config{
+		GroupByLabels: []string{},
+		OutputResourceAttributes: map[string]string{
+			"aggregation.level": "cluster",
+		},
+		EmitOriginalMetrics: false,
+		AggregationRules: []AggregationRule{
+			{
+				MetricPattern:           "throughput",
+				MatchType:               "strict",
+				OutputMetricName:        "cluster_throughput",
+				AggregationType:         "sum",
+				PreserveOriginalMetrics: true,
+			},
+		},
+	}
+
+	processor := newMetricsAggregatorProcessor(cfg, zap.NewNop())
+
+	md := pmetric.NewMetrics()
+	for _, name := range []string{"throughput", "unrelated_metric"} {
+		rm := md.ResourceMetrics().AppendEmpty()
+		rm.Resource().Attributes().PutStr("service.name", "svc")
+		metric := rm.ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+		metric.SetName(name)
+		metric.SetEmptyGauge().DataPoints().AppendEmpty().SetDoubleValue(10.0)
+	}
+
+	result, err := processor.processMetrics(context.Background(), md)
+	require.NoError(t, err)
+
+	// Only the aggregated resource remains, the preserved and unmatched originals are dropped
+	require.Equal(t, 1, result.ResourceMetrics().Len())
+	aggregationLevel, ok := result.ResourceMetrics().At(0).Resource().Attributes().Get("aggregation.level")
+	require.True(t, ok)
+	assert.Equal(t, "cluster", aggregationLevel.Str())
+	assert.Empty(t, findOutputMetrics(result, "throughput"))
+	assert.Empty(t, findOutputMetrics(result, "unrelated_metric"))
+	require.Len(t, findOutputMetrics(result, "cluster_throughput"), 1)
+}
+
+func TestNormalizeGroupValues(t *testing.T) {
+	cfg := &Config{
+		GroupByLabels: []string{"service"},
+		OutputResourceAttributes: map[string]string{
+			"aggregation.level": "cluster",
+		},
+		NormalizeGroupValues: true,
+		AggregationRules: []AggregationRule{
+			{
+				MetricPattern:    "throughput",
+				MatchType:        "strict",
+				OutputMetricName: "service_throughput",
+				AggregationType:  "sum",
+			},
+		},
+	}
+	require.NoError(t, cfg.Validate())
+
+	processor := newMetricsAggregatorProcessor(cfg, zap.NewNop())
+
+	md := pmetric.NewMetrics()
+	for _, service := range []string{"Service-A", " service-a ", "SERVICE-A"} {
+		rm := md.ResourceMetrics().AppendEmpty()
+		rm.Resource().Attributes().PutStr("service", service)
+		metric := rm.ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+		metric.SetName("throughput")
+		metric.SetEmptyGauge().DataPoints().AppendEmpty().SetDoubleValue(10.0)
+	}
+
+	result, err := processor.processMetrics(context.Background(), md)
+	require.NoError(t, err)
+
+	// The case and whitespace variants collapse into one group
+	outputs := findOutputMetrics(result, "service_throughput")
+	require.Len(t, outputs, 1)
+	assert.Equal(t, 30.0, outputs[0].metric.Gauge().DataPoints().At(0).DoubleValue())
+
+	// The output label carries the normalized value
+	service, ok := outputs[0].resource.Attributes().Get("service")
+	require.True(t, ok)
+	assert.Equal(t, "service-a", service.Str())
+
+	cfg.GroupValueTransforms = []string{"uppercase"}
+	require.Error(t, cfg.Validate())
+}
+
+func TestEmitLineage(t *testing.T) {
+	cfg := &Config{
+		GroupByLabels: []string{},
+		OutputResourceAttributes: map[string]string{
+			"aggregation.level": "cluster",
+		},
+		AggregationRules: []AggregationRule{
+			{
+				MetricPattern:    "throughput",
+				MatchType:        "strict",
+				OutputMetricName: "cluster_throughput",
+				AggregationType:  "sum",
+				EmitLineage:      true,
+			},
+			{
+				MetricPattern:    "^(latency|errors)$",
+				MatchType:        "regex",
+				OutputMetricName: "cluster_max",
+				AggregationType:  "max",
+				EmitLineage:      true,
+			},
+			{
+				MetricPattern:    "throughput",
+				MatchType:        "strict",
+				OutputMetricName: "cluster_throughput_mean",
+				AggregationType:  "mean",
+			},
+		},
+	}
+
+	processor := newMetricsAggregatorProcessor(cfg, zap.NewNop())
+
+	md := pmetric.NewMetrics()
+	for _, name := range []string{"throughput", "throughput", "throughput", "throughput", "latency", "errors"} {
+		metric := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+		metric.SetName(name)
+		metric.SetEmptyGauge().DataPoints().AppendEmpty().SetDoubleValue(1.0)
+	}
+
+	result, err := processor.processMetrics(context.Background(), md)
+	require.NoError(t, err)
+
+	throughput := findOutputMetrics(result, "cluster_throughput")
+	require.Len(t, throughput, 1)
+	lineage, ok := throughput[0].metric.Gauge().DataPoints().At(0).Attributes().Get(lineageAttribute)
+	require.True(t, ok)
+	assert.Equal(t, "sum(throughput) over 4 series", lineage.Str())
+
+	maxOutputs := findOutputMetrics(result, "cluster_max")
+	require.Len(t, maxOutputs, 1)
+	lineage, ok = maxOutputs[0].metric.Gauge().DataPoints().At(0).Attributes().Get(lineageAttribute)
+	require.True(t, ok)
+	assert.Equal(t, "max(errors,latency) over 2 series", lineage.Str())
+
+	// Lineage is off by default
+	mean := findOutputMetrics(result, "cluster_throughput_mean")
+	require.Len(t, mean, 1)
+	_, ok = mean[0].metric.Gauge().DataPoints().At(0).Attributes().Get(lineageAttribute)
+	assert.False(t, ok)
+}
+
+func TestAggregationTimeWindow(t *testing.T) {
+	now := time.Now()
+	cfg := &Config{
+		EmitOriginalMetrics: true,
+		GroupByLabels:       []string{},
+		OutputResourceAttributes: map[string]string{
+			"aggregation.level": "cluster",
+		},
+		AggregationRules: []AggregationRule{
+			{
+				MetricPattern:    "throughput",
+				MatchType:        "strict",
+				OutputMetricName: "recent_throughput",
+				AggregationType:  "sum",
+				MaxAge:           10 * time.Minute,
+			},
+			{
+				MetricPattern:           "throughput",
+				MatchType:               "strict",
+				OutputMetricName:        "backfill_throughput",
+				AggregationType:         "sum",
+				PreserveOriginalMetrics: true,
+				TimeWindowStart:         now.Add(-2 * time.Hour),
+				TimeWindowEnd:           now.Add(-30 * time.Minute),
+			},
+		},
+	}
+	for i, rule := range cfg.AggregationRules {
+		require.NoError(t, validateAggregationRule(rule, i))
+	}
+
+	processor := newMetricsAggregatorProcessor(cfg, zap.NewNop())
+
+	md := pmetric.NewMetrics()
+	for _, point := range []struct {
+		value float64
+		age   time.Duration
+	}{
+		{value: 10.0, age: time.Minute},
+		{value: 20.0, age: 2 * time.Minute},
+		{value: 100.0, age: time.Hour},
+	} {
+		metric := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+		metric.SetName("throughput")
+		dp := metric.SetEmptyGauge().DataPoints().AppendEmpty()
+		dp.SetDoubleValue(point.value)
+		dp.SetTimestamp(pcommon.NewTimestampFromTime(now.Add(-point.age)))
+	}
+
+	result, err := processor.processMetrics(context.Background(), md)
+	require.NoError(t, err)
+
+	// The old point is excluded from the recent aggregate
+	recent := findOutputMetrics(result, "recent_throughput")
+	require.Len(t, recent, 1)
+	assert.Equal(t, 30.0, recent[0].metric.Gauge().DataPoints().At(0).DoubleValue())
+
+	backfill := findOutputMetrics(result, "backfill_throughput")
+	require.Len(t, backfill, 1)
+	assert.Equal(t, 100.0, backfill[0].metric.Gauge().DataPoints().At(0).DoubleValue())
+
+	// Out-of-window points are left untouched when the originals are removed
+	originals := findOutputMetrics(result, "throughput")
+	require.Len(t, originals, 1)
+	assert.Equal(t, 100.0, originals[0].metric.Gauge().DataPoints().At(0).DoubleValue())
+
+	invalid := cfg.AggregationRules[1]
+	invalid.TimeWindowStart, invalid.TimeWindowEnd = invalid.TimeWindowEnd, invalid.TimeWindowStart
+	assert.Error(t, validateAggregationRule(invalid, 1))
+}
+
+func TestModeAggregation(t *testing.T) {
+	cfg := &Config{
+		GroupByLabels: []string{"cluster"},
+		OutputResourceAttributes: map[string]string{
+			"aggregation.level": "cluster",
+		},
+		AggregationRules: []AggregationRule{
+			{
+				MetricPattern:    "up",
+				MatchType:        "strict",
+				OutputMetricName: "cluster_up",
+				AggregationType:  "mode",
+			},
+		},
+	}
+	require.NoError(t, cfg.Validate())
+
+	processor := newMetricsAggregatorProcessor(cfg, zap.NewNop())
+
+	md := pmetric.NewMetrics()
+	for cluster, values := range map[string][]float64{
+		"majority": {1, 1, 0},
+		"tie":      {0, 0, 1, 1},
+	} {
+		for _, value := range values {
+			rm := md.ResourceMetrics().AppendEmpty()
+			rm.Resource().Attributes().PutStr("cluster", cluster)
+			metric := rm.ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+			metric.SetName("up")
+			metric.SetEmptyGauge().DataPoints().AppendEmpty().SetDoubleValue(value)
+		}
+	}
+
+	result, err := processor.processMetrics(context.Background(), md)
+	require.NoError(t, err)
+
+	outputs := findOutputMetrics(result, "cluster_up")
+	require.Len(t, outputs, 2)
+	values := make(map[string]float64)
+	for _, output := range outputs {
+		cluster, ok := output.resource.Attributes().Get("cluster")
+		require.True(t, ok)
+		values[cluster.Str()] = output.metric.Gauge().DataPoints().At(0).DoubleValue()
+	}
+
+	assert.Equal(t, 1.0, values["majority"])
+	// Ties are broken by the smallest value
+	assert.Equal(t, 0.0, values["tie"])
+}
+
+func TestMaxTotalGroups(t *testing.T) {
+	cfg := &Config{
+		GroupByLabels: []string{"service"},
+		OutputResourceAttributes: map[string]string{
+			"aggregation.level": "cluster",
+		},
+		MaxTotalGroups: 2,
+		AggregationRules: []AggregationRule{
+			{
+				MetricPattern:    "throughput",
+				MatchType:        "strict",
+				OutputMetricName: "service_throughput",
+				AggregationType:  "sum",
+			},
+		},
+	}
+	require.NoError(t, cfg.Validate())
+
+	processor := newMetricsAggregatorProcessor(cfg, zap.NewNop())
+
+	newMetrics := func() pmetric.Metrics {
+		md := pmetric.NewMetrics()
+		for i, service := range []string{"a", "b", "c", "d", "a", "e"} {
+			rm := md.ResourceMetrics().AppendEmpty()
+			rm.Resource().Attributes().PutStr("service", service)
+			metric := rm.ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+			metric.SetName("throughput")
+			metric.SetEmptyGauge().DataPoints().AppendEmpty().SetDoubleValue(float64(i + 1))
+		}
+		return md
+	}
+
+	result, err := processor.processMetrics(context.Background(), newMetrics())
+	require.NoError(t, err)
+
+	values := make(map[string]float64)
+	for _, output := range findOutputMetrics(result, "service_throughput") {
+		service, ok := output.resource.Attributes().Get("service")
+		require.True(t, ok)
+		values[service.Str()] = output.metric.Gauge().DataPoints().At(0).DoubleValue()
+	}
+
+	// The first two groups are kept, existing groups still receive data points after the cap is reached.
+	// The overflow group is labeled so that it is not mistaken for a total.
+	assert.Equal(t, map[string]float64{
+		"a":              1.0 + 5.0,
+		"b":              2.0,
+		overflowGroupKey: 3.0 + 4.0 + 6.0,
+	}, values)
+
+	outputs := findOutputMetrics(result, groupOverflowMetricName)
+	require.Len(t, outputs, 1)
+	require.Equal(t, pmetric.MetricTypeSum, outputs[0].metric.Type())
+	assert.True(t, outputs[0].metric.Sum().IsMonotonic())
+	assert.Equal(t, int64(3), outputs[0].metric.Sum().DataPoints().At(0).IntValue())
+
+	// The counter keeps counting across batches
+	result, err = processor.processMetrics(context.Background(), newMetrics())
+	require.NoError(t, err)
+	outputs = findOutputMetrics(result, groupOverflowMetricName)
+	require.Len(t, outputs, 1)
+	assert.Equal(t, int64(6), outputs[0].metric.Sum().DataPoints().At(0).IntValue())
+}
+
+func TestOutputMonotonic(t *testing.T) {
+	monotonic := true
+	cfg := &Config{
+		GroupByLabels: []string{},
+		OutputResourceAttributes: map[string]string{
+			"aggregation.level": "cluster",
+		},
+		AggregationRules: []AggregationRule{
+			{
+				MetricPattern:    "queue_depth",
+				MatchType:        "strict",
+				OutputMetricName: "cluster_queue_depth",
+				AggregationType:  "sum",
+				OutputMetricType: "sum",
+			},
+			{
+				MetricPattern:    "requests_total",
+				MatchType:        "strict",
+				OutputMetricName: "cluster_requests_total",
+				AggregationType:  "sum",
+				OutputMetricType: "sum",
+			},
+			{
+				MetricPattern:    "queue_depth",
+				MatchType:        "strict",
+				OutputMetricName: "cluster_queue_depth_forced",
+				AggregationType:  "sum",
+				OutputMetricType: "sum",
+				OutputMonotonic:  &monotonic,
+			},
+		},
+	}
+	for i, rule := range cfg.AggregationRules {
+		require.NoError(t, validateAggregationRule(rule, i))
+	}
+
+	processor := newMetricsAggregatorProcessor(cfg, zap.NewNop())
+
+	md := pmetric.NewMetrics()
+	metrics := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics()
+	gauge := metrics.AppendEmpty()
+	gauge.SetName("queue_depth")
+	gauge.SetEmptyGauge().DataPoints().AppendEmpty().SetDoubleValue(5)
+	counter := metrics.AppendEmpty()
+	counter.SetName("requests_total")
+	counter.SetEmptySum().SetIsMonotonic(true)
+	counter.Sum().SetAggregationTemporality(pmetric.AggregationTemporalityCumulative)
+	counter.Sum().DataPoints().AppendEmpty().SetDoubleValue(100)
+
+	result, err := processor.processMetrics(context.Background(), md)
+	require.NoError(t, err)
+
+	// A gauge aggregated into a sum is not monotonic by default
+	outputs := findOutputMetrics(result, "cluster_queue_depth")
+	require.Len(t, outputs, 1)
+	assert.False(t, outputs[0].metric.Sum().IsMonotonic())
+
+	outputs = findOutputMetrics(result, "cluster_requests_total")
+	require.Len(t, outputs, 1)
+	assert.True(t, outputs[0].metric.Sum().IsMonotonic())
+
+	outputs = findOutputMetrics(result, "cluster_queue_depth_forced")
+	require.Len(t, outputs, 1)
+	assert.True(t, outputs[0].metric.Sum().IsMonotonic())
+
+	// output_monotonic only applies to sum outputs
+	invalid := cfg.AggregationRules[2]
+	invalid.OutputMetricType = "gauge"
+	assert.Error(t, validateAggregationRule(invalid, 2))
+}
+
+func TestUnitMismatchPolicy(t *testing.T) {
+	newMetrics := func() pmetric.Metrics {
+		md := pmetric.NewMetrics()
+		for _, source := range []struct {
+			name  string
+			unit  string
+			value float64
+		}{
+			{"checkout_latency_ms", "ms", 200},
+			{"payment_latency_ms", "ms", 300},
+			{"search_latency_seconds", "s", 0.5},
+		} {
+			metric := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+			metric.SetName(source.name)
+			metric.SetUnit(source.unit)
+			metric.SetEmptyGauge().DataPoints().AppendEmpty().SetDoubleValue(source.value)
+		}
+		return md
+	}
+	newProcessor := func(policy string) *metricsAggregatorProcessor {
+		cfg := &Config{
+			EmitOriginalMetrics: true,
+			GroupByLabels:       []string{},
+			OutputResourceAttributes: map[string]string{
+				"aggregation.level": "cluster",
+			},
+			AggregationRules: []AggregationRule{
+				{
+					MetricPattern:      "_latency_",
+					MatchType:          "regex",
+					OutputMetricName:   "total_latency",
+					AggregationType:    "sum",
+					UnitMismatchPolicy: policy,
+				},
+			},
+		}
+		require.NoError(t, validateAggregationRule(cfg.AggregationRules[0], 0))
+		return newMetricsAggregatorProcessor(cfg, zap.NewNop())
+	}
+
+	t.Run("Ignore", func(t *testing.T) {
+		result, err := newProcessor("").processMetrics(context.Background(), newMetrics())
+		require.NoError(t, err)
+		outputs := findOutputMetrics(result, "total_latency")
+		require.Len(t, outputs, 1)
+		assert.Equal(t, 500.5, outputs[0].metric.Gauge().DataPoints().At(0).DoubleValue())
+	})
+
+	t.Run("Skip", func(t *testing.T) {
+		result, err := newProcessor("skip").processMetrics(context.Background(), newMetrics())
+		require.NoError(t, err)
+		outputs := findOutputMetrics(result, "total_latency")
+		require.Len(t, outputs, 1)
+		assert.Equal(t, 500.0, outputs[0].metric.Gauge().DataPoints().At(0).DoubleValue())
+		assert.Equal(t, "ms", outputs[0].metric.Unit())
+
+		// The skipped metric was not aggregated, so it is kept
+		assert.Len(t, findOutputMetrics(result, "search_latency_seconds"), 1)
+		assert.Empty(t, findOutputMetrics(result, "checkout_latency_ms"))
+	})
+
+	t.Run("Split", func(t *testing.T) {
+		result, err := newProcessor("split").processMetrics(context.Background(), newMetrics())
+		require.NoError(t, err)
+		outputs := findOutputMetrics(result, "total_latency")
+		require.Len(t, outputs, 1)
+		assert.Equal(t, 500.0, outputs[0].metric.Gauge().DataPoints().At(0).DoubleValue())
+		assert.Equal(t, "ms", outputs[0].metric.Unit())
+
+		outputs = findOutputMetrics(result, "total_latency_s")
+		require.Len(t, outputs, 1)
+		assert.Equal(t, 0.5, outputs[0].metric.Gauge().DataPoints().At(0).DoubleValue())
+		assert.Equal(t, "s", outputs[0].metric.Unit())
+	})
+
+	assert.Error(t, validateAggregationRule(AggregationRule{
+		MetricPattern:      "latency",
+		OutputMetricName:   "total_latency",
+		UnitMismatchPolicy: "convert",
+	}, 0))
+}
+
+func TestRuleResourceAttributes(t *testing.T) {
+	cfg := &Config{
+		GroupByLabels: []string{},
+		OutputResourceAttributes: map[string]string{
+			"aggregation.level": "cluster",
+		},
+		AggregationRules: []AggregationRule{
+			{
+				MetricPattern:    "throughput",
+				MatchType:        "strict",
+				OutputMetricName: "cluster_throughput",
+				AggregationType:  "sum",
+				RuleResourceAttributes: map[string]string{
+					"rollup":            "throughput_v2",
+					"aggregation.level": "ignored",
+				},
+				PreserveOriginalMetrics: true,
+			},
+			{
+				MetricPattern:    "throughput",
+				MatchType:        "strict",
+				OutputMetricName: "cluster_throughput_max",
+				AggregationType:  "max",
+			},
+		},
+	}
+
+	processor := newMetricsAggregatorProcessor(cfg, zap.NewNop())
+
+	md := pmetric.NewMetrics()
+	for _, value := range []float64{10.0, 30.0} {
+		metric := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+		metric.SetName("throughput")
+		metric.SetEmptyGauge().DataPoints().AppendEmpty().SetDoubleValue(value)
+	}
+
+	result, err := processor.processMetrics(context.Background(), md)
+	require.NoError(t, err)
+
+	outputs := findOutputMetrics(result, "cluster_throughput")
+	require.Len(t, outputs, 1)
+	attrs := outputs[0].resource.Attributes().AsRaw()
+	assert.Equal(t, "throughput_v2", attrs["rollup"])
+	// The global markers win, so the output is still recognized as aggregated
+	assert.Equal(t, "cluster", attrs["aggregation.level"])
+
+	outputs = findOutputMetrics(result, "cluster_throughput_max")
+	require.Len(t, outputs, 1)
+	assert.NotContains(t, outputs[0].resource.Attributes().AsRaw(), "rollup")
+	assert.Equal(t, "cluster", outputs[0].resource.Attributes().AsRaw()["aggregation.level"])
+}
+
+func TestIntegerSumPrecision(t *testing.T) {
+	cfg := &Config{
+		GroupByLabels: []string{},
+		OutputResourceAttributes: map[string]string{
+			"aggregation.level": "cluster",
+		},
+		AggregationRules: []AggregationRule{
+			{
+				MetricPattern:    "bytes_transferred",
+				MatchType:        "strict",
+				OutputMetricName: "cluster_bytes_transferred",
+				AggregationType:  "sum",
+			},
+		},
+	}
+
+	processor := newMetricsAggregatorProcessor(cfg, zap.NewNop())
+
+	newMetrics := func(values ...int64) pmetric.Metrics {
+		md := pmetric.NewMetrics()
+		for _, value := range values {
+			metric := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+			metric.SetName("bytes_transferred")
+			metric.SetEmptyGauge().DataPoints().AppendEmpty().SetIntValue(value)
+		}
+		return md
+	}
+
+	// Summed or emitted as float64, the odd sum would be rounded to an even value
+	result, err := processor.processMetrics(context.Background(), newMetrics(1<<53, 1, 1, 1))
+	require.NoError(t, err)
+	outputs := findOutputMetrics(result, "cluster_bytes_transferred")
+	require.Len(t, outputs, 1)
+	dp := outputs[0].metric.Gauge().DataPoints().At(0)
+	require.Equal(t, pmetric.NumberDataPointValueTypeInt, dp.ValueType())
+	assert.Equal(t, int64(1<<53+3), dp.IntValue())
+
+	// An int64 overflow falls back to float64
+	result, err = processor.processMetrics(context.Background(), newMetrics(math.MaxInt64, math.MaxInt64))
+	require.NoError(t, err)
+	outputs = findOutputMetrics(result, "cluster_bytes_transferred")
+	require.Len(t, outputs, 1)
+	assert.Equal(t, 2*float64(math.MaxInt64), outputs[0].metric.Gauge().DataPoints().At(0).DoubleValue())
+}
+
+func TestOutputModeReplace(t *testing.T) {
+	cfg := &Config{
+		GroupByLabels: []string{"cluster"},
+		OutputResourceAttributes: map[string]string{
+			"aggregation.level": "cluster",
+		},
+		OutputMode: "replace",
+		AggregationRules: []AggregationRule{
+			{
+				MetricPattern:    "throughput",
+				MatchType:        "strict",
+				OutputMetricName: "cluster_throughput",
+				AggregationType:  "sum",
+			},
+		},
+	}
+	require.NoError(t, cfg.Validate())
+
+	processor := newMetricsAggregatorProcessor(cfg, zap.NewNop())
+
+	md := pmetric.NewMetrics()
+	for _, value := range []float64{10.0, 30.0} {
+		rm := md.ResourceMetrics().AppendEmpty()
+		rm.Resource().Attributes().PutStr("cluster", "prod")
+		rm.Resource().Attributes().PutStr("pod", fmt.Sprintf("pod-%v", value))
+		metrics := rm.ScopeMetrics().AppendEmpty().Metrics()
+		throughput := metrics.AppendEmpty()
+		throughput.SetName("throughput")
+		throughput.SetEmptyGauge().DataPoints().AppendEmpty().SetDoubleValue(value)
+		other := metrics.AppendEmpty()
+		other.SetName("memory_usage")
+		other.SetEmptyGauge().DataPoints().AppendEmpty().SetDoubleValue(1)
+	}
+	input := pmetric.NewMetrics()
+	md.CopyTo(input)
+
+	result, err := processor.processMetrics(context.Background(), md)
+	require.NoError(t, err)
+
+	// The input is left as it was, including the metrics the rule matched
+	assert.Equal(t, input, md)
+	assert.Len(t, findOutputMetrics(md, "throughput"), 2)
+	assert.Empty(t, findOutputMetrics(md, "cluster_throughput"))
+
+	// The result only contains the aggregated resources
+	require.Equal(t, 1, result.ResourceMetrics().Len())
+	outputs := findOutputMetrics(result, "cluster_throughput")
+	require.Len(t, outputs, 1)
+	assert.Equal(t, 40.0, outputs[0].metric.Gauge().DataPoints().At(0).DoubleValue())
+	assert.Empty(t, findOutputMetrics(result, "memory_usage"))
+
+	cfg.OutputMode = "fork"
+	assert.Error(t, cfg.Validate())
+}
+
+func TestMatchUnitAndDescription(t *testing.T) {
+	newMetrics := func() pmetric.Metrics {
+		md := pmetric.NewMetrics()
+		for _, source := range []struct {
+			unit        string
+			description string
+			value       float64
+		}{
+			{"By", "Memory used by the process", 100},
+			{"By", "Memory used by the process", 200},
+			{"ms", "Time spent collecting memory", 7},
+		} {
+			metric := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+			metric.SetName("memory")
+			metric.SetUnit(source.unit)
+			metric.SetDescription(source.description)
+			metric.SetEmptyGauge().DataPoints().AppendEmpty().SetDoubleValue(source.value)
+		}
+		return md
+	}
+	process := func(rule AggregationRule) pmetric.Metrics {
+		cfg := &Config{
+			EmitOriginalMetrics: true,
+			GroupByLabels:       []string{},
+			OutputResourceAttributes: map[string]string{
+				"aggregation.level": "cluster",
+			},
+			AggregationRules: []AggregationRule{rule},
+		}
+		require.NoError(t, validateAggregationRule(rule, 0))
+		result, err := newMetricsAggregatorProcessor(cfg, zap.NewNop()).processMetrics(context.Background(), newMetrics())
+		require.NoError(t, err)
+		return result
+	}
+
+	t.Run("Unit", func(t *testing.T) {
+		result := process(AggregationRule{
+			MetricPattern:    "memory",
+			MatchType:        "strict",
+			MatchUnit:        "By",
+			OutputMetricName: "cluster_memory_bytes",
+			AggregationType:  "sum",
+		})
+		outputs := findOutputMetrics(result, "cluster_memory_bytes")
+		require.Len(t, outputs, 1)
+		assert.Equal(t, 300.0, outputs[0].metric.Gauge().DataPoints().At(0).DoubleValue())
+
+		// The ms variant was not aggregated, so it is kept
+		remaining := findOutputMetrics(result, "memory")
+		require.Len(t, remaining, 1)
+		assert.Equal(t, "ms", remaining[0].metric.Unit())
+	})
+
+	t.Run("Description", func(t *testing.T) {
+		result := process(AggregationRule{
+			MetricPattern:         "memory",
+			MatchType:             "strict",
+			MatchDescriptionRegex: "^Time spent",
+			OutputMetricName:      "cluster_gc_time",
+			AggregationType:       "sum",
+		})
+		outputs := findOutputMetrics(result, "cluster_gc_time")
+		require.Len(t, outputs, 1)
+		assert.Equal(t, 7.0, outputs[0].metric.Gauge().DataPoints().At(0).DoubleValue())
+		assert.Len(t, findOutputMetrics(result, "memory"), 2)
+	})
+
+	assert.Error(t, validateAggregationRule(AggregationRule{
+		MetricPattern:         "memory",
+		OutputMetricName:      "cluster_memory",
+		MatchDescriptionRegex: "(unclosed",
+	}, 0))
+}
+
+func TestEmitMatchInfo(t *testing.T) {
+	cfg := &Config{
+		GroupByLabels: []string{},
+		OutputResourceAttributes: map[string]string{
+			"aggregation.level": "cluster",
+		},
+		AggregationRules: []AggregationRule{
+			{
+				MetricPattern:           "throughput",
+				OutputMetricName:        "cluster_throughput",
+				AggregationType:         "sum",
+				EmitMatchInfo:           true,
+				PreserveOriginalMetrics: true,
+			},
+			{
+				MetricPattern:           "^through.*$",
+				MatchType:               "regex",
+				OutputMetricName:        "cluster_throughput_max",
+				AggregationType:         "max",
+				EmitMatchInfo:           true,
+				PreserveOriginalMetrics: true,
+			},
+			{
+				MetricPattern:    "throughput",
+				MatchType:        "strict",
+				OutputMetricName: "cluster_throughput_mean",
+				AggregationType:  "mean",
+			},
+		},
+	}
+
+	processor := newMetricsAggregatorProcessor(cfg, zap.NewNop())
+
+	md := pmetric.NewMetrics()
+	for _, value := range []float64{10.0, 30.0} {
+		metric := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+		metric.SetName("throughput")
+		metric.SetEmptyGauge().DataPoints().AppendEmpty().SetDoubleValue(value)
+	}
+
+	result, err := processor.processMetrics(context.Background(), md)
+	require.NoError(t, err)
+
+	outputs := findOutputMetrics(result, "cluster_throughput")
+	require.Len(t, outputs, 1)
+	attrs := outputs[0].metric.Gauge().DataPoints().At(0).Attributes().AsRaw()
+	assert.Equal(t, "throughput", attrs[sourcePatternAttribute])
+	assert.Equal(t, "strict", attrs[matchTypeAttribute])
+
+	outputs = findOutputMetrics(result, "cluster_throughput_max")
+	require.Len(t, outputs, 1)
+	attrs = outputs[0].metric.Gauge().DataPoints().At(0).Attributes().AsRaw()
+	assert.Equal(t, "^through.*$", attrs[sourcePatternAttribute])
+	assert.Equal(t, "regex", attrs[matchTypeAttribute])
+
+	// Match info is off by default
+	outputs = findOutputMetrics(result, "cluster_throughput_mean")
+	require.Len(t, outputs, 1)
+	attrs = outputs[0].metric.Gauge().DataPoints().At(0).Attributes().AsRaw()
+	assert.NotContains(t, attrs, sourcePatternAttribute)
+	assert.NotContains(t, attrs, matchTypeAttribute)
+}
+
+func TestHistogramValueSource(t *testing.T) {
+	newMetrics := func() pmetric.Metrics {
+		md := pmetric.NewMetrics()
+		for _, count := range []uint64{5, 7} {
+			metric := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+			metric.SetName("requests")
+			histogram := metric.SetEmptyHistogram()
+			histogram.SetAggregationTemporality(pmetric.AggregationTemporalityCumulative)
+			// The exporter only encodes the count, there is no sum
+			histogram.DataPoints().AppendEmpty().SetCount(count)
+		}
+		return md
+	}
+	process := func(histogramValueSource string) float64 {
+		cfg := &Config{
+			GroupByLabels: []string{},
+			OutputResourceAttributes: map[string]string{
+				"aggregation.level": "cluster",
+			},
+			AggregationRules: []AggregationRule{
+				{
+					MetricPattern:        "requests",
+					MatchType:            "strict",
+					OutputMetricName:     "cluster_requests",
+					AggregationType:      "sum",
+					HistogramValueSource: histogramValueSource,
+				},
+			},
+		}
+		require.NoError(t, validateAggregationRule(cfg.AggregationRules[0], 0))
+
+		result, err := newMetricsAggregatorProcessor(cfg, zap.NewNop()).processMetrics(context.Background(), newMetrics())
+		require.NoError(t, err)
+		outputs := findOutputMetrics(result, "cluster_requests")
+		require.Len(t, outputs, 1)
+		return outputs[0].metric.Gauge().DataPoints().At(0).DoubleValue()
+	}
+
+	assert.Equal(t, 0.0, process(""))
+	assert.Equal(t, 12.0, process("count"))
+
+	assert.Error(t, validateAggregationRule(AggregationRule{
+		MetricPattern:        "requests",
+		OutputMetricName:     "cluster_requests",
+		HistogramValueSource: "buckets",
+	}, 0))
+}
+
+func TestRouteByResourceAttribute(t *testing.T) {
+	cfg := &Config{
+		GroupByLabels: []string{"team"},
+		OutputResourceAttributes: map[string]string{
+			"aggregation.level": "cluster",
+		},
+		RouteByResourceAttribute: "team",
+		AggregationRules: []AggregationRule{
+			{
+				MetricPattern:    "throughput",
+				MatchType:        "strict",
+				OutputMetricName: "team_throughput",
+				AggregationType:  "sum",
+			},
+		},
+	}
+
+	processor := newMetricsAggregatorProcessor(cfg, zap.NewNop())
+
+	md := pmetric.NewMetrics()
+	for _, team := range []string{"payments", "payments", "search", ""} {
+		rm := md.ResourceMetrics().AppendEmpty()
+		if team != "" {
+			rm.Resource().Attributes().PutStr("team", team)
+		}
+		metric := rm.ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+		metric.SetName("throughput")
+		metric.SetEmptyGauge().DataPoints().AppendEmpty().SetDoubleValue(10.0)
+	}
+
+	result, err := processor.processMetrics(context.Background(), md)
+	require.NoError(t, err)
+
+	scopes := map[string]string{}
+	for _, output := range findOutputMetrics(result, "team_throughput") {
+		team := ""
+		if value, ok := output.resource.Attributes().Get("team"); ok {
+			team = value.AsString()
+		}
+		scopes[team] = output.scope.Name()
+	}
+	assert.Equal(t, map[string]string{
+		"payments": "metricsaggregator/payments",
+		"search":   "metricsaggregator/search",
+		// Resources without the attribute keep the default scope
+		"": "metricsaggregator",
+	}, scopes)
+}
+
+func TestMissingLabelPolicy(t *testing.T) {
+	newMetrics := func() pmetric.Metrics {
+		md := pmetric.NewMetrics()
+		for _, source := range []struct {
+			region string
+			value  float64
+		}{
+			{"eu", 10},
+			{"eu", 5},
+			{"", 20},
+			{"", 1},
+		} {
+			metric := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+			metric.SetName("throughput")
+			dp := metric.SetEmptyGauge().DataPoints().AppendEmpty()
+			dp.SetDoubleValue(source.value)
+			if source.region != "" {
+				dp.Attributes().PutStr("region", source.region)
+			}
+		}
+		return md
+	}
+	// process returns the aggregated values keyed by the region label of the output, "<unset>" if it has none
+	process := func(policy string, placeholder string) map[string]float64 {
+		cfg := &Config{
+			GroupByLabels: []string{"region"},
+			OutputResourceAttributes: map[string]string{
+				"aggregation.level": "cluster",
+			},
+			MissingLabelPolicy:      policy,
+			MissingLabelPlaceholder: placeholder,
+			AggregationRules: []AggregationRule{
+				{
+					MetricPattern:    "throughput",
+					MatchType:        "strict",
+					OutputMetricName: "region_throughput",
+					AggregationType:  "sum",
+				},
+			},
+		}
+		require.NoError(t, cfg.Validate())
+
+		result, err := newMetricsAggregatorProcessor(cfg, zap.NewNop()).processMetrics(context.Background(), newMetrics())
+		require.NoError(t, err)
+
+		values := map[string]float64{}
+		for _, output := range findOutputMetrics(result, "region_throughput") {
+			dp := output.metric.Gauge().DataPoints().At(0)
+			region := "<unset>"
+			if value, ok := dp.Attributes().Get("region"); ok {
+				region = value.Str()
+			}
+			values[region] = dp.DoubleValue()
+		}
+		return values
+	}
+
+	// The series without the label end up in a group without it
+	assert.Equal(t, map[string]float64{"eu": 15, "<unset>": 21}, process("", ""))
+
+	// With a placeholder they form a group labeled as missing
+	assert.Equal(t, map[string]float64{"eu": 15, "__missing__": 21}, process("placeholder", ""))
+	assert.Equal(t, map[string]float64{"eu": 15, "(none)": 21}, process("placeholder", "(none)"))
+
+	cfg := &Config{
+		GroupByLabels:            []string{"region"},
+		OutputResourceAttributes: map[string]string{"aggregation.level": "cluster"},
+		MissingLabelPolicy:       "drop",
+		AggregationRules:         []AggregationRule{{MetricPattern: "throughput", OutputMetricName: "region_throughput"}},
+	}
+	assert.Error(t, cfg.Validate())
+}
+
+func TestOutputTemporality(t *testing.T) {
+	cfg := &Config{
+		GroupByLabels: []string{},
+		OutputResourceAttributes: map[string]string{
+			"aggregation.level": "cluster",
+		},
+		AggregationRules: []AggregationRule{
+			{
+				MetricPattern:     "requests",
+				MatchType:         "strict",
+				OutputMetricName:  "cluster_requests_total",
+				AggregationType:   "sum",
+				OutputMetricType:  "sum",
+				OutputTemporality: "cumulative",
+			},
+			{
+				MetricPattern:     "requests",
+				MatchType:         "strict",
+				OutputMetricName:  "cluster_requests_delta",
+				AggregationType:   "sum",
+				OutputMetricType:  "sum",
+				OutputTemporality: "delta",
+			},
+		},
+	}
+	for i, rule := range cfg.AggregationRules {
+		require.NoError(t, validateAggregationRule(rule, i))
+	}
+
+	processor := newMetricsAggregatorProcessor(cfg, zap.NewNop())
+
+	md := pmetric.NewMetrics()
+	for _, value := range []float64{10, 15} {
+		metric := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+		metric.SetName("requests")
+		metric.SetEmptySum().SetAggregationTemporality(pmetric.AggregationTemporalityDelta)
+		metric.Sum().SetIsMonotonic(true)
+		metric.Sum().DataPoints().AppendEmpty().SetDoubleValue(value)
+	}
+
+	result, err := processor.processMetrics(context.Background(), md)
+	require.NoError(t, err)
+
+	// Delta sources aggregated into a cumulative output
+	outputs := findOutputMetrics(result, "cluster_requests_total")
+	require.Len(t, outputs, 1)
+	assert.Equal(t, pmetric.AggregationTemporalityCumulative, outputs[0].metric.Sum().AggregationTemporality())
+	assert.Equal(t, 25.0, outputs[0].metric.Sum().DataPoints().At(0).DoubleValue())
+
+	outputs = findOutputMetrics(result, "cluster_requests_delta")
+	require.Len(t, outputs, 1)
+	assert.Equal(t, pmetric.AggregationTemporalityDelta, outputs[0].metric.Sum().AggregationTemporality())
+
+	// output_temporality must be valid and only applies to sum outputs
+	err = validateAggregationRule(AggregationRule{MetricPattern: "requests", OutputMetricName: "x", AggregationType: "sum", OutputMetricType: "sum", OutputTemporality: "unspecified"}, 0)
+	assert.ErrorContains(t, err, "invalid output_temporality")
+	err = validateAggregationRule(AggregationRule{MetricPattern: "requests", OutputMetricName: "x", AggregationType: "sum", OutputTemporality: "delta"}, 0)
+	assert.ErrorContains(t, err, "requires output_metric_type 'sum'")
+}
+
+func TestEmitHeartbeat(t *testing.T) {
+	cfg := &Config{
+		GroupByLabels: []string{},
+		OutputResourceAttributes: map[string]string{
+			"aggregation.level": "cluster",
+		},
+		EmitHeartbeat: true,
+		AggregationRules: []AggregationRule{
+			{
+				MetricPattern:    "throughput",
+				MatchType:        "strict",
+				OutputMetricName: "cluster_throughput",
+				AggregationType:  "sum",
+			},
+		},
+	}
+
+	processor := newMetricsAggregatorProcessor(cfg, zap.NewNop())
+
+	runHeartbeat := func() float64 {
+		// The heartbeat is emitted even when no rule matches
+		md := pmetric.NewMetrics()
+		metric := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+		metric.SetName("unrelated")
+		metric.SetEmptyGauge().DataPoints().AppendEmpty().SetDoubleValue(1)
+
+		result, err := processor.processMetrics(context.Background(), md)
+		require.NoError(t, err)
+
+		outputs := findOutputMetrics(result, heartbeatMetricName)
+		require.Len(t, outputs, 1)
+		value, ok := outputs[0].resource.Attributes().Get("aggregation.level")
+		require.True(t, ok)
+		assert.Equal(t, "cluster", value.Str())
+		require.Equal(t, pmetric.MetricTypeGauge, outputs[0].metric.Type())
+		return outputs[0].metric.Gauge().DataPoints().At(0).DoubleValue()
+	}
+
+	first := runHeartbeat()
+	assert.InDelta(t, float64(time.Now().Unix()), first, 5)
+
+	time.Sleep(10 * time.Millisecond)
+	second := runHeartbeat()
+	assert.Greater(t, second, first)
+}
+
+func TestEmitOriginalsRemoved(t *testing.T) {
+	cfg := &Config{
+		EmitOriginalMetrics: true,
+		GroupByLabels:       []string{},
+		OutputResourceAttributes: map[string]string{
+			"aggregation.level": "cluster",
+		},
+		EmitOriginalsRemoved: true,
+		AggregationRules: []AggregationRule{
+			{
+				RuleName:         "throughput-total",
+				MetricPattern:    "throughput",
+				MatchType:        "strict",
+				OutputMetricName: "cluster_throughput",
+				AggregationType:  "sum",
+			},
+			{
+				RuleName:         "latency-max",
+				MetricPattern:    "latency_.*",
+				MatchType:        "regex",
+				OutputMetricName: "cluster_latency",
+				AggregationType:  "max",
+				ConsumeMatched:   true,
+			},
+			{
+				RuleName:                "errors-kept",
+				MetricPattern:           "errors",
+				MatchType:               "strict",
+				OutputMetricName:        "cluster_errors",
+				AggregationType:         "sum",
+				PreserveOriginalMetrics: true,
+			},
+		},
+	}
+	for i, rule := range cfg.AggregationRules {
+		require.NoError(t, validateAggregationRule(rule, i))
+	}
+
+	processor := newMetricsAggregatorProcessor(cfg, zap.NewNop())
+
+	md := pmetric.NewMetrics()
+	for _, name := range []string{"throughput", "throughput", "throughput", "latency_p50", "latency_p99", "errors", "unrelated"} {
+		metric := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+		metric.SetName(name)
+		metric.SetEmptyGauge().DataPoints().AppendEmpty().SetDoubleValue(1)
+	}
+
+	result, err := processor.processMetrics(context.Background(), md)
+	require.NoError(t, err)
+
+	outputs := findOutputMetrics(result, originalsRemovedMetricName)
+	require.Len(t, outputs, 1)
+	value, ok := outputs[0].resource.Attributes().Get("aggregation.level")
+	require.True(t, ok)
+	assert.Equal(t, "cluster", value.Str())
+
+	// The rule preserving its originals has no data point
+	removed := make(map[string]int64)
+	dps := outputs[0].metric.Gauge().DataPoints()
+	for i := 0; i < dps.Len(); i++ {
+		rule, ok := dps.At(i).Attributes().Get(ruleAttribute)
+		require.True(t, ok)
+		removed[rule.Str()] = dps.At(i).IntValue()
+	}
+	assert.Equal(t, map[string]int64{"throughput-total": 3, "latency-max": 2}, removed)
+
+	// The counts match the originals that are gone from the batch
+	assert.Empty(t, findOutputMetrics(result, "throughput"))
+	assert.Empty(t, findOutputMetrics(result, "latency_p50"))
+	assert.Empty(t, findOutputMetrics(result, "latency_p99"))
+	assert.Len(t, findOutputMetrics(result, "errors"), 1)
+}
+
+func TestExpectedSources(t *testing.T) {
+	cfg := &Config{
+		GroupByLabels: []string{"cluster"},
+		OutputResourceAttributes: map[string]string{
+			"aggregation.level": "cluster",
+		},
+		AggregationRules: []AggregationRule{
+			{
+				MetricPattern:        "throughput",
+				MatchType:            "strict",
+				OutputMetricName:     "cluster_throughput",
+				AggregationType:      "sum",
+				ExpectedSources:      10,
+				MinFraction:          0.8,
+				EmitIncompleteMarker: true,
+			},
+		},
+	}
+	require.NoError(t, cfg.Validate())
+
+	processor := newMetricsAggregatorProcessor(cfg, zap.NewNop())
+
+	md := pmetric.NewMetrics()
+	addPods := func(cluster string, pods int) {
+		for i := 0; i < pods; i++ {
+			rm := md.ResourceMetrics().AppendEmpty()
+			rm.Resource().Attributes().PutStr("cluster", cluster)
+			metric := rm.ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+			metric.SetName("throughput")
+			metric.SetEmptyGauge().DataPoints().AppendEmpty().SetDoubleValue(10)
+		}
+	}
+	addPods("complete", 8)
+	addPods("degraded", 2)
+
+	result, err := processor.processMetrics(context.Background(), md)
+	require.NoError(t, err)
+
+	// 8 of 10 sources reach min_fraction, 2 of 10 do not
+	outputs := findOutputMetrics(result, "cluster_throughput")
+	require.Len(t, outputs, 1)
+	cluster, _ := outputs[0].resource.Attributes().Get("cluster")
+	assert.Equal(t, "complete", cluster.Str())
+	assert.Equal(t, 80.0, outputs[0].metric.Gauge().DataPoints().At(0).DoubleValue())
+
+	markers := findOutputMetrics(result, incompleteMetricName)
+	require.Len(t, markers, 1)
+	cluster, _ = markers[0].resource.Attributes().Get("cluster")
+	assert.Equal(t, "degraded", cluster.Str())
+	dp := markers[0].metric.Gauge().DataPoints().At(0)
+	assert.Equal(t, 2.0, dp.DoubleValue())
+	output, _ := dp.Attributes().Get(incompleteOutputAttribute)
+	assert.Equal(t, "cluster_throughput", output.Str())
+
+	// min_fraction requires expected_sources
+	err = validateAggregationRule(AggregationRule{MetricPattern: "throughput", OutputMetricName: "x", AggregationType: "sum", MinFraction: 0.5}, 0)
+	assert.ErrorContains(t, err, "require expected_sources")
+}
+
+func TestWithStdDev(t *testing.T) {
+	cfg := &Config{
+		GroupByLabels: []string{},
+		OutputResourceAttributes: map[string]string{
+			"aggregation.level": "cluster",
+		},
+		AggregationRules: []AggregationRule{
+			{
+				MetricPattern:    "latency",
+				MatchType:        "strict",
+				OutputMetricName: "cluster_latency",
+				AggregationType:  "mean",
+				WithStdDev:       true,
+			},
+		},
+	}
+	for i, rule := range cfg.AggregationRules {
+		require.NoError(t, validateAggregationRule(rule, i))
+	}
+
+	processor := newMetricsAggregatorProcessor(cfg, zap.NewNop())
+
+	md := pmetric.NewMetrics()
+	for _, value := range []float64{2, 4, 4, 4, 5, 5, 7, 9} {
+		metric := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+		metric.SetName("latency")
+		metric.SetEmptyGauge().DataPoints().AppendEmpty().SetDoubleValue(value)
+	}
+
+	result, err := processor.processMetrics(context.Background(), md)
+	require.NoError(t, err)
+
+	outputs := findOutputMetrics(result, "cluster_latency")
+	require.Len(t, outputs, 1)
+	assert.Equal(t, 5.0, outputs[0].metric.Gauge().DataPoints().At(0).DoubleValue())
+
+	outputs = findOutputMetrics(result, "cluster_latency_stddev")
+	require.Len(t, outputs, 1)
+	assert.InDelta(t, 2.0, outputs[0].metric.Gauge().DataPoints().At(0).DoubleValue(), 1e-9)
+
+	// with_stddev only makes sense next to a mean
+	err = validateAggregationRule(AggregationRule{MetricPattern: "latency", OutputMetricName: "x", AggregationType: "sum", WithStdDev: true}, 0)
+	assert.ErrorContains(t, err, "with_stddev requires aggregation_type 'mean'")
+}
+
+func TestRuleTemplates(t *testing.T) {
+	cfg := &Config{
+		GroupByLabels: []string{"cluster"},
+		OutputResourceAttributes: map[string]string{
+			"aggregation.level": "cluster",
+		},
+		RuleTemplates: map[string]AggregationRule{
+			"per-service-sum": {
+				MetricPattern:    "unused",
+				MatchType:        "strict",
+				AggregationType:  "sum",
+				OutputMetricType: "sum",
+				GroupBySets:      [][]string{{"service"}},
+			},
+		},
+		AggregationRules: []AggregationRule{
+			{
+				Extends:          "per-service-sum",
+				MetricPattern:    "requests",
+				OutputMetricName: "requests",
+			},
+		},
+	}
+	require.NoError(t, cfg.Validate())
+
+	processor := newMetricsAggregatorProcessor(cfg, zap.NewNop())
+
+	md := pmetric.NewMetrics()
+	for _, service := range []string{"checkout", "checkout", "payment"} {
+		metric := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+		metric.SetName("requests")
+		dp := metric.SetEmptyGauge().DataPoints().AppendEmpty()
+		dp.SetDoubleValue(5)
+		dp.Attributes().PutStr("service", service)
+	}
+
+	result, err := processor.processMetrics(context.Background(), md)
+	require.NoError(t, err)
+
+	// The rule's pattern overrides the template's, the group-by set and output type come from the template
+	outputs := findOutputMetrics(result, "requests_by_service")
+	require.Len(t, outputs, 2)
+	totals := make(map[string]float64)
+	for _, output := range outputs {
+		require.Equal(t, pmetric.MetricTypeSum, output.metric.Type())
+		dp := output.metric.Sum().DataPoints().At(0)
+		service, _ := dp.Attributes().Get("service")
+		totals[service.Str()] = dp.DoubleValue()
+	}
+	assert.Equal(t, map[string]float64{"checkout": 10, "payment": 5}, totals)
+
+	// Unknown templates are rejected
+	cfg.AggregationRules[0].Extends = "missing"
+	assert.ErrorContains(t, cfg.Validate(), "unknown rule template 'missing'")
+}
+
+func TestPreserveSourceType(t *testing.T) {
+	newProcessor := func(preserveSourceType bool) *metricsAggregatorProcessor {
+		return newMetricsAggregatorProcessor(&Config{
+			GroupByLabels: []string{},
+			OutputResourceAttributes: map[string]string{
+				"aggregation.level": "cluster",
+			},
+			PreserveSourceType: preserveSourceType,
+			AggregationRules: []AggregationRule{
+				{
+					MetricPattern:    "requests",
+					MatchType:        "strict",
+					OutputMetricName: "cluster_requests",
+					AggregationType:  "sum",
+				},
+				{
+					MetricPattern:    "queue_depth",
+					MatchType:        "strict",
+					OutputMetricName: "cluster_queue_depth",
+					AggregationType:  "sum",
+				},
+			},
+		}, zap.NewNop())
+	}
+
+	newMetrics := func() pmetric.Metrics {
+		md := pmetric.NewMetrics()
+		for _, value := range []float64{10, 15} {
+			metrics := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics()
+			counter := metrics.AppendEmpty()
+			counter.SetName("requests")
+			counter.SetEmptySum().SetAggregationTemporality(pmetric.AggregationTemporalityCumulative)
+			counter.Sum().SetIsMonotonic(true)
+			counter.Sum().DataPoints().AppendEmpty().SetDoubleValue(value)
+
+			gauge := metrics.AppendEmpty()
+			gauge.SetName("queue_depth")
+			gauge.SetEmptyGauge().DataPoints().AppendEmpty().SetDoubleValue(value)
+		}
+		return md
+	}
+
+	t.Run("Preserved", func(t *testing.T) {
+		result, err := newProcessor(true).processMetrics(context.Background(), newMetrics())
+		require.NoError(t, err)
+
+		// The counters are aggregated into a counter without an output_metric_type
+		outputs := findOutputMetrics(result, "cluster_requests")
+		require.Len(t, outputs, 1)
+		require.Equal(t, pmetric.MetricTypeSum, outputs[0].metric.Type())
+		assert.True(t, outputs[0].metric.Sum().IsMonotonic())
+		assert.Equal(t, 25.0, outputs[0].metric.Sum().DataPoints().At(0).DoubleValue())
+
+		outputs = findOutputMetrics(result, "cluster_queue_depth")
+		require.Len(t, outputs, 1)
+		assert.Equal(t, pmetric.MetricTypeGauge, outputs[0].metric.Type())
+	})
+
+	t.Run("Default", func(t *testing.T) {
+		result, err := newProcessor(false).processMetrics(context.Background(), newMetrics())
+		require.NoError(t, err)
+
+		outputs := findOutputMetrics(result, "cluster_requests")
+		require.Len(t, outputs, 1)
+		assert.Equal(t, pmetric.MetricTypeGauge, outputs[0].metric.Type())
+	})
+}
+
+func TestCumulativeMergeStrategy(t *testing.T) {
+	cfg := &Config{
+		GroupByLabels: []string{},
+		OutputResourceAttributes: map[string]string{
+			"aggregation.level": "cluster",
+		},
+		AggregationRules: []AggregationRule{
+			{
+				MetricPattern:           "requests",
+				MatchType:               "strict",
+				OutputMetricName:        "cluster_requests_aligned",
+				AggregationType:         "sum",
+				OutputMetricType:        "sum",
+				CumulativeMergeStrategy: "latest",
+			},
+			{
+				MetricPattern:    "requests",
+				MatchType:        "strict",
+				OutputMetricName: "cluster_requests_plain",
+				AggregationType:  "sum",
+				OutputMetricType: "sum",
+			},
+		},
+	}
+	for i, rule := range cfg.AggregationRules {
+		require.NoError(t, validateAggregationRule(rule, i))
+	}
+
+	processor := newMetricsAggregatorProcessor(cfg, zap.NewNop())
+
+	base := time.Unix(1700000000, 0)
+	at := func(seconds int) pcommon.Timestamp {
+		return pcommon.NewTimestampFromTime(base.Add(time.Duration(seconds) * time.Second))
+	}
+
+	// Two counters reporting at staggered times, pod-a twice in the batch
+	md := pmetric.NewMetrics()
+	for _, source := range []struct {
+		pod   string
+		start int
+		ts    int
+		value float64
+	}{
+		{"pod-a", 0, 10, 100},
+		{"pod-b", -30, 15, 40},
+		{"pod-a", 0, 20, 130},
+	} {
+		rm := md.ResourceMetrics().AppendEmpty()
+		rm.Resource().Attributes().PutStr("k8s.pod.name", source.pod)
+		metric := rm.ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+		metric.SetName("requests")
+		metric.SetEmptySum().SetAggregationTemporality(pmetric.AggregationTemporalityCumulative)
+		metric.Sum().SetIsMonotonic(true)
+		dp := metric.Sum().DataPoints().AppendEmpty()
+		dp.SetStartTimestamp(at(source.start))
+		dp.SetTimestamp(at(source.ts))
+		dp.SetDoubleValue(source.value)
+	}
+
+	result, err := processor.processMetrics(context.Background(), md)
+	require.NoError(t, err)
+
+	// The latest value of each counter, at the latest timestamp, since the earliest start
+	outputs := findOutputMetrics(result, "cluster_requests_aligned")
+	require.Len(t, outputs, 1)
+	dp := outputs[0].metric.Sum().DataPoints().At(0)
+	assert.Equal(t, 170.0, dp.DoubleValue())
+	assert.Equal(t, at(20), dp.Timestamp())
+	assert.Equal(t, at(-30), dp.StartTimestamp())
+
+	// A plain sum counts the earlier value of pod-a again
+	outputs = findOutputMetrics(result, "cluster_requests_plain")
+	require.Len(t, outputs, 1)
+	assert.Equal(t, 270.0, outputs[0].metric.Sum().DataPoints().At(0).DoubleValue())
+
+	err = validateAggregationRule(AggregationRule{MetricPattern: "requests", OutputMetricName: "x", AggregationType: "max", CumulativeMergeStrategy: "latest"}, 0)
+	assert.ErrorContains(t, err, "requires aggregation_type 'sum'")
+	err = validateAggregationRule(AggregationRule{MetricPattern: "requests", OutputMetricName: "x", AggregationType: "sum", CumulativeMergeStrategy: "earliest"}, 0)
+	assert.ErrorContains(t, err, "invalid cumulative_merge_strategy")
+}
+
+func TestValueTransform(t *testing.T) {
+	cfg := &Config{
+		GroupByLabels: []string{},
+		OutputResourceAttributes: map[string]string{
+			"aggregation.level": "cluster",
+		},
+		AggregationRules: []AggregationRule{
+			{
+				MetricPattern:    "memory_usage_bytes",
+				MatchType:        "strict",
+				OutputMetricName: "cluster_memory_usage_kilobytes",
+				AggregationType:  "sum",
+				ValueTransform:   "multiply:0.001",
+			},
+			{
+				MetricPattern:    "memory_usage_bytes",
+				MatchType:        "strict",
+				OutputMetricName: "cluster_memory_usage_bytes",
+				AggregationType:  "sum",
+			},
+		},
+	}
+	for i, rule := range cfg.AggregationRules {
+		require.NoError(t, validateAggregationRule(rule, i))
+	}
+
+	processor := newMetricsAggregatorProcessor(cfg, zap.NewNop())
+
+	md := pmetric.NewMetrics()
+	for _, value := range []int64{250000, 750000} {
+		metric := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+		metric.SetName("memory_usage_bytes")
+		metric.SetEmptyGauge().DataPoints().AppendEmpty().SetIntValue(value)
+	}
+
+	result, err := processor.processMetrics(context.Background(), md)
+	require.NoError(t, err)
+
+	outputs := findOutputMetrics(result, "cluster_memory_usage_kilobytes")
+	require.Len(t, outputs, 1)
+	assert.InDelta(t, 1000.0, outputs[0].metric.Gauge().DataPoints().At(0).DoubleValue(), 1e-9)
+
+	// Rules without a transform are unaffected, and sum the integers exactly
+	outputs = findOutputMetrics(result, "cluster_memory_usage_bytes")
+	require.Len(t, outputs, 1)
+	assert.Equal(t, int64(1000000), outputs[0].metric.Gauge().DataPoints().At(0).IntValue())
+
+	for expr, value := range map[string]float64{"abs": 3, "clamp_min:0": 0, "multiply:-2": 6} {
+		transform, err := parseValueTransform(expr)
+		require.NoError(t, err, expr)
+		assert.Equal(t, value, transform(-3), expr)
+	}
+
+	for _, expr := range []string{"sqrt", "multiply", "multiply:x", "abs:1", "clamp_min:NaN"} {
+		err := validateAggregationRule(AggregationRule{MetricPattern: "m", OutputMetricName: "x", AggregationType: "sum", ValueTransform: expr}, 0)
+		assert.ErrorContains(t, err, "invalid value_transform", expr)
+	}
+}
+
+func TestTrimmedMean(t *testing.T) {
+	cfg := &Config{
+		GroupByLabels: []string{},
+		OutputResourceAttributes: map[string]string{
+			"aggregation.level": "cluster",
+		},
+		AggregationRules: []AggregationRule{
+			{
+				MetricPattern:    "cpu_utilization",
+				MatchType:        "strict",
+				OutputMetricName: "cluster_cpu_utilization_trimmed",
+				AggregationType:  "trimmed_mean",
+				TrimFraction:     0.2,
+			},
+			{
+				MetricPattern:    "cpu_utilization",
+				MatchType:        "strict",
+				OutputMetricName: "cluster_cpu_utilization_mean",
+				AggregationType:  "mean",
+			},
+		},
+	}
+	for i, rule := range cfg.AggregationRules {
+		require.NoError(t, validateAggregationRule(rule, i))
+	}
+
+	processor := newMetricsAggregatorProcessor(cfg, zap.NewNop())
+
+	// A stuck node reports 100 while the others are around 50
+	md := pmetric.NewMetrics()
+	for _, value := range []float64{50, 100, 50, 45, 50} {
+		metric := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+		metric.SetName("cpu_utilization")
+		metric.SetEmptyGauge().DataPoints().AppendEmpty().SetDoubleValue(value)
+	}
+
+	result, err := processor.processMetrics(context.Background(), md)
+	require.NoError(t, err)
+
+	outputs := findOutputMetrics(result, "cluster_cpu_utilization_trimmed")
+	require.Len(t, outputs, 1)
+	assert.Equal(t, 50.0, outputs[0].metric.Gauge().DataPoints().At(0).DoubleValue())
+
+	outputs = findOutputMetrics(result, "cluster_cpu_utilization_mean")
+	require.Len(t, outputs, 1)
+	assert.Equal(t, 59.0, outputs[0].metric.Gauge().DataPoints().At(0).DoubleValue())
+
+	for _, fraction := range []float64{-0.1, 0.5, 0.8} {
+		err := validateAggregationRule(AggregationRule{MetricPattern: "m", OutputMetricName: "x", AggregationType: "trimmed_mean", TrimFraction: fraction}, 0)
+		assert.ErrorContains(t, err, "trim_fraction must be", fraction)
+	}
+	err = validateAggregationRule(AggregationRule{MetricPattern: "m", OutputMetricName: "x", AggregationType: "mean", TrimFraction: 0.1}, 0)
+	assert.ErrorContains(t, err, "trim_fraction requires aggregation_type 'trimmed_mean'")
+}
+
+func TestEmitSourceRanks(t *testing.T) {
+	cfg := &Config{
+		GroupByLabels: []string{"cluster"},
+		OutputResourceAttributes: map[string]string{
+			"aggregation.level": "cluster",
+		},
+		AggregationRules: []AggregationRule{
+			{
+				MetricPattern:    "cpu_utilization",
+				MatchType:        "strict",
+				OutputMetricName: "cluster_cpu_utilization",
+				AggregationType:  "mean",
+				EmitSourceRanks:  true,
+				MaxRankedSources: 3,
+			},
+		},
+	}
+	for i, rule := range cfg.AggregationRules {
+		require.NoError(t, validateAggregationRule(rule, i))
+	}
+
+	processor := newMetricsAggregatorProcessor(cfg, zap.NewNop())
+
+	// The small cluster has 3 nodes, the large one 5
+	md := pmetric.NewMetrics()
+	addNode := func(cluster string, node string, value float64) {
+		rm := md.ResourceMetrics().AppendEmpty()
+		rm.Resource().Attributes().PutStr("cluster", cluster)
+		rm.Resource().Attributes().PutStr("host.name", node)
+		metric := rm.ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+		metric.SetName("cpu_utilization")
+		metric.SetEmptyGauge().DataPoints().AppendEmpty().SetDoubleValue(value)
+	}
+	addNode("small", "small-1", 60)
+	addNode("small", "small-2", 20)
+	addNode("small", "small-3", 40)
+	for i, value := range []float64{10, 20, 30, 40, 50} {
+		addNode("large", fmt.Sprintf("large-%d", i+1), value)
+	}
+
+	result, err := processor.processMetrics(context.Background(), md)
+	require.NoError(t, err)
+
+	require.Len(t, findOutputMetrics(result, "cluster_cpu_utilization"), 2)
+
+	outputs := findOutputMetrics(result, "cluster_cpu_utilization_source_ranks")
+	require.Len(t, outputs, 1)
+	cluster, ok := outputs[0].resource.Attributes().Get("cluster")
+	require.True(t, ok)
+	assert.Equal(t, "small", cluster.Str())
+
+	type rankedNode struct {
+		node     string
+		value    float64
+		rank     int64
+		quantile float64
+	}
+	var ranked []rankedNode
+	dps := outputs[0].metric.Gauge().DataPoints()
+	for i := 0; i < dps.Len(); i++ {
+		dp := dps.At(i)
+		node, ok := dp.Attributes().Get("host.name")
+		require.True(t, ok)
+		rank, ok := dp.Attributes().Get(sourceRankAttribute)
+		require.True(t, ok)
+		quantile, ok := dp.Attributes().Get(sourceQuantileAttribute)
+		require.True(t, ok)
+		ranked = append(ranked, rankedNode{node: node.Str(), value: dp.DoubleValue(), rank: rank.Int(), quantile: quantile.Double()})
+	}
+	assert.Equal(t, []rankedNode{
+		{node: "small-2", value: 20, rank: 1, quantile: 0},
+		{node: "small-3", value: 40, rank: 2, quantile: 0.5},
+		{node: "small-1", value: 60, rank: 3, quantile: 1},
+	}, ranked)
+
+	err = validateAggregationRule(AggregationRule{MetricPattern: "m", OutputMetricName: "x", EmitSourceRanks: true, MaxRankedSources: 1000}, 0)
+	assert.ErrorContains(t, err, "max_ranked_sources must be between 0 and 100")
+	err = validateAggregationRule(AggregationRule{MetricPattern: "m", OutputMetricName: "x", MaxRankedSources: 5}, 0)
+	assert.ErrorContains(t, err, "max_ranked_sources requires emit_source_ranks")
+}
+
+func TestMetricPatterns(t *testing.T) {
+	cfg := &Config{
+		EmitOriginalMetrics: true,
+		GroupByLabels:       []string{},
+		OutputResourceAttributes: map[string]string{
+			"aggregation.level": "cluster",
+		},
+		AggregationRules: []AggregationRule{
+			{
+				MetricPatterns:   []string{"cpu_usage", "mem_usage"},
+				MatchType:        "strict",
+				OutputMetricName: "resource_usage",
+				AggregationType:  "sum",
+			},
+		},
+	}
+	for i, rule := range cfg.AggregationRules {
+		require.NoError(t, validateAggregationRule(rule, i))
+	}
+
+	processor := newMetricsAggregatorProcessor(cfg, zap.NewNop())
+
+	md := pmetric.NewMetrics()
+	for name, value := range map[string]float64{"cpu_usage": 20, "mem_usage": 30, "disk_usage": 50} {
+		metric := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+		metric.SetName(name)
+		metric.SetEmptyGauge().DataPoints().AppendEmpty().SetDoubleValue(value)
+	}
+
+	result, err := processor.processMetrics(context.Background(), md)
+	require.NoError(t, err)
+
+	outputs := findOutputMetrics(result, "resource_usage")
+	require.Len(t, outputs, 1)
+	assert.Equal(t, 50.0, outputs[0].metric.Gauge().DataPoints().At(0).DoubleValue())
+
+	// Only the unmatched metric is left
+	assert.Empty(t, findOutputMetrics(result, "cpu_usage"))
+	assert.Empty(t, findOutputMetrics(result, "mem_usage"))
+	assert.Len(t, findOutputMetrics(result, "disk_usage"), 1)
+
+	err = validateAggregationRule(AggregationRule{MetricPatterns: []string{"cpu_.*", "[invalid"}, MatchType: "regex", OutputMetricName: "x"}, 0)
+	assert.ErrorContains(t, err, "invalid regex pattern '[invalid'")
+	err = validateAggregationRule(AggregationRule{MetricPatterns: []string{"cpu_usage", ""}, OutputMetricName: "x"}, 0)
+	assert.ErrorContains(t, err, "metric_patterns[1] cannot be empty")
+}
+
+func TestEmitContributors(t *testing.T) {
+	cfg := &Config{
+		GroupByLabels: []string{},
+		OutputResourceAttributes: map[string]string{
+			"aggregation.level": "cluster",
+		},
+		AggregationRules: []AggregationRule{
+			{
+				MetricPattern:    "request_duration",
+				MatchType:        "strict",
+				OutputMetricName: "cluster_request_duration",
+				AggregationType:  "sum",
+				OutputMetricType: "histogram",
+				EmitContributors: true,
+			},
+		},
+	}
+	for i, rule := range cfg.AggregationRules {
+		require.NoError(t, validateAggregationRule(rule, i))
+	}
+
+	processor := newMetricsAggregatorProcessor(cfg, zap.NewNop())
+
+	// Each source histogram holds 100 observations
+	md := pmetric.NewMetrics()
+	for _, sum := range []float64{1000, 2000, 3000} {
+		metric := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+		metric.SetName("request_duration")
+		dp := metric.SetEmptyHistogram().DataPoints().AppendEmpty()
+		dp.SetCount(100)
+		dp.SetSum(sum)
+	}
+
+	result, err := processor.processMetrics(context.Background(), md)
+	require.NoError(t, err)
+
+	outputs := findOutputMetrics(result, "cluster_request_duration")
+	require.Len(t, outputs, 1)
+	dp := outputs[0].metric.Histogram().DataPoints().At(0)
+	assert.Equal(t, 6000.0, dp.Sum())
+	contributors, ok := dp.Attributes().Get(contributorsAttribute)
+	require.True(t, ok)
+	assert.Equal(t, int64(3), contributors.Int())
+
+	err = validateAggregationRule(AggregationRule{MetricPattern: "m", OutputMetricName: "x", EmitContributors: true}, 0)
+	assert.ErrorContains(t, err, "emit_contributors requires output_metric_type 'histogram'")
+}
+
+func TestEnrichOriginalsWithAggregate(t *testing.T) {
+	cfg := &Config{
+		EmitOriginalMetrics: true,
+		GroupByLabels:       []string{"cluster"},
+		OutputResourceAttributes: map[string]string{
+			"aggregation.level": "cluster",
+		},
+		AggregationRules: []AggregationRule{
+			{
+				MetricPattern:                "cpu_utilization",
+				MatchType:                    "strict",
+				OutputMetricName:             "cluster_cpu_utilization",
+				AggregationType:              "mean",
+				PreserveOriginalMetrics:      true,
+				EnrichOriginalsWithAggregate: true,
+			},
+		},
+	}
+	for i, rule := range cfg.AggregationRules {
+		require.NoError(t, validateAggregationRule(rule, i))
+	}
+
+	processor := newMetricsAggregatorProcessor(cfg, zap.NewNop())
+
+	md := pmetric.NewMetrics()
+	pods := map[string]struct {
+		cluster string
+		value   float64
+	}{
+		"east-1": {cluster: "east", value: 20},
+		"east-2": {cluster: "east", value: 40},
+		"west-1": {cluster: "west", value: 70},
+	}
+	for pod, source := range pods {
+		rm := md.ResourceMetrics().AppendEmpty()
+		rm.Resource().Attributes().PutStr("cluster", source.cluster)
+		rm.Resource().Attributes().PutStr("k8s.pod.name", pod)
+		metric := rm.ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+		metric.SetName("cpu_utilization")
+		metric.SetEmptyGauge().DataPoints().AppendEmpty().SetDoubleValue(source.value)
+	}
+
+	result, err := processor.processMetrics(context.Background(), md)
+	require.NoError(t, err)
+
+	require.Len(t, findOutputMetrics(result, "cluster_cpu_utilization"), 2)
+
+	expectedMeans := map[string]float64{"east-1": 30, "east-2": 30, "west-1": 70}
+	originals := findOutputMetrics(result, "cpu_utilization")
+	require.Len(t, originals, 3)
+	for _, original := range originals {
+		pod, ok := original.resource.Attributes().Get("k8s.pod.name")
+		require.True(t, ok)
+		dp := original.metric.Gauge().DataPoints().At(0)
+		assert.Equal(t, pods[pod.Str()].value, dp.DoubleValue())
+		mean, ok := dp.Attributes().Get("aggregation.mean")
+		require.True(t, ok, pod.Str())
+		assert.Equal(t, expectedMeans[pod.Str()], mean.Double(), pod.Str())
+	}
+
+	err = validateAggregationRule(AggregationRule{MetricPattern: "m", OutputMetricName: "x", EnrichOriginalsWithAggregate: true}, 0)
+	assert.ErrorContains(t, err, "enrich_originals_with_aggregate requires preserve_original_metrics")
+}
+
+func TestLabelPrecedence(t *testing.T) {
+	// newMetrics returns two sources of the same resource region with different data point regions
+	newMetrics := func() pmetric.Metrics {
+		md := pmetric.NewMetrics()
+		for _, region := range []string{"eu-west", "eu-north"} {
+			rm := md.ResourceMetrics().AppendEmpty()
+			rm.Resource().Attributes().PutStr("region", "us-east")
+			metric := rm.ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+			metric.SetName("throughput")
+			dp := metric.SetEmptyGauge().DataPoints().AppendEmpty()
+			dp.SetDoubleValue(10.0)
+			dp.Attributes().PutStr("region", region)
+		}
+		return md
+	}
+
+	// aggregate returns the region of every output, read from its data point or its resource
+	aggregate := func(t *testing.T, precedence string) (dataPointRegions []string, resourceRegions []string) {
+		cfg := &Config{
+			GroupByLabels: []string{"region"},
+			OutputResourceAttributes: map[string]string{
+				"aggregation.level": "cluster",
+			},
+			LabelPrecedence: precedence,
+			AggregationRules: []AggregationRule{
+				{
+					MetricPattern:    "throughput",
+					MatchType:        "strict",
+					OutputMetricName: "regional_throughput",
+					AggregationType:  "sum",
+				},
+			},
+		}
+		require.NoError(t, cfg.Validate())
+
+		processor := newMetricsAggregatorProcessor(cfg, zap.NewNop())
+		result, err := processor.processMetrics(context.Background(), newMetrics())
+		require.NoError(t, err)
+
+		for _, output := range findOutputMetrics(result, "regional_throughput") {
+			if region, ok := output.metric.Gauge().DataPoints().At(0).Attributes().Get("region"); ok {
+				dataPointRegions = append(dataPointRegions, region.Str())
+			}
+			if region, ok := output.resource.Attributes().Get("region"); ok {
+				resourceRegions = append(resourceRegions, region.Str())
+			}
+		}
+		return dataPointRegions, resourceRegions
+	}
+
+	t.Run("Datapoint", func(t *testing.T) {
+		dataPointRegions, resourceRegions := aggregate(t, "datapoint")
+		assert.ElementsMatch(t, []string{"eu-north", "eu-west"}, dataPointRegions)
+		assert.Empty(t, resourceRegions)
+	})
+
+	t.Run("Resource", func(t *testing.T) {
+		dataPointRegions, resourceRegions := aggregate(t, "resource")
+		assert.Empty(t, dataPointRegions)
+		assert.Equal(t, []string{"us-east"}, resourceRegions)
+	})
+
+	cfg := &Config{
+		GroupByLabels:            []string{"region"},
+		OutputResourceAttributes: map[string]string{"aggregation.level": "cluster"},
+		LabelPrecedence:          "metric",
+		AggregationRules:         []AggregationRule{{MetricPattern: "throughput", OutputMetricName: "x"}},
+	}
+	assert.ErrorContains(t, cfg.Validate(), "invalid label_precedence 'metric'")
+}
+
+func TestNoRecordedValue(t *testing.T) {
+	cfg := &Config{
+		GroupByLabels: []string{"cluster"},
+		OutputResourceAttributes: map[string]string{
+			"aggregation.level": "cluster",
+		},
+		AggregationRules: []AggregationRule{
+			{
+				MetricPattern:    "cpu_utilization",
+				MatchType:        "strict",
+				OutputMetricName: "cluster_cpu_utilization",
+				AggregationType:  "mean",
+			},
+		},
+	}
+	for i, rule := range cfg.AggregationRules {
+		require.NoError(t, validateAggregationRule(rule, i))
+	}
+
+	processor := newMetricsAggregatorProcessor(cfg, zap.NewNop())
+
+	// Every source of "stale" went away, one source of "mixed" did
+	md := pmetric.NewMetrics()
+	for _, source := range []struct {
+		cluster         string
+		value           float64
+		noRecordedValue bool
+	}{
+		{"stale", 0, true},
+		{"stale", 0, true},
+		{"mixed", 10, false},
+		{"mixed", 20, false},
+		{"mixed", 0, true},
+	} {
+		metric := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+		metric.SetName("cpu_utilization")
+		dp := metric.SetEmptyGauge().DataPoints().AppendEmpty()
+		dp.SetDoubleValue(source.value)
+		dp.Attributes().PutStr("cluster", source.cluster)
+		dp.SetFlags(pmetric.DefaultDataPointFlags.WithNoRecordedValue(source.noRecordedValue))
+	}
+
+	result, err := processor.processMetrics(context.Background(), md)
+	require.NoError(t, err)
+
+	outputs := findOutputMetrics(result, "cluster_cpu_utilization")
+	require.Len(t, outputs, 2)
+	dps := make(map[string]pmetric.NumberDataPoint)
+	for _, output := range outputs {
+		dp := output.metric.Gauge().DataPoints().At(0)
+		cluster, ok := dp.Attributes().Get("cluster")
+		require.True(t, ok)
+		dps[cluster.Str()] = dp
+	}
+
+	// The mixed group aggregates only the recorded values
+	require.Contains(t, dps, "mixed")
+	assert.Equal(t, 15.0, dps["mixed"].DoubleValue())
+	assert.False(t, dps["mixed"].Flags().NoRecordedValue())
+
+	// The stale group is flagged instead of reporting 0
+	require.Contains(t, dps, "stale")
+	assert.True(t, dps["stale"].Flags().NoRecordedValue())
+}
+
+func TestSampleRate(t *testing.T) {
+	cfg := &Config{
+		GroupByLabels: []string{},
+		OutputResourceAttributes: map[string]string{
+			"aggregation.level": "cluster",
+		},
+		AggregationRules: []AggregationRule{
+			{
+				MetricPattern:    "request_bytes",
+				MatchType:        "strict",
+				OutputMetricName: "cluster_request_bytes",
+				AggregationType:  "sum",
+				OutputMetricType: "histogram",
+				EmitContributors: true,
+				SampleRate:       0.5,
+			},
+		},
+	}
+	for i, rule := range cfg.AggregationRules {
+		require.NoError(t, validateAggregationRule(rule, i))
+	}
+
+	processor := newMetricsAggregatorProcessor(cfg, zap.NewNop())
+
+	newMetrics := func() pmetric.Metrics {
+		md := pmetric.NewMetrics()
+		for i := 1; i <= 1000; i++ {
+			metric := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+			metric.SetName("request_bytes")
+			dp := metric.SetEmptyGauge().DataPoints().AppendEmpty()
+			dp.SetDoubleValue(float64(i % 100))
+			dp.Attributes().PutStr("instance", fmt.Sprintf("instance-%d", i))
+		}
+		return md
+	}
+
+	aggregate := func() (float64, int64) {
+		result, err := processor.processMetrics(context.Background(), newMetrics())
+		require.NoError(t, err)
+		outputs := findOutputMetrics(result, "cluster_request_bytes")
+		require.Len(t, outputs, 1)
+		dp := outputs[0].metric.Histogram().DataPoints().At(0)
+		contributors, ok := dp.Attributes().Get(contributorsAttribute)
+		require.True(t, ok)
+		return dp.Sum(), contributors.Int()
+	}
+
+	// About half of the data points are aggregated, and the scaled sum approximates the full sum of 49500
+	sum, contributors := aggregate()
+	assert.InDelta(t, 500, contributors, 75)
+	assert.InEpsilon(t, 49500.0, sum, 0.15)
+
+	// The same series are sampled in every batch
+	nextSum, nextContributors := aggregate()
+	assert.Equal(t, contributors, nextContributors)
+	assert.Equal(t, sum, nextSum)
+
+	for _, rate := range []float64{-0.5, 1.5} {
+		err := validateAggregationRule(AggregationRule{MetricPattern: "m", OutputMetricName: "x", SampleRate: rate}, 0)
+		assert.ErrorContains(t, err, "sample_rate must be between 0 and 1")
+	}
+}
+
+func TestHashGroupKeys(t *testing.T) {
+	var groupByLabels []string
+	for i := 0; i < 12; i++ {
+		groupByLabels = append(groupByLabels, fmt.Sprintf("kubernetes.label.%d", i))
+	}
+
+	newMetrics := func() pmetric.Metrics {
+		md := pmetric.NewMetrics()
+		for _, source := range []struct {
+			team  string
+			value float64
+		}{{"payments", 10}, {"payments", 20}, {"checkout", 5}} {
+			rm := md.ResourceMetrics().AppendEmpty()
+			// The first label is a resource attribute, the others are data point attributes
+			rm.Resource().Attributes().PutStr(groupByLabels[0], "cluster-with-a-very-long-name-"+source.team)
+			metric := rm.ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+			metric.SetName("throughput")
+			dp := metric.SetEmptyGauge().DataPoints().AppendEmpty()
+			dp.SetDoubleValue(source.value)
+			for _, label := range groupByLabels[1:] {
+				dp.Attributes().PutStr(label, "a-long-value-of-"+label+"-for-"+source.team)
+			}
+		}
+		return md
+	}
+
+	// aggregate returns the outputs keyed by their resource and data point attributes
+	aggregate := func(hashGroupKeys bool) (*metricsAggregatorProcessor, map[string]float64) {
+		cfg := &Config{
+			GroupByLabels: groupByLabels,
+			OutputResourceAttributes: map[string]string{
+				"aggregation.level": "cluster",
+			},
+			HashGroupKeys: hashGroupKeys,
+			AggregationRules: []AggregationRule{
+				{
+					MetricPattern:    "throughput",
+					MatchType:        "strict",
+					OutputMetricName: "team_throughput",
+					AggregationType:  "sum",
+				},
+			},
+		}
+		processor := newMetricsAggregatorProcessor(cfg, zap.NewNop())
+		result, err := processor.processMetrics(context.Background(), newMetrics())
+		require.NoError(t, err)
+
+		outputs := make(map[string]float64)
+		for _, output := range findOutputMetrics(result, "team_throughput") {
+			dp := output.metric.Gauge().DataPoints().At(0)
+			key := fmt.Sprint(output.resource.Attributes().AsRaw(), dp.Attributes().AsRaw())
+			outputs[key] = dp.DoubleValue()
+		}
+		return processor, outputs
+	}
+
+	_, expected := aggregate(false)
+	require.Len(t, expected, 2)
+	processor, outputs := aggregate(true)
+	assert.Equal(t, expected, outputs)
+
+	// The hashed key is much shorter than the readable one
+	resourceAttrs := pcommon.NewMap()
+	resourceAttrs.PutStr(groupByLabels[0], "cluster-with-a-very-long-name-payments")
+	dpAttrs := pcommon.NewMap()
+	for _, label := range groupByLabels[1:] {
+		dpAttrs.PutStr(label, "a-long-value-of-"+label+"-for-payments")
+	}
+	readable := processor.buildReadableGroupKey(resourceAttrs, dpAttrs, groupByLabels)
+	hashed := processor.buildGroupKeyFromPresentAttributes(resourceAttrs, dpAttrs, groupByLabels)
+	assert.Greater(t, len(readable), 500)
+	assert.LessOrEqual(t, len(hashed), 16)
+}
+
+func TestSummaryOutput(t *testing.T) {
+	cfg := &Config{
+		GroupByLabels: []string{"service"},
+		OutputResourceAttributes: map[string]string{
+			"aggregation.level": "cluster",
+		},
+		AggregationRules: []AggregationRule{
+			{
+				MetricPattern:    "request_latency",
+				MatchType:        "strict",
+				OutputMetricName: "service_request_latency",
+				OutputMetricType: "summary",
+				Quantiles:        []float64{0.5, 0.99},
+			},
+		},
+	}
+	for i, rule := range cfg.AggregationRules {
+		require.NoError(t, validateAggregationRule(rule, i))
+	}
+
+	processor := newMetricsAggregatorProcessor(cfg, zap.NewNop())
+
+	// 101 instances with latencies from 1 to 101, in no particular order
+	md := pmetric.NewMetrics()
+	for i := 0; i < 101; i++ {
+		metric := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+		metric.SetName("request_latency")
+		dp := metric.SetEmptyGauge().DataPoints().AppendEmpty()
+		dp.SetDoubleValue(float64((i*37)%101 + 1))
+		dp.Attributes().PutStr("service", "checkout")
+		dp.Attributes().PutStr("instance", fmt.Sprintf("instance-%d", i))
+	}
+
+	result, err := processor.processMetrics(context.Background(), md)
+	require.NoError(t, err)
+
+	outputs := findOutputMetrics(result, "service_request_latency")
+	require.Len(t, outputs, 1)
+	require.Equal(t, pmetric.MetricTypeSummary, outputs[0].metric.Type())
+	dp := outputs[0].metric.Summary().DataPoints().At(0)
+	assert.Equal(t, uint64(101), dp.Count())
+	assert.Equal(t, 5151.0, dp.Sum())
+	service, ok := dp.Attributes().Get("service")
+	require.True(t, ok)
+	assert.Equal(t, "checkout", service.Str())
+
+	require.Equal(t, 2, dp.QuantileValues().Len())
+	assert.Equal(t, 0.5, dp.QuantileValues().At(0).Quantile())
+	assert.Equal(t, 51.0, dp.QuantileValues().At(0).Value())
+	assert.Equal(t, 0.99, dp.QuantileValues().At(1).Quantile())
+	assert.Equal(t, 100.0, dp.QuantileValues().At(1).Value())
+
+	// Quantiles are interpolated between the two closest values
+	assert.Equal(t, 2.5, quantile([]float64{1, 2, 3, 4}, 0.5))
+
+	for _, q := range []float64{0, 1, 1.5} {
+		err := validateAggregationRule(AggregationRule{MetricPattern: "m", OutputMetricName: "x", OutputMetricType: "summary", Quantiles: []float64{0.5, q}}, 0)
+		assert.ErrorContains(t, err, "quantiles must be between 0 and 1 exclusive")
+	}
+	err = validateAggregationRule(AggregationRule{MetricPattern: "m", OutputMetricName: "x", OutputMetricType: "summary"}, 0)
+	assert.ErrorContains(t, err, "output_metric_type 'summary' requires quantiles")
+	err = validateAggregationRule(AggregationRule{MetricPattern: "m", OutputMetricName: "x", Quantiles: []float64{0.5}}, 0)
+	assert.ErrorContains(t, err, "quantiles requires output_metric_type 'summary'")
+}
+
+func TestSummaryOutputCollisions(t *testing.T) {
+	newRule := func(pattern string) AggregationRule {
+		return AggregationRule{
+			MetricPattern:    pattern,
+			MatchType:        "strict",
+			OutputMetricName: "request_latency_summary",
+			OutputMetricType: "summary",
+			Quantiles:        []float64{0.5},
+		}
+	}
+	cfg := &Config{
+		GroupByLabels: []string{},
+		OutputResourceAttributes: map[string]string{
+			"aggregation.level": "cluster",
+		},
+		StrictCollisions: true,
+		// Mis-specified: both rules emit the same summary without any distinguishing label
+		AggregationRules: []AggregationRule{newRule("http_latency"), newRule("grpc_latency")},
+	}
+	for i, rule := range cfg.AggregationRules {
+		require.NoError(t, validateAggregationRule(rule, i))
+	}
+
+	processor := newMetricsAggregatorProcessor(cfg, zap.NewNop())
+
+	md := pmetric.NewMetrics()
+	for _, name := range []string{"http_latency", "grpc_latency"} {
+		metric := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+		metric.SetName(name)
+		metric.SetEmptyGauge().DataPoints().AppendEmpty().SetDoubleValue(10)
+	}
+
+	_, err := processor.processMetrics(context.Background(), md)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "request_latency_summary")
+	assert.Equal(t, int64(1), processor.outputCollisions.Load())
+}
+
+func TestSummaryOutputSampleRate(t *testing.T) {
+	cfg := &Config{
+		GroupByLabels: []string{},
+		OutputResourceAttributes: map[string]string{
+			"aggregation.level": "cluster",
+		},
+		AggregationRules: []AggregationRule{
+			{
+				MetricPattern:    "request_latency",
+				MatchType:        "strict",
+				OutputMetricName: "cluster_request_latency",
+				OutputMetricType: "summary",
+				Quantiles:        []float64{0.5},
+				SampleRate:       0.5,
+			},
+		},
+	}
+	for i, rule := range cfg.AggregationRules {
+		require.NoError(t, validateAggregationRule(rule, i))
+	}
+
+	processor := newMetricsAggregatorProcessor(cfg, zap.NewNop())
+
+	md := pmetric.NewMetrics()
+	for i := 0; i < 1000; i++ {
+		metric := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+		metric.SetName("request_latency")
+		dp := metric.SetEmptyGauge().DataPoints().AppendEmpty()
+		dp.SetDoubleValue(2)
+		dp.Attributes().PutStr("instance", fmt.Sprintf("instance-%d", i))
+	}
+
+	result, err := processor.processMetrics(context.Background(), md)
+	require.NoError(t, err)
+
+	// The count and sum estimate the 1000 series from about half of them, the quantiles are those of the sample
+	outputs := findOutputMetrics(result, "cluster_request_latency")
+	require.Len(t, outputs, 1)
+	dp := outputs[0].metric.Summary().DataPoints().At(0)
+	assert.InDelta(t, 1000, dp.Count(), 150)
+	assert.InDelta(t, 2.0*float64(dp.Count()), dp.Sum(), 2.0)
+	assert.Equal(t, 2.0, dp.QuantileValues().At(0).Value())
+}
+
+// outputMetric is a metric found in processed metrics along with its resource and scope
+type outputMetric struct {
+	resource pcommon.Resource
+	scope    pcommon.InstrumentationScope
+	metric   pmetric.Metric
+}
+
+// findOutputMetrics returns every metric with the given name in md
+func findOutputMetrics(md pmetric.Metrics, name string) []outputMetric {
+	var outputs []outputMetric
+	for i := 0; i < md.ResourceMetrics().Len(); i++ {
+		rm := md.ResourceMetrics().At(i)
+		for j := 0; j < rm.ScopeMetrics().Len(); j++ {
+			sm := rm.ScopeMetrics().At(j)
+			for k := 0; k < sm.Metrics().Len(); k++ {
+				if sm.Metrics().At(k).Name() == name {
+					outputs = append(outputs, outputMetric{
+						resource: rm.Resource(),
+						scope:    sm.Scope(),
+						metric:   sm.Metrics().At(k),
+					})
+				}
+			}
+		}
+	}
+	return outputs
+}
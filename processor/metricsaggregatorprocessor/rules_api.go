@@ -0,0 +1,282 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package metricsaggregatorprocessor
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ck-otel-collector/internal/sharedcomponent"
+	"go.opentelemetry.io/collector/component"
+	"go.uber.org/zap"
+)
+
+const (
+	// rulesAPIPath is the path of the endpoint replacing the aggregation rules at runtime
+	rulesAPIPath = "/aggregator/rules"
+
+	// groupLabelsAPIPath is the path of the debug endpoint reporting the group-by labels used by each rule
+	groupLabelsAPIPath = "/aggregator/debug/group-labels"
+
+	// maxRulesBodyBytes limits the size of a rules payload
+	maxRulesBodyBytes = 1 << 20
+)
+
+// rulesAPIs holds the rules API of each processor ID. The collector creates a processor instance for every
+// pipeline the ID is used in, and those instances share one rule set and one server on rules_api_endpoint.
+var rulesAPIs = sharedcomponent.NewMap[component.ID, *rulesAPI]()
+
+// rulesAPI holds the aggregation rules shared by the instances of a processor ID and serves the
+// endpoints replacing them at runtime
+type rulesAPI struct {
+	// configMu guards config, whose aggregation rules can be replaced at runtime via the rules API.
+	// A batch holds the read lock while it is processed, so it sees a single set of rules.
+	configMu sync.RWMutex
+	config   *Config
+	logger   *zap.Logger
+
+	// server serves the rules API, nil when it is disabled
+	server *http.Server
+
+	// groupLabelUsage holds, per rule name, the group-by labels that applied in the rule's last run
+	groupLabelUsageMu sync.Mutex
+	groupLabelUsage   map[string]GroupLabelUsage
+}
+
+// newRulesAPI creates the rule set of a processor ID from its configuration
+func newRulesAPI(config *Config, logger *zap.Logger) *rulesAPI {
+	// Rules extending a template run with the template's fields filled in
+	if len(config.RuleTemplates) > 0 {
+		if rules, err := resolveRuleTemplates(config.AggregationRules, config.RuleTemplates); err != nil {
+			logger.Error("Ignoring rule templates", zap.Error(err))
+		} else {
+			resolvedConfig := *config
+			resolvedConfig.AggregationRules = rules
+			config = &resolvedConfig
+		}
+	}
+
+	return &rulesAPI{
+		config:          config,
+		logger:          logger,
+		groupLabelUsage: make(map[string]GroupLabelUsage),
+	}
+}
+
+// Start starts the rules API server when an endpoint is configured
+func (a *rulesAPI) Start(_ context.Context, _ component.Host) error {
+	if a.config.RulesAPIEndpoint == "" {
+		return nil
+	}
+
+	ln, err := net.Listen("tcp", a.config.RulesAPIEndpoint)
+	if err != nil {
+		return fmt.Errorf("failed to start rules API on %s: %w", a.config.RulesAPIEndpoint, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(rulesAPIPath, a.rulesHandler)
+	mux.HandleFunc(groupLabelsAPIPath, a.groupLabelsHandler)
+	a.server = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		if err := a.server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			a.logger.Error("Rules API server failed", zap.Error(err))
+		}
+	}()
+
+	a.logger.Info("Rules API enabled",
+		zap.String("endpoint", a.config.RulesAPIEndpoint),
+		zap.Strings("paths", []string{rulesAPIPath, groupLabelsAPIPath}))
+	return nil
+}
+
+// Shutdown stops the rules API server, if it was started. Every batch is aggregated as a whole
+// in processMetrics, so there is no pending aggregate to flush.
+func (a *rulesAPI) Shutdown(ctx context.Context) error {
+	a.logger.Debug("Shutting down metrics aggregator processor")
+	if a.server != nil {
+		return a.server.Shutdown(ctx)
+	}
+	return nil
+}
+
+// rulesHandler returns the current aggregation rules on GET and replaces them on POST.
+// A POST body is a JSON array of rules using the same field names as the configuration,
+// and its rules can extend the configured rule templates.
+// The new rules apply to every batch processed after the request returns, in every pipeline using the processor ID.
+func (a *rulesAPI) rulesHandler(w http.ResponseWriter, r *http.Request) {
+	if !a.isRulesRequestAuthorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		a.configMu.RLock()
+		rules := a.config.AggregationRules
+		a.configMu.RUnlock()
+		writeRulesResponse(w, http.StatusOK, map[string]any{"aggregation_rules": rules})
+	case http.MethodPost:
+		var rules []AggregationRule
+		decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRulesBodyBytes))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&rules); err != nil {
+			writeRulesResponse(w, http.StatusBadRequest, map[string]any{"error": fmt.Sprintf("invalid rules payload: %v", err)})
+			return
+		}
+		a.configMu.RLock()
+		templates := a.config.RuleTemplates
+		a.configMu.RUnlock()
+		rules, err := resolveRuleTemplates(rules, templates)
+		if err != nil {
+			writeRulesResponse(w, http.StatusBadRequest, map[string]any{"error": err.Error()})
+			return
+		}
+		if err := validateAggregationRules(rules); err != nil {
+			writeRulesResponse(w, http.StatusBadRequest, map[string]any{"error": err.Error()})
+			return
+		}
+
+		a.replaceAggregationRules(rules)
+		a.logger.Info("Aggregation rules replaced via rules API", zap.Int("rules", len(rules)))
+		writeRulesResponse(w, http.StatusOK, map[string]any{"aggregation_rules": rules})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// groupLabelsHandler returns, for every current rule that ran, which of its group-by labels were present
+// on the data points it matched in its last run
+func (a *rulesAPI) groupLabelsHandler(w http.ResponseWriter, r *http.Request) {
+	if !a.isRulesRequestAuthorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	a.configMu.RLock()
+	rules := a.config.AggregationRules
+	a.configMu.RUnlock()
+	writeRulesResponse(w, http.StatusOK, map[string]any{"rules": a.getGroupLabelUsage(rules)})
+}
+
+// getGroupLabelUsage returns the group-by label usage of the current rules, across the instances of the processor ID, in rule order.
+// Rules that did not run yet are left out.
+func (a *rulesAPI) getGroupLabelUsage(rules []AggregationRule) []GroupLabelUsage {
+	a.groupLabelUsageMu.Lock()
+	defer a.groupLabelUsageMu.Unlock()
+
+	usages := []GroupLabelUsage{}
+	for _, rule := range rules {
+		if usage, ok := a.groupLabelUsage[getRuleName(rule)]; ok {
+			usages = append(usages, usage)
+		}
+	}
+	return usages
+}
+
+// isRulesRequestAuthorized checks the bearer token when one is configured
+func (a *rulesAPI) isRulesRequestAuthorized(r *http.Request) bool {
+	if a.config.RulesAPIToken == "" {
+		return true
+	}
+	expected := "Bearer " + string(a.config.RulesAPIToken)
+	return subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(expected)) == 1
+}
+
+// validateAggregationRules validates a complete set of rules
+func validateAggregationRules(rules []AggregationRule) error {
+	if len(rules) == 0 {
+		return errors.New("at least one aggregation rule must be specified")
+	}
+	for i, rule := range rules {
+		if err := validateAggregationRule(rule, i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replaceAggregationRules swaps the shared config for a copy with the given rules.
+// It waits for the batch being processed, which holds the config lock for its whole duration.
+func (a *rulesAPI) replaceAggregationRules(rules []AggregationRule) {
+	a.configMu.Lock()
+	defer a.configMu.Unlock()
+
+	config := *a.config
+	config.AggregationRules = rules
+	a.config = &config
+}
+
+// isLoopbackEndpoint reports whether a host:port address only accepts connections from the local host
+func isLoopbackEndpoint(endpoint string) bool {
+	host, _, err := net.SplitHostPort(endpoint)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// MarshalJSON encodes a rule like UnmarshalJSON decodes it, with max_age as a duration string
+func (r AggregationRule) MarshalJSON() ([]byte, error) {
+	type rule AggregationRule
+	aux := struct {
+		rule
+		MaxAge string `json:"max_age,omitempty"`
+	}{rule: rule(r)}
+	if r.MaxAge != 0 {
+		aux.MaxAge = r.MaxAge.String()
+	}
+	return json.Marshal(aux)
+}
+
+// UnmarshalJSON decodes a rule posted to the rules API. max_age is a duration string such as "10m", as in
+// the configuration, and unknown fields are rejected.
+func (r *AggregationRule) UnmarshalJSON(data []byte) error {
+	type rule AggregationRule
+	aux := struct {
+		*rule
+		MaxAge string `json:"max_age,omitempty"`
+	}{rule: (*rule)(r)}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&aux); err != nil {
+		return err
+	}
+
+	r.MaxAge = 0
+	if aux.MaxAge != "" {
+		maxAge, err := time.ParseDuration(aux.MaxAge)
+		if err != nil {
+			return fmt.Errorf("invalid max_age: %w", err)
+		}
+		r.MaxAge = maxAge
+	}
+	return nil
+}
+
+func writeRulesResponse(w http.ResponseWriter, status int, body map[string]any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
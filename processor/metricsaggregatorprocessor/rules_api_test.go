@@ -0,0 +1,326 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package metricsaggregatorprocessor
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/processor"
+	metricnoop "go.opentelemetry.io/otel/metric/noop"
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
+	"go.uber.org/zap"
+)
+
+func TestRulesAPI(t *testing.T) {
+	cfg := &Config{
+		GroupByLabels: []string{},
+		OutputResourceAttributes: map[string]string{
+			"aggregation.level": "cluster",
+		},
+		RulesAPIToken: "secret",
+		AggregationRules: []AggregationRule{
+			{
+				MetricPattern:    "throughput",
+				MatchType:        "strict",
+				OutputMetricName: "cluster_throughput",
+				AggregationType:  "sum",
+			},
+		},
+	}
+
+	processor := newMetricsAggregatorProcessor(cfg, zap.NewNop())
+
+	newMetrics := func() pmetric.Metrics {
+		md := pmetric.NewMetrics()
+		for _, value := range []float64{10.0, 30.0} {
+			metric := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+			metric.SetName("throughput")
+			metric.SetEmptyGauge().DataPoints().AppendEmpty().SetDoubleValue(value)
+		}
+		return md
+	}
+
+	postRules := func(body string, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, rulesAPIPath, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		processor.rules.rulesHandler(w, req)
+		return w
+	}
+
+	result, err := processor.processMetrics(context.Background(), newMetrics())
+	require.NoError(t, err)
+	require.Len(t, findOutputMetrics(result, "cluster_throughput"), 1)
+
+	t.Run("Unauthorized", func(t *testing.T) {
+		w := postRules(`[{"metric_pattern": "throughput", "output_metric_name": "x"}]`, "wrong")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("InvalidRules", func(t *testing.T) {
+		w := postRules(`[{"metric_pattern": "throughput", "output_metric_name": "x", "aggregation_type": "median"}]`, "secret")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "invalid aggregation_type")
+
+		w = postRules(`[]`, "secret")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = postRules(`[{"metric_patern": "throughput"}]`, "secret")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("ReplaceRules", func(t *testing.T) {
+		w := postRules(`[{"metric_pattern": "throughput", "match_type": "strict", "output_metric_name": "cluster_throughput_max", "aggregation_type": "max"}]`, "secret")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		// The same processor now aggregates with the new rules
+		result, err := processor.processMetrics(context.Background(), newMetrics())
+		require.NoError(t, err)
+		assert.Empty(t, findOutputMetrics(result, "cluster_throughput"))
+		outputs := findOutputMetrics(result, "cluster_throughput_max")
+		require.Len(t, outputs, 1)
+		assert.Equal(t, 30.0, outputs[0].metric.Gauge().DataPoints().At(0).DoubleValue())
+
+		req := httptest.NewRequest(http.MethodGet, rulesAPIPath, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		w = httptest.NewRecorder()
+		processor.rules.rulesHandler(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "cluster_throughput_max")
+	})
+}
+
+func TestGroupLabelsAPI(t *testing.T) {
+	cfg := &Config{
+		GroupByLabels: []string{"team", "region"},
+		OutputResourceAttributes: map[string]string{
+			"aggregation.level": "cluster",
+		},
+		AggregationRules: []AggregationRule{
+			{
+				RuleName:         "throughput-by-team",
+				MetricPattern:    "throughput",
+				MatchType:        "strict",
+				OutputMetricName: "team_throughput",
+				AggregationType:  "sum",
+			},
+		},
+	}
+
+	processor := newMetricsAggregatorProcessor(cfg, zap.NewNop())
+
+	getUsage := func() []GroupLabelUsage {
+		req := httptest.NewRequest(http.MethodGet, groupLabelsAPIPath, nil)
+		w := httptest.NewRecorder()
+		processor.rules.groupLabelsHandler(w, req)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var response struct {
+			Rules []GroupLabelUsage `json:"rules"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response.Rules
+	}
+
+	// Nothing is reported before the first run
+	assert.Empty(t, getUsage())
+
+	// team is a resource attribute on one source, region is on none
+	md := pmetric.NewMetrics()
+	for _, team := range []string{"payments", ""} {
+		rm := md.ResourceMetrics().AppendEmpty()
+		if team != "" {
+			rm.Resource().Attributes().PutStr("team", team)
+		}
+		metric := rm.ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+		metric.SetName("throughput")
+		metric.SetEmptyGauge().DataPoints().AppendEmpty().SetDoubleValue(10.0)
+	}
+	_, err := processor.processMetrics(context.Background(), md)
+	require.NoError(t, err)
+
+	usage := getUsage()
+	require.Len(t, usage, 1)
+	assert.Equal(t, "throughput-by-team", usage[0].Rule)
+	assert.Equal(t, []string{"team", "region"}, usage[0].GroupByLabels)
+	assert.Equal(t, []string{"team"}, usage[0].UsedLabels)
+	assert.Equal(t, []string{"region"}, usage[0].UnusedLabels)
+	assert.Equal(t, 2, usage[0].DataPoints)
+
+	req := httptest.NewRequest(http.MethodPost, groupLabelsAPIPath, nil)
+	w := httptest.NewRecorder()
+	processor.rules.groupLabelsHandler(w, req)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
+
+func TestRulesAPIMaxAge(t *testing.T) {
+	cfg := &Config{
+		GroupByLabels: []string{},
+		AggregationRules: []AggregationRule{
+			{
+				MetricPattern:    "throughput",
+				OutputMetricName: "cluster_throughput",
+			},
+		},
+	}
+	processor := newMetricsAggregatorProcessor(cfg, zap.NewNop())
+
+	postRules := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, rulesAPIPath, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		processor.rules.rulesHandler(w, req)
+		return w
+	}
+
+	// max_age is a duration string, as in the configuration
+	w := postRules(`[{"metric_pattern": "throughput", "output_metric_name": "cluster_throughput", "max_age": "10m"}]`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, 10*time.Minute, processor.rules.config.AggregationRules[0].MaxAge)
+	assert.Contains(t, w.Body.String(), `"max_age":"10m0s"`)
+
+	w = postRules(`[{"metric_pattern": "throughput", "output_metric_name": "cluster_throughput", "max_age": "10 minutes"}]`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid max_age")
+	assert.Equal(t, 10*time.Minute, processor.rules.config.AggregationRules[0].MaxAge)
+}
+
+func TestRulesAPIEndpointRequiresToken(t *testing.T) {
+	cfg := &Config{
+		GroupByLabels: []string{"service"},
+		OutputResourceAttributes: map[string]string{
+			"aggregation.level": "cluster",
+		},
+		AggregationRules: []AggregationRule{
+			{
+				MetricPattern:    "throughput",
+				OutputMetricName: "cluster_throughput",
+			},
+		},
+	}
+
+	for _, endpoint := range []string{"localhost:8890", "127.0.0.1:8890", "[::1]:8890"} {
+		cfg.RulesAPIEndpoint = endpoint
+		assert.NoError(t, cfg.Validate(), endpoint)
+	}
+
+	for _, endpoint := range []string{"0.0.0.0:8890", ":8890", "collector.example.com:8890"} {
+		cfg.RulesAPIEndpoint = endpoint
+		assert.ErrorContains(t, cfg.Validate(), "rules_api_token is required", endpoint)
+	}
+
+	cfg.RulesAPIToken = "secret"
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestStartShutdown(t *testing.T) {
+	// Shutting down a rules API that was never started is a no-op
+	api := newRulesAPI(&Config{}, zap.NewNop())
+	require.NoError(t, api.Shutdown(context.Background()))
+
+	ln, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	endpoint := ln.Addr().String()
+	require.NoError(t, ln.Close())
+
+	api = newRulesAPI(&Config{RulesAPIEndpoint: endpoint}, zap.NewNop())
+	require.NoError(t, api.Start(context.Background(), nil))
+
+	res, err := http.Get("http://" + endpoint + rulesAPIPath)
+	require.NoError(t, err)
+	require.NoError(t, res.Body.Close())
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	// The rules API stops with the processor and its address is free again
+	require.NoError(t, api.Shutdown(context.Background()))
+	_, err = http.Get("http://" + endpoint + rulesAPIPath)
+	require.Error(t, err)
+	ln, err = net.Listen("tcp", endpoint)
+	require.NoError(t, err)
+	require.NoError(t, ln.Close())
+}
+
+func TestRulesAPISharedAcrossPipelines(t *testing.T) {
+	ln, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	endpoint := ln.Addr().String()
+	require.NoError(t, ln.Close())
+
+	cfg := &Config{
+		GroupByLabels:    []string{},
+		RulesAPIEndpoint: endpoint,
+		AggregationRules: []AggregationRule{
+			{
+				MetricPattern:    "throughput",
+				MatchType:        "strict",
+				OutputMetricName: "cluster_throughput",
+				AggregationType:  "sum",
+			},
+		},
+	}
+	set := processor.Settings{
+		ID: component.MustNewID(typeStr),
+		TelemetrySettings: component.TelemetrySettings{
+			Logger:         zap.NewNop(),
+			MeterProvider:  metricnoop.NewMeterProvider(),
+			TracerProvider: tracenoop.NewTracerProvider(),
+		},
+	}
+
+	// The collector creates one instance of the processor ID per pipeline it is used in
+	var sinks [2][]pmetric.Metrics
+	var pipelines [2]processor.Metrics
+	for i := range pipelines {
+		next, err := consumer.NewMetrics(func(_ context.Context, md pmetric.Metrics) error {
+			sinks[i] = append(sinks[i], md)
+			return nil
+		})
+		require.NoError(t, err)
+		pipelines[i], err = NewFactory().CreateMetrics(context.Background(), set, cfg, next)
+		require.NoError(t, err)
+	}
+	for _, pipeline := range pipelines {
+		require.NoError(t, pipeline.Start(context.Background(), nil))
+	}
+
+	req, err := http.NewRequest(http.MethodPost, "http://"+endpoint+rulesAPIPath,
+		strings.NewReader(`[{"metric_pattern": "throughput", "match_type": "strict", "output_metric_name": "cluster_throughput_max", "aggregation_type": "max"}]`))
+	require.NoError(t, err)
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.NoError(t, res.Body.Close())
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	// A single request replaced the rules of both pipelines
+	for i, pipeline := range pipelines {
+		md := pmetric.NewMetrics()
+		for _, value := range []float64{10.0, 30.0} {
+			metric := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+			metric.SetName("throughput")
+			metric.SetEmptyGauge().DataPoints().AppendEmpty().SetDoubleValue(value)
+		}
+		require.NoError(t, pipeline.ConsumeMetrics(context.Background(), md))
+		require.Len(t, sinks[i], 1)
+		assert.Empty(t, findOutputMetrics(sinks[i][0], "cluster_throughput"), "pipeline %d", i)
+		assert.Len(t, findOutputMetrics(sinks[i][0], "cluster_throughput_max"), 1, "pipeline %d", i)
+	}
+
+	for _, pipeline := range pipelines {
+		require.NoError(t, pipeline.Shutdown(context.Background()))
+	}
+	ln, err = net.Listen("tcp", endpoint)
+	require.NoError(t, err)
+	require.NoError(t, ln.Close())
+}
@@ -9,6 +9,8 @@ import (
 	"fmt"
 	"net/url"
 	"path"
+	"slices"
+	"strings"
 
 	"go.opentelemetry.io/collector/component"
 	"go.opentelemetry.io/collector/config/configgrpc"
@@ -48,6 +50,37 @@ type HeaderExtractionConfig struct {
 	Enabled bool `mapstructure:"enabled"`
 	// HeadersToExtract defines which headers to extract and how to map them
 	HeadersToExtract []HeaderMapping `mapstructure:"headers_to_extract"`
+	// RequiredHeaders lists headers every metrics request must carry. Requests missing one of them
+	// are refused with InvalidArgument (HTTP 400), whether or not extraction is enabled.
+	RequiredHeaders []string `mapstructure:"required_headers"`
+	// NormalizeAttributeNames lowercases the configured attribute names, so that e.g. "X-Tenant"
+	// and "x-tenant" end up as the same attribute
+	NormalizeAttributeNames bool `mapstructure:"normalize_attribute_names"`
+	// Signals limits header extraction to the listed signals. Extraction is only implemented for
+	// "metrics" so far, so it is the only accepted value. Extraction applies to every signal when it is empty.
+	Signals []string `mapstructure:"signals"`
+}
+
+// headerExtractionSignals are the signals header extraction is implemented for, and so can be limited to.
+// Other signals are rejected rather than accepted without effect.
+var headerExtractionSignals = []string{"metrics"}
+
+// appliesTo reports whether headers should be extracted from requests of the given signal
+func (cfg HeaderExtractionConfig) appliesTo(signal string) bool {
+	return len(cfg.Signals) == 0 || slices.Contains(cfg.Signals, signal)
+}
+
+// SamplingConfig defines configuration for dropping a fraction of incoming metric data points
+type SamplingConfig struct {
+	// Enabled enables sampling
+	Enabled bool `mapstructure:"enabled"`
+	// Percentage is the share of data points to keep, between 0 and 100
+	Percentage float64 `mapstructure:"percentage"`
+	// KeyAttribute is the attribute whose value is hashed to decide whether a data point is kept.
+	// Data points without it are keyed by their metric name and attributes.
+	KeyAttribute string `mapstructure:"key_attribute"`
+	// MatchAttributes restricts sampling to data points with these attribute values; all others are kept
+	MatchAttributes map[string]string `mapstructure:"match_attributes"`
 }
 
 type HTTPConfig struct {
@@ -80,6 +113,17 @@ type Config struct {
 	Protocols `mapstructure:"protocols"`
 	// HeaderExtraction defines configuration for extracting headers and adding them as attributes
 	HeaderExtraction HeaderExtractionConfig `mapstructure:"header_extraction"`
+	// Sampling defines configuration for dropping a fraction of incoming metric data points
+	Sampling SamplingConfig `mapstructure:"sampling"`
+	// PeerAttributeName, if set, is the resource attribute set to the IP address of the client
+	// that sent each metrics request
+	PeerAttributeName string `mapstructure:"peer_attribute_name"`
+	// TrustForwardedFor takes the client address from the first X-Forwarded-For entry, when the
+	// request has one, instead of the connection peer. Only enable it behind a proxy setting the header.
+	TrustForwardedFor bool `mapstructure:"trust_forwarded_for"`
+	// DropEmptyResourceMetrics removes the resource metrics without any data point from metrics requests
+	// before they are passed to the next consumer
+	DropEmptyResourceMetrics bool `mapstructure:"drop_empty_resource_metrics"`
 }
 
 var _ component.Config = (*Config)(nil)
@@ -106,5 +150,34 @@ func (cfg *Config) Validate() error {
 		}
 	}
 
+	for i, header := range cfg.HeaderExtraction.RequiredHeaders {
+		if strings.TrimSpace(header) == "" {
+			return fmt.Errorf("header_extraction.required_headers[%d] cannot be empty", i)
+		}
+	}
+
+	for i, signal := range cfg.HeaderExtraction.Signals {
+		if !slices.Contains(headerExtractionSignals, signal) {
+			return fmt.Errorf("header_extraction.signals[%d]: unsupported signal '%s', header extraction is only implemented for: %s", i, signal, strings.Join(headerExtractionSignals, ", "))
+		}
+	}
+
+	// Validate sampling configuration
+	if cfg.Sampling.Enabled {
+		if cfg.Sampling.Percentage < 0 || cfg.Sampling.Percentage > 100 {
+			return fmt.Errorf("sampling.percentage must be between 0 and 100, got %v", cfg.Sampling.Percentage)
+		}
+
+		for name, value := range cfg.Sampling.MatchAttributes {
+			if name == "" || value == "" {
+				return errors.New("sampling.match_attributes cannot contain empty names or values")
+			}
+		}
+	}
+
+	if cfg.TrustForwardedFor && cfg.PeerAttributeName == "" {
+		return errors.New("trust_forwarded_for requires peer_attribute_name")
+	}
+
 	return nil
 }
@@ -256,3 +256,31 @@ func TestUnmarshalConfigEmpty(t *testing.T) {
 	require.NoError(t, confmap.New().Unmarshal(&cfg))
 	assert.EqualError(t, xconfmap.Validate(cfg), "must specify at least one protocol when using the OTLP receiver")
 }
+
+func TestHeaderExtractionSignals(t *testing.T) {
+	factory := NewFactory()
+	cfg := factory.CreateDefaultConfig().(*Config)
+	GetOrInsertDefault(t, &cfg.GRPC)
+	cfg.HeaderExtraction = HeaderExtractionConfig{
+		Enabled: true,
+		HeadersToExtract: []HeaderMapping{
+			{HeaderName: "x-tenant-id", AttributeName: "tenant_id"},
+		},
+	}
+
+	// Extraction applies to every signal by default
+	assert.True(t, cfg.HeaderExtraction.appliesTo("metrics"))
+	assert.True(t, cfg.HeaderExtraction.appliesTo("logs"))
+
+	cfg.HeaderExtraction.Signals = []string{"metrics"}
+	require.NoError(t, xconfmap.Validate(cfg))
+	assert.True(t, cfg.HeaderExtraction.appliesTo("metrics"))
+	assert.False(t, cfg.HeaderExtraction.appliesTo("logs"))
+
+	// Signals extraction is not implemented for are rejected rather than ignored
+	cfg.HeaderExtraction.Signals = []string{"metrics", "logs"}
+	assert.EqualError(t, xconfmap.Validate(cfg), "header_extraction.signals[1]: unsupported signal 'logs', header extraction is only implemented for: metrics")
+
+	cfg.HeaderExtraction.Signals = []string{"spans"}
+	assert.EqualError(t, xconfmap.Validate(cfg), "header_extraction.signals[0]: unsupported signal 'spans', header extraction is only implemented for: metrics")
+}
@@ -5,13 +5,18 @@ package metrics // import "github.com/ck-otel-collector/receiver/otlpreceiver/in
 
 import (
 	"context"
+	"net"
+	"strings"
 
 	"go.opentelemetry.io/collector/consumer"
 	"go.opentelemetry.io/collector/pdata/pmetric"
 	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
 	"github.com/ck-otel-collector/receiver/otlpreceiver/internal/errors"
 	"go.opentelemetry.io/collector/receiver/receiverhelper"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
 )
 
 const dataFormatProtobuf = "protobuf"
@@ -24,8 +29,9 @@ type HeaderMapping struct {
 
 // HeaderExtractionConfig defines configuration for header extraction
 type HeaderExtractionConfig struct {
-	Enabled          bool
-	HeadersToExtract []HeaderMapping
+	Enabled                 bool
+	HeadersToExtract        []HeaderMapping
+	NormalizeAttributeNames bool
 }
 
 // Receiver is the type used to handle metrics from OpenTelemetry exporters.
@@ -34,6 +40,13 @@ type Receiver struct {
 	nextConsumer consumer.Metrics
 	obsreport    *receiverhelper.ObsReport
 	headerConfig HeaderExtractionConfig
+
+	samplingConfig    SamplingConfig
+	requiredHeaders   []string
+	peerAttributeName string
+	trustForwardedFor bool
+
+	dropEmptyResourceMetrics bool
 }
 
 // New creates a new Receiver reference.
@@ -53,6 +66,49 @@ func NewWithHeaderExtraction(nextConsumer consumer.Metrics, obsreport *receiverh
 	}
 }
 
+// WithSampling enables sampling of incoming data points on the Receiver.
+func (r *Receiver) WithSampling(samplingConfig SamplingConfig) *Receiver {
+	r.samplingConfig = samplingConfig
+	return r
+}
+
+// WithRequiredHeaders makes the Receiver refuse requests that do not carry all of the given headers.
+func (r *Receiver) WithRequiredHeaders(requiredHeaders []string) *Receiver {
+	r.requiredHeaders = requiredHeaders
+	return r
+}
+
+// WithPeerAttribute makes the Receiver set the IP address of the client as the given resource attribute.
+// With trustForwardedFor, the first X-Forwarded-For entry is used instead of the connection peer when present.
+func (r *Receiver) WithPeerAttribute(attributeName string, trustForwardedFor bool) *Receiver {
+	r.peerAttributeName = attributeName
+	r.trustForwardedFor = trustForwardedFor
+	return r
+}
+
+// WithDropEmptyResourceMetrics makes the Receiver remove the resource metrics without any data point
+// before passing a request to the next consumer.
+func (r *Receiver) WithDropEmptyResourceMetrics(drop bool) *Receiver {
+	r.dropEmptyResourceMetrics = drop
+	return r
+}
+
+// checkRequiredHeaders returns an InvalidArgument status error when a required header is missing
+// from the incoming request metadata
+func (r *Receiver) checkRequiredHeaders(ctx context.Context) error {
+	if len(r.requiredHeaders) == 0 {
+		return nil
+	}
+
+	grpcMD, _ := metadata.FromIncomingContext(ctx)
+	for _, header := range r.requiredHeaders {
+		if len(grpcMD.Get(header)) == 0 {
+			return status.Errorf(codes.InvalidArgument, "missing required header %q", header)
+		}
+	}
+	return nil
+}
+
 // extractHeadersToAttributes extracts headers from gRPC context and adds them as resource attributes
 func (r *Receiver) extractHeadersToAttributes(ctx context.Context, md pmetric.Metrics) {
 	if !r.headerConfig.Enabled {
@@ -72,14 +128,98 @@ func (r *Receiver) extractHeadersToAttributes(ctx context.Context, md pmetric.Me
 		// Add headers as resource attributes
 		for _, mapping := range r.headerConfig.HeadersToExtract {
 			if values := grpcMD.Get(mapping.HeaderName); len(values) > 0 {
-				rm.Resource().Attributes().PutStr(mapping.AttributeName, values[0])
+				rm.Resource().Attributes().PutStr(r.attributeName(mapping), values[0])
+			}
+		}
+	}
+}
+
+// addPeerAttribute sets the client address as a resource attribute, replacing any value sent by the client
+func (r *Receiver) addPeerAttribute(ctx context.Context, md pmetric.Metrics) {
+	if r.peerAttributeName == "" {
+		return
+	}
+
+	addr := r.peerAddress(ctx)
+	if addr == "" {
+		return
+	}
+	for i := 0; i < md.ResourceMetrics().Len(); i++ {
+		md.ResourceMetrics().At(i).Resource().Attributes().PutStr(r.peerAttributeName, addr)
+	}
+}
+
+// peerAddress returns the IP address of the client, or an empty string when it is unknown
+func (r *Receiver) peerAddress(ctx context.Context) string {
+	if r.trustForwardedFor {
+		// The leftmost entry is the client, the others are the proxies it went through
+		grpcMD, _ := metadata.FromIncomingContext(ctx)
+		if values := grpcMD.Get("x-forwarded-for"); len(values) > 0 {
+			if client, _, _ := strings.Cut(values[0], ","); strings.TrimSpace(client) != "" {
+				return strings.TrimSpace(client)
 			}
 		}
 	}
+
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	// Unix sockets and in-memory listeners have no port
+	addr := p.Addr.String()
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// removeEmptyResourceMetrics removes the resource metrics that have no data point in any of their metrics
+func removeEmptyResourceMetrics(md pmetric.Metrics) {
+	md.ResourceMetrics().RemoveIf(func(rm pmetric.ResourceMetrics) bool {
+		for i := 0; i < rm.ScopeMetrics().Len(); i++ {
+			metrics := rm.ScopeMetrics().At(i).Metrics()
+			for j := 0; j < metrics.Len(); j++ {
+				if metricDataPointCount(metrics.At(j)) > 0 {
+					return false
+				}
+			}
+		}
+		return true
+	})
+}
+
+// metricDataPointCount returns the number of data points of a metric
+func metricDataPointCount(metric pmetric.Metric) int {
+	switch metric.Type() {
+	case pmetric.MetricTypeGauge:
+		return metric.Gauge().DataPoints().Len()
+	case pmetric.MetricTypeSum:
+		return metric.Sum().DataPoints().Len()
+	case pmetric.MetricTypeHistogram:
+		return metric.Histogram().DataPoints().Len()
+	case pmetric.MetricTypeExponentialHistogram:
+		return metric.ExponentialHistogram().DataPoints().Len()
+	case pmetric.MetricTypeSummary:
+		return metric.Summary().DataPoints().Len()
+	}
+	return 0
+}
+
+// attributeName returns the name of the attribute a header is stored under
+func (r *Receiver) attributeName(mapping HeaderMapping) string {
+	if r.headerConfig.NormalizeAttributeNames {
+		return strings.ToLower(strings.TrimSpace(mapping.AttributeName))
+	}
+	return mapping.AttributeName
 }
 
 // Export implements the service Export metrics func.
 func (r *Receiver) Export(ctx context.Context, req pmetricotlp.ExportRequest) (pmetricotlp.ExportResponse, error) {
+	// Refuse requests that cannot be attributed, e.g. to a tenant
+	if err := r.checkRequiredHeaders(ctx); err != nil {
+		return pmetricotlp.NewExportResponse(), err
+	}
+
 	md := req.Metrics()
 	dataPointCount := md.DataPointCount()
 	if dataPointCount == 0 {
@@ -88,6 +228,20 @@ func (r *Receiver) Export(ctx context.Context, req pmetricotlp.ExportRequest) (p
 
 	// Extract headers and add as attributes if enabled
 	r.extractHeadersToAttributes(ctx, md)
+	r.addPeerAttribute(ctx, md)
+
+	// Drop the data points that are not selected by sampling
+	if r.samplingConfig.Enabled {
+		r.sampleMetrics(md)
+		if dataPointCount = md.DataPointCount(); dataPointCount == 0 {
+			return pmetricotlp.NewExportResponse(), nil
+		}
+	}
+
+	// Resources without data points, e.g. sent by SDKs with nothing to report, are not worth processing downstream
+	if r.dropEmptyResourceMetrics {
+		removeEmptyResourceMetrics(md)
+	}
 
 	ctx = r.obsreport.StartMetricsOp(ctx)
 	err := r.nextConsumer.ConsumeMetrics(ctx, md)
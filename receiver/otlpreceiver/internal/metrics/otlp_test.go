@@ -7,6 +7,7 @@ import (
 	"context"
 	"errors"
 	"net"
+	"strconv"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -14,12 +15,15 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	grpcmetadata "google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
 
 	"go.opentelemetry.io/collector/component"
 	"go.opentelemetry.io/collector/consumer"
 	"go.opentelemetry.io/collector/consumer/consumererror"
 	"go.opentelemetry.io/collector/consumer/consumertest"
+	"go.opentelemetry.io/collector/pdata/pmetric"
 	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
 	"go.opentelemetry.io/collector/pdata/testdata"
 	"github.com/ck-otel-collector/receiver/otlpreceiver/internal/metadata"
@@ -73,6 +77,209 @@ func TestExport_PermanentErrorConsumer(t *testing.T) {
 	assert.Equal(t, pmetricotlp.ExportResponse{}, resp)
 }
 
+func TestExport_Sampling(t *testing.T) {
+	generateMetrics := func() pmetric.Metrics {
+		md := pmetric.NewMetrics()
+		rm := md.ResourceMetrics().AppendEmpty()
+		rm.Resource().Attributes().PutStr("service.name", "checkout")
+		dps := rm.ScopeMetrics().AppendEmpty().Metrics().AppendEmpty().SetEmptyGauge().DataPoints()
+		for i := 0; i < 1000; i++ {
+			dp := dps.AppendEmpty()
+			dp.Attributes().PutStr("user.id", strconv.Itoa(i))
+			dp.SetIntValue(int64(i))
+		}
+		// A data point on a different service is never sampled
+		other := md.ResourceMetrics().AppendEmpty()
+		other.Resource().Attributes().PutStr("service.name", "payment")
+		other.ScopeMetrics().AppendEmpty().Metrics().AppendEmpty().SetEmptyGauge().DataPoints().AppendEmpty().SetIntValue(1)
+		return md
+	}
+
+	keptKeys := func(md pmetric.Metrics) []string {
+		var keys []string
+		for i := 0; i < md.ResourceMetrics().Len(); i++ {
+			rm := md.ResourceMetrics().At(i)
+			if service, _ := rm.Resource().Attributes().Get("service.name"); service.Str() != "checkout" {
+				continue
+			}
+			for j := 0; j < rm.ScopeMetrics().Len(); j++ {
+				metrics := rm.ScopeMetrics().At(j).Metrics()
+				for k := 0; k < metrics.Len(); k++ {
+					dps := metrics.At(k).Gauge().DataPoints()
+					for l := 0; l < dps.Len(); l++ {
+						key, _ := dps.At(l).Attributes().Get("user.id")
+						keys = append(keys, key.Str())
+					}
+				}
+			}
+		}
+		return keys
+	}
+
+	sink := new(consumertest.MetricsSink)
+	r := New(sink, newTestObsReport(t)).WithSampling(SamplingConfig{
+		Enabled:         true,
+		Percentage:      30,
+		KeyAttribute:    "user.id",
+		MatchAttributes: map[string]string{"service.name": "checkout"},
+	})
+
+	for i := 0; i < 2; i++ {
+		_, err := r.Export(context.Background(), pmetricotlp.NewExportRequestFromMetrics(generateMetrics()))
+		require.NoError(t, err)
+	}
+
+	batches := sink.AllMetrics()
+	require.Len(t, batches, 2)
+
+	first := keptKeys(batches[0])
+	assert.InDelta(t, 300, len(first), 50, "roughly the configured fraction of data points should be kept")
+	assert.Equal(t, first, keptKeys(batches[1]), "the sampling decision should be deterministic per key")
+
+	// Non-matching data points are always kept
+	assert.Equal(t, len(first)+1, batches[0].DataPointCount())
+}
+
+func TestExport_RequiredHeaders(t *testing.T) {
+	sink := new(consumertest.MetricsSink)
+	r := New(sink, newTestObsReport(t)).WithRequiredHeaders([]string{"X-Tenant-ID"})
+	req := pmetricotlp.NewExportRequestFromMetrics(testdata.GenerateMetrics(1))
+
+	// A request without the header is refused and nothing is consumed
+	_, err := r.Export(grpcmetadata.NewIncomingContext(context.Background(), grpcmetadata.Pairs("x-other", "value")), req)
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Contains(t, err.Error(), "X-Tenant-ID")
+	assert.Empty(t, sink.AllMetrics())
+
+	_, err = r.Export(context.Background(), req)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = r.Export(grpcmetadata.NewIncomingContext(context.Background(), grpcmetadata.Pairs("x-tenant-id", "acme")), req)
+	require.NoError(t, err)
+	assert.Len(t, sink.AllMetrics(), 1)
+}
+
+func TestExport_NormalizeAttributeNames(t *testing.T) {
+	sink := new(consumertest.MetricsSink)
+	r := NewWithHeaderExtraction(sink, newTestObsReport(t), HeaderExtractionConfig{
+		Enabled: true,
+		HeadersToExtract: []HeaderMapping{
+			{HeaderName: "x-tenant", AttributeName: "X-Tenant"},
+			{HeaderName: "x-region", AttributeName: "region"},
+		},
+		NormalizeAttributeNames: true,
+	})
+	req := pmetricotlp.NewExportRequestFromMetrics(testdata.GenerateMetrics(1))
+
+	ctx := grpcmetadata.NewIncomingContext(context.Background(), grpcmetadata.Pairs("X-Tenant", "acme", "x-region", "eu"))
+	_, err := r.Export(ctx, req)
+	require.NoError(t, err)
+	require.Len(t, sink.AllMetrics(), 1)
+
+	attrs := sink.AllMetrics()[0].ResourceMetrics().At(0).Resource().Attributes()
+	tenant, ok := attrs.Get("x-tenant")
+	require.True(t, ok)
+	assert.Equal(t, "acme", tenant.Str())
+	_, ok = attrs.Get("X-Tenant")
+	assert.False(t, ok)
+	region, ok := attrs.Get("region")
+	require.True(t, ok)
+	assert.Equal(t, "eu", region.Str())
+}
+
+func TestExport_PeerAttribute(t *testing.T) {
+	// peerAttribute exports a request with the given context and returns the peer attribute of the forwarded resource
+	peerAttribute := func(t *testing.T, r *Receiver, ctx context.Context) (string, bool) {
+		sink := new(consumertest.MetricsSink)
+		r.nextConsumer = sink
+		_, err := r.Export(ctx, pmetricotlp.NewExportRequestFromMetrics(testdata.GenerateMetrics(1)))
+		require.NoError(t, err)
+		require.Len(t, sink.AllMetrics(), 1)
+
+		value, ok := sink.AllMetrics()[0].ResourceMetrics().At(0).Resource().Attributes().Get("net.peer.ip")
+		if !ok {
+			return "", false
+		}
+		return value.Str(), true
+	}
+
+	peerCtx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("10.1.2.3"), Port: 51234}})
+	forwardedCtx := grpcmetadata.NewIncomingContext(peerCtx, grpcmetadata.Pairs("X-Forwarded-For", "203.0.113.7, 10.0.0.1"))
+
+	t.Run("Peer", func(t *testing.T) {
+		r := New(nil, newTestObsReport(t)).WithPeerAttribute("net.peer.ip", false)
+		value, ok := peerAttribute(t, r, peerCtx)
+		require.True(t, ok)
+		assert.Equal(t, "10.1.2.3", value)
+
+		// X-Forwarded-For is ignored unless trusted
+		value, ok = peerAttribute(t, r, forwardedCtx)
+		require.True(t, ok)
+		assert.Equal(t, "10.1.2.3", value)
+	})
+
+	t.Run("TrustForwardedFor", func(t *testing.T) {
+		r := New(nil, newTestObsReport(t)).WithPeerAttribute("net.peer.ip", true)
+		value, ok := peerAttribute(t, r, forwardedCtx)
+		require.True(t, ok)
+		assert.Equal(t, "203.0.113.7", value)
+
+		// Requests that did not go through a proxy fall back to the peer
+		value, ok = peerAttribute(t, r, peerCtx)
+		require.True(t, ok)
+		assert.Equal(t, "10.1.2.3", value)
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		_, ok := peerAttribute(t, New(nil, newTestObsReport(t)), peerCtx)
+		assert.False(t, ok)
+	})
+}
+
+func TestExport_DropEmptyResourceMetrics(t *testing.T) {
+	// newRequest returns a request with two resources with data points and two without
+	newRequest := func() pmetricotlp.ExportRequest {
+		md := pmetric.NewMetrics()
+		for _, service := range []string{"checkout", "no-metrics", "payment", "no-data-points"} {
+			rm := md.ResourceMetrics().AppendEmpty()
+			rm.Resource().Attributes().PutStr("service.name", service)
+			switch service {
+			case "no-metrics":
+				rm.ScopeMetrics().AppendEmpty()
+			case "no-data-points":
+				rm.ScopeMetrics().AppendEmpty().Metrics().AppendEmpty().SetEmptyGauge()
+			default:
+				metric := rm.ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+				metric.SetName("requests")
+				metric.SetEmptySum().DataPoints().AppendEmpty().SetIntValue(1)
+			}
+		}
+		return pmetricotlp.NewExportRequestFromMetrics(md)
+	}
+
+	// services exports a request and returns the service names of the forwarded resources
+	services := func(t *testing.T, drop bool) []string {
+		sink := new(consumertest.MetricsSink)
+		r := New(sink, newTestObsReport(t)).WithDropEmptyResourceMetrics(drop)
+		_, err := r.Export(context.Background(), newRequest())
+		require.NoError(t, err)
+		require.Len(t, sink.AllMetrics(), 1)
+
+		var names []string
+		rms := sink.AllMetrics()[0].ResourceMetrics()
+		for i := 0; i < rms.Len(); i++ {
+			name, ok := rms.At(i).Resource().Attributes().Get("service.name")
+			require.True(t, ok)
+			names = append(names, name.Str())
+		}
+		return names
+	}
+
+	assert.Equal(t, []string{"checkout", "payment"}, services(t, true))
+	assert.Equal(t, []string{"checkout", "no-metrics", "payment", "no-data-points"}, services(t, false))
+}
+
 func makeMetricsServiceClient(t *testing.T, mc consumer.Metrics) pmetricotlp.GRPCClient {
 	addr := otlpReceiverOnGRPCServer(t, mc)
 
@@ -93,15 +300,7 @@ func otlpReceiverOnGRPCServer(t *testing.T, mc consumer.Metrics) net.Addr {
 		require.NoError(t, ln.Close())
 	})
 
-	set := receivertest.NewNopSettings(metadata.Type)
-	set.ID = component.MustNewIDWithName("otlp", "metrics")
-	obsreport, err := receiverhelper.NewObsReport(receiverhelper.ObsReportSettings{
-		ReceiverID:             set.ID,
-		Transport:              "grpc",
-		ReceiverCreateSettings: set,
-	})
-	require.NoError(t, err)
-	r := New(mc, obsreport)
+	r := New(mc, newTestObsReport(t))
 	// Now run it as a gRPC server
 	srv := grpc.NewServer()
 	pmetricotlp.RegisterGRPCServer(srv, r)
@@ -111,3 +310,15 @@ func otlpReceiverOnGRPCServer(t *testing.T, mc consumer.Metrics) net.Addr {
 
 	return ln.Addr()
 }
+
+func newTestObsReport(t *testing.T) *receiverhelper.ObsReport {
+	set := receivertest.NewNopSettings(metadata.Type)
+	set.ID = component.MustNewIDWithName("otlp", "metrics")
+	obsreport, err := receiverhelper.NewObsReport(receiverhelper.ObsReportSettings{
+		ReceiverID:             set.ID,
+		Transport:              "grpc",
+		ReceiverCreateSettings: set,
+	})
+	require.NoError(t, err)
+	return obsreport
+}
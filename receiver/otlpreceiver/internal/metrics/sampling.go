@@ -0,0 +1,123 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics // import "github.com/ck-otel-collector/receiver/otlpreceiver/internal/metrics"
+
+import (
+	"hash/fnv"
+	"sort"
+	"strings"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+)
+
+// samplingBuckets is the number of hash buckets used to turn the sampling percentage into a decision
+const samplingBuckets = 10000
+
+// SamplingConfig defines configuration for dropping a fraction of incoming data points
+type SamplingConfig struct {
+	Enabled         bool
+	Percentage      float64
+	KeyAttribute    string
+	MatchAttributes map[string]string
+}
+
+// sampleMetrics drops the data points that are not selected by the sampling configuration.
+// Metrics left without data points are removed as well.
+func (r *Receiver) sampleMetrics(md pmetric.Metrics) {
+	if !r.samplingConfig.Enabled {
+		return
+	}
+
+	for i := 0; i < md.ResourceMetrics().Len(); i++ {
+		rm := md.ResourceMetrics().At(i)
+		resourceAttrs := rm.Resource().Attributes()
+		for j := 0; j < rm.ScopeMetrics().Len(); j++ {
+			rm.ScopeMetrics().At(j).Metrics().RemoveIf(func(metric pmetric.Metric) bool {
+				return r.sampleMetric(metric, resourceAttrs)
+			})
+		}
+	}
+}
+
+// sampleMetric removes the dropped data points of a metric and reports whether the metric is now empty
+func (r *Receiver) sampleMetric(metric pmetric.Metric, resourceAttrs pcommon.Map) bool {
+	drop := func(attrs pcommon.Map) bool {
+		return !r.keepDataPoint(metric.Name(), resourceAttrs, attrs)
+	}
+
+	switch metric.Type() {
+	case pmetric.MetricTypeGauge:
+		dps := metric.Gauge().DataPoints()
+		dps.RemoveIf(func(dp pmetric.NumberDataPoint) bool { return drop(dp.Attributes()) })
+		return dps.Len() == 0
+	case pmetric.MetricTypeSum:
+		dps := metric.Sum().DataPoints()
+		dps.RemoveIf(func(dp pmetric.NumberDataPoint) bool { return drop(dp.Attributes()) })
+		return dps.Len() == 0
+	case pmetric.MetricTypeHistogram:
+		dps := metric.Histogram().DataPoints()
+		dps.RemoveIf(func(dp pmetric.HistogramDataPoint) bool { return drop(dp.Attributes()) })
+		return dps.Len() == 0
+	case pmetric.MetricTypeExponentialHistogram:
+		dps := metric.ExponentialHistogram().DataPoints()
+		dps.RemoveIf(func(dp pmetric.ExponentialHistogramDataPoint) bool { return drop(dp.Attributes()) })
+		return dps.Len() == 0
+	case pmetric.MetricTypeSummary:
+		dps := metric.Summary().DataPoints()
+		dps.RemoveIf(func(dp pmetric.SummaryDataPoint) bool { return drop(dp.Attributes()) })
+		return dps.Len() == 0
+	}
+	return false
+}
+
+// keepDataPoint decides whether a data point survives sampling.
+// Data points that do not match the configured attributes are always kept.
+func (r *Receiver) keepDataPoint(metricName string, resourceAttrs, dpAttrs pcommon.Map) bool {
+	for name, value := range r.samplingConfig.MatchAttributes {
+		if attributeValue(name, resourceAttrs, dpAttrs) != value {
+			return true
+		}
+	}
+
+	key := r.samplingKey(metricName, resourceAttrs, dpAttrs)
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	return float64(h.Sum64()%samplingBuckets) < r.samplingConfig.Percentage*samplingBuckets/100
+}
+
+// samplingKey returns the value hashed for the sampling decision.
+// It is the key attribute when present, otherwise the identity of the series.
+func (r *Receiver) samplingKey(metricName string, resourceAttrs, dpAttrs pcommon.Map) string {
+	if r.samplingConfig.KeyAttribute != "" {
+		if value, ok := dpAttrs.Get(r.samplingConfig.KeyAttribute); ok {
+			return value.AsString()
+		}
+		if value, ok := resourceAttrs.Get(r.samplingConfig.KeyAttribute); ok {
+			return value.AsString()
+		}
+	}
+
+	pairs := make([]string, 0, resourceAttrs.Len()+dpAttrs.Len())
+	for k, v := range resourceAttrs.All() {
+		pairs = append(pairs, k+"="+v.AsString())
+	}
+	for k, v := range dpAttrs.All() {
+		pairs = append(pairs, k+"="+v.AsString())
+	}
+	sort.Strings(pairs)
+
+	return metricName + "," + strings.Join(pairs, ",")
+}
+
+// attributeValue looks up an attribute on the data point first, then on the resource
+func attributeValue(name string, resourceAttrs, dpAttrs pcommon.Map) string {
+	if value, ok := dpAttrs.Get(name); ok {
+		return value.AsString()
+	}
+	if value, ok := resourceAttrs.Get(name); ok {
+		return value.AsString()
+	}
+	return ""
+}
@@ -90,7 +90,8 @@ func newOtlpReceiver(cfg *Config, set *receiver.Settings) (*otlpReceiver, error)
 // convertHeaderConfig converts the config HeaderExtractionConfig to the internal HeaderExtractionConfig
 func (r *otlpReceiver) convertHeaderConfig() metrics.HeaderExtractionConfig {
 	headerConfig := metrics.HeaderExtractionConfig{
-		Enabled: r.cfg.HeaderExtraction.Enabled,
+		Enabled:                 r.cfg.HeaderExtraction.Enabled,
+		NormalizeAttributeNames: r.cfg.HeaderExtraction.NormalizeAttributeNames,
 	}
 
 	for _, mapping := range r.cfg.HeaderExtraction.HeadersToExtract {
@@ -103,6 +104,16 @@ func (r *otlpReceiver) convertHeaderConfig() metrics.HeaderExtractionConfig {
 	return headerConfig
 }
 
+// convertSamplingConfig converts the config SamplingConfig to the internal SamplingConfig
+func (r *otlpReceiver) convertSamplingConfig() metrics.SamplingConfig {
+	return metrics.SamplingConfig{
+		Enabled:         r.cfg.Sampling.Enabled,
+		Percentage:      r.cfg.Sampling.Percentage,
+		KeyAttribute:    r.cfg.Sampling.KeyAttribute,
+		MatchAttributes: r.cfg.Sampling.MatchAttributes,
+	}
+}
+
 func (r *otlpReceiver) startGRPCServer(host component.Host) error {
 	// If GRPC is not enabled, nothing to start.
 	if !r.cfg.GRPC.HasValue() {
@@ -121,11 +132,11 @@ func (r *otlpReceiver) startGRPCServer(host component.Host) error {
 
 	if r.nextMetrics != nil {
 		// Use header extraction if enabled
-		if r.cfg.HeaderExtraction.Enabled {
+		if r.cfg.HeaderExtraction.Enabled && r.cfg.HeaderExtraction.appliesTo("metrics") {
 			headerConfig := r.convertHeaderConfig()
-			pmetricotlp.RegisterGRPCServer(r.serverGRPC, metrics.NewWithHeaderExtraction(r.nextMetrics, r.obsrepGRPC, headerConfig))
+			pmetricotlp.RegisterGRPCServer(r.serverGRPC, metrics.NewWithHeaderExtraction(r.nextMetrics, r.obsrepGRPC, headerConfig).WithSampling(r.convertSamplingConfig()).WithRequiredHeaders(r.cfg.HeaderExtraction.RequiredHeaders).WithPeerAttribute(r.cfg.PeerAttributeName, r.cfg.TrustForwardedFor).WithDropEmptyResourceMetrics(r.cfg.DropEmptyResourceMetrics))
 		} else {
-			pmetricotlp.RegisterGRPCServer(r.serverGRPC, metrics.New(r.nextMetrics, r.obsrepGRPC))
+			pmetricotlp.RegisterGRPCServer(r.serverGRPC, metrics.New(r.nextMetrics, r.obsrepGRPC).WithSampling(r.convertSamplingConfig()).WithRequiredHeaders(r.cfg.HeaderExtraction.RequiredHeaders).WithPeerAttribute(r.cfg.PeerAttributeName, r.cfg.TrustForwardedFor).WithDropEmptyResourceMetrics(r.cfg.DropEmptyResourceMetrics))
 		}
 	}
 
@@ -170,7 +181,7 @@ func (r *otlpReceiver) startHTTPServer(ctx context.Context, host component.Host)
 	}
 
 	if r.nextMetrics != nil {
-		httpMetricsReceiver := metrics.New(r.nextMetrics, r.obsrepHTTP)
+		httpMetricsReceiver := metrics.New(r.nextMetrics, r.obsrepHTTP).WithSampling(r.convertSamplingConfig()).WithRequiredHeaders(r.cfg.HeaderExtraction.RequiredHeaders).WithPeerAttribute(r.cfg.PeerAttributeName, r.cfg.TrustForwardedFor).WithDropEmptyResourceMetrics(r.cfg.DropEmptyResourceMetrics)
 		httpMux.HandleFunc(string(httpCfg.MetricsURLPath), func(resp http.ResponseWriter, req *http.Request) {
 			handleMetrics(resp, req, httpMetricsReceiver)
 		})
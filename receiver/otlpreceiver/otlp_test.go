@@ -28,6 +28,7 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	grpcmetadata "google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
 
@@ -45,6 +46,7 @@ import (
 	"go.opentelemetry.io/collector/internal/testutil"
 	"go.opentelemetry.io/collector/pdata/plog"
 	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
 	"go.opentelemetry.io/collector/pdata/pprofile"
 	"go.opentelemetry.io/collector/pdata/ptrace"
 	"go.opentelemetry.io/collector/pdata/ptrace/ptraceotlp"
@@ -751,6 +753,54 @@ func TestGRPCMaxRecvSize(t *testing.T) {
 	assert.Equal(t, td, sink.AllTraces()[0])
 }
 
+func TestGRPCHeaderExtractionSignals(t *testing.T) {
+	// exportWithTenant sends metrics with a tenant header to a receiver extracting it for the given signals
+	// and returns the tenant_id resource attribute of the forwarded metrics, if any
+	exportWithTenant := func(t *testing.T, signals []string) (string, bool) {
+		addr := testutil.GetAvailableLocalAddress(t)
+		sink := newErrOrSinkConsumer()
+
+		cfg := createDefaultConfig().(*Config)
+		GetOrInsertDefault(t, &cfg.GRPC).NetAddr.Endpoint = addr
+		cfg.HeaderExtraction = HeaderExtractionConfig{
+			Enabled: true,
+			Signals: signals,
+			HeadersToExtract: []HeaderMapping{
+				{HeaderName: "x-tenant-id", AttributeName: "tenant_id"},
+			},
+		}
+		recv := newReceiver(t, componenttest.NewNopTelemetrySettings(), cfg, otlpReceiverID, sink)
+		require.NoError(t, recv.Start(context.Background(), componenttest.NewNopHost()))
+		t.Cleanup(func() { require.NoError(t, recv.Shutdown(context.Background())) })
+
+		cc, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		require.NoError(t, err)
+		defer func() {
+			assert.NoError(t, cc.Close())
+		}()
+
+		ctx := grpcmetadata.AppendToOutgoingContext(context.Background(), "x-tenant-id", "acme")
+		_, err = pmetricotlp.NewGRPCClient(cc).Export(ctx, pmetricotlp.NewExportRequestFromMetrics(testdata.GenerateMetrics(1)))
+		require.NoError(t, err)
+		require.Len(t, sink.AllMetrics(), 1)
+
+		tenant, ok := sink.AllMetrics()[0].ResourceMetrics().At(0).Resource().Attributes().Get("tenant_id")
+		if !ok {
+			return "", false
+		}
+		return tenant.Str(), true
+	}
+
+	tenant, ok := exportWithTenant(t, []string{"metrics"})
+	require.True(t, ok)
+	assert.Equal(t, "acme", tenant)
+
+	// Extraction applies to every signal when none is listed
+	tenant, ok = exportWithTenant(t, nil)
+	require.True(t, ok)
+	assert.Equal(t, "acme", tenant)
+}
+
 func TestHTTPInvalidTLSCredentials(t *testing.T) {
 	cfg := &Config{
 		Protocols: Protocols{
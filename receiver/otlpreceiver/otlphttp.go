@@ -4,6 +4,7 @@
 package otlpreceiver // import "go.opentelemetry.io/collector/receiver/otlpreceiver"
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"mime"
@@ -11,6 +12,8 @@ import (
 	"strconv"
 	"time"
 
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
 
 	"github.com/ck-otel-collector/internal/statusutil"
@@ -74,7 +77,7 @@ func handleMetrics(resp http.ResponseWriter, req *http.Request, metricsReceiver
 		return
 	}
 
-	otlpResp, err := metricsReceiver.Export(req.Context(), otlpReq)
+	otlpResp, err := metricsReceiver.Export(withHeaderMetadata(req), otlpReq)
 	if err != nil {
 		writeError(resp, enc, err, http.StatusInternalServerError)
 		return
@@ -88,6 +91,27 @@ func handleMetrics(resp http.ResponseWriter, req *http.Request, metricsReceiver
 	writeResponse(resp, enc.contentType(), http.StatusOK, msg)
 }
 
+// withHeaderMetadata exposes the HTTP request headers as incoming gRPC metadata, and the remote
+// address as the gRPC peer, so that the metrics receiver handles both protocols the same way
+func withHeaderMetadata(req *http.Request) context.Context {
+	md := metadata.MD{}
+	for name, values := range req.Header {
+		md.Append(name, values...)
+	}
+	ctx := metadata.NewIncomingContext(req.Context(), md)
+	if req.RemoteAddr != "" {
+		ctx = peer.NewContext(ctx, &peer.Peer{Addr: remoteAddr(req.RemoteAddr)})
+	}
+	return ctx
+}
+
+// remoteAddr is the address of an HTTP client, as found in http.Request.RemoteAddr
+type remoteAddr string
+
+func (a remoteAddr) Network() string { return "tcp" }
+
+func (a remoteAddr) String() string { return string(a) }
+
 func handleLogs(resp http.ResponseWriter, req *http.Request, logsReceiver *logs.Receiver) {
 	enc, ok := readContentType(resp, req)
 	if !ok {